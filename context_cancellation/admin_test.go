@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/testharness"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+)
+
+// waitForTask polls an admin endpoint until requestID is in flight
+func waitForTask(t *testing.T, adminURL, requestID string) admin.Task {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if resp, err := http.Get(adminURL + "/admin/tasks"); err == nil {
+			var list struct{ Tasks []admin.Task }
+			json.NewDecoder(resp.Body).Decode(&list)
+			resp.Body.Close()
+			for _, task := range list.Tasks {
+				if task.RequestID == requestID {
+					return task
+				}
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s never showed up on %s/admin/tasks", requestID, adminURL)
+	return admin.Task{}
+}
+
+func cancelTask(t *testing.T, adminURL, requestID string) {
+	t.Helper()
+	resp, err := http.Post(fmt.Sprintf("%s/admin/tasks/%s/cancel", adminURL, requestID), "", nil)
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the cancel to return 200, got %d", resp.StatusCode)
+	}
+}
+
+// TestHealthAndAdminEndpoints checks the probes of both binaries, the
+// worker's gRPC health and reflection services, and that an operator can
+// cancel a stuck request on either side with both transactions rolled back
+func TestHealthAndAdminEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	echoDbPath, workerDbPath := filepath.Join(dir, "echo.db"), filepath.Join(dir, "worker.db")
+	grpcPort, httpPort, gatewayPort := testharness.FreePort(t), testharness.FreePort(t), testharness.FreePort(t)
+	workerAdmin := fmt.Sprintf("localhost:%d", testharness.FreePort(t))
+	echoAdmin := fmt.Sprintf("localhost:%d", testharness.FreePort(t))
+
+	startWorkerProcess(t, grpcPort, workerDbPath, "-admin-addr="+workerAdmin, fmt.Sprintf("-http-port=%d", gatewayPort))
+	startEchoProcess(t, httpPort, grpcPort, echoDbPath, "-admin-addr="+echoAdmin)
+	echoURL := fmt.Sprintf("http://localhost:%d", httpPort)
+
+	t.Log("🔍 Checking the worker's gRPC health and reflection services...")
+	conn, err := grpc.NewClient(fmt.Sprintf("localhost:%d", grpcPort), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer conn.Close()
+	for _, service := range []string{"", workerpb.WorkerService_ServiceDesc.ServiceName} {
+		resp, err := healthpb.NewHealthClient(conn).Check(t.Context(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("❌ Expected %q to be SERVING, got %v, %v", service, resp, err)
+		}
+	}
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(t.Context())
+	if err != nil {
+		t.Fatalf("Reflection failed: %v", err)
+	}
+	stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+	reply, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Reflection failed: %v", err)
+	}
+	listed := false
+	for _, s := range reply.GetListServicesResponse().GetService() {
+		listed = listed || s.Name == workerpb.WorkerService_ServiceDesc.ServiceName
+	}
+	if !listed {
+		t.Errorf("❌ Reflection does not list the worker service: %v", reply)
+	}
+	stream.CloseSend()
+
+	t.Log("🔍 Checking the HTTP probes...")
+	for _, url := range []string{
+		echoURL + "/healthz", echoURL + "/readyz",
+		"http://" + echoAdmin + "/readyz", "http://" + workerAdmin + "/readyz",
+	} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("❌ Expected %s to return 200, got %d", url, resp.StatusCode)
+		}
+	}
+
+	t.Log("🔍 Checking that metrics are on the admin listeners only...")
+	for url, want := range map[string]int{
+		"http://" + echoAdmin + "/debug/vars":                      http.StatusOK,
+		"http://" + workerAdmin + "/debug/vars":                    http.StatusOK,
+		echoURL + "/debug/vars":                                    http.StatusNotFound,
+		fmt.Sprintf("http://localhost:%d/debug/vars", gatewayPort): http.StatusNotFound,
+	} {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("❌ Expected %s to return %d, got %d", url, want, resp.StatusCode)
+		}
+	}
+
+	client := &http.Client{Transport: &http.Transport{}}
+
+	t.Log("🛑 Cancelling a request on echo's admin endpoint...")
+	results := sendEchoWith(t.Context(), client, echoURL, "stuck-echo")
+	waitForTask(t, "http://"+echoAdmin, "stuck-echo")
+	cancelTask(t, "http://"+echoAdmin, "stuck-echo")
+	if res := waitForResult(t, results); res.status != http.StatusServiceUnavailable || res.errorCode() != "cancelled_by_operator" {
+		t.Errorf("❌ Expected 503 cancelled_by_operator, got %d %s (%v)", res.status, res.body, res.err)
+	}
+
+	t.Log("🛑 Cancelling a task on the worker's admin endpoint...")
+	results = sendEchoWith(t.Context(), client, echoURL, "stuck-worker")
+	waitForTask(t, "http://"+workerAdmin, "stuck-worker")
+	cancelTask(t, "http://"+workerAdmin, "stuck-worker")
+	if res := waitForResult(t, results); res.err != nil || res.status == http.StatusOK {
+		t.Errorf("❌ Expected the request to fail, got %d %s (%v)", res.status, res.body, res.err)
+	}
+
+	// The worker rolls back asynchronously once its context is cancelled
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	for countWorkerRecords(t, workerDbPath) != 0 && ctx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := countEchoRecords(t, echoDbPath); n != 0 {
+		t.Errorf("❌ Expected no echo records, found %d", n)
+	}
+	if n := countWorkerRecords(t, workerDbPath); n != 0 {
+		t.Errorf("❌ Expected no worker records, found %d", n)
+	}
+}
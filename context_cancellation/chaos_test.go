@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/echo"
+	"context_cancellation/internal/testharness"
+	"context_cancellation/internal/worker"
+)
+
+var (
+	chaosEnabled     = flag.Bool("chaos", false, "Run TestChaos, which takes -chaos.duration and is skipped otherwise")
+	chaosSeed        = flag.Uint64("chaos.seed", 0, "Seed for TestChaos's fault schedule (0 picks one from the clock)")
+	chaosDuration    = flag.Duration("chaos.duration", 10*time.Second, "How long TestChaos injects faults")
+	chaosConcurrency = flag.Int("chaos.concurrency", 4, "Concurrent /echo clients during TestChaos")
+	chaosReportPath  = flag.String("chaos.report", "", "File to write the TestChaos report to")
+)
+
+// chaosFault is one entry of the fault schedule
+type chaosFault struct {
+	at     time.Duration
+	target string // "echo" or "worker"
+	signal syscall.Signal
+	// pause is how long a SIGSTOPped process stays frozen
+	pause time.Duration
+}
+
+func (f chaosFault) String() string {
+	s := fmt.Sprintf("%8v %-6s %v", f.at.Round(time.Millisecond), f.target, f.signal)
+	if f.signal == syscall.SIGSTOP {
+		s += fmt.Sprintf(" for %v", f.pause.Round(time.Millisecond))
+	}
+	return s
+}
+
+// chaosSchedule derives the whole fault schedule from seed up front, so the
+// same seed injects the same faults at the same offsets. Request timing
+// still varies between runs.
+func chaosSchedule(seed uint64, duration time.Duration) []chaosFault {
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	signals := []syscall.Signal{syscall.SIGKILL, syscall.SIGTERM, syscall.SIGSTOP}
+
+	var faults []chaosFault
+	at := time.Duration(0)
+	for {
+		at += time.Second + time.Duration(rng.Int64N(int64(2*time.Second)))
+		if at >= duration {
+			return faults
+		}
+		f := chaosFault{
+			at:     at,
+			target: []string{"echo", "worker"}[rng.IntN(2)],
+			signal: signals[rng.IntN(len(signals))],
+		}
+		if f.signal == syscall.SIGSTOP {
+			f.pause = 200*time.Millisecond + time.Duration(rng.Int64N(int64(1800*time.Millisecond)))
+		}
+		faults = append(faults, f)
+	}
+}
+
+// chaosCluster runs echo and the worker as OS processes on fixed ports and
+// databases, so that a killed process can be restarted in its place
+type chaosCluster struct {
+	t            *testing.T
+	httpPort     int
+	grpcPort     int
+	echoDbPath   string
+	workerDbPath string
+
+	mu     sync.Mutex
+	echo   *testharness.ProcessWithLogs
+	worker *testharness.ProcessWithLogs
+}
+
+func (c *chaosCluster) start(target string) {
+	var p *testharness.ProcessWithLogs
+	if target == "worker" {
+		// Fast keepalive so a frozen echo does not hold worker transactions open
+		p = startWorkerProcess(c.t, c.grpcPort, c.workerDbPath, "-keepalive-time=1s", "-keepalive-timeout=500ms")
+	} else {
+		// A frozen worker must not hold echo transactions open either
+		p = startEchoProcess(c.t, c.httpPort, c.grpcPort, c.echoDbPath, "-worker-timeout=5s")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if target == "worker" {
+		c.worker = p
+	} else {
+		c.echo = p
+	}
+}
+
+func (c *chaosCluster) process(target string) *testharness.ProcessWithLogs {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if target == "worker" {
+		return c.worker
+	}
+	return c.echo
+}
+
+// inject applies one fault and brings the process back afterwards
+func (c *chaosCluster) inject(f chaosFault) {
+	p := c.process(f.target)
+	switch f.signal {
+	case syscall.SIGSTOP:
+		p.Signal(syscall.SIGSTOP)
+		time.Sleep(f.pause)
+		p.Signal(syscall.SIGCONT)
+	case syscall.SIGTERM:
+		// Graceful shutdown waits for in-flight work, which takes about 3s
+		if err := p.Stop(10 * time.Second); err != nil {
+			c.t.Logf("chaos: %s %v", f.target, err)
+		}
+		c.start(f.target)
+	default:
+		p.Kill()
+		c.start(f.target)
+	}
+}
+
+// chaosLoad sends /echo requests with unique request ids until stopped and
+// counts the outcomes
+type chaosLoad struct {
+	url    string
+	prefix string
+
+	next     atomic.Int64
+	mu       sync.Mutex
+	outcomes map[string]int
+}
+
+func (l *chaosLoad) run(ctx context.Context) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	for ctx.Err() == nil {
+		requestID := fmt.Sprintf("%s-%d", l.prefix, l.next.Add(1))
+		res := <-sendEchoWith(ctx, client, l.url, requestID)
+
+		outcome := ""
+		switch {
+		case ctx.Err() != nil:
+			outcome = "interrupted by the end of the run"
+		case res.err != nil:
+			outcome = "transport error"
+		case res.status == http.StatusOK:
+			outcome = "200 ok"
+		default:
+			outcome = fmt.Sprintf("%d %s", res.status, res.errorCode())
+		}
+		// Do not spin while a process is down and requests fail at once
+		if res.status != http.StatusOK {
+			time.Sleep(100 * time.Millisecond)
+		}
+		l.mu.Lock()
+		l.outcomes[outcome]++
+		l.mu.Unlock()
+	}
+}
+
+// chaosReport is what TestChaos found
+type chaosReport struct {
+	seed        uint64
+	duration    time.Duration
+	faults      []chaosFault
+	outcomes    map[string]int
+	echoRows    int
+	workerRows  int
+	workerOnly  []string
+	violations  []string
+	reproduceAs string
+}
+
+func (r *chaosReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== Chaos report ===\n")
+	fmt.Fprintf(&b, "Seed: %d (reproduce: %s)\n", r.seed, r.reproduceAs)
+	fmt.Fprintf(&b, "Duration: %v, faults injected: %d\n", r.duration, len(r.faults))
+	for _, f := range r.faults {
+		fmt.Fprintf(&b, "  %v\n", f)
+	}
+	fmt.Fprintf(&b, "Requests:\n")
+	for _, outcome := range sortedKeys(r.outcomes) {
+		fmt.Fprintf(&b, "  %-40s %d\n", outcome, r.outcomes[outcome])
+	}
+	fmt.Fprintf(&b, "Committed rows: echo %d, worker %d\n", r.echoRows, r.workerRows)
+	fmt.Fprintf(&b, "Worker commits without an echo row (caller gave up after the worker committed): %d\n", len(r.workerOnly))
+	if len(r.violations) == 0 {
+		fmt.Fprintf(&b, "Invariant violations: none\n")
+	} else {
+		fmt.Fprintf(&b, "Invariant violations: %d\n", len(r.violations))
+		for _, v := range r.violations {
+			fmt.Fprintf(&b, "  ❌ %s\n", v)
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkChaosInvariants verifies that every committed echo row has a matching
+// worker row and that neither database holds an id twice. There is no
+// compensation log yet, so no echo row is excused from having a worker row.
+func checkChaosInvariants(t *testing.T, r *chaosReport, echoDbPath, workerDbPath string) {
+	t.Helper()
+	echoIDs := countIDs(t, echoDbPath, "SELECT request_id FROM echo_requests")
+	workerIDs := countIDs(t, workerDbPath, "SELECT task_id FROM worker_tasks")
+
+	for _, id := range sortedKeys(echoIDs) {
+		n := echoIDs[id]
+		r.echoRows += n
+		if n > 1 {
+			r.violations = append(r.violations, fmt.Sprintf("echo_requests has %d rows for request_id=%s", n, id))
+		}
+		if workerIDs[id] == 0 {
+			r.violations = append(r.violations, fmt.Sprintf("echo committed request_id=%s but the worker has no task", id))
+		}
+	}
+	for _, id := range sortedKeys(workerIDs) {
+		n := workerIDs[id]
+		r.workerRows += n
+		if n > 1 {
+			r.violations = append(r.violations, fmt.Sprintf("worker_tasks has %d rows for task_id=%s", n, id))
+		}
+		if echoIDs[id] == 0 {
+			r.workerOnly = append(r.workerOnly, id)
+		}
+	}
+}
+
+// countIDs counts the rows per id returned by query
+func countIDs(t *testing.T, dbPath, query string) map[string]int {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("Failed to query %s: %v", dbPath, err)
+	}
+	defer rows.Close()
+
+	ids := map[string]int{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("Failed to scan %s: %v", dbPath, err)
+		}
+		ids[id]++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Failed to read %s: %v", dbPath, err)
+	}
+	return ids
+}
+
+// TestChaos drives concurrent /echo traffic while it kills, terminates and
+// freezes both processes on a seeded schedule, then checks both databases.
+//
+// It only runs when asked for, since it is long and its seed is random:
+//
+//	go test -run Chaos -v -chaos -chaos.duration=5m
+//	go test -run Chaos -v -chaos -chaos.seed=<seed from the report>
+func TestChaos(t *testing.T) {
+	if !*chaosEnabled {
+		t.Skip("chaos test runs with -chaos only")
+	}
+
+	seed := *chaosSeed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+	report := &chaosReport{
+		seed:        seed,
+		duration:    *chaosDuration,
+		faults:      chaosSchedule(seed, *chaosDuration),
+		reproduceAs: fmt.Sprintf("go test -run Chaos -v -chaos -chaos.seed=%d -chaos.duration=%v", seed, *chaosDuration),
+	}
+	t.Logf("Chaos seed %d, %d faults over %v", seed, len(report.faults), *chaosDuration)
+
+	dir := t.TempDir()
+	c := &chaosCluster{
+		t:            t,
+		httpPort:     testharness.FreePort(t),
+		grpcPort:     testharness.FreePort(t),
+		echoDbPath:   filepath.Join(dir, "echo.db"),
+		workerDbPath: filepath.Join(dir, "worker.db"),
+	}
+	c.start("worker")
+	c.start("echo")
+
+	load := &chaosLoad{
+		url:      fmt.Sprintf("http://localhost:%d", c.httpPort),
+		prefix:   fmt.Sprintf("chaos-%d", seed),
+		outcomes: map[string]int{},
+	}
+	ctx, stopLoad := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < *chaosConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			load.run(ctx)
+		}()
+	}
+
+	start := time.Now()
+	for _, f := range report.faults {
+		time.Sleep(time.Until(start.Add(f.at)))
+		t.Logf("chaos: %v", f)
+		c.inject(f)
+	}
+	time.Sleep(time.Until(start.Add(*chaosDuration)))
+
+	stopLoad()
+	wg.Wait()
+	report.outcomes = load.outcomes
+
+	// Shut both down so every transaction has either committed or rolled back
+	for _, target := range []string{"echo", "worker"} {
+		if err := c.process(target).Stop(10 * time.Second); err != nil {
+			t.Logf("chaos: %s %v", target, err)
+		}
+	}
+	checkChaosInvariants(t, report, c.echoDbPath, c.workerDbPath)
+
+	t.Log("\n" + report.String())
+	if *chaosReportPath != "" {
+		if err := os.WriteFile(*chaosReportPath, []byte(report.String()), 0o644); err != nil {
+			t.Errorf("Failed to write chaos report: %v", err)
+		}
+	}
+	if len(report.violations) > 0 {
+		t.Errorf("%d invariant violations with seed %d; reproduce with: %s", len(report.violations), seed, report.reproduceAs)
+	}
+}
+
+// TestChaosInvariants checks that the invariant checker catches what it should
+func TestChaosInvariants(t *testing.T) {
+	dir := t.TempDir()
+	echoDb, err := echo.InitDatabase(filepath.Join(dir, "echo.db"))
+	if err != nil {
+		t.Fatalf("Failed to init echo database: %v", err)
+	}
+	defer echoDb.Close()
+	workerDb, err := worker.InitDatabase(filepath.Join(dir, "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	defer workerDb.Close()
+
+	for _, id := range []string{"ok", "dup", "dup", "missing"} {
+		echoDb.Exec("INSERT INTO echo_requests (request_id, message) VALUES (?, '')", id)
+	}
+	for _, id := range []string{"ok", "dup", "orphan", "orphan"} {
+		workerDb.Exec("INSERT INTO worker_tasks (task_id, data) VALUES (?, '')", id)
+	}
+
+	report := &chaosReport{}
+	checkChaosInvariants(t, report, filepath.Join(dir, "echo.db"), filepath.Join(dir, "worker.db"))
+
+	want := []string{
+		"echo_requests has 2 rows for request_id=dup",
+		"echo committed request_id=missing but the worker has no task",
+		"worker_tasks has 2 rows for task_id=orphan",
+	}
+	if strings.Join(report.violations, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected violations:\n%s", strings.Join(report.violations, "\n"))
+	}
+	if len(report.workerOnly) != 1 || report.workerOnly[0] != "orphan" {
+		t.Errorf("Expected orphan as the only worker-only task, got %v", report.workerOnly)
+	}
+	if report.echoRows != 4 || report.workerRows != 4 {
+		t.Errorf("Expected 4 rows on each side, got echo %d, worker %d", report.echoRows, report.workerRows)
+	}
+}
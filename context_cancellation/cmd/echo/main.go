@@ -2,171 +2,156 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"expvar"
 	"flag"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/auth"
+	"context_cancellation/internal/config"
+	"context_cancellation/internal/echo"
+	"context_cancellation/internal/tlsconfig"
+	"context_cancellation/workerpb"
+
 	_ "github.com/mattn/go-sqlite3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
 )
 
-// Global database for echo server
-var echoDb *sql.DB
-
-// initEchoDatabase initializes the echo server SQLite database
-func initEchoDatabase(dbPath string) error {
-	var err error
-
-	// Initialize echo server database
-	echoDb, err = sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return fmt.Errorf("failed to open echo database: %v", err)
-	}
-
-	// Create echo_requests table
-	_, err = echoDb.Exec(`
-		CREATE TABLE IF NOT EXISTS echo_requests (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			request_id TEXT NOT NULL,
-			message TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+func main() {
+	cfg, src, err := config.LoadEcho(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create echo_requests table: %v", err)
+		log.Fatalf("[ECHO] Failed to load configuration: %v", err)
 	}
-
-	log.Println("[ECHO] Database initialized successfully")
-	return nil
-}
-
-// httpEchoHandler handles HTTP requests and makes gRPC calls
-func httpEchoHandler(grpcClient WorkerServiceClient) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		requestID := r.URL.Query().Get("request_id")
-		if requestID == "" {
-			requestID = fmt.Sprintf("req-%d", time.Now().Unix())
-		}
-
-		message := r.URL.Query().Get("message")
-		if message == "" {
-			message = "Hello"
-		}
-
-		log.Printf("[ECHO] Received HTTP request: request_id=%s, message=%s", requestID, message)
-
-		// Start database transaction on echo server
-		ctx := r.Context()
-		tx, err := echoDb.BeginTx(ctx, nil)
-		if err != nil {
-			log.Printf("[ECHO] Failed to start transaction: %v", err)
-			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
-			return
-		}
-
-		// Ensure transaction is rolled back if we don't commit
-		defer func() {
-			if tx != nil {
-				log.Printf("[ECHO] Rolling back transaction for request_id=%s", requestID)
-				tx.Rollback()
-			}
-		}()
-
-		// Insert a record into echo database
-		_, err = tx.ExecContext(ctx, "INSERT INTO echo_requests (request_id, message) VALUES (?, ?)", requestID, message)
-		if err != nil {
-			log.Printf("[ECHO] Failed to insert request: %v", err)
-			http.Error(w, "Failed to insert request", http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("[ECHO] Inserted echo record for request_id=%s", requestID)
-
-		// Pass request_id to gRPC via metadata
-		ctx = metadata.AppendToOutgoingContext(ctx, "request-id", requestID)
-
-		// Call gRPC worker service
-		log.Printf("[ECHO] Calling gRPC worker service for request_id=%s", requestID)
-		resp, err := grpcClient.DoWork(ctx, &WorkRequest{
-			TaskId: requestID,
-			Data:   message,
-		})
-
-		if err != nil {
-			log.Printf("[ECHO] gRPC call failed for request_id=%s: %v", requestID, err)
-			if rbErr := tx.Rollback(); rbErr != nil {
-				// If transaction was already rolled back by the driver due to context cancellation, that's ok
-				if rbErr == sql.ErrTxDone {
-					log.Printf("[ECHO] ❌ TRANSACTION ROLLED BACK for request_id=%s (automatically by driver)", requestID)
-				} else {
-					log.Printf("[ECHO] ⚠️  Failed to rollback transaction for request_id=%s: %v", requestID, rbErr)
-				}
-			} else {
-				log.Printf("[ECHO] ❌ TRANSACTION ROLLED BACK for request_id=%s", requestID)
-			}
-			tx = nil // Prevent double rollback in defer
-			http.Error(w, fmt.Sprintf("Worker failed: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		// gRPC call succeeded - commit echo transaction
-		if err := tx.Commit(); err != nil {
-			log.Printf("[ECHO] Failed to commit transaction: %v", err)
-			http.Error(w, "Failed to commit", http.StatusInternalServerError)
-			return
-		}
-		tx = nil // Prevent rollback in defer
-
-		log.Printf("[ECHO] ✅ TRANSACTION COMMITTED for request_id=%s", requestID)
-		log.Printf("[ECHO] Response from worker: %s", resp.Message)
-		fmt.Fprintf(w, "Success: %s\n", resp.Message)
+	if src.PrintConfig {
+		config.Print(os.Stdout, cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("[ECHO] Invalid configuration: %v", err)
+	}
+	if src.PrintConfig {
+		return
 	}
-}
 
-func main() {
-	httpPort := flag.Int("http-port", 8080, "HTTP server port")
-	grpcPort := flag.Int("grpc-port", 50051, "gRPC server port (to connect to)")
-	dbPath := flag.String("db", "./test_echo.db", "Database path")
-	flag.Parse()
+	var logOut config.LogOutput
+	if err := logOut.Apply(cfg.Log); err != nil {
+		log.Fatalf("[ECHO] %v", err)
+	}
+	defer logOut.Close()
+	if src.File != "" {
+		log.Printf("[ECHO] Configuration loaded from %s", src.File)
+	}
 
-	log.Printf("[ECHO] Starting HTTP Echo server on port %d", *httpPort)
-	log.Printf("[ECHO] Will connect to gRPC Worker at localhost:%d", *grpcPort)
+	log.Printf("[ECHO] Starting HTTP Echo server on %s", cfg.Listen.HTTP)
+	log.Printf("[ECHO] Will connect to gRPC Worker at %s", cfg.Worker.Address)
 
 	// Initialize echo database
-	if err := initEchoDatabase(*dbPath); err != nil {
+	echoDb, err := echo.InitDatabase(cfg.Database.DSN)
+	if err != nil {
 		log.Fatalf("[ECHO] Failed to initialize database: %v", err)
 	}
 	defer echoDb.Close()
 
 	// Create gRPC client connection to worker service
-	conn, err := grpc.NewClient(
-		fmt.Sprintf("localhost:%d", *grpcPort),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	creds := insecure.NewCredentials()
+	if tlsFiles := cfg.TLS.Files(); tlsFiles.Enabled() {
+		reloader, err := tlsconfig.NewReloader(tlsFiles, "[ECHO]")
+		if err != nil {
+			log.Fatalf("[ECHO] Failed to load TLS certificates: %v", err)
+		}
+		creds = credentials.NewTLS(reloader.ClientConfig(cfg.TLS.ServerName))
+		log.Printf("[ECHO] Mutual TLS enabled (cert=%s, ca=%s)", tlsFiles.CertFile, tlsFiles.CAFile)
+	}
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+	}, echo.ClientInterceptors()...)
+	dialOpts = append(dialOpts, cfg.Worker.Keepalive.Config().DialOptions()...)
+	conn, err := grpc.NewClient(cfg.Worker.Address, dialOpts...)
 	if err != nil {
 		log.Fatalf("[ECHO] Failed to connect to gRPC server: %v", err)
 	}
 	defer conn.Close()
 
-	grpcClient := NewWorkerServiceClient(conn)
+	grpcClient := workerpb.NewWorkerServiceClient(conn)
 
 	// Create HTTP server
+	// The worker timeout and commit confirmation can change on SIGHUP
+	settings := &echo.Settings{}
+	settings.SetWorkerTimeout(time.Duration(cfg.Worker.Timeout))
+	settings.SetConfirmCommit(cfg.Worker.ConfirmCommit)
+	if cfg.Worker.ConfirmCommit {
+		log.Printf("[ECHO] Commit confirmation enabled: the worker waits for echo's go-ahead before committing")
+	}
+	// Requests in flight are listed on the admin endpoint, where an operator can cancel them
+	tracker := admin.NewTracker("[ECHO]")
+	var echoHandler http.Handler = echo.Handler(echoDb, grpcClient, echo.WithSettings(settings), echo.WithTracker(tracker))
+	var limiter *echo.RateLimiter
+	if cfg.RateLimit.Config != "" {
+		limits, err := echo.LoadRateLimitConfig(cfg.RateLimit.Config)
+		if err != nil {
+			log.Fatalf("[ECHO] Failed to load rate limits: %v", err)
+		}
+		limiter = echo.NewRateLimiter(limits)
+		echoHandler = echo.RateLimit(limiter, echoHandler)
+		log.Printf("[ECHO] Rate limiting enabled: per_client=%+v per_request_id=%+v", limits.PerClient, limits.PerRequestID)
+	}
+	// Authentication wraps rate limiting, so authenticated callers are limited by identity
+	if cfg.Auth.SecretFile != "" {
+		verifier, err := auth.LoadHMAC(cfg.Auth.SecretFile)
+		if err != nil {
+			log.Fatalf("[ECHO] Failed to load auth secret: %v", err)
+		}
+		auditOut, err := auth.OpenAuditLog(cfg.Auth.AuditLog)
+		if err != nil {
+			log.Fatalf("[ECHO] Failed to open audit log: %v", err)
+		}
+		defer auditOut.Close()
+
+		echoHandler = echo.RequireBearerToken(verifier, auth.NewAuditor(auditOut, "echo"), echoHandler)
+		log.Printf("[ECHO] Bearer token authentication enabled")
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/echo", httpEchoHandler(grpcClient))
+	mux.Handle("/echo", echoHandler)
+	mux.HandleFunc("GET /openapi.json", echo.OpenAPIHandler)
+	readiness := []admin.Check{admin.DatabaseCheck(echoDb), admin.ConnCheck("worker", conn)}
+	admin.RegisterHealth(mux, readiness...)
 
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", *httpPort),
+		Addr:    cfg.Listen.HTTP,
 		Handler: mux,
 	}
 
+	// The admin endpoints can cancel requests, so they get their own listener
+	var adminServer *http.Server
+	if cfg.Listen.Admin != "" {
+		adminMux := http.NewServeMux()
+		admin.RegisterHealth(adminMux, readiness...)
+		admin.RegisterTasks(adminMux, tracker)
+		// expvar includes the command line, which can name secret files, so
+		// metrics are only on the admin listener
+		adminMux.Handle("GET /debug/vars", expvar.Handler())
+		adminServer = &http.Server{Addr: cfg.Listen.Admin, Handler: adminMux}
+		go func() {
+			log.Printf("[ECHO] Admin endpoints listening on %s", cfg.Listen.Admin)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("[ECHO] Admin server error: %v", err)
+			}
+		}()
+	}
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -174,13 +159,77 @@ func main() {
 	go func() {
 		<-sigChan
 		log.Printf("[ECHO] Shutting down gracefully...")
+		if adminServer != nil {
+			adminServer.Shutdown(context.Background())
+		}
 		server.Shutdown(context.Background())
 	}()
 
-	log.Printf("[ECHO] HTTP Echo server listening on :%d", *httpPort)
-	log.Printf("[ECHO] Try: curl 'http://localhost:%d/echo?request_id=test-001&message=hello'", *httpPort)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func(current *config.Echo) {
+		for range hupChan {
+			current = reload(current, settings, limiter, &logOut)
+		}
+	}(cfg)
+
+	local := config.LocalTarget(cfg.Listen.HTTP)
+	log.Printf("[ECHO] HTTP Echo server listening on %s", cfg.Listen.HTTP)
+	log.Printf("[ECHO] Try: curl 'http://%s/echo?request_id=test-001&message=hello'", local)
+	log.Printf("[ECHO] OpenAPI document: http://%s/openapi.json", local)
 
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("[ECHO] Server error: %v", err)
 	}
 }
+
+// reload re-reads the configuration on SIGHUP and applies the settings that
+// can change while echo runs. It returns the configuration now in effect;
+// anything else that changed is logged and waits for a restart.
+func reload(cfg *config.Echo, settings *echo.Settings, limiter *echo.RateLimiter, logOut *config.LogOutput) *config.Echo {
+	log.Printf("[ECHO] SIGHUP received, reloading configuration")
+	next, _, err := config.LoadEcho(os.Args[1:], os.LookupEnv)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		log.Printf("[ECHO] ⚠️  Keeping the current configuration: %v", err)
+		return cfg
+	}
+
+	changed, restart := cfg.Diff(next)
+	if len(restart) > 0 {
+		log.Printf("[ECHO] ⚠️  Restart to apply: %s", strings.Join(restart, ", "))
+	}
+
+	applied := *cfg
+	if err := logOut.Apply(next.Log); err != nil {
+		log.Printf("[ECHO] ⚠️  Keeping the current log output: %v", err)
+	} else {
+		applied.Log = next.Log
+	}
+	settings.SetWorkerTimeout(time.Duration(next.Worker.Timeout))
+	settings.SetConfirmCommit(next.Worker.ConfirmCommit)
+	applied.Worker.Timeout, applied.Worker.ConfirmCommit = next.Worker.Timeout, next.Worker.ConfirmCommit
+
+	// The rate limit file is re-read even if its name did not change
+	if limiter != nil && next.RateLimit.Config == cfg.RateLimit.Config {
+		limits, err := echo.LoadRateLimitConfig(cfg.RateLimit.Config)
+		if err != nil {
+			log.Printf("[ECHO] ⚠️  Keeping the current rate limits: %v", err)
+		} else {
+			limiter.SetConfig(limits)
+			log.Printf("[ECHO] Rate limits reloaded: per_client=%+v per_request_id=%+v", limits.PerClient, limits.PerRequestID)
+		}
+	}
+
+	log.Printf("[ECHO] ✅ Configuration reloaded (changed: %s)", orNone(changed))
+	return &applied
+}
+
+func orNone(paths []string) string {
+	if len(paths) == 0 {
+		return "none"
+	}
+	return strings.Join(paths, ", ")
+}
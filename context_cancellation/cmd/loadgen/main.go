@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"context_cancellation/internal/loadgen"
+)
+
+// loadgen sends /echo traffic to a local echo server and reports latency,
+// transaction outcomes and errors
+func main() {
+	var cfg loadgen.Config
+	flag.StringVar(&cfg.URL, "url", "http://localhost:8080", "Echo server base URL")
+	flag.Float64Var(&cfg.Rate, "rate", 0, "Requests started per second (0 is as fast as -concurrency allows)")
+	flag.IntVar(&cfg.Concurrency, "concurrency", 4, "Requests in flight at most")
+	flag.DurationVar(&cfg.Duration, "duration", 30*time.Second, "Stop starting requests after this long (0 for no limit)")
+	flag.IntVar(&cfg.Requests, "requests", 0, "Stop after this many requests (0 for no limit)")
+	flag.Float64Var(&cfg.CancelPercent, "cancel-percent", 0, "Percentage of requests the client cancels")
+	flag.DurationVar(&cfg.CancelAfterMax, "cancel-after-max", 4*time.Second, "Cancelled requests are cancelled at a random offset below this")
+	flag.Uint64Var(&cfg.Seed, "seed", 0, "Seed for which requests are cancelled and when (0 picks one from the clock)")
+	flag.StringVar(&cfg.Prefix, "prefix", "", "request_id prefix (default loadgen-<unix time>)")
+	tokenFile := flag.String("token-file", "", "File with a bearer token for echo (see cmd/token)")
+	echoDbPath := flag.String("echo-db", "", "Echo database to count this run's committed rows in (optional)")
+	workerDbPath := flag.String("worker-db", "", "Worker database to count this run's committed rows in (optional)")
+	format := flag.String("format", "table", "Report format: table, json or both")
+	flag.Parse()
+
+	if cfg.Seed == 0 {
+		cfg.Seed = uint64(time.Now().UnixNano())
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = fmt.Sprintf("loadgen-%d", time.Now().Unix())
+	}
+	if *tokenFile != "" {
+		token, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatalf("Failed to read token: %v", err)
+		}
+		cfg.Token = strings.TrimSpace(string(token))
+	}
+	if *format != "table" && *format != "json" && *format != "both" {
+		log.Fatalf("Unknown -format %q (want table, json or both)", *format)
+	}
+	if (*echoDbPath == "") != (*workerDbPath == "") {
+		log.Fatalf("-echo-db and -worker-db go together")
+	}
+
+	// Ctrl-C stops starting requests; the ones in flight still finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("Sending load to %s (prefix %s, seed %d)", cfg.URL, cfg.Prefix, cfg.Seed)
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: cfg.Concurrency}}
+	report, err := loadgen.Run(ctx, cfg, client)
+	if err != nil {
+		log.Fatalf("Load run failed: %v", err)
+	}
+	if *echoDbPath != "" {
+		if err := report.CountDatabases(*echoDbPath, *workerDbPath); err != nil {
+			log.Fatalf("Failed to count database rows: %v", err)
+		}
+	}
+
+	if *format != "json" {
+		report.WriteTable(os.Stdout)
+	}
+	if *format != "table" {
+		report.WriteJSON(os.Stdout)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"context_cancellation/internal/auth"
+)
+
+// token prints a bearer token for the echo server, signed with the shared secret
+func main() {
+	secretFile := flag.String("secret-file", "", "File with the HMAC secret (same as echo -auth-secret-file)")
+	subject := flag.String("sub", "", "Caller identity to put in the token")
+	ttl := flag.Duration("ttl", time.Hour, "Token lifetime (0 for no expiry)")
+	flag.Parse()
+
+	if *secretFile == "" || *subject == "" {
+		log.Fatalf("usage: token -secret-file=secret.txt -sub=alice [-ttl=1h]")
+	}
+
+	signer, err := auth.LoadHMAC(*secretFile)
+	if err != nil {
+		log.Fatalf("Failed to load secret: %v", err)
+	}
+
+	now := time.Now()
+	claims := auth.Claims{Subject: *subject, IssuedAt: now.Unix()}
+	if *ttl > 0 {
+		claims.ExpiresAt = now.Add(*ttl).Unix()
+	}
+
+	token, err := signer.Sign(claims)
+	if err != nil {
+		log.Fatalf("Failed to sign token: %v", err)
+	}
+	fmt.Println(token)
+}
@@ -2,137 +2,192 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"flag"
-	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/auth"
+	"context_cancellation/internal/config"
+	"context_cancellation/internal/tlsconfig"
+	"context_cancellation/internal/worker"
+	"context_cancellation/workerpb"
+
 	_ "github.com/mattn/go-sqlite3"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
-// workerServer implements the WorkerService
-type workerServer struct {
-	UnimplementedWorkerServiceServer
-	db *sql.DB
-}
-
-// DoWork implements the DoWork RPC method
-func (s *workerServer) DoWork(ctx context.Context, req *WorkRequest) (*WorkResponse, error) {
-	taskID := req.TaskId
-	log.Printf("[WORKER] Received work request: task_id=%s, data=%s", taskID, req.Data)
+// healthCheckInterval is how often the gRPC health status is refreshed
+const healthCheckInterval = 5 * time.Second
 
-	// Start database transaction on worker server
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		log.Printf("[WORKER] Failed to start transaction: %v", err)
-		return nil, status.Error(codes.Internal, "failed to start transaction")
+func main() {
+	cfg, src, err := config.LoadWorker(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	// Ensure transaction is rolled back if we don't commit
-	defer func() {
-		if tx != nil {
-			log.Printf("[WORKER] Rolling back transaction for task_id=%s", taskID)
-			tx.Rollback()
-		}
-	}()
-
-	// Insert a record into worker database
-	_, err = tx.ExecContext(ctx, "INSERT INTO worker_tasks (task_id, data) VALUES (?, ?)", taskID, req.Data)
 	if err != nil {
-		log.Printf("[WORKER] Failed to insert task: %v", err)
-		return nil, status.Error(codes.Internal, "failed to insert task")
-	}
-
-	log.Printf("[WORKER] Inserted task record for task_id=%s", taskID)
-
-	// Simulate long-running work with periodic context checking
-	ticker := time.NewTicker(100 * time.Millisecond)
-	defer ticker.Stop()
-
-	endTime := time.Now().Add(3 * time.Second)
-
-	for {
-		select {
-		case <-ctx.Done():
-			// Context was cancelled - rollback transaction
-			log.Printf("[WORKER] Context cancelled for task_id=%s: %v", taskID, ctx.Err())
-			if err := tx.Rollback(); err != nil {
-				// If transaction was already rolled back by the driver due to context cancellation, that's ok
-				if err == sql.ErrTxDone {
-					log.Printf("[WORKER] ❌ TRANSACTION ROLLED BACK for task_id=%s (automatically by driver)", taskID)
-				} else {
-					log.Printf("[WORKER] ⚠️  Failed to rollback transaction for task_id=%s: %v", taskID, err)
-				}
-			} else {
-				log.Printf("[WORKER] ❌ TRANSACTION ROLLED BACK for task_id=%s", taskID)
-			}
-			tx = nil // Prevent double rollback in defer
-			return nil, status.Error(codes.Canceled, "work cancelled")
-
-		case <-ticker.C:
-			if time.Now().After(endTime) {
-				// Work completed successfully - commit transaction
-				if err := tx.Commit(); err != nil {
-					log.Printf("[WORKER] Failed to commit transaction: %v", err)
-					return nil, status.Error(codes.Internal, "failed to commit")
-				}
-				tx = nil // Prevent rollback in defer
-
-				log.Printf("[WORKER] ✅ TRANSACTION COMMITTED for task_id=%s", taskID)
-				return &WorkResponse{
-					Success: true,
-					Message: fmt.Sprintf("Work completed for task %s", taskID),
-				}, nil
-			}
-		}
+		log.Fatalf("[WORKER] Failed to load configuration: %v", err)
+	}
+	if src.PrintConfig {
+		config.Print(os.Stdout, cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("[WORKER] Invalid configuration: %v", err)
+	}
+	if src.PrintConfig {
+		return
 	}
-}
 
-func main() {
-	port := flag.Int("port", 50051, "gRPC server port")
-	dbPath := flag.String("db", "./test_worker.db", "Database path")
-	flag.Parse()
+	var logOut config.LogOutput
+	if err := logOut.Apply(cfg.Log); err != nil {
+		log.Fatalf("[WORKER] %v", err)
+	}
+	defer logOut.Close()
+	if src.File != "" {
+		log.Printf("[WORKER] Configuration loaded from %s", src.File)
+	}
 
-	log.Printf("[WORKER] Starting gRPC Worker server on port %d with database %s", *port, *dbPath)
+	log.Printf("[WORKER] Starting gRPC Worker server on %s with database %s", cfg.Listen.GRPC, cfg.Database.DSN)
 
 	// Initialize worker database
-	db, err := sql.Open("sqlite3", *dbPath)
+	db, err := worker.InitDatabase(cfg.Database.DSN)
 	if err != nil {
-		log.Fatalf("[WORKER] Failed to open database: %v", err)
+		log.Fatalf("[WORKER] Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
-	// Create worker_tasks table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS worker_tasks (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			task_id TEXT NOT NULL,
-			data TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
+	// Start gRPC server
+	lis, err := net.Listen("tcp", cfg.Listen.GRPC)
 	if err != nil {
-		log.Fatalf("[WORKER] Failed to create table: %v", err)
+		log.Fatalf("[WORKER] Failed to listen: %v", err)
 	}
 
-	log.Printf("[WORKER] Database initialized successfully")
-
-	// Start gRPC server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *port))
+	// Caller policy for the auth hook; it can be replaced on SIGHUP
+	var policy atomic.Pointer[auth.Policy]
+	if cfg.Auth.Policy != "" {
+		p, err := auth.LoadPolicy(cfg.Auth.Policy)
+		if err != nil {
+			log.Fatalf("[WORKER] Failed to load auth policy: %v", err)
+		}
+		policy.Store(p)
+		log.Printf("[WORKER] Caller policy loaded from %s (%d callers)", cfg.Auth.Policy, len(p.Callers))
+	}
+	auditOut, err := auth.OpenAuditLog(cfg.Auth.AuditLog)
 	if err != nil {
-		log.Fatalf("[WORKER] Failed to listen: %v", err)
+		log.Fatalf("[WORKER] Failed to open audit log: %v", err)
+	}
+	defer auditOut.Close()
+
+	ka := cfg.Keepalive.Config()
+	serverOpts := worker.ServerInterceptors(worker.NewReloadablePolicyAuthFunc(&policy, auth.NewAuditor(auditOut, "worker")))
+	serverOpts = append(serverOpts, ka.ServerOptions()...)
+	log.Printf("[WORKER] Keepalive: ping after %v idle, timeout %v, client min interval %v", ka.Time, ka.Timeout, ka.MinTime)
+
+	// With mutual TLS every client must present a certificate signed by the CA;
+	// the gateway connects to this server as a client with the server's own
+	// certificate, so its own callers must present one too
+	gatewayCreds := insecure.NewCredentials()
+	var gatewayTLS *tls.Config
+	if tlsFiles := cfg.TLS.Files(); tlsFiles.Enabled() {
+		reloader, err := tlsconfig.NewReloader(tlsFiles, "[WORKER]")
+		if err != nil {
+			log.Fatalf("[WORKER] Failed to load TLS certificates: %v", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+		gatewayCreds = credentials.NewTLS(reloader.ClientConfig("localhost"))
+		gatewayTLS = reloader.HTTPServerConfig()
+		log.Printf("[WORKER] Mutual TLS enabled (cert=%s, ca=%s)", tlsFiles.CertFile, tlsFiles.CAFile)
+	}
+
+	grpcServer := grpc.NewServer(serverOpts...)
+	// Tasks in flight are listed on the admin endpoint, where an operator can cancel them
+	tracker := admin.NewTracker("[WORKER]")
+	workerServer := worker.NewServer(db, worker.WithConfirmTimeout(time.Duration(cfg.ConfirmTimeout)), worker.WithTracker(tracker))
+	workerpb.RegisterWorkerServiceServer(grpcServer, workerServer)
+
+	// The gRPC health service follows the database check; reflection lets
+	// grpcurl and friends discover the API
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+	readiness := admin.DatabaseCheck(db)
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go admin.WatchGRPCHealth(healthCtx, healthServer, healthCheckInterval, "[WORKER]",
+		[]string{workerpb.WorkerService_ServiceDesc.ServiceName}, readiness)
+
+	// Start HTTP/JSON gateway that transcodes into gRPC calls on this server
+	var gatewayServer *http.Server
+	if cfg.Listen.HTTP != "" {
+		gatewayConn, err := grpc.NewClient(
+			config.LocalTarget(cfg.Listen.GRPC),
+			grpc.WithTransportCredentials(gatewayCreds),
+		)
+		if err != nil {
+			log.Fatalf("[WORKER] Failed to create gateway connection: %v", err)
+		}
+		defer gatewayConn.Close()
+
+		gatewayHandler, err := worker.NewGatewayHandler(context.Background(), gatewayConn)
+		if err != nil {
+			log.Fatalf("[WORKER] Failed to register gateway: %v", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/", gatewayHandler)
+		admin.RegisterHealth(mux, readiness)
+
+		gatewayLis, err := net.Listen("tcp", cfg.Listen.HTTP)
+		if err != nil {
+			log.Fatalf("[WORKER] Failed to listen for the gateway: %v", err)
+		}
+		gatewayServer = &http.Server{Handler: mux}
+		go func() {
+			scheme, curlTLS := "http", ""
+			if gatewayTLS != nil {
+				scheme = "https"
+				curlTLS = " --cert CERT --key KEY --cacert CA"
+			}
+			log.Printf("[WORKER] HTTP/JSON gateway listening on %s (%s)", cfg.Listen.HTTP, scheme)
+			log.Printf("[WORKER] Try: curl%s -X POST %s://%s/v1/work -d '{\"task_id\":\"test-001\",\"data\":\"hello\"}'", curlTLS, scheme, config.LocalTarget(cfg.Listen.HTTP))
+			if err := worker.ServeGateway(gatewayServer, gatewayLis, gatewayTLS); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("[WORKER] Gateway error: %v", err)
+			}
+		}()
 	}
 
-	grpcServer := grpc.NewServer()
-	RegisterWorkerServiceServer(grpcServer, &workerServer{db: db})
+	// The admin endpoints can cancel tasks, so they get their own listener
+	var adminServer *http.Server
+	if cfg.Listen.Admin != "" {
+		adminMux := http.NewServeMux()
+		admin.RegisterHealth(adminMux, readiness)
+		admin.RegisterTasks(adminMux, tracker)
+		// expvar includes the command line, which can name secret files, so
+		// metrics are only on the admin listener
+		adminMux.Handle("GET /debug/vars", expvar.Handler())
+		adminServer = &http.Server{Addr: cfg.Listen.Admin, Handler: adminMux}
+		go func() {
+			log.Printf("[WORKER] Admin endpoints listening on %s", cfg.Listen.Admin)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("[WORKER] Admin server error: %v", err)
+			}
+		}()
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -141,11 +196,83 @@ func main() {
 	go func() {
 		<-sigChan
 		log.Printf("[WORKER] Shutting down gracefully...")
+		// Health checks see NOT_SERVING while the calls in flight finish
+		stopHealth()
+		healthServer.Shutdown()
+		if adminServer != nil {
+			adminServer.Shutdown(context.Background())
+		}
+		if gatewayServer != nil {
+			gatewayServer.Shutdown(context.Background())
+		}
 		grpcServer.GracefulStop()
 	}()
 
-	log.Printf("[WORKER] gRPC Worker server listening on :%d", *port)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func(current *config.Worker) {
+		for range hupChan {
+			current = reload(current, workerServer, &policy, &logOut)
+		}
+	}(cfg)
+
+	log.Printf("[WORKER] gRPC Worker server listening on %s", cfg.Listen.GRPC)
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("[WORKER] Server error: %v", err)
 	}
 }
+
+// reload re-reads the configuration on SIGHUP and applies the settings that
+// can change while the worker runs. It returns the configuration now in
+// effect; anything else that changed is logged and waits for a restart.
+func reload(cfg *config.Worker, server *worker.Server, policy *atomic.Pointer[auth.Policy], logOut *config.LogOutput) *config.Worker {
+	log.Printf("[WORKER] SIGHUP received, reloading configuration")
+	next, _, err := config.LoadWorker(os.Args[1:], os.LookupEnv)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		log.Printf("[WORKER] ⚠️  Keeping the current configuration: %v", err)
+		return cfg
+	}
+
+	changed, restart := cfg.Diff(next)
+	if len(restart) > 0 {
+		log.Printf("[WORKER] ⚠️  Restart to apply: %s", strings.Join(restart, ", "))
+	}
+
+	applied := *cfg
+	if err := logOut.Apply(next.Log); err != nil {
+		log.Printf("[WORKER] ⚠️  Keeping the current log output: %v", err)
+	} else {
+		applied.Log = next.Log
+	}
+	server.SetConfirmTimeout(time.Duration(next.ConfirmTimeout))
+	applied.ConfirmTimeout = next.ConfirmTimeout
+
+	// The policy file is re-read even if its name did not change
+	switch {
+	case next.Auth.Policy == "":
+		policy.Store(nil)
+		applied.Auth.Policy = ""
+	default:
+		p, err := auth.LoadPolicy(next.Auth.Policy)
+		if err != nil {
+			log.Printf("[WORKER] ⚠️  Keeping the current caller policy: %v", err)
+			break
+		}
+		policy.Store(p)
+		applied.Auth.Policy = next.Auth.Policy
+		log.Printf("[WORKER] Caller policy reloaded from %s (%d callers)", next.Auth.Policy, len(p.Callers))
+	}
+
+	log.Printf("[WORKER] ✅ Configuration reloaded (changed: %s)", orNone(changed))
+	return &applied
+}
+
+func orNone(paths []string) string {
+	if len(paths) == 0 {
+		return "none"
+	}
+	return strings.Join(paths, ", ")
+}
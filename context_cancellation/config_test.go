@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/testharness"
+)
+
+func TestPrintConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "echo.yaml")
+	os.WriteFile(configPath, []byte("worker:\n  address: worker.internal:6000\n  timeout: 5s\n"), 0o600)
+
+	cmd := exec.Command(testharness.Build(t, "context_cancellation/cmd/echo"), "--print-config", "-http-port=9090")
+	cmd.Env = append(os.Environ(), "ECHO_CONFIG="+configPath, "ECHO_WORKER_TIMEOUT=7s")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("--print-config failed: %v", err)
+	}
+	for _, want := range []string{"http: :9090", "address: worker.internal:6000", "timeout: 7s"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Effective config is missing %q:\n%s", want, out)
+		}
+	}
+
+	// An invalid configuration is printed, then rejected
+	cmd = exec.Command(testharness.Build(t, "context_cancellation/cmd/worker"), "--print-config", "-confirm-timeout=0s")
+	out, err = cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "confirm_timeout: 0s") || !strings.Contains(string(out), "Invalid configuration") {
+		t.Errorf("Expected the config and a validation error, got %v:\n%s", err, out)
+	}
+}
+
+// TestConfigReloadOnSIGHUP gives a running echo server a worker timeout
+// through its config file and SIGHUP, with no restart
+func TestConfigReloadOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	grpcPort, httpPort := testharness.FreePort(t), testharness.FreePort(t)
+	startWorkerProcess(t, grpcPort, filepath.Join(dir, "worker.db"))
+
+	configPath := filepath.Join(dir, "echo.yaml")
+	if err := os.WriteFile(configPath, []byte("worker:\n  timeout: 0s\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	echoProc := startEchoProcess(t, httpPort, grpcPort, filepath.Join(dir, "echo.db"), "-config="+configPath)
+	echoURL := fmt.Sprintf("http://localhost:%d", httpPort)
+
+	// The worker takes 3s, well past the timeout the reload sets
+	os.WriteFile(configPath, []byte("worker:\n  timeout: 1s\n  keepalive:\n    time: 20s\n"), 0o600)
+	echoProc.Signal(syscall.SIGHUP)
+	if err := echoProc.WaitForLog("Configuration reloaded (changed: worker.timeout)", 5*time.Second); err != nil {
+		t.Fatalf("Echo did not reload: %v\n%s", err, echoProc.Logs())
+	}
+	if !strings.Contains(echoProc.Logs(), "Restart to apply: worker.keepalive.time") {
+		t.Errorf("Expected the keepalive change to wait for a restart:\n%s", echoProc.Logs())
+	}
+
+	res := <-sendEchoWith(t.Context(), http.DefaultClient, echoURL, "reload-001")
+	if res.err != nil || res.status != http.StatusGatewayTimeout || res.errorCode() != "worker_timeout" {
+		t.Fatalf("Expected the reloaded 1s timeout to answer 504, got %d %v: %s", res.status, res.err, res.body)
+	}
+
+	// A broken file is refused and the running configuration kept
+	os.WriteFile(configPath, []byte("worker:\n  timeout: soon\n"), 0o600)
+	echoProc.Signal(syscall.SIGHUP)
+	if err := echoProc.WaitForLog("Keeping the current configuration", 5*time.Second); err != nil {
+		t.Fatalf("Echo did not refuse the broken file: %v\n%s", err, echoProc.Logs())
+	}
+}
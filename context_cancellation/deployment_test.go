@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/auth"
+	"context_cancellation/internal/echo"
+	"context_cancellation/internal/faultproxy"
+	"context_cancellation/internal/testharness"
+	"context_cancellation/internal/worker"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// deployment is one echo server talking to one worker, started either as
+// separate OS processes or inside the test process. The scenarios in
+// main_test.go run against both.
+type deployment struct {
+	description  string
+	echoURL      string
+	echoDbPath   string
+	workerDbPath string
+
+	echoLogs   func() string
+	workerLogs func() string
+
+	// With deploymentOptions.faultProxies, clients reach echo through
+	// clientProxy and echo reaches the worker through workerProxy
+	clientProxy *faultproxy.Proxy
+	workerProxy *faultproxy.Proxy
+
+	// echoProc is the echo process in the multi-process mode, nil otherwise
+	echoProc *testharness.ProcessWithLogs
+}
+
+// deploymentOptions changes how a deployment is wired
+type deploymentOptions struct {
+	// faultProxies puts a fault proxy in front of echo and another between echo and the worker
+	faultProxies bool
+	// workerTimeout is echo's -worker-timeout
+	workerTimeout time.Duration
+	// confirmCommit is echo's -confirm-commit
+	confirmCommit bool
+	// workerKeepalive replaces the worker's default keepalive settings
+	workerKeepalive *worker.KeepaliveConfig
+}
+
+// deploymentModes is the table every scenario runs through
+var deploymentModes = []struct {
+	name  string
+	start func(t *testing.T, opts deploymentOptions) *deployment
+}{
+	{"in-process", startInProcess},
+	{"multi-process", startProcesses},
+}
+
+// waitForEchoLog fails the test if echo does not log substr in time
+func (d *deployment) waitForEchoLog(t *testing.T, substr string) {
+	t.Helper()
+	waitForLogs(t, "echo", d.echoLogs, substr)
+}
+
+// waitForWorkerLog fails the test if the worker does not log substr in time
+func (d *deployment) waitForWorkerLog(t *testing.T, substr string) {
+	t.Helper()
+	waitForLogs(t, "worker", d.workerLogs, substr)
+}
+
+func waitForLogs(t *testing.T, name string, logs func() string, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs(), substr) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not log %q within 5s", name, substr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startFaultProxy starts a fault proxy to target that is closed when the test ends
+func startFaultProxy(t *testing.T, target string) *faultproxy.Proxy {
+	t.Helper()
+	p, err := faultproxy.New(target)
+	if err != nil {
+		t.Fatalf("Failed to start fault proxy: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+// startProcesses builds both binaries and runs them as separate OS processes on real ports
+func startProcesses(t *testing.T, opts deploymentOptions) *deployment {
+	grpcPort := testharness.FreePort(t)
+	httpPort := testharness.FreePort(t)
+	dir := t.TempDir()
+	d := &deployment{
+		description:  "SEPARATE OS PROCESSES",
+		echoURL:      fmt.Sprintf("http://localhost:%d", httpPort),
+		echoDbPath:   filepath.Join(dir, "echo.db"),
+		workerDbPath: filepath.Join(dir, "worker.db"),
+	}
+
+	t.Logf("Starting SEPARATE OS PROCESSES: Echo on :%d, Worker on :%d", httpPort, grpcPort)
+
+	// Both processes are stopped when the test finishes
+	var workerArgs []string
+	if ka := opts.workerKeepalive; ka != nil {
+		workerArgs = append(workerArgs,
+			fmt.Sprintf("-keepalive-time=%v", ka.Time),
+			fmt.Sprintf("-keepalive-timeout=%v", ka.Timeout),
+			fmt.Sprintf("-keepalive-min-time=%v", ka.MinTime),
+			fmt.Sprintf("-keepalive-permit-without-stream=%v", ka.PermitWithoutStream),
+		)
+	}
+	workerProc := startWorkerProcess(t, grpcPort, d.workerDbPath, workerArgs...)
+	d.workerLogs = workerProc.Logs
+
+	echoArgs := []string{
+		fmt.Sprintf("-worker-timeout=%v", opts.workerTimeout),
+		fmt.Sprintf("-confirm-commit=%v", opts.confirmCommit),
+	}
+	workerPort := grpcPort
+	if opts.faultProxies {
+		d.workerProxy = startFaultProxy(t, fmt.Sprintf("localhost:%d", grpcPort))
+		workerPort = d.workerProxy.Port()
+	}
+	echoProc := startEchoProcess(t, httpPort, workerPort, d.echoDbPath, echoArgs...)
+	d.echoLogs = echoProc.Logs
+	d.echoProc = echoProc
+
+	if opts.faultProxies {
+		d.clientProxy = startFaultProxy(t, fmt.Sprintf("localhost:%d", httpPort))
+		d.echoURL = "http://" + d.clientProxy.Addr()
+	}
+	return d
+}
+
+// startWorkerProcess starts the gRPC worker server as a separate OS process
+func startWorkerProcess(t *testing.T, port int, dbPath string, extraArgs ...string) *testharness.ProcessWithLogs {
+	t.Logf("Starting worker server as OS process on port %d...", port)
+	return testharness.Start(t, testharness.Config{
+		Name:  "worker",
+		Path:  testharness.Build(t, "context_cancellation/cmd/worker"),
+		Args:  append([]string{fmt.Sprintf("-port=%d", port), fmt.Sprintf("-db=%s", dbPath)}, extraArgs...),
+		Ready: testharness.GRPCReady(fmt.Sprintf("localhost:%d", port)),
+	})
+}
+
+// startEchoProcess starts the HTTP echo server as a separate OS process
+func startEchoProcess(t *testing.T, httpPort, grpcPort int, dbPath string, extraArgs ...string) *testharness.ProcessWithLogs {
+	t.Logf("Starting echo server as OS process on port %d...", httpPort)
+	return testharness.Start(t, testharness.Config{
+		Name: "echo",
+		Path: testharness.Build(t, "context_cancellation/cmd/echo"),
+		Args: append([]string{
+			fmt.Sprintf("-http-port=%d", httpPort),
+			fmt.Sprintf("-grpc-port=%d", grpcPort),
+			fmt.Sprintf("-db=%s", dbPath),
+		}, extraArgs...),
+		Ready: testharness.HTTPReady(fmt.Sprintf("http://localhost:%d/openapi.json", httpPort)),
+	})
+}
+
+// startInProcess runs the worker on an in-memory bufconn listener and echo on
+// an httptest.Server, wired together the same way the binaries are. Fault
+// proxies need real sockets, so with them the worker listens on TCP instead.
+func startInProcess(t *testing.T, opts deploymentOptions) *deployment {
+	dir := t.TempDir()
+	d := &deployment{
+		description:  "ONE PROCESS over bufconn + httptest",
+		echoDbPath:   filepath.Join(dir, "echo.db"),
+		workerDbPath: filepath.Join(dir, "worker.db"),
+	}
+
+	// Both services log through the standard logger; their [ECHO] and
+	// [WORKER] lines are told apart by the messages the scenarios wait for
+	logs := captureLogs(t)
+	d.echoLogs = logs.String
+	d.workerLogs = logs.String
+
+	workerDb, err := worker.InitDatabase(d.workerDbPath)
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	t.Cleanup(func() { workerDb.Close() })
+
+	ka := worker.DefaultKeepalive()
+	if opts.workerKeepalive != nil {
+		ka = *opts.workerKeepalive
+	}
+	serverOpts := append(worker.ServerInterceptors(worker.NewPolicyAuthFunc(nil, auth.NewAuditor(io.Discard, "worker"))), ka.ServerOptions()...)
+	grpcServer := grpc.NewServer(serverOpts...)
+	workerpb.RegisterWorkerServiceServer(grpcServer, worker.NewServer(workerDb))
+	t.Cleanup(grpcServer.Stop)
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, echo.ClientInterceptors()...)
+	dialOpts = append(dialOpts, echo.DefaultKeepalive().DialOptions()...)
+	target := "passthrough:///bufconn"
+	if opts.faultProxies {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		go grpcServer.Serve(lis)
+		d.workerProxy = startFaultProxy(t, lis.Addr().String())
+		target = d.workerProxy.Addr()
+	} else {
+		lis := bufconn.Listen(1 << 20)
+		go grpcServer.Serve(lis)
+		dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	}
+	conn, err := grpc.NewClient(target, dialOpts...)
+	if err != nil {
+		t.Fatalf("Failed to create worker client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	echoDb, err := echo.InitDatabase(d.echoDbPath)
+	if err != nil {
+		t.Fatalf("Failed to init echo database: %v", err)
+	}
+	t.Cleanup(func() { echoDb.Close() })
+
+	mux := http.NewServeMux()
+	handlerOpts := []echo.Option{echo.WithWorkerTimeout(opts.workerTimeout)}
+	if opts.confirmCommit {
+		handlerOpts = append(handlerOpts, echo.WithCommitConfirmation())
+	}
+	mux.Handle("/echo", echo.Handler(echoDb, workerpb.NewWorkerServiceClient(conn), handlerOpts...))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	d.echoURL = server.URL
+	if opts.faultProxies {
+		d.clientProxy = startFaultProxy(t, server.Listener.Addr().String())
+		d.echoURL = "http://" + d.clientProxy.Addr()
+	}
+	t.Logf("Started IN-PROCESS deployment: Echo on %s, Worker on %s", d.echoURL, target)
+	return d
+}
+
+// syncBuffer is a bytes.Buffer that is safe to write from the servers' goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs sends the standard logger to a buffer (and stderr) until the test ends
+func captureLogs(t *testing.T) *syncBuffer {
+	buf := &syncBuffer{}
+	log.SetOutput(io.MultiWriter(os.Stderr, buf))
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return buf
+}
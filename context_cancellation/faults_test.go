@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/faultproxy"
+	"context_cancellation/internal/worker"
+)
+
+// echoResult is what the HTTP client saw
+type echoResult struct {
+	status int
+	body   string
+	err    error
+}
+
+// errorCode returns the structured error code of a failed echo response
+func (r echoResult) errorCode() string {
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal([]byte(r.body), &body)
+	return body.Error.Code
+}
+
+// sendEcho calls /echo in the background on a connection of its own
+func sendEcho(ctx context.Context, d *deployment, requestID string) <-chan echoResult {
+	return sendEchoWith(ctx, &http.Client{Transport: &http.Transport{}}, d.echoURL, requestID)
+}
+
+// sendEchoWith calls /echo on echoURL in the background with client
+func sendEchoWith(ctx context.Context, client *http.Client, echoURL, requestID string) <-chan echoResult {
+	results := make(chan echoResult, 1)
+	go func() {
+		url := fmt.Sprintf("%s/echo?request_id=%s&message=fault", echoURL, requestID)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			results <- echoResult{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- echoResult{status: resp.StatusCode, body: string(body), err: err}
+	}()
+	return results
+}
+
+func waitForResult(t *testing.T, results <-chan echoResult) echoResult {
+	t.Helper()
+	select {
+	case res := <-results:
+		return res
+	case <-time.After(10 * time.Second):
+		t.Fatal("HTTP request did not finish")
+		return echoResult{}
+	}
+}
+
+// expectRecords checks how the two transactions came out
+func expectRecords(t *testing.T, d *deployment, wantEcho, wantWorker int) {
+	t.Helper()
+	echoCount := countEchoRecords(t, d.echoDbPath)
+	workerCount := countWorkerRecords(t, d.workerDbPath)
+	t.Logf("   Echo database records: %d, Worker database records: %d", echoCount, workerCount)
+	if echoCount != wantEcho {
+		t.Errorf("❌ Expected %d echo records, found %d", wantEcho, echoCount)
+	}
+	if workerCount != wantWorker {
+		t.Errorf("❌ Expected %d worker records, found %d", wantWorker, workerCount)
+	}
+}
+
+// forEachMode runs a fault scenario in every deployment mode with fault proxies in place
+func forEachMode(t *testing.T, opts deploymentOptions, scenario func(t *testing.T, d *deployment)) {
+	opts.faultProxies = true
+	for _, mode := range deploymentModes {
+		t.Run(mode.name, func(t *testing.T) {
+			scenario(t, mode.start(t, opts))
+		})
+	}
+}
+
+// TestFaultLatency: slow links on both hops only make the request slower
+func TestFaultLatency(t *testing.T) {
+	forEachMode(t, deploymentOptions{}, func(t *testing.T, d *deployment) {
+		slow := faultproxy.Faults{Latency: 50 * time.Millisecond}
+		for _, p := range []*faultproxy.Proxy{d.clientProxy, d.workerProxy} {
+			p.SetFaults(faultproxy.Upstream, slow)
+			p.SetFaults(faultproxy.Downstream, slow)
+		}
+
+		res := waitForResult(t, sendEcho(context.Background(), d, "latency-001"))
+		if res.err != nil || res.status != http.StatusOK {
+			t.Fatalf("Expected 200, got %d %v: %s", res.status, res.err, res.body)
+		}
+		expectRecords(t, d, 1, 1)
+	})
+}
+
+// TestFaultPartitionHidesCancellation: when echo and the worker are
+// partitioned, the client's cancellation never reaches the worker, which
+// commits on its own. This is the hazard keepalive pings exist for, see
+// TestFaultKeepaliveDetectsPartition.
+func TestFaultPartitionHidesCancellation(t *testing.T) {
+	forEachMode(t, deploymentOptions{}, func(t *testing.T, d *deployment) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		requestID := "partition-001"
+		results := sendEcho(ctx, d, requestID)
+
+		d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+		t.Log("1. Partitioning echo from the worker...")
+		d.workerProxy.Partition()
+
+		t.Log("2. Cancelling the HTTP request...")
+		cancel()
+		waitForResult(t, results)
+		d.waitForEchoLog(t, "TRANSACTION ROLLED BACK for request_id="+requestID)
+
+		t.Log("3. The worker never hears about it and commits")
+		d.waitForWorkerLog(t, "TRANSACTION COMMITTED for task_id="+requestID)
+		expectRecords(t, d, 0, 1)
+	})
+}
+
+// TestFaultPartitionWithCommitConfirmation is TestFaultPartitionHidesCancellation
+// with echo calling DoWorkConfirmed: the worker finishes its work but never
+// gets a go-ahead through the partition, so it rolls back instead of committing
+func TestFaultPartitionWithCommitConfirmation(t *testing.T) {
+	forEachMode(t, deploymentOptions{confirmCommit: true}, func(t *testing.T, d *deployment) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		requestID := "partition-003"
+		results := sendEcho(ctx, d, requestID)
+
+		d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+		d.workerProxy.Partition()
+		cancel()
+		waitForResult(t, results)
+		d.waitForEchoLog(t, "TRANSACTION ROLLED BACK for request_id="+requestID)
+
+		d.waitForWorkerLog(t, "No commit confirmation for task_id="+requestID)
+		d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
+		expectRecords(t, d, 0, 0)
+	})
+}
+
+// TestFaultPartitionWithWorkerTimeout: echo's worker timeout becomes a gRPC
+// deadline that travels with the call (grpc-timeout), so the partitioned
+// worker gives up on its own even though it never hears from echo again
+func TestFaultPartitionWithWorkerTimeout(t *testing.T) {
+	forEachMode(t, deploymentOptions{workerTimeout: time.Second}, func(t *testing.T, d *deployment) {
+		requestID := "partition-002"
+		results := sendEcho(context.Background(), d, requestID)
+
+		d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+		d.workerProxy.Partition()
+
+		res := waitForResult(t, results)
+		if res.status != http.StatusGatewayTimeout || res.errorCode() != "worker_timeout" {
+			t.Fatalf("Expected 504 worker_timeout, got %d: %s", res.status, res.body)
+		}
+
+		// Echo can only report the worker's outcome as unknown; it rolled back
+		d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
+		expectRecords(t, d, 0, 0)
+	})
+}
+
+// TestFaultResetDuringWork: a reset connection between echo and the worker
+// cancels the call on both sides
+func TestFaultResetDuringWork(t *testing.T) {
+	forEachMode(t, deploymentOptions{}, func(t *testing.T, d *deployment) {
+		requestID := "reset-001"
+		results := sendEcho(context.Background(), d, requestID)
+
+		d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+		d.workerProxy.ResetAll()
+
+		res := waitForResult(t, results)
+		if res.status != http.StatusInternalServerError || res.errorCode() != "worker_failed" {
+			t.Fatalf("Expected 500 worker_failed, got %d: %s", res.status, res.body)
+		}
+		d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
+		expectRecords(t, d, 0, 0)
+	})
+}
+
+// TestFaultClientHalfClose: net/http treats a client that closes its sending
+// side as gone and cancels the request context, so both sides roll back
+func TestFaultClientHalfClose(t *testing.T) {
+	forEachMode(t, deploymentOptions{}, func(t *testing.T, d *deployment) {
+		requestID := "halfclose-001"
+		results := sendEcho(context.Background(), d, requestID)
+
+		d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+		d.clientProxy.HalfClose(faultproxy.Upstream)
+
+		d.waitForEchoLog(t, "TRANSACTION ROLLED BACK for request_id="+requestID)
+		d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
+		waitForResult(t, results)
+		expectRecords(t, d, 0, 0)
+	})
+}
+
+// TestFaultResponseLost: a reset after the first byte of the response leaves
+// the client with an error for a request that committed on both sides
+func TestFaultResponseLost(t *testing.T) {
+	forEachMode(t, deploymentOptions{}, func(t *testing.T, d *deployment) {
+		d.clientProxy.SetFaults(faultproxy.Downstream, faultproxy.Faults{ResetAfterBytes: 1})
+
+		res := waitForResult(t, sendEcho(context.Background(), d, "lost-001"))
+		if res.err == nil {
+			t.Fatalf("Expected the client to see an error, got %d: %s", res.status, res.body)
+		}
+		t.Logf("   Client error: %v", res.err)
+		expectRecords(t, d, 1, 1)
+	})
+}
+
+// fastKeepalive makes the worker notice a silent client within about 1.5s,
+// well before the 3s of work commits
+var fastKeepalive = worker.KeepaliveConfig{
+	Time:                time.Second,
+	Timeout:             500 * time.Millisecond,
+	MinTime:             5 * time.Second,
+	PermitWithoutStream: true,
+}
+
+// TestFaultKeepaliveDetectsPartition is TestFaultPartitionHidesCancellation
+// with keepalive pings on the worker: the worker notices echo is unreachable,
+// closes the connection and rolls back instead of committing.
+func TestFaultKeepaliveDetectsPartition(t *testing.T) {
+	forEachMode(t, deploymentOptions{workerKeepalive: &fastKeepalive}, func(t *testing.T, d *deployment) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		requestID := "keepalive-001"
+		results := sendEcho(ctx, d, requestID)
+
+		d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+		d.workerProxy.Partition()
+		cancel()
+		waitForResult(t, results)
+
+		d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
+		expectRecords(t, d, 0, 0)
+	})
+}
+
+// TestFaultFrozenEcho freezes the echo process with SIGSTOP while the worker
+// is mid-transaction. The kernel keeps the TCP connection open, so only a
+// keepalive ping that goes unanswered tells the worker its caller is gone.
+// With the default settings the ping comes too late and the worker commits;
+// once echo is thawed it gets the reply and commits too.
+func TestFaultFrozenEcho(t *testing.T) {
+	tests := []struct {
+		name       string
+		keepalive  *worker.KeepaliveConfig
+		wantWorker string
+		wantEcho   string
+		wantCount  int
+	}{
+		{"fast keepalive", &fastKeepalive, "TRANSACTION ROLLED BACK", "TRANSACTION ROLLED BACK", 0},
+		{"default keepalive", nil, "TRANSACTION COMMITTED", "TRANSACTION COMMITTED", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := startProcesses(t, deploymentOptions{workerKeepalive: tt.keepalive})
+			requestID := "frozen-001"
+			results := sendEcho(context.Background(), d, requestID)
+
+			d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
+			t.Log("1. Freezing echo with SIGSTOP...")
+			if err := d.echoProc.Signal(syscall.SIGSTOP); err != nil {
+				t.Fatalf("Failed to stop echo: %v", err)
+			}
+			d.waitForWorkerLog(t, tt.wantWorker+" for task_id="+requestID)
+
+			t.Log("2. Thawing echo with SIGCONT...")
+			if err := d.echoProc.Signal(syscall.SIGCONT); err != nil {
+				t.Fatalf("Failed to continue echo: %v", err)
+			}
+			d.waitForEchoLog(t, tt.wantEcho+" for request_id="+requestID)
+			waitForResult(t, results)
+			expectRecords(t, d, tt.wantCount, tt.wantCount)
+		})
+	}
+}
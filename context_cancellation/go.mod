@@ -3,9 +3,13 @@ module context_cancellation
 go 1.25.3
 
 require (
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.27.3
 	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/time v0.14.0
+	google.golang.org/genproto/googleapis/api v0.0.0-20251029180050-ab9386a59fda
 	google.golang.org/grpc v1.78.0
 	google.golang.org/protobuf v1.36.11
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
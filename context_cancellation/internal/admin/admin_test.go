@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker("[TEST]")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	tracker.now = func() time.Time { return now }
+
+	ctxA, doneA := tracker.Track(t.Context(), "req-a", "alice")
+	now = now.Add(time.Second)
+	_, doneB := tracker.Track(t.Context(), "req-b", "")
+	defer doneB()
+	now = now.Add(500 * time.Millisecond)
+
+	tasks := tracker.List()
+	if len(tasks) != 2 || tasks[0].RequestID != "req-a" || tasks[1].RequestID != "req-b" {
+		t.Fatalf("Expected req-a then req-b, got %+v", tasks)
+	}
+	if tasks[0].AgeMs != 1500 || tasks[1].AgeMs != 500 || tasks[0].Caller != "alice" {
+		t.Errorf("Unexpected tasks: %+v", tasks)
+	}
+
+	if n := tracker.Cancel("missing"); n != 0 {
+		t.Errorf("Cancelled %d tasks that do not exist", n)
+	}
+	if n := tracker.Cancel("req-a"); n != 1 {
+		t.Fatalf("Expected to cancel 1 task, cancelled %d", n)
+	}
+	if !errors.Is(context.Cause(ctxA), ErrCancelled) {
+		t.Errorf("Expected cause ErrCancelled, got %v", context.Cause(ctxA))
+	}
+
+	doneA()
+	if tasks := tracker.List(); len(tasks) != 1 || tasks[0].RequestID != "req-b" {
+		t.Errorf("Expected only req-b left, got %+v", tasks)
+	}
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	ctx, done := tracker.Track(t.Context(), "req-a", "")
+	done()
+	if ctx != t.Context() {
+		t.Error("A nil tracker must return the context unchanged")
+	}
+}
+
+func TestTasksEndpoints(t *testing.T) {
+	tracker := NewTracker("[TEST]")
+	mux := http.NewServeMux()
+	RegisterTasks(mux, tracker)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, done := tracker.Track(t.Context(), "stuck-001", "")
+	defer done()
+
+	resp, err := http.Get(server.URL + "/admin/tasks")
+	if err != nil {
+		t.Fatalf("GET /admin/tasks failed: %v", err)
+	}
+	var list struct{ Tasks []Task }
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Tasks) != 1 || list.Tasks[0].RequestID != "stuck-001" {
+		t.Fatalf("Expected stuck-001, got %+v", list.Tasks)
+	}
+
+	resp, err = http.Post(server.URL+"/admin/tasks/other/cancel", "", nil)
+	if err != nil {
+		t.Fatalf("POST cancel failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown request_id, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/admin/tasks/stuck-001/cancel", "", nil)
+	if err != nil {
+		t.Fatalf("POST cancel failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if !errors.Is(context.Cause(ctx), ErrCancelled) {
+		t.Errorf("Task was not cancelled: %v", context.Cause(ctx))
+	}
+}
+
+func probe(t *testing.T, url string) (int, map[string]any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	healthy := true
+	mux := http.NewServeMux()
+	RegisterHealth(mux,
+		Check{Name: "always", Run: func(ctx context.Context) error { return nil }},
+		Check{Name: "toggle", Run: func(ctx context.Context) error {
+			if !healthy {
+				return errors.New("down")
+			}
+			return nil
+		}},
+	)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	if code, _ := probe(t, server.URL+"/healthz"); code != http.StatusOK {
+		t.Errorf("Expected /healthz 200, got %d", code)
+	}
+	if code, body := probe(t, server.URL+"/readyz"); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("Expected ready, got %d %v", code, body)
+	}
+
+	healthy = false
+	code, body := probe(t, server.URL+"/readyz")
+	if code != http.StatusServiceUnavailable || body["status"] != "not_ready" {
+		t.Fatalf("Expected not_ready, got %d %v", code, body)
+	}
+	checks, _ := body["checks"].(map[string]any)
+	if checks["toggle"] != "down" || checks["always"] != "ok" {
+		t.Errorf("Unexpected check results: %v", checks)
+	}
+	if code, _ := probe(t, server.URL+"/healthz"); code != http.StatusOK {
+		t.Errorf("Liveness must not depend on the checks, got %d", code)
+	}
+}
+
+func TestDatabaseCheck(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	check := DatabaseCheck(db)
+	if err := check.Run(t.Context()); err != nil {
+		t.Fatalf("Expected a writable database, got %v", err)
+	}
+
+	// access(2) lets root write anything
+	if os.Geteuid() == 0 {
+		t.Skip("running as root")
+	}
+	os.Chmod(filepath.Join(dir, "test.db"), 0o400)
+	if err := check.Run(t.Context()); err == nil {
+		t.Error("Expected a read-only database file to fail the check")
+	}
+}
+
+func TestConnCheckUnreachable(t *testing.T) {
+	conn, err := grpc.NewClient("localhost:1", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	if err := ConnCheck("worker", conn).Run(ctx); err == nil {
+		t.Error("Expected an unreachable worker to fail the check")
+	}
+}
+
+func TestWatchGRPCHealth(t *testing.T) {
+	hs := health.NewServer()
+	failing := make(chan bool, 1)
+	failing <- false
+	check := Check{Name: "toggle", Run: func(ctx context.Context) error {
+		f := <-failing
+		failing <- f
+		if f {
+			return errors.New("down")
+		}
+		return nil
+	}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go WatchGRPCHealth(ctx, hs, 10*time.Millisecond, "[TEST]", []string{"test.Service"}, check)
+
+	waitFor := func(service string, want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			resp, err := hs.Check(t.Context(), &healthpb.HealthCheckRequest{Service: service})
+			if err == nil && resp.Status == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%q never became %s (last %v, %v)", service, want, resp, err)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor("", healthpb.HealthCheckResponse_SERVING)
+	waitFor("test.Service", healthpb.HealthCheckResponse_SERVING)
+
+	<-failing
+	failing <- true
+	waitFor("", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitFor("test.Service", healthpb.HealthCheckResponse_NOT_SERVING)
+}
@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"context_cancellation/internal/sqliteutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// checkTimeout bounds each readiness check
+const checkTimeout = 2 * time.Second
+
+// Check is one dependency readiness depends on
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// DatabaseCheck is ready while db answers a ping and its file can be written
+func DatabaseCheck(db *sql.DB) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) error {
+		return sqliteutil.CheckWritable(ctx, db)
+	}}
+}
+
+// ConnCheck is ready while conn is connected. An idle connection is asked to
+// connect, and the check waits for it until its deadline.
+func ConnCheck(name string, conn *grpc.ClientConn) Check {
+	return Check{Name: name, Run: func(ctx context.Context) error {
+		state := conn.GetState()
+		if state == connectivity.Idle {
+			conn.Connect()
+		}
+		for state != connectivity.Ready {
+			if state == connectivity.Shutdown || !conn.WaitForStateChange(ctx, state) {
+				return fmt.Errorf("connection is %s", state)
+			}
+			state = conn.GetState()
+		}
+		return nil
+	}}
+}
+
+// run runs every check and returns the failures by name
+func run(ctx context.Context, checks []Check) map[string]string {
+	failures := map[string]string{}
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		if err := c.Run(ctx); err != nil {
+			failures[c.Name] = err.Error()
+		}
+		cancel()
+	}
+	return failures
+}
+
+// RegisterHealth serves the probes on mux:
+//
+//	GET /healthz   200 while the process serves HTTP (liveness)
+//	GET /readyz    200 if every check passes, 503 with the failures otherwise
+func RegisterHealth(mux *http.ServeMux, checks ...Check) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		results := map[string]string{}
+		for _, c := range checks {
+			results[c.Name] = "ok"
+		}
+		failures := run(r.Context(), checks)
+		for name, reason := range failures {
+			results[name] = reason
+		}
+		if len(failures) > 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not_ready", "checks": results})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "checks": results})
+	})
+}
+
+// WatchGRPCHealth runs the checks every interval until ctx is done and
+// reports the result as the overall status and as the status of each of
+// services on hs, logging every change. logPrefix is e.g. "[WORKER]".
+func WatchGRPCHealth(ctx context.Context, hs *health.Server, interval time.Duration, logPrefix string, services []string, checks ...Check) {
+	set := func(status healthpb.HealthCheckResponse_ServingStatus) {
+		hs.SetServingStatus("", status)
+		for _, s := range services {
+			hs.SetServingStatus(s, status)
+		}
+	}
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		failures := run(ctx, checks)
+		if len(failures) > 0 {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		if status != last {
+			if len(failures) > 0 {
+				log.Printf("%s ⚠️  Health %s: %v", logPrefix, status, failures)
+			} else {
+				log.Printf("%s ✅ Health %s", logPrefix, status)
+			}
+			last = status
+		}
+		set(status)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package admin serves the operational endpoints of the echo and worker
+// binaries: liveness, readiness and the list of tasks in flight, any of
+// which an operator can cancel by request_id.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCancelled is the cause of a task's context when an operator cancelled it
+var ErrCancelled = errors.New("cancelled by an operator")
+
+// Task is one request being handled
+type Task struct {
+	RequestID string    `json:"request_id"`
+	Caller    string    `json:"caller,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	AgeMs     float64   `json:"age_ms"`
+}
+
+type trackedTask struct {
+	task   Task
+	cancel context.CancelCauseFunc
+}
+
+// Tracker keeps the tasks in flight. A nil Tracker tracks nothing.
+type Tracker struct {
+	logPrefix string
+	now       func() time.Time
+
+	mu    sync.Mutex
+	next  uint64
+	tasks map[uint64]*trackedTask
+}
+
+// NewTracker returns an empty Tracker; logPrefix is prepended to its log lines, e.g. "[ECHO]"
+func NewTracker(logPrefix string) *Tracker {
+	return &Tracker{logPrefix: logPrefix, now: time.Now, tasks: make(map[uint64]*trackedTask)}
+}
+
+// Track lists the task until done is called. The returned context is
+// cancelled with ErrCancelled if an operator cancels the task.
+func (t *Tracker) Track(ctx context.Context, requestID, caller string) (_ context.Context, done func()) {
+	if t == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	t.mu.Lock()
+	t.next++
+	id := t.next
+	t.tasks[id] = &trackedTask{
+		task:   Task{RequestID: requestID, Caller: caller, StartedAt: t.now()},
+		cancel: cancel,
+	}
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.tasks, id)
+		t.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// List returns the tasks in flight, oldest first
+func (t *Tracker) List() []Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	tasks := make([]Task, 0, len(t.tasks))
+	for _, tracked := range t.tasks {
+		task := tracked.task
+		task.AgeMs = float64(now.Sub(task.StartedAt).Microseconds()) / 1000
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].StartedAt.Before(tasks[j].StartedAt) })
+	return tasks
+}
+
+// Cancel cancels every task in flight with requestID and returns how many there were
+func (t *Tracker) Cancel(requestID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, tracked := range t.tasks {
+		if tracked.task.RequestID == requestID {
+			tracked.cancel(ErrCancelled)
+			n++
+		}
+	}
+	return n
+}
+
+// RegisterTasks serves the tracker on mux:
+//
+//	GET  /admin/tasks                       tasks in flight, oldest first
+//	POST /admin/tasks/{request_id}/cancel   cancel them; 404 if there are none
+func RegisterTasks(mux *http.ServeMux, t *Tracker) {
+	mux.HandleFunc("GET /admin/tasks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"tasks": t.List()})
+	})
+	mux.HandleFunc("POST /admin/tasks/{request_id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.PathValue("request_id")
+		n := t.Cancel(requestID)
+		if n == 0 {
+			writeJSON(w, http.StatusNotFound, map[string]any{"request_id": requestID, "cancelled": 0})
+			return
+		}
+		log.Printf("%s ⚠️  Operator cancelled %d task(s) with request_id=%s (from %s)", t.logPrefix, n, requestID, r.RemoteAddr)
+		writeJSON(w, http.StatusOK, map[string]any{"request_id": requestID, "cancelled": n})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
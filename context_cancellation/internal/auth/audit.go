@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEvent is one line of the audit log
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Service   string    `json:"service"`
+	Event     string    `json:"event"`
+	Caller    string    `json:"caller,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Target    string    `json:"target"`
+	Remote    string    `json:"remote,omitempty"`
+	Reason    string    `json:"reason"`
+}
+
+// Auditor writes audit events as JSON lines
+type Auditor struct {
+	service string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditor returns an auditor that tags events with service ("echo" or "worker")
+func NewAuditor(w io.Writer, service string) *Auditor {
+	return &Auditor{w: w, service: service}
+}
+
+// Reject records a request that was refused by authentication or authorization
+func (a *Auditor) Reject(event AuditEvent) {
+	event.Time = time.Now().UTC()
+	event.Service = a.service
+	if event.Event == "" {
+		event.Event = "auth_rejected"
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.w.Write(append(line, '\n'))
+}
+
+// OpenAuditLog opens path for appending audit events, or returns stderr when path is empty
+func OpenAuditLog(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{os.Stderr}, nil
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
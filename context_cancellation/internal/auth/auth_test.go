@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestSignAndVerify(t *testing.T) {
+	h, err := NewHMAC(testSecret)
+	if err != nil {
+		t.Fatalf("NewHMAC failed: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	token, err := h.Sign(Claims{Subject: "alice", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	claims, err := h.Verify(token, now)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if claims.Subject != "alice" {
+		t.Errorf("Expected subject alice, got %q", claims.Subject)
+	}
+
+	if _, err := h.Verify(token, now.Add(2*time.Hour)); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+
+	other, _ := NewHMAC(bytes.Repeat([]byte("x"), 32))
+	if _, err := other.Verify(token, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature with another secret, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperedTokens(t *testing.T) {
+	h, _ := NewHMAC(testSecret)
+	now := time.Now()
+	token, _ := h.Sign(Claims{Subject: "alice"})
+	parts := strings.Split(token, ".")
+
+	forgedClaims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`))
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"forged claims", parts[0] + "." + forgedClaims + "." + parts[2], ErrInvalidSignature},
+		{"alg none", noneHeader + "." + parts[1] + ".", ErrMalformedToken},
+		{"two segments", parts[0] + "." + parts[1], ErrMalformedToken},
+		{"garbage", "not-a-token", ErrMalformedToken},
+	}
+	for _, tt := range tests {
+		if _, err := h.Verify(tt.token, now); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	if token, ok := BearerToken("Bearer abc.def.ghi"); !ok || token != "abc.def.ghi" {
+		t.Errorf("Expected token abc.def.ghi, got %q, %v", token, ok)
+	}
+	for _, header := range []string{"", "Basic dXNlcg==", "Bearer ", "abc"} {
+		if _, ok := BearerToken(header); ok {
+			t.Errorf("BearerToken(%q) should fail", header)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(path, []byte(`{
+		"callers": {
+			"alice": {"task_prefixes": ["alice-", "shared-"]},
+			"loadgen": {"task_prefixes": [""]}
+		}
+	}`), 0o600)
+
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		caller, taskID string
+		want           bool
+	}{
+		{"alice", "alice-001", true},
+		{"alice", "shared-001", true},
+		{"alice", "bob-001", false},
+		{"loadgen", "anything", true},
+		{"mallory", "alice-001", false},
+		{"", "alice-001", false},
+	}
+	for _, tt := range tests {
+		if got, reason := policy.AllowTask(tt.caller, tt.taskID); got != tt.want {
+			t.Errorf("AllowTask(%q, %q) = %v (%s), want %v", tt.caller, tt.taskID, got, reason, tt.want)
+		}
+	}
+}
+
+func TestAuditorWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	auditor := NewAuditor(&buf, "worker")
+	auditor.Reject(AuditEvent{Caller: "alice", Target: "/worker.WorkerService/DoWork", Reason: "denied"})
+
+	var event AuditEvent
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("Audit line is not JSON: %v (%s)", err, buf.String())
+	}
+	if event.Service != "worker" || event.Event != "auth_rejected" || event.Caller != "alice" {
+		t.Errorf("Unexpected audit event: %+v", event)
+	}
+}
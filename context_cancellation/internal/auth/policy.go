@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Policy decides which callers may submit which tasks to the worker.
+//
+// The policy file is JSON and lists, per caller, the task_id prefixes the
+// caller may use. An empty prefix allows every task_id.
+//
+//	{
+//	  "callers": {
+//	    "alice":   {"task_prefixes": ["alice-", "shared-"]},
+//	    "loadgen": {"task_prefixes": [""]}
+//	  }
+//	}
+type Policy struct {
+	Callers map[string]CallerPolicy `json:"callers"`
+}
+
+// CallerPolicy is the set of permissions for one caller
+type CallerPolicy struct {
+	TaskPrefixes []string `json:"task_prefixes"`
+}
+
+// LoadPolicy reads a policy file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %v", err)
+	}
+
+	var policy Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %v", path, err)
+	}
+	return &policy, nil
+}
+
+// AllowTask reports whether caller may submit taskID, and why not if it may not
+func (p *Policy) AllowTask(caller, taskID string) (bool, string) {
+	if caller == "" {
+		return false, "no caller identity"
+	}
+	perms, ok := p.Callers[caller]
+	if !ok {
+		return false, fmt.Sprintf("caller %q is not in the policy", caller)
+	}
+	for _, prefix := range perms.TaskPrefixes {
+		if strings.HasPrefix(taskID, prefix) {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("caller %q may not submit task_id %q", caller, taskID)
+}
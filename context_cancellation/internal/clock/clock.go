@@ -0,0 +1,50 @@
+// Package clock lets the worker's DoWork loop and echo's worker timeout run
+// on an injected clock, so tests can step time instead of sleeping.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the part of the time package the services use
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	// WithTimeout is context.WithTimeout on this clock. When the timeout
+	// fires, context.Cause of the returned context is context.DeadlineExceeded.
+	WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc)
+}
+
+// Ticker is a time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real returns the wall clock
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, d)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,117 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestFakeTickerDeliversEveryTick(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(100 * time.Millisecond)
+
+	received := make(chan time.Time, 10)
+	go func() {
+		for tick := range ticker.C() {
+			received <- tick
+		}
+	}()
+
+	// 350ms covers three ticks; none of them may be dropped
+	if n := f.Advance(350 * time.Millisecond); n != 3 {
+		t.Fatalf("Expected 3 ticks delivered, got %d", n)
+	}
+	for i := 1; i <= 3; i++ {
+		if got, want := <-received, start.Add(time.Duration(i)*100*time.Millisecond); !got.Equal(want) {
+			t.Errorf("Tick %d at %v, want %v", i, got, want)
+		}
+	}
+	if now := f.Now(); !now.Equal(start.Add(350 * time.Millisecond)) {
+		t.Errorf("Clock at %v after Advance", now)
+	}
+
+	ticker.Stop()
+	if n := f.Advance(time.Second); n != 0 {
+		t.Errorf("Stopped ticker delivered %d ticks", n)
+	}
+}
+
+func TestFakeTickerStoppedWhileTicking(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Second)
+
+	// Nobody reads the ticker; Advance must not hang once it is stopped
+	done := make(chan int)
+	go func() { done <- f.Advance(time.Second) }()
+	ticker.Stop()
+	if n := <-done; n != 0 {
+		t.Errorf("Expected no delivered ticks, got %d", n)
+	}
+}
+
+func TestFakeWithTimeout(t *testing.T) {
+	f := NewFake(start)
+	ctx, cancel := f.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	f.Advance(1999 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("Context cancelled before its timeout")
+	}
+	f.Advance(time.Millisecond)
+	if ctx.Err() == nil {
+		t.Fatal("Context not cancelled at its timeout")
+	}
+	if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		t.Errorf("Expected cause DeadlineExceeded, got %v", context.Cause(ctx))
+	}
+}
+
+func TestFakeWithTimeoutCancelled(t *testing.T) {
+	f := NewFake(start)
+	ctx, cancel := f.WithTimeout(context.Background(), time.Second)
+	cancel()
+
+	if !errors.Is(context.Cause(ctx), context.Canceled) {
+		t.Errorf("Expected cause Canceled, got %v", context.Cause(ctx))
+	}
+	f.BlockUntil(0)
+	f.Advance(time.Second)
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(start)
+
+	ready := make(chan struct{})
+	go func() {
+		f.BlockUntil(2)
+		close(ready)
+	}()
+
+	f.NewTicker(time.Second)
+	select {
+	case <-ready:
+		t.Fatal("BlockUntil(2) returned with one waiter")
+	default:
+	}
+	_, cancel := f.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	<-ready
+}
+
+func TestRealClock(t *testing.T) {
+	c := Real()
+	ctx, cancel := c.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		t.Errorf("Expected cause DeadlineExceeded, got %v", context.Cause(ctx))
+	}
+
+	ticker := c.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	<-ticker.C()
+}
@@ -0,0 +1,200 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when Advance is called.
+//
+// Unlike time.Ticker, a fake ticker never drops ticks: Advance hands each tick
+// to the goroutine reading the ticker and does not return until it has been
+// taken, or the ticker was stopped. A test that advances one period at a
+// time therefore knows exactly which tick the code under test was handling.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	tickers []*fakeTicker
+	timers  []*fakeTimer
+}
+
+// NewFake returns a fake clock set to start
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker returns a ticker that fires every d of fake time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTicker{
+		clock:  f,
+		period: d,
+		next:   f.now.Add(d),
+		c:      make(chan time.Time),
+		stop:   make(chan struct{}),
+	}
+	f.tickers = append(f.tickers, t)
+	f.changed.Broadcast()
+	return t
+}
+
+// WithTimeout returns a context that is cancelled once d of fake time has passed
+func (f *Fake) WithTimeout(parent context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	f.mu.Lock()
+	t := &fakeTimer{when: f.now.Add(d), fire: func() { cancel(context.DeadlineExceeded) }}
+	f.timers = append(f.timers, t)
+	f.changed.Broadcast()
+	f.mu.Unlock()
+
+	return ctx, func() {
+		f.removeTimer(t)
+		cancel(context.Canceled)
+	}
+}
+
+// Advance moves the clock forward by d, firing every tick and timeout that
+// falls into that interval in time order. It returns the number of ticks
+// that were delivered to a reader.
+func (f *Fake) Advance(d time.Duration) int {
+	f.mu.Lock()
+	end := f.now.Add(d)
+	f.mu.Unlock()
+
+	delivered := 0
+	for {
+		f.mu.Lock()
+		at, fire := f.nextEvent(end)
+		if fire == nil {
+			f.now = end
+			f.mu.Unlock()
+			return delivered
+		}
+		f.now = at
+		f.mu.Unlock()
+
+		// Fire outside the lock: the reader may call back into the clock
+		if fire() {
+			delivered++
+		}
+	}
+}
+
+// nextEvent finds the earliest tick or timeout at or before end and returns
+// its time and a func that fires it. Called with f.mu held.
+func (f *Fake) nextEvent(end time.Time) (time.Time, func() bool) {
+	var ticker *fakeTicker
+	for _, t := range f.tickers {
+		if ticker == nil || t.next.Before(ticker.next) {
+			ticker = t
+		}
+	}
+	var timer *fakeTimer
+	for _, t := range f.timers {
+		if timer == nil || t.when.Before(timer.when) {
+			timer = t
+		}
+	}
+
+	switch {
+	case ticker != nil && !ticker.next.After(end) && (timer == nil || !timer.when.Before(ticker.next)):
+		at := ticker.next
+		ticker.next = at.Add(ticker.period)
+		return at, ticker.deliver
+	case timer != nil && !timer.when.After(end):
+		f.timers = removeOne(f.timers, timer)
+		f.changed.Broadcast()
+		return timer.when, func() bool {
+			timer.fire()
+			return false
+		}
+	}
+	return time.Time{}, nil
+}
+
+// BlockUntil waits until n tickers and timeouts are active, so a test can
+// advance the clock only once the code under test has started waiting on it
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.tickers)+len(f.timers) < n {
+		f.changed.Wait()
+	}
+}
+
+func (f *Fake) removeTicker(t *fakeTicker) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tickers = removeOne(f.tickers, t)
+	f.changed.Broadcast()
+}
+
+func (f *Fake) removeTimer(t *fakeTimer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.timers = removeOne(f.timers, t)
+	f.changed.Broadcast()
+}
+
+func removeOne[T comparable](items []T, item T) []T {
+	for i, other := range items {
+		if other == item {
+			return append(items[:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	period time.Duration
+	next   time.Time
+
+	c        chan time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stop)
+		t.clock.removeTicker(t)
+	})
+}
+
+// deliver blocks until the tick is received or the ticker is stopped
+func (t *fakeTicker) deliver() bool {
+	now := t.clock.Now()
+	select {
+	case t.c <- now:
+		return true
+	case <-t.stop:
+		return false
+	}
+}
+
+type fakeTimer struct {
+	when time.Time
+	fire func()
+}
@@ -0,0 +1,218 @@
+// Package config loads the echo and worker configuration in layers:
+// built-in defaults, then a YAML file, then environment variables, then
+// command-line flags, each overriding the one before.
+//
+// Every flag has an environment variable named after it: the binary's prefix
+// followed by the flag name in upper case with dashes turned into
+// underscores, e.g. -worker-timeout is ECHO_WORKER_TIMEOUT for echo. The
+// file is chosen with -config or the CONFIG variable (ECHO_CONFIG, WORKER_CONFIG).
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as "1.5s" in config files and flags
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.Set(node.Value)
+}
+
+// Set implements flag.Value
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// TLS locates the PEM files for mutual TLS; all three are set or none
+type TLS struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+}
+
+// Log configures the standard logger
+type Log struct {
+	// File is appended to instead of stderr; it is reopened on SIGHUP, so it can be rotated
+	File string `yaml:"file"`
+	// Timestamps prefixes every line with the date and time
+	Timestamps bool `yaml:"timestamps"`
+}
+
+// Source records how the configuration was loaded
+type Source struct {
+	// File is the config file that was read, empty if none
+	File string
+	// PrintConfig is set by --print-config
+	PrintConfig bool
+}
+
+// load layers the file, the environment and args over the defaults.
+// register binds the binary's flags to a config; it runs twice, first to
+// find -config on a scratch copy and then for real.
+func load[T any](name, envPrefix string, defaults func() *T, register func(*T, *flag.FlagSet), args []string, lookupEnv func(string) (string, bool)) (*T, Source, error) {
+	var src Source
+
+	// First pass: only to find -config; errors are reported by the second pass
+	scratch := flag.NewFlagSet(name, flag.ContinueOnError)
+	scratch.SetOutput(io.Discard)
+	register(defaults(), scratch)
+	scratch.StringVar(&src.File, "config", "", "")
+	scratch.Bool("print-config", false, "")
+	scratch.Parse(args)
+	if src.File == "" {
+		src.File, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+
+	cfg := defaults()
+	if src.File != "" {
+		if err := readFile(src.File, cfg); err != nil {
+			return nil, src, err
+		}
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	register(cfg, fs)
+
+	// Environment variables override the file
+	var envErrs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		key := EnvName(envPrefix, f.Name)
+		if v, ok := lookupEnv(key); ok {
+			if err := f.Value.Set(v); err != nil {
+				envErrs = append(envErrs, fmt.Errorf("invalid %s=%q: %v", key, v, err))
+			}
+		}
+	})
+	if err := errors.Join(envErrs...); err != nil {
+		return nil, src, err
+	}
+
+	fs.String("config", src.File, "YAML config file (env "+envPrefix+"CONFIG)")
+	fs.BoolVar(&src.PrintConfig, "print-config", false, "Print the effective configuration as YAML and exit")
+	if err := fs.Parse(args); err != nil {
+		return nil, src, err
+	}
+	return cfg, src, nil
+}
+
+// EnvName is the environment variable for a flag, e.g. ECHO_ and worker-timeout give ECHO_WORKER_TIMEOUT
+func EnvName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readFile decodes a YAML file over cfg; unknown keys are an error, so typos do not go unnoticed
+func readFile(path string, cfg any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Print writes cfg as YAML, in the same form the config file takes
+func Print(w io.Writer, cfg any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// portFlag sets *addr to host:port, for the -port style flags that predate the addresses
+func portFlag(addr *string, host string) func(string) error {
+	return func(s string) error {
+		port, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port %q", s)
+		}
+		*addr = net.JoinHostPort(host, strconv.FormatUint(port, 10))
+		return nil
+	}
+}
+
+// LocalTarget turns a listen address into one this host can dial: ":8080" becomes "localhost:8080"
+func LocalTarget(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func checkAddr(path, addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("%s: invalid port %q", path, port)
+	}
+	return nil
+}
+
+// diff lists the settings that differ between old and next by their path in
+// the config file, split by whether they can be applied without a restart
+func diff(old, next any, reloadable map[string]bool) (reload, restart []string) {
+	var walk func(prefix string, a, b reflect.Value)
+	walk = func(prefix string, a, b reflect.Value) {
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			path := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if path == "" {
+				// Inlined struct
+				path = prefix
+			} else if prefix != "" {
+				path = prefix + "." + path
+			}
+			if field.Type.Kind() == reflect.Struct {
+				walk(path, a.Field(i), b.Field(i))
+				continue
+			}
+			if a.Field(i).Interface() == b.Field(i).Interface() {
+				continue
+			}
+			if reloadable[path] {
+				reload = append(reload, path)
+			} else {
+				restart = append(restart, path)
+			}
+		}
+	}
+	walk("", reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem())
+	return reload, restart
+}
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadEchoDefaults(t *testing.T) {
+	cfg, src, err := LoadEcho(nil, env(nil))
+	if err != nil {
+		t.Fatalf("LoadEcho failed: %v", err)
+	}
+	if src.File != "" || src.PrintConfig {
+		t.Errorf("Unexpected source %+v", src)
+	}
+	if cfg.Listen.HTTP != ":8080" || cfg.Worker.Address != "localhost:50051" || cfg.Database.DSN != "./test_echo.db" {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Defaults do not validate: %v", err)
+	}
+}
+
+func TestLoadEchoLayers(t *testing.T) {
+	path := writeFile(t, `
+listen:
+  http: ":9000"
+worker:
+  address: worker.internal:6000
+  timeout: 5s
+  confirm_commit: true
+database:
+  dsn: /var/lib/echo.db
+log:
+  timestamps: false
+`)
+	vars := map[string]string{
+		"ECHO_CONFIG":         path,
+		"ECHO_WORKER_TIMEOUT": "7s",
+		"ECHO_DB":             "/env/echo.db",
+	}
+	cfg, src, err := LoadEcho([]string{"-worker-timeout=9s", "-confirm-commit=false"}, env(vars))
+	if err != nil {
+		t.Fatalf("LoadEcho failed: %v", err)
+	}
+	if src.File != path {
+		t.Errorf("Expected the file from ECHO_CONFIG, got %q", src.File)
+	}
+
+	// Only in the file
+	if cfg.Listen.HTTP != ":9000" || cfg.Worker.Address != "worker.internal:6000" || cfg.Log.Timestamps {
+		t.Errorf("File settings not applied: %+v", cfg)
+	}
+	// File, then env
+	if cfg.Database.DSN != "/env/echo.db" {
+		t.Errorf("Expected env to override the file, got dsn %q", cfg.Database.DSN)
+	}
+	// File, env, then flags
+	if time.Duration(cfg.Worker.Timeout) != 9*time.Second || cfg.Worker.ConfirmCommit {
+		t.Errorf("Expected flags to override env and file, got timeout %v confirm_commit %v", cfg.Worker.Timeout, cfg.Worker.ConfirmCommit)
+	}
+	// Untouched
+	if cfg.TLS.ServerName != "localhost" || time.Duration(cfg.Worker.Keepalive.Time) != 30*time.Second {
+		t.Errorf("Defaults lost: %+v", cfg)
+	}
+}
+
+func TestLoadConfigFlagOverridesEnv(t *testing.T) {
+	fromEnv := writeFile(t, "database:\n  dsn: env.db\n")
+	fromFlag := writeFile(t, "database:\n  dsn: flag.db\n")
+	cfg, src, err := LoadWorker([]string{"-config", fromFlag}, env(map[string]string{"WORKER_CONFIG": fromEnv}))
+	if err != nil {
+		t.Fatalf("LoadWorker failed: %v", err)
+	}
+	if src.File != fromFlag || cfg.Database.DSN != "flag.db" {
+		t.Errorf("Expected -config to win over WORKER_CONFIG, got %q with dsn %q", src.File, cfg.Database.DSN)
+	}
+}
+
+func TestLoadPortShorthands(t *testing.T) {
+	echoCfg, _, err := LoadEcho([]string{"-http-port", "18080", "-grpc-port", "15051"}, env(nil))
+	if err != nil {
+		t.Fatalf("LoadEcho failed: %v", err)
+	}
+	if echoCfg.Listen.HTTP != ":18080" || echoCfg.Worker.Address != "localhost:15051" {
+		t.Errorf("Unexpected addresses %q and %q", echoCfg.Listen.HTTP, echoCfg.Worker.Address)
+	}
+
+	workerCfg, _, err := LoadWorker([]string{"-port", "15051", "-http-port", "18081"}, env(nil))
+	if err != nil {
+		t.Fatalf("LoadWorker failed: %v", err)
+	}
+	if workerCfg.Listen.GRPC != ":15051" || workerCfg.Listen.HTTP != ":18081" {
+		t.Errorf("Unexpected addresses %q and %q", workerCfg.Listen.GRPC, workerCfg.Listen.HTTP)
+	}
+
+	workerCfg, _, err = LoadWorker([]string{"-http-addr", ":8081", "-http-port", "0"}, env(nil))
+	if err != nil {
+		t.Fatalf("LoadWorker failed: %v", err)
+	}
+	if workerCfg.Listen.HTTP != "" {
+		t.Errorf("-http-port 0 should disable the gateway, got %q", workerCfg.Listen.HTTP)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"unknown key in file", []string{"-config", writeFile(t, "worker:\n  adress: x\n")}, nil, "adress"},
+		{"bad duration in file", []string{"-config", writeFile(t, "worker:\n  timeout: soon\n")}, nil, "soon"},
+		{"missing file", []string{"-config", "/does/not/exist.yaml"}, nil, "failed to read config file"},
+		{"bad env value", nil, map[string]string{"ECHO_WORKER_TIMEOUT": "soon"}, "ECHO_WORKER_TIMEOUT"},
+		{"bad port", []string{"-http-port", "http"}, nil, "invalid port"},
+		{"unknown flag", []string{"-no-such-flag"}, nil, "no-such-flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := load("echo", "ECHO_", DefaultEcho, (*Echo).register, tt.args, env(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLegacyFlagsKept(t *testing.T) {
+	fs := flag.NewFlagSet("echo", flag.ContinueOnError)
+	DefaultEcho().register(fs)
+	for _, name := range []string{"http-port", "grpc-port", "db", "worker-timeout", "confirm-commit", "keepalive-time"} {
+		if fs.Lookup(name) == nil {
+			t.Errorf("Flag -%s is gone; scripts and tests still pass it", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	echoTests := []struct {
+		name   string
+		modify func(c *Echo)
+		want   string
+	}{
+		{"bad listen address", func(c *Echo) { c.Listen.HTTP = "8080" }, "listen.http"},
+		{"no worker address", func(c *Echo) { c.Worker.Address = "" }, "worker.address"},
+		{"negative timeout", func(c *Echo) { c.Worker.Timeout = Duration(-time.Second) }, "worker.timeout"},
+		{"keepalive below minimum", func(c *Echo) { c.Worker.Keepalive.Time = Duration(time.Second) }, "worker.keepalive"},
+		{"no database", func(c *Echo) { c.Database.DSN = "" }, "database.dsn"},
+		{"partial tls", func(c *Echo) { c.TLS.Cert = "cert.pem" }, "tls"},
+	}
+	for _, tt := range echoTests {
+		t.Run("echo "+tt.name, func(t *testing.T) {
+			c := DefaultEcho()
+			tt.modify(c)
+			if err := c.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	workerTests := []struct {
+		name   string
+		modify func(c *Worker)
+		want   string
+	}{
+		{"bad gateway port", func(c *Worker) { c.Listen.HTTP = ":http" }, "listen.http"},
+		{"zero confirm timeout", func(c *Worker) { c.ConfirmTimeout = 0 }, "confirm_timeout"},
+		{"keepalive below minimum", func(c *Worker) { c.Keepalive.Time = Duration(time.Millisecond) }, "keepalive"},
+	}
+	for _, tt := range workerTests {
+		t.Run("worker "+tt.name, func(t *testing.T) {
+			c := DefaultWorker()
+			tt.modify(c)
+			if err := c.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	c := DefaultEcho()
+	c.Worker.Address, c.Database.DSN = "", ""
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "worker.address") || !strings.Contains(err.Error(), "database.dsn") {
+		t.Errorf("Expected both errors, got %v", err)
+	}
+}
+
+func TestPrintRoundTrips(t *testing.T) {
+	cfg := DefaultEcho()
+	cfg.Worker.Timeout = Duration(1500 * time.Millisecond)
+	cfg.TLS = ClientTLS{TLS: TLS{Cert: "c.pem", Key: "k.pem", CA: "ca.pem"}, ServerName: "worker"}
+
+	var out bytes.Buffer
+	if err := Print(&out, cfg); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "timeout: 1.5s") || !strings.Contains(out.String(), "cert: c.pem") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+
+	loaded, _, err := LoadEcho([]string{"-config", writeFile(t, out.String())}, env(nil))
+	if err != nil {
+		t.Fatalf("Printed config does not load: %v", err)
+	}
+	if *loaded != *cfg {
+		t.Errorf("Round trip changed the config:\n%+v\n%+v", cfg, loaded)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := DefaultEcho()
+	next := DefaultEcho()
+	next.Worker.Timeout = Duration(time.Second)
+	next.Log.File = "echo.log"
+	next.Worker.Address = "elsewhere:50051"
+	next.TLS.CA = "ca.pem"
+
+	reload, restart := old.Diff(next)
+	if !slices.Equal(reload, []string{"worker.timeout", "log.file"}) {
+		t.Errorf("Unexpected reloadable changes %v", reload)
+	}
+	if !slices.Equal(restart, []string{"worker.address", "tls.ca"}) {
+		t.Errorf("Unexpected restart changes %v", restart)
+	}
+
+	oldWorker, nextWorker := DefaultWorker(), DefaultWorker()
+	nextWorker.Auth.Policy = "policy.json"
+	nextWorker.Listen.GRPC = ":6000"
+	reload, restart = oldWorker.Diff(nextWorker)
+	if !slices.Equal(reload, []string{"auth.policy"}) || !slices.Equal(restart, []string{"listen.grpc"}) {
+		t.Errorf("Unexpected worker changes %v / %v", reload, restart)
+	}
+}
+
+func TestLocalTarget(t *testing.T) {
+	for addr, want := range map[string]string{
+		":8080":         "localhost:8080",
+		"0.0.0.0:8080":  "localhost:8080",
+		"[::]:8080":     "localhost:8080",
+		"10.0.0.1:8080": "10.0.0.1:8080",
+	} {
+		if got := LocalTarget(addr); got != want {
+			t.Errorf("LocalTarget(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestLogOutputReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "echo.log")
+	var out LogOutput
+	defer out.Close()
+
+	if err := out.Apply(Log{File: path}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	log.Print("before rotation")
+
+	// Rotate: move the file away, then reopen on the next Apply
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if err := out.Apply(Log{File: path}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	log.Print("after rotation")
+	out.Close()
+
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if string(rotated) != "before rotation\n" || string(current) != "after rotation\n" {
+		t.Errorf("Unexpected log contents %q and %q", rotated, current)
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"context_cancellation/internal/echo"
+	"context_cancellation/internal/tlsconfig"
+)
+
+// Echo is the echo server's configuration
+type Echo struct {
+	Listen    EchoListen   `yaml:"listen"`
+	Worker    WorkerTarget `yaml:"worker"`
+	Database  Database     `yaml:"database"`
+	TLS       ClientTLS    `yaml:"tls"`
+	Auth      EchoAuth     `yaml:"auth"`
+	RateLimit RateLimit    `yaml:"rate_limit"`
+	Log       Log          `yaml:"log"`
+}
+
+type EchoListen struct {
+	HTTP string `yaml:"http"`
+	// Admin serves the probes and the in-flight request list; empty disables it
+	Admin string `yaml:"admin"`
+}
+
+// WorkerTarget is how echo reaches the worker
+type WorkerTarget struct {
+	// Address is a gRPC target, e.g. localhost:50051 or dns:///worker:50051
+	Address       string          `yaml:"address"`
+	Timeout       Duration        `yaml:"timeout"`
+	ConfirmCommit bool            `yaml:"confirm_commit"`
+	Keepalive     ClientKeepalive `yaml:"keepalive"`
+}
+
+type ClientKeepalive struct {
+	Time                Duration `yaml:"time"`
+	Timeout             Duration `yaml:"timeout"`
+	PermitWithoutStream bool     `yaml:"permit_without_stream"`
+}
+
+// Config converts to the settings echo dials with
+func (k ClientKeepalive) Config() echo.KeepaliveConfig {
+	return echo.KeepaliveConfig{
+		Time:                time.Duration(k.Time),
+		Timeout:             time.Duration(k.Timeout),
+		PermitWithoutStream: k.PermitWithoutStream,
+	}
+}
+
+type Database struct {
+	// DSN is the SQLite file name or URI
+	DSN string `yaml:"dsn"`
+}
+
+// ClientTLS is TLS for a client, which also checks the server's name
+type ClientTLS struct {
+	TLS        `yaml:",inline"`
+	ServerName string `yaml:"server_name"`
+}
+
+// Files converts to the files tlsconfig loads
+func (t TLS) Files() tlsconfig.Files {
+	return tlsconfig.Files{CertFile: t.Cert, KeyFile: t.Key, CAFile: t.CA}
+}
+
+type EchoAuth struct {
+	// SecretFile holds the HMAC secret for bearer tokens; empty disables authentication
+	SecretFile string `yaml:"secret_file"`
+	AuditLog   string `yaml:"audit_log"`
+}
+
+type RateLimit struct {
+	// Config is the JSON rate limit file; empty disables rate limiting
+	Config string `yaml:"config"`
+}
+
+// DefaultEcho is the configuration echo runs with when nothing is set
+func DefaultEcho() *Echo {
+	ka := echo.DefaultKeepalive()
+	return &Echo{
+		Listen: EchoListen{HTTP: ":8080"},
+		Worker: WorkerTarget{
+			Address: "localhost:50051",
+			Keepalive: ClientKeepalive{
+				Time:                Duration(ka.Time),
+				Timeout:             Duration(ka.Timeout),
+				PermitWithoutStream: ka.PermitWithoutStream,
+			},
+		},
+		Database: Database{DSN: "./test_echo.db"},
+		TLS:      ClientTLS{ServerName: "localhost"},
+		Log:      Log{Timestamps: true},
+	}
+}
+
+func (c *Echo) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen.HTTP, "http-addr", c.Listen.HTTP, "HTTP listen address")
+	fs.Func("http-port", "HTTP port on all interfaces (shorthand for -http-addr=:PORT)", portFlag(&c.Listen.HTTP, ""))
+	fs.StringVar(&c.Listen.Admin, "admin-addr", c.Listen.Admin, "Admin listen address for /healthz, /readyz and /admin/tasks (empty disables it)")
+	fs.StringVar(&c.Worker.Address, "worker-addr", c.Worker.Address, "gRPC target of the worker")
+	fs.Func("grpc-port", "Worker port on localhost (shorthand for -worker-addr=localhost:PORT)", portFlag(&c.Worker.Address, "localhost"))
+	fs.Var(&c.Worker.Timeout, "worker-timeout", "Give up on the worker after this long and answer 504 (0 waits as long as the client does)")
+	fs.BoolVar(&c.Worker.ConfirmCommit, "confirm-commit", c.Worker.ConfirmCommit, "Use DoWorkConfirmed: the worker commits only after echo confirms the client is still waiting")
+	fs.Var(&c.Worker.Keepalive.Time, "keepalive-time", "Ping the worker after this long without activity (minimum 10s)")
+	fs.Var(&c.Worker.Keepalive.Timeout, "keepalive-timeout", "Fail in-flight calls if a ping is not answered within this long")
+	fs.BoolVar(&c.Worker.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", c.Worker.Keepalive.PermitWithoutStream, "Keep pinging when no call is in flight")
+	fs.StringVar(&c.Database.DSN, "db", c.Database.DSN, "Database path")
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "Client certificate (PEM) presented to the worker")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "Client private key (PEM)")
+	fs.StringVar(&c.TLS.CA, "tls-ca", c.TLS.CA, "CA bundle (PEM) used to verify the worker certificate")
+	fs.StringVar(&c.TLS.ServerName, "tls-server-name", c.TLS.ServerName, "Name expected in the worker certificate")
+	fs.StringVar(&c.Auth.SecretFile, "auth-secret-file", c.Auth.SecretFile, "File with the HMAC secret for bearer tokens (empty disables authentication)")
+	fs.StringVar(&c.Auth.AuditLog, "audit-log", c.Auth.AuditLog, "File to append audit events to (default stderr)")
+	fs.StringVar(&c.RateLimit.Config, "rate-limit-config", c.RateLimit.Config, "JSON file with per-client and per-request_id rate limits (empty disables rate limiting)")
+	fs.StringVar(&c.Log.File, "log-file", c.Log.File, "File to append log lines to (default stderr)")
+	fs.BoolVar(&c.Log.Timestamps, "log-timestamps", c.Log.Timestamps, "Prefix log lines with the date and time")
+}
+
+// LoadEcho builds echo's configuration from the defaults, the config file,
+// ECHO_* environment variables and args. It does not validate the result.
+func LoadEcho(args []string, lookupEnv func(string) (string, bool)) (*Echo, Source, error) {
+	return load("echo", "ECHO_", DefaultEcho, (*Echo).register, args, lookupEnv)
+}
+
+// Validate reports every setting echo cannot start with
+func (c *Echo) Validate() error {
+	var errs []error
+	if err := checkAddr("listen.http", c.Listen.HTTP); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Listen.Admin != "" {
+		if err := checkAddr("listen.admin", c.Listen.Admin); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Worker.Address == "" {
+		errs = append(errs, errors.New("worker.address is required"))
+	}
+	if c.Worker.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("worker.timeout must not be negative, got %v", c.Worker.Timeout))
+	}
+	if err := c.Worker.Keepalive.Config().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("worker.keepalive: %v", err))
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+	if err := c.TLS.Files().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %v", err))
+	}
+	return errors.Join(errs...)
+}
+
+// echoReloadable are the settings echo applies on SIGHUP
+var echoReloadable = map[string]bool{
+	"worker.timeout":        true,
+	"worker.confirm_commit": true,
+	"log.file":              true,
+	"log.timestamps":        true,
+}
+
+// Diff lists the settings next changes, split into those echo applies on
+// SIGHUP and those that need a restart. The rate limit file's contents are
+// reloaded on every SIGHUP; only a different file needs a restart.
+func (c *Echo) Diff(next *Echo) (reload, restart []string) {
+	return diff(c, next, echoReloadable)
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// LogOutput points the standard logger at the configured destination.
+// Apply reopens the file every time, so a rotated log file is picked up on SIGHUP.
+type LogOutput struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Apply switches the standard logger to cfg, closing the previous file
+func (o *LogOutput) Apply(cfg Log) error {
+	var out io.Writer = os.Stderr
+	var file *os.File
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %v", err)
+		}
+		out, file = f, f
+	}
+
+	flags := 0
+	if cfg.Timestamps {
+		flags = log.LstdFlags
+	}
+	log.SetOutput(out)
+	log.SetFlags(flags)
+
+	o.mu.Lock()
+	old := o.file
+	o.file = file
+	o.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close closes the log file, if there is one
+func (o *LogOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	log.SetOutput(os.Stderr)
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
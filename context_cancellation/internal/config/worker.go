@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"context_cancellation/internal/worker"
+)
+
+// Worker is the worker server's configuration
+type Worker struct {
+	Listen         WorkerListen    `yaml:"listen"`
+	Database       Database        `yaml:"database"`
+	ConfirmTimeout Duration        `yaml:"confirm_timeout"`
+	Keepalive      ServerKeepalive `yaml:"keepalive"`
+	TLS            TLS             `yaml:"tls"`
+	Auth           WorkerAuth      `yaml:"auth"`
+	Log            Log             `yaml:"log"`
+}
+
+type WorkerListen struct {
+	GRPC string `yaml:"grpc"`
+	// HTTP is the HTTP/JSON gateway's address; empty disables the gateway
+	HTTP string `yaml:"http"`
+	// Admin serves the probes and the in-flight task list; empty disables it
+	Admin string `yaml:"admin"`
+}
+
+type ServerKeepalive struct {
+	Time                Duration `yaml:"time"`
+	Timeout             Duration `yaml:"timeout"`
+	MinTime             Duration `yaml:"min_time"`
+	PermitWithoutStream bool     `yaml:"permit_without_stream"`
+}
+
+// Config converts to the settings the worker serves with
+func (k ServerKeepalive) Config() worker.KeepaliveConfig {
+	return worker.KeepaliveConfig{
+		Time:                time.Duration(k.Time),
+		Timeout:             time.Duration(k.Timeout),
+		MinTime:             time.Duration(k.MinTime),
+		PermitWithoutStream: k.PermitWithoutStream,
+	}
+}
+
+type WorkerAuth struct {
+	// Policy is the JSON caller policy; empty allows everything
+	Policy   string `yaml:"policy"`
+	AuditLog string `yaml:"audit_log"`
+}
+
+// DefaultWorker is the configuration the worker runs with when nothing is set
+func DefaultWorker() *Worker {
+	ka := worker.DefaultKeepalive()
+	return &Worker{
+		Listen:         WorkerListen{GRPC: ":50051"},
+		Database:       Database{DSN: "./test_worker.db"},
+		ConfirmTimeout: Duration(time.Second),
+		Keepalive: ServerKeepalive{
+			Time:                Duration(ka.Time),
+			Timeout:             Duration(ka.Timeout),
+			MinTime:             Duration(ka.MinTime),
+			PermitWithoutStream: ka.PermitWithoutStream,
+		},
+		Log: Log{Timestamps: true},
+	}
+}
+
+func (c *Worker) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Listen.GRPC, "grpc-addr", c.Listen.GRPC, "gRPC listen address")
+	fs.Func("port", "gRPC port on all interfaces (shorthand for -grpc-addr=:PORT)", portFlag(&c.Listen.GRPC, ""))
+	fs.StringVar(&c.Listen.HTTP, "http-addr", c.Listen.HTTP, "HTTP/JSON gateway listen address (empty disables the gateway)")
+	fs.Func("http-port", "HTTP/JSON gateway port on all interfaces, 0 disables the gateway (shorthand for -http-addr)", func(s string) error {
+		if s == "0" {
+			c.Listen.HTTP = ""
+			return nil
+		}
+		return portFlag(&c.Listen.HTTP, "")(s)
+	})
+	fs.StringVar(&c.Listen.Admin, "admin-addr", c.Listen.Admin, "Admin listen address for /healthz, /readyz and /admin/tasks (empty disables it)")
+	fs.StringVar(&c.Database.DSN, "db", c.Database.DSN, "Database path")
+	fs.Var(&c.ConfirmTimeout, "confirm-timeout", "How long DoWorkConfirmed waits for the caller's go-ahead before rolling back")
+	fs.Var(&c.Keepalive.Time, "keepalive-time", "Ping a client after this long without activity (minimum 1s)")
+	fs.Var(&c.Keepalive.Timeout, "keepalive-timeout", "Close the connection, cancelling its calls, if a ping is not answered within this long")
+	fs.Var(&c.Keepalive.MinTime, "keepalive-min-time", "Disconnect clients that ping more often than this")
+	fs.BoolVar(&c.Keepalive.PermitWithoutStream, "keepalive-permit-without-stream", c.Keepalive.PermitWithoutStream, "Allow client pings when no call is in flight")
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "Server certificate (PEM) for mutual TLS")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "Server private key (PEM) for mutual TLS")
+	fs.StringVar(&c.TLS.CA, "tls-ca", c.TLS.CA, "CA bundle (PEM) used to verify client certificates")
+	fs.StringVar(&c.Auth.Policy, "auth-policy", c.Auth.Policy, "JSON policy of which callers may submit which task_id prefixes (empty allows everything)")
+	fs.StringVar(&c.Auth.AuditLog, "audit-log", c.Auth.AuditLog, "File to append audit events to (default stderr)")
+	fs.StringVar(&c.Log.File, "log-file", c.Log.File, "File to append log lines to (default stderr)")
+	fs.BoolVar(&c.Log.Timestamps, "log-timestamps", c.Log.Timestamps, "Prefix log lines with the date and time")
+}
+
+// LoadWorker builds the worker's configuration from the defaults, the config
+// file, WORKER_* environment variables and args. It does not validate the result.
+func LoadWorker(args []string, lookupEnv func(string) (string, bool)) (*Worker, Source, error) {
+	return load("worker", "WORKER_", DefaultWorker, (*Worker).register, args, lookupEnv)
+}
+
+// Validate reports every setting the worker cannot start with
+func (c *Worker) Validate() error {
+	var errs []error
+	if err := checkAddr("listen.grpc", c.Listen.GRPC); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Listen.HTTP != "" {
+		if err := checkAddr("listen.http", c.Listen.HTTP); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Listen.Admin != "" {
+		if err := checkAddr("listen.admin", c.Listen.Admin); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+	if c.ConfirmTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("confirm_timeout must be positive, got %v", c.ConfirmTimeout))
+	}
+	if err := c.Keepalive.Config().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("keepalive: %v", err))
+	}
+	if err := c.TLS.Files().Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("tls: %v", err))
+	}
+	return errors.Join(errs...)
+}
+
+// workerReloadable are the settings the worker applies on SIGHUP
+var workerReloadable = map[string]bool{
+	"confirm_timeout": true,
+	"auth.policy":     true,
+	"log.file":        true,
+	"log.timestamps":  true,
+}
+
+// Diff lists the settings next changes, split into those the worker applies
+// on SIGHUP and those that need a restart. The policy file's contents are
+// reloaded on every SIGHUP.
+func (c *Worker) Diff(next *Worker) (reload, restart []string) {
+	return diff(c, next, workerReloadable)
+}
@@ -0,0 +1,290 @@
+package echo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeText = "text/plain"
+
+	maxRequestBodyBytes = 1 << 20
+	maxRequestIDLength  = 128
+	maxMessageLength    = 4096
+)
+
+// echoRequest is the JSON body accepted by POST /echo
+type echoRequest struct {
+	RequestID string `json:"request_id"`
+	Message   string `json:"message"`
+}
+
+// echoResponse is the JSON body returned by /echo
+type echoResponse struct {
+	RequestID     string              `json:"request_id"`
+	Message       string              `json:"message"`
+	WorkerMessage string              `json:"worker_message,omitempty"`
+	Timings       echoTimings         `json:"timings"`
+	Transactions  transactionOutcomes `json:"transactions"`
+}
+
+// echoTimings reports how long each step of the request took, in milliseconds
+type echoTimings struct {
+	InsertMs float64 `json:"insert_ms"`
+	WorkerMs float64 `json:"worker_ms"`
+	CommitMs float64 `json:"commit_ms"`
+	TotalMs  float64 `json:"total_ms"`
+}
+
+// transactionOutcomes reports what happened to the transaction on each side
+type transactionOutcomes struct {
+	Echo   string `json:"echo"`
+	Worker string `json:"worker"`
+}
+
+// Transaction outcomes reported in responses
+const (
+	txCommitted  = "committed"
+	txRolledBack = "rolled_back"
+	txNotStarted = "not_started"
+	txUnknown    = "unknown"
+)
+
+// apiError is the structured error body returned for every failed request
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code         string               `json:"code"`
+	Message      string               `json:"message"`
+	RequestID    string               `json:"request_id,omitempty"`
+	Violations   []fieldViolation     `json:"violations,omitempty"`
+	Transactions *transactionOutcomes `json:"transactions,omitempty"`
+}
+
+// fieldViolation describes a single invalid field in the request
+type fieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// requestError is returned by parseEchoRequest for input the client must fix
+type requestError struct {
+	status     int
+	code       string
+	message    string
+	violations []fieldViolation
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+func invalidArgument(violations ...fieldViolation) *requestError {
+	return &requestError{
+		status:     http.StatusBadRequest,
+		code:       "invalid_argument",
+		message:    "request has invalid fields",
+		violations: violations,
+	}
+}
+
+// parseEchoRequest reads the request from the query string (GET) or a JSON body (POST).
+// A missing request_id is left empty for the handler to generate.
+func parseEchoRequest(r *http.Request) (echoRequest, error) {
+	var req echoRequest
+
+	switch r.Method {
+	case http.MethodGet:
+		req.RequestID = r.URL.Query().Get("request_id")
+		req.Message = r.URL.Query().Get("message")
+
+	case http.MethodPost:
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != contentTypeJSON {
+			return req, &requestError{
+				status:  http.StatusUnsupportedMediaType,
+				code:    "unsupported_media_type",
+				message: "request body must be application/json",
+			}
+		}
+
+		dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBodyBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			return req, &requestError{
+				status:  http.StatusBadRequest,
+				code:    "malformed_body",
+				message: describeDecodeError(err),
+			}
+		}
+		if dec.More() {
+			return req, &requestError{
+				status:  http.StatusBadRequest,
+				code:    "malformed_body",
+				message: "request body must contain a single JSON object",
+			}
+		}
+
+	default:
+		return req, &requestError{
+			status:  http.StatusMethodNotAllowed,
+			code:    "method_not_allowed",
+			message: fmt.Sprintf("method %s is not allowed, use GET or POST", r.Method),
+		}
+	}
+
+	var violations []fieldViolation
+	if len(req.RequestID) > maxRequestIDLength {
+		violations = append(violations, fieldViolation{"request_id", fmt.Sprintf("must be at most %d characters", maxRequestIDLength)})
+	} else if !isPrintableASCII(req.RequestID) {
+		// gRPC refuses any other metadata value, so the worker call would fail
+		violations = append(violations, fieldViolation{"request_id", "must be printable ASCII"})
+	}
+
+	if req.Message == "" {
+		req.Message = "Hello"
+	} else if len(req.Message) > maxMessageLength {
+		violations = append(violations, fieldViolation{"message", fmt.Sprintf("must be at most %d bytes", maxMessageLength)})
+	}
+
+	if len(violations) > 0 {
+		return req, invalidArgument(violations...)
+	}
+	return req, nil
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// describeDecodeError turns encoding/json errors into messages a client can act on
+func describeDecodeError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("field %q must be a %s", typeErr.Field, typeErr.Type)
+	case errors.As(err, &maxBytesErr):
+		return fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit)
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		return strings.TrimPrefix(err.Error(), "json: ")
+	default:
+		return "request body must be a JSON object"
+	}
+}
+
+// responseContentType picks the response format for r. Without a preference
+// in Accept, GET gets plain text, as /echo has always answered, and POST, which
+// only JSON clients send, gets JSON.
+func responseContentType(r *http.Request) string {
+	fallback := contentTypeText
+	if r.Method == http.MethodPost {
+		fallback = contentTypeJSON
+	}
+	return negotiateContentType(r.Header.Get("Accept"), fallback)
+}
+
+// negotiateContentType picks the response format from the Accept header, or
+// fallback when it names neither format. "*/*", which curl sends, is no
+// preference either.
+func negotiateContentType(accept, fallback string) string {
+	best, bestQ, bestRank := "", 0.0, 0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		// rank orders candidates of equal weight: a named type before a
+		// wildcard, and JSON before text
+		var candidate string
+		var rank int
+		switch mediaType {
+		case contentTypeJSON:
+			candidate, rank = contentTypeJSON, 4
+		case contentTypeText:
+			candidate, rank = contentTypeText, 3
+		case "application/*":
+			candidate, rank = contentTypeJSON, 2
+		case "text/*":
+			candidate, rank = contentTypeText, 1
+		case "*/*":
+			candidate, rank = fallback, 0
+		default:
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && rank > bestRank) {
+			best, bestQ, bestRank = candidate, q, rank
+		}
+	}
+
+	if best == "" || bestQ == 0 {
+		return fallback
+	}
+	return best
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a structured error in the negotiated format
+func writeError(w http.ResponseWriter, r *http.Request, status int, body apiErrorBody) {
+	if responseContentType(r) == contentTypeText {
+		message := body.Message
+		for _, v := range body.Violations {
+			message += fmt.Sprintf("; %s %s", v.Field, v.Description)
+		}
+		http.Error(w, message, status)
+		return
+	}
+	writeJSON(w, status, apiError{Error: body})
+}
+
+// writeRequestError writes the error returned by parseEchoRequest
+func writeRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		writeError(w, r, http.StatusBadRequest, apiErrorBody{Code: "invalid_argument", Message: err.Error()})
+		return
+	}
+	if reqErr.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", "GET, POST")
+	}
+	writeError(w, r, reqErr.status, apiErrorBody{
+		Code:       reqErr.code,
+		Message:    reqErr.message,
+		Violations: reqErr.violations,
+	})
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,398 @@
+package echo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/clock"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeWorkerClient answers DoWork without a real worker process
+type fakeWorkerClient struct {
+	workerpb.WorkerServiceClient // only DoWork is implemented
+	err                          error
+}
+
+func (f *fakeWorkerClient) DoWork(ctx context.Context, in *workerpb.WorkRequest, opts ...grpc.CallOption) (*workerpb.WorkResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &workerpb.WorkResponse{Success: true, Message: "Work completed for task " + in.TaskId}, nil
+}
+
+func setupEchoDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "echo.db"))
+	if err != nil {
+		t.Fatalf("Failed to init echo database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestEchoHandlerJSON(t *testing.T) {
+	db := setupEchoDatabase(t)
+	handler := Handler(db, &fakeWorkerClient{})
+
+	req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"request_id":"json-001","message":"hi"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != contentTypeJSON {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+
+	var resp echoResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.RequestID != "json-001" || resp.Message != "hi" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if resp.WorkerMessage != "Work completed for task json-001" {
+		t.Errorf("Unexpected worker message: %q", resp.WorkerMessage)
+	}
+	if resp.Transactions != (transactionOutcomes{Echo: txCommitted, Worker: txCommitted}) {
+		t.Errorf("Unexpected transactions: %+v", resp.Transactions)
+	}
+}
+
+// newJSONRequest is a GET of target that asks for a JSON response
+func newJSONRequest(target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Accept", contentTypeJSON)
+	return req
+}
+
+func TestEchoHandlerGeneratedRequestID(t *testing.T) {
+	db := setupEchoDatabase(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	handler := Handler(db, &fakeWorkerClient{}, WithClock(fake))
+
+	// Both requests arrive in the same second
+	for _, want := range []string{"req-1735689600-1", "req-1735689600-2"} {
+		rec := httptest.NewRecorder()
+		handler(rec, newJSONRequest("/echo"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp echoResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.RequestID != want {
+			t.Errorf("Expected request_id %q, got %q", want, resp.RequestID)
+		}
+	}
+}
+
+func TestEchoHandlerPlainText(t *testing.T) {
+	db := setupEchoDatabase(t)
+	handler := Handler(db, &fakeWorkerClient{})
+
+	req := httptest.NewRequest(http.MethodGet, "/echo?request_id=text-001&message=hi", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Body.String(); got != "Success: Work completed for task text-001\n" {
+		t.Errorf("Unexpected body: %q", got)
+	}
+}
+
+// TestEchoHandlerDefaultsToPlainText checks that a GET without a preference,
+// as curl sends it, is answered as before JSON responses existed, whatever its
+// request_id
+func TestEchoHandlerDefaultsToPlainText(t *testing.T) {
+	db := setupEchoDatabase(t)
+	handler := Handler(db, &fakeWorkerClient{})
+
+	for _, accept := range []string{"", "*/*"} {
+		req := httptest.NewRequest(http.MethodGet, "/echo?request_id=order+42/retry&message=hi", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept %q: expected 200, got %d: %s", accept, rec.Code, rec.Body.String())
+		}
+		if got := rec.Body.String(); got != "Success: Work completed for task order 42/retry\n" {
+			t.Errorf("Accept %q: unexpected body: %q", accept, got)
+		}
+	}
+}
+
+func TestEchoHandlerErrors(t *testing.T) {
+	db := setupEchoDatabase(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		worker      *fakeWorkerClient
+		wantStatus  int
+		wantCode    string
+		wantField   string
+	}{
+		{"malformed JSON", http.MethodPost, "application/json", `{"request_id":`, &fakeWorkerClient{}, http.StatusBadRequest, "malformed_body", ""},
+		{"unknown field", http.MethodPost, "application/json", `{"reqid":"x"}`, &fakeWorkerClient{}, http.StatusBadRequest, "malformed_body", ""},
+		{"wrong type", http.MethodPost, "application/json", `{"message":42}`, &fakeWorkerClient{}, http.StatusBadRequest, "malformed_body", ""},
+		{"invalid request_id", http.MethodPost, "application/json", `{"request_id":"bad\nid"}`, &fakeWorkerClient{}, http.StatusBadRequest, "invalid_argument", "request_id"},
+		{"wrong content type", http.MethodPost, "text/plain", `hello`, &fakeWorkerClient{}, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"wrong method", http.MethodDelete, "", ``, &fakeWorkerClient{}, http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{"worker cancelled", http.MethodPost, "application/json", `{"request_id":"w-1"}`, &fakeWorkerClient{err: status.Error(codes.Canceled, "work cancelled")}, http.StatusInternalServerError, "worker_failed", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/echo", strings.NewReader(tt.body))
+			req.Header.Set("Accept", contentTypeJSON)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			Handler(db, tt.worker)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+
+			var resp apiError
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Error body is not JSON: %v (%s)", err, rec.Body.String())
+			}
+			if resp.Error.Code != tt.wantCode {
+				t.Errorf("Expected code %q, got %q", tt.wantCode, resp.Error.Code)
+			}
+			if tt.wantField != "" && (len(resp.Error.Violations) != 1 || resp.Error.Violations[0].Field != tt.wantField) {
+				t.Errorf("Expected violation on %q, got %+v", tt.wantField, resp.Error.Violations)
+			}
+		})
+	}
+
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("Failed requests must not leave echo records, found %d", n)
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept   string
+		fallback string
+		want     string
+	}{
+		{"", contentTypeText, contentTypeText},
+		{"", contentTypeJSON, contentTypeJSON},
+		{"*/*", contentTypeText, contentTypeText},
+		{"*/*", contentTypeJSON, contentTypeJSON},
+		{"application/json", contentTypeText, contentTypeJSON},
+		{"application/json, */*", contentTypeText, contentTypeJSON},
+		{"text/plain", contentTypeJSON, contentTypeText},
+		{"text/plain, */*", contentTypeJSON, contentTypeText},
+		{"text/*", contentTypeJSON, contentTypeText},
+		{"text/plain, application/json", contentTypeText, contentTypeJSON},
+		{"application/json;q=0.5, text/plain", contentTypeJSON, contentTypeText},
+		{"application/json;q=0", contentTypeText, contentTypeText},
+		{"text/html", contentTypeText, contentTypeText},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateContentType(tt.accept, tt.fallback); got != tt.want {
+			t.Errorf("negotiateContentType(%q, %q) = %q, want %q", tt.accept, tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM echo_requests").Scan(&n); err != nil {
+		t.Fatalf("Failed to count echo records: %v", err)
+	}
+	return n
+}
+
+// blockingWorkerClient answers DoWork only once the call's context is done
+type blockingWorkerClient struct {
+	workerpb.WorkerServiceClient // only DoWork is implemented
+}
+
+func (blockingWorkerClient) DoWork(ctx context.Context, in *workerpb.WorkRequest, opts ...grpc.CallOption) (*workerpb.WorkResponse, error) {
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func TestEchoHandlerWorkerTimeout(t *testing.T) {
+	db := setupEchoDatabase(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	handler := Handler(db, blockingWorkerClient{}, WithClock(fake), WithWorkerTimeout(2*time.Second))
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=slow-001"))
+		close(done)
+	}()
+
+	// Wait for the handler to arm its timeout, then step right up to it
+	fake.BlockUntil(1)
+	fake.Advance(1999 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatalf("Handler gave up before the timeout: %s", rec.Body.String())
+	default:
+	}
+
+	fake.Advance(time.Millisecond)
+	<-done
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected 504, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error body is not JSON: %v", err)
+	}
+	if resp.Error.Code != "worker_timeout" || *resp.Error.Transactions != (transactionOutcomes{Echo: txRolledBack, Worker: txUnknown}) {
+		t.Errorf("Unexpected error: %+v", resp.Error)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("Echo transaction should have rolled back, found %d rows", n)
+	}
+}
+
+func TestEchoHandlerSettingsChange(t *testing.T) {
+	db := setupEchoDatabase(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	settings := &Settings{}
+	handler := Handler(db, blockingWorkerClient{}, WithClock(fake), WithSettings(settings))
+
+	// Without a worker timeout the request follows the client
+	ctx, cancel := context.WithCancel(t.Context())
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=slow-001").WithContext(ctx))
+		close(done)
+	}()
+	fake.Advance(time.Hour)
+	cancel()
+	<-done
+	if rec.Code == http.StatusGatewayTimeout {
+		t.Fatalf("No worker timeout was set, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A timeout set later applies to the next request
+	settings.SetWorkerTimeout(time.Second)
+	rec = httptest.NewRecorder()
+	done = make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=slow-002"))
+		close(done)
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	<-done
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("Expected 504 after the timeout was set, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestEchoHandlerCancelledByOperator(t *testing.T) {
+	db := setupEchoDatabase(t)
+	tracker := admin.NewTracker("[ECHO]")
+	handler := Handler(db, blockingWorkerClient{}, WithTracker(tracker))
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=stuck-001"))
+		close(done)
+	}()
+
+	for len(tracker.List()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := tracker.Cancel("stuck-001"); n != 1 {
+		t.Fatalf("Expected to cancel 1 request, cancelled %d", n)
+	}
+	<-done
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error body is not JSON: %v", err)
+	}
+	// The worker may have committed before the cancel reached it
+	if resp.Error.Code != "cancelled_by_operator" || *resp.Error.Transactions != (transactionOutcomes{Echo: txRolledBack, Worker: txUnknown}) {
+		t.Errorf("Unexpected error: %+v", resp.Error)
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("Echo transaction should have rolled back, found %d rows", n)
+	}
+}
+
+// committingWorkerClient commits, then waits for the call's context like a
+// worker whose answer has not arrived yet
+type committingWorkerClient struct {
+	workerpb.WorkerServiceClient // only DoWork is implemented
+	committed                    chan struct{}
+}
+
+func (c committingWorkerClient) DoWork(ctx context.Context, in *workerpb.WorkRequest, opts ...grpc.CallOption) (*workerpb.WorkResponse, error) {
+	close(c.committed)
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+// A client that goes away makes gRPC fail the call with Canceled too, but
+// that says nothing about the worker, which here has already committed
+func TestEchoHandlerClientGoneAfterWorkerCommitted(t *testing.T) {
+	db := setupEchoDatabase(t)
+	client := committingWorkerClient{committed: make(chan struct{})}
+	handler := Handler(db, client)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=gone-001").WithContext(ctx))
+		close(done)
+	}()
+	<-client.committed
+	cancel()
+	<-done
+
+	var resp apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error body is not JSON: %v (%s)", err, rec.Body.String())
+	}
+	if *resp.Error.Transactions != (transactionOutcomes{Echo: txRolledBack, Worker: txUnknown}) {
+		t.Errorf("Expected the worker outcome to be unknown, got %+v", *resp.Error.Transactions)
+	}
+}
@@ -0,0 +1,63 @@
+package echo
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"context_cancellation/internal/auth"
+)
+
+const callerContextKey contextKey = iota + 1
+
+// withCaller stores the authenticated caller so it can be recorded and forwarded to the worker
+func withCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerContextKey, caller)
+}
+
+func callerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerContextKey).(string)
+	return caller
+}
+
+// RequireBearerToken rejects requests without a valid "Authorization: Bearer" token.
+// The token subject becomes the caller identity for the rest of the request.
+func RequireBearerToken(verifier *auth.HMAC, auditor *auth.Auditor, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := auth.BearerToken(r.Header.Get("Authorization"))
+		if !ok {
+			rejectUnauthenticated(w, r, auditor, "missing bearer token")
+			return
+		}
+
+		claims, err := verifier.Verify(token, time.Now())
+		if err != nil {
+			reason := "invalid token"
+			if errors.Is(err, auth.ErrTokenExpired) {
+				reason = "token expired"
+			}
+			rejectUnauthenticated(w, r, auditor, reason)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withCaller(r.Context(), claims.Subject)))
+	})
+}
+
+func rejectUnauthenticated(w http.ResponseWriter, r *http.Request, auditor *auth.Auditor, reason string) {
+	log.Printf("[ECHO] Rejected unauthenticated request from %s: %s", r.RemoteAddr, reason)
+	auditor.Reject(auth.AuditEvent{
+		RequestID: r.URL.Query().Get("request_id"),
+		Target:    r.Method + " " + r.URL.Path,
+		Remote:    r.RemoteAddr,
+		Reason:    reason,
+	})
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="echo", error="invalid_token"`)
+	writeError(w, r, http.StatusUnauthorized, apiErrorBody{
+		Code:    "unauthenticated",
+		Message: reason,
+	})
+}
@@ -0,0 +1,89 @@
+package echo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/auth"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+)
+
+// callerRecordingClient remembers the caller seen by DoWork
+type callerRecordingClient struct {
+	workerpb.WorkerServiceClient // only DoWork is implemented
+	caller                       string
+}
+
+func (c *callerRecordingClient) DoWork(ctx context.Context, in *workerpb.WorkRequest, opts ...grpc.CallOption) (*workerpb.WorkResponse, error) {
+	c.caller = callerFromContext(ctx)
+	return &workerpb.WorkResponse{Success: true, Message: "done"}, nil
+}
+
+func TestRequireBearerToken(t *testing.T) {
+	db := setupEchoDatabase(t)
+
+	signer, err := auth.NewHMAC([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("NewHMAC failed: %v", err)
+	}
+	var audit bytes.Buffer
+	worker := &callerRecordingClient{}
+	handler := RequireBearerToken(signer, auth.NewAuditor(&audit, "echo"), Handler(db, worker))
+
+	valid, _ := signer.Sign(auth.Claims{Subject: "alice", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	expired, _ := signer.Sign(auth.Claims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+
+	for name, header := range map[string]string{
+		"missing token": "",
+		"expired token": "Bearer " + expired,
+		"garbage token": "Bearer nope",
+	} {
+		req := newJSONRequest("/echo?request_id=auth-001")
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, rec.Code)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", name)
+		}
+		var resp apiError
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Error.Code != "unauthenticated" {
+			t.Errorf("%s: expected structured unauthenticated error, got %s", name, rec.Body.String())
+		}
+	}
+	if n := bytes.Count(audit.Bytes(), []byte("\n")); n != 3 {
+		t.Errorf("Expected 3 audit events, got %d:\n%s", n, audit.String())
+	}
+
+	req := newJSONRequest("/echo?request_id=auth-002")
+	req.Header.Set("Authorization", "Bearer "+valid)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with a valid token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if worker.caller != "alice" {
+		t.Errorf("Expected caller alice to reach the worker client, got %q", worker.caller)
+	}
+
+	var caller string
+	if err := db.QueryRow("SELECT caller FROM echo_requests WHERE request_id = ?", "auth-002").Scan(&caller); err != nil {
+		t.Fatalf("Failed to read echo record: %v", err)
+	}
+	if caller != "alice" {
+		t.Errorf("Expected caller alice to be stored, got %q", caller)
+	}
+}
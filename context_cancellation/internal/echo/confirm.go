@@ -0,0 +1,91 @@
+package echo
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"context_cancellation/internal/clock"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// commitResultGrace is how much longer than the worker timeout echo waits for
+// the worker's result once it has given the go-ahead
+const commitResultGrace = 5 * time.Second
+
+// callWorkerConfirmed runs req over DoWorkConfirmed and gives the worker its
+// go-ahead only if ctx is still live when the worker is ready to commit.
+//
+// Until then cancelling ctx cancels the call, and the worker, which never
+// commits without a go-ahead, rolls back. After the go-ahead the call no
+// longer follows ctx: the worker is committing, so echo waits for the result
+// and commits too. That wait lasts until deadline (the end of the worker
+// timeout, zero for none) plus commitResultGrace on clk; a result that has
+// not arrived by then fails the call with DeadlineExceeded and the worker's
+// outcome is unknown. confirmed reports whether the go-ahead was sent.
+func callWorkerConfirmed(ctx context.Context, clk clock.Clock, deadline time.Time, client workerpb.WorkerServiceClient, req *workerpb.WorkRequest) (resp *workerpb.WorkResponse, confirmed bool, err error) {
+	streamCtx, cancelStream := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelStream()
+	stopFollowing := context.AfterFunc(ctx, cancelStream)
+	defer stopFollowing()
+
+	stream, err := client.DoWorkConfirmed(streamCtx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := stream.Send(&workerpb.ConfirmedWorkRequest{
+		Msg: &workerpb.ConfirmedWorkRequest_Work{Work: req},
+	}); err != nil && err != io.EOF {
+		// On io.EOF the stream has failed and Recv returns the real error
+		return nil, false, err
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		return nil, false, err
+	}
+	ready := msg.GetReady()
+	if ready == nil {
+		return nil, false, status.Errorf(codes.Internal, "worker sent %T before asking to commit", msg.GetMsg())
+	}
+
+	// The commit boundary: either ctx is already done and has cancelled the
+	// stream, or it no longer can
+	if !stopFollowing() {
+		log.Printf("[ECHO] Not confirming commit for task_id=%s: %v", req.TaskId, context.Cause(ctx))
+		return nil, false, status.FromContextError(ctx.Err()).Err()
+	}
+	log.Printf("[ECHO] Confirming commit for task_id=%s (worker waits %dms)", req.TaskId, ready.ConfirmTimeoutMs)
+	wait := commitResultGrace
+	if !deadline.IsZero() {
+		wait += max(deadline.Sub(clk.Now()), 0)
+	}
+	waitCtx, cancelWait := clk.WithTimeout(context.Background(), wait)
+	defer cancelWait()
+	stopWaiting := context.AfterFunc(waitCtx, cancelStream)
+	defer stopWaiting()
+
+	if err := stream.Send(&workerpb.ConfirmedWorkRequest{
+		Msg: &workerpb.ConfirmedWorkRequest_Decision{Decision: &workerpb.CommitDecision{Commit: true}},
+	}); err != nil && err != io.EOF {
+		return nil, true, err
+	}
+
+	msg, err = stream.Recv()
+	if err != nil {
+		if waitCtx.Err() != nil {
+			log.Printf("[ECHO] ⚠️  No result for task_id=%s within %v of the go-ahead", req.TaskId, wait)
+			return nil, true, status.Errorf(codes.DeadlineExceeded, "worker did not report its commit within %v of the go-ahead", wait)
+		}
+		return nil, true, err
+	}
+	result := msg.GetResult()
+	if result == nil {
+		return nil, true, status.Errorf(codes.Internal, "worker sent %T instead of a result", msg.GetMsg())
+	}
+	return result, true, nil
+}
@@ -0,0 +1,206 @@
+package echo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/clock"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// confirmingWorkerClient plays the worker side of DoWorkConfirmed: it asks
+// for a go-ahead right away and commits only if it gets one. The hooks run at
+// the commit boundary, before echo sees ReadyToCommit and after it confirmed.
+// hangAfterConfirm loses the worker's result after the go-ahead.
+type confirmingWorkerClient struct {
+	workerpb.WorkerServiceClient // only DoWorkConfirmed is implemented
+	blockUntilDone               bool
+	hangAfterConfirm             bool
+	onReady                      func()
+	onConfirm                    func()
+	decisions                    []bool
+}
+
+func (c *confirmingWorkerClient) DoWorkConfirmed(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[workerpb.ConfirmedWorkRequest, workerpb.ConfirmedWorkResponse], error) {
+	return &fakeConfirmClientStream{client: c, ctx: ctx}, nil
+}
+
+type fakeConfirmClientStream struct {
+	grpc.ClientStream
+	client *confirmingWorkerClient
+	ctx    context.Context
+	taskID string
+}
+
+func (s *fakeConfirmClientStream) Send(msg *workerpb.ConfirmedWorkRequest) error {
+	if work := msg.GetWork(); work != nil {
+		s.taskID = work.TaskId
+		return nil
+	}
+	s.client.decisions = append(s.client.decisions, msg.GetDecision().GetCommit())
+	if s.client.onConfirm != nil {
+		s.client.onConfirm()
+	}
+	return nil
+}
+
+func (s *fakeConfirmClientStream) Recv() (*workerpb.ConfirmedWorkResponse, error) {
+	if s.client.blockUntilDone {
+		<-s.ctx.Done()
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+	if len(s.client.decisions) == 0 {
+		if s.client.onReady != nil {
+			s.client.onReady()
+		}
+		return &workerpb.ConfirmedWorkResponse{
+			Msg: &workerpb.ConfirmedWorkResponse_Ready{Ready: &workerpb.ReadyToCommit{TaskId: s.taskID, ConfirmTimeoutMs: 1000}},
+		}, nil
+	}
+	if s.client.hangAfterConfirm {
+		<-s.ctx.Done()
+	}
+	if err := s.ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return &workerpb.ConfirmedWorkResponse{
+		Msg: &workerpb.ConfirmedWorkResponse_Result{Result: &workerpb.WorkResponse{Success: true, Message: "Work completed for task " + s.taskID}},
+	}, nil
+}
+
+func TestEchoHandlerCommitConfirmation(t *testing.T) {
+	tests := []struct {
+		name          string
+		cancelAt      string
+		wantDecisions int
+		wantCode      int
+		wantRows      int
+		wantWorker    string
+	}{
+		{"confirmed", "", 1, http.StatusOK, 1, txCommitted},
+		{"client gone before the go-ahead", "ready", 0, http.StatusInternalServerError, 0, txRolledBack},
+		{"client gone right after the go-ahead", "confirm", 1, http.StatusOK, 1, txCommitted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupEchoDatabase(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			client := &confirmingWorkerClient{}
+			switch tt.cancelAt {
+			case "ready":
+				client.onReady = cancel
+			case "confirm":
+				client.onConfirm = cancel
+			}
+			handler := Handler(db, client, WithCommitConfirmation())
+
+			rec := httptest.NewRecorder()
+			handler(rec, newJSONRequest("/echo?request_id=confirm-001").WithContext(ctx))
+
+			if len(client.decisions) != tt.wantDecisions {
+				t.Errorf("Expected %d go-aheads, echo sent %v", tt.wantDecisions, client.decisions)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("Expected %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if n := countRows(t, db); n != tt.wantRows {
+				t.Errorf("Expected %d echo rows, found %d", tt.wantRows, n)
+			}
+
+			var body struct {
+				Transactions transactionOutcomes `json:"transactions"`
+				Error        apiErrorBody        `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Response is not JSON: %v", err)
+			}
+			worker := body.Transactions.Worker
+			if body.Error.Transactions != nil {
+				worker = body.Error.Transactions.Worker
+			}
+			if worker != tt.wantWorker {
+				t.Errorf("Expected worker outcome %q, got %q", tt.wantWorker, worker)
+			}
+		})
+	}
+}
+
+// Without a go-ahead the worker cannot have committed, so a timeout no
+// longer leaves its outcome unknown
+func TestEchoHandlerWorkerTimeoutWithConfirmation(t *testing.T) {
+	db := setupEchoDatabase(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := &confirmingWorkerClient{blockUntilDone: true}
+	handler := Handler(db, client, WithClock(fake), WithWorkerTimeout(2*time.Second), WithCommitConfirmation())
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=slow-002"))
+		close(done)
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(2 * time.Second)
+	<-done
+
+	var resp apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error body is not JSON: %v", err)
+	}
+	if rec.Code != http.StatusGatewayTimeout || *resp.Error.Transactions != (transactionOutcomes{Echo: txRolledBack, Worker: txRolledBack}) {
+		t.Errorf("Expected 504 with both rolled back, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("Echo transaction should have rolled back, found %d rows", n)
+	}
+}
+
+// Once the go-ahead is sent the worker may have committed, so a result that
+// never arrives must not hold the request forever nor be reported as a rollback
+func TestEchoHandlerResultLostAfterConfirmation(t *testing.T) {
+	db := setupEchoDatabase(t)
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := &confirmingWorkerClient{hangAfterConfirm: true}
+	handler := Handler(db, client, WithClock(fake), WithWorkerTimeout(2*time.Second), WithCommitConfirmation())
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler(rec, newJSONRequest("/echo?request_id=lost-001"))
+		close(done)
+	}()
+
+	// The worker timeout and the wait for the result are both armed
+	fake.BlockUntil(2)
+	fake.Advance(2*time.Second + commitResultGrace - time.Millisecond)
+	select {
+	case <-done:
+		t.Fatalf("Handler gave up on the result too early: %s", rec.Body.String())
+	default:
+	}
+	fake.Advance(time.Millisecond)
+	<-done
+
+	if len(client.decisions) != 1 {
+		t.Errorf("Expected one go-ahead, echo sent %v", client.decisions)
+	}
+	var resp apiError
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error body is not JSON: %v", err)
+	}
+	if rec.Code != http.StatusGatewayTimeout || *resp.Error.Transactions != (transactionOutcomes{Echo: txRolledBack, Worker: txUnknown}) {
+		t.Errorf("Expected 504 with the worker unknown, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := countRows(t, db); n != 0 {
+		t.Errorf("Echo transaction should have rolled back, found %d rows", n)
+	}
+}
@@ -0,0 +1,340 @@
+// Package echo is the HTTP echo server: /echo records each request in its own
+// SQLite transaction, calls the worker over gRPC and commits only if the
+// worker did. It also holds the echo server's API types, client interceptors,
+// authentication and rate limiting, so tests can run it in-process.
+package echo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/clock"
+	"context_cancellation/internal/sqliteutil"
+	"context_cancellation/workerpb"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// InitDatabase opens the echo server SQLite database and creates the echo_requests table
+func InitDatabase(dbPath string) (*sql.DB, error) {
+	echoDb, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open echo database: %v", err)
+	}
+
+	// Create echo_requests table
+	_, err = echoDb.Exec(`
+		CREATE TABLE IF NOT EXISTS echo_requests (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			request_id TEXT NOT NULL,
+			message TEXT NOT NULL,
+			caller TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		echoDb.Close()
+		return nil, fmt.Errorf("failed to create echo_requests table: %v", err)
+	}
+
+	// Databases created before authentication existed have no caller column
+	if err := sqliteutil.AddColumnIfMissing(echoDb, "echo_requests", "caller", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		echoDb.Close()
+		return nil, err
+	}
+
+	log.Println("[ECHO] Database initialized successfully")
+	return echoDb, nil
+}
+
+// Option configures Handler
+type Option func(*handlerConfig)
+
+type handlerConfig struct {
+	clock    clock.Clock
+	settings *Settings
+	tracker  *admin.Tracker
+}
+
+// Settings are the handler settings that can change while echo runs, e.g. on
+// SIGHUP. Each request reads them once when it starts. The zero value waits
+// for the worker as long as the client does and calls DoWork.
+type Settings struct {
+	workerTimeout atomic.Int64
+	confirmCommit atomic.Bool
+}
+
+// WorkerTimeout is how long a request waits for the worker (0 waits as long as the client does)
+func (s *Settings) WorkerTimeout() time.Duration {
+	return time.Duration(s.workerTimeout.Load())
+}
+
+func (s *Settings) SetWorkerTimeout(d time.Duration) {
+	s.workerTimeout.Store(int64(d))
+}
+
+// ConfirmCommit reports whether requests call the worker over DoWorkConfirmed
+func (s *Settings) ConfirmCommit() bool {
+	return s.confirmCommit.Load()
+}
+
+func (s *Settings) SetConfirmCommit(on bool) {
+	s.confirmCommit.Store(on)
+}
+
+// WithSettings reads the worker timeout and commit confirmation from s, so
+// they can be changed after the handler is built. WithWorkerTimeout and
+// WithCommitConfirmation given after it change s.
+func WithSettings(s *Settings) Option {
+	return func(cfg *handlerConfig) {
+		cfg.settings = s
+	}
+}
+
+// WithClock measures timings and the worker timeout on c instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(cfg *handlerConfig) {
+		cfg.clock = c
+	}
+}
+
+// WithWorkerTimeout gives up on the worker after d and answers 504 (0 waits as long as the client does)
+func WithWorkerTimeout(d time.Duration) Option {
+	return func(cfg *handlerConfig) {
+		cfg.settings.SetWorkerTimeout(d)
+	}
+}
+
+// WithCommitConfirmation calls the worker over DoWorkConfirmed, so the worker
+// commits only after echo confirms that the client is still waiting
+func WithCommitConfirmation() Option {
+	return func(cfg *handlerConfig) {
+		cfg.settings.SetConfirmCommit(true)
+	}
+}
+
+// WithTracker lists every request in t while it is handled, so an operator
+// can see it and cancel it
+func WithTracker(t *admin.Tracker) Option {
+	return func(cfg *handlerConfig) {
+		cfg.tracker = t
+	}
+}
+
+// Handler handles HTTP requests on /echo: it records the request in db and
+// calls the worker inside the same transaction, committing only if the worker did
+func Handler(echoDb *sql.DB, grpcClient workerpb.WorkerServiceClient, opts ...Option) http.HandlerFunc {
+	cfg := handlerConfig{clock: clock.Real(), settings: &Settings{}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	millisSince := func(start time.Time) float64 {
+		return millis(cfg.clock.Now().Sub(start))
+	}
+	// Generated request ids carry a sequence number so two requests in the
+	// same second still get distinct ids, which the tracker is keyed on
+	var generated atomic.Uint64
+	newRequestID := func(now time.Time) string {
+		return fmt.Sprintf("req-%d-%d", now.Unix(), generated.Add(1))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := cfg.clock.Now()
+		workerTimeout, confirmCommit := cfg.settings.WorkerTimeout(), cfg.settings.ConfirmCommit()
+
+		req, err := parseEchoRequest(r)
+		if err != nil {
+			log.Printf("[ECHO] Rejected HTTP request: %v", err)
+			writeRequestError(w, r, err)
+			return
+		}
+		requestID, message := req.RequestID, req.Message
+		if requestID == "" {
+			requestID = newRequestID(start)
+		}
+		caller := callerFromContext(r.Context())
+
+		log.Printf("[ECHO] Received HTTP request: request_id=%s, message=%s, caller=%s", requestID, message, caller)
+
+		ctx, done := cfg.tracker.Track(r.Context(), requestID, caller)
+		defer done()
+
+		// Start database transaction on echo server. With commit confirmation
+		// echo must still commit after confirming even if the client has gone,
+		// so the transaction does not follow the request context.
+		txCtx := ctx
+		if confirmCommit {
+			txCtx = context.WithoutCancel(ctx)
+		}
+		tx, err := echoDb.BeginTx(txCtx, nil)
+		if err != nil {
+			log.Printf("[ECHO] Failed to start transaction: %v", err)
+			writeError(w, r, http.StatusInternalServerError, apiErrorBody{
+				Code:         "internal",
+				Message:      "Failed to start transaction",
+				RequestID:    requestID,
+				Transactions: &transactionOutcomes{Echo: txNotStarted, Worker: txNotStarted},
+			})
+			return
+		}
+
+		// Ensure transaction is rolled back if we don't commit
+		defer func() {
+			if tx != nil {
+				log.Printf("[ECHO] Rolling back transaction for request_id=%s", requestID)
+				tx.Rollback()
+			}
+		}()
+
+		// Insert a record into echo database
+		var timings echoTimings
+		stepStart := cfg.clock.Now()
+		_, err = tx.ExecContext(ctx, "INSERT INTO echo_requests (request_id, message, caller) VALUES (?, ?, ?)", requestID, message, caller)
+		if err != nil {
+			log.Printf("[ECHO] Failed to insert request: %v", err)
+			writeError(w, r, http.StatusInternalServerError, apiErrorBody{
+				Code:         "internal",
+				Message:      "Failed to insert request",
+				RequestID:    requestID,
+				Transactions: &transactionOutcomes{Echo: txRolledBack, Worker: txNotStarted},
+			})
+			return
+		}
+		timings.InsertMs = millisSince(stepStart)
+
+		log.Printf("[ECHO] Inserted echo record for request_id=%s", requestID)
+
+		// Pass request_id to gRPC; the client interceptors put it (and the caller) into metadata
+		ctx = withRequestID(ctx, requestID)
+
+		// Call gRPC worker service, bounded by the worker timeout if there is one
+		workerCtx := ctx
+		if workerTimeout > 0 {
+			var cancel context.CancelFunc
+			workerCtx, cancel = cfg.clock.WithTimeout(ctx, workerTimeout)
+			defer cancel()
+		}
+		log.Printf("[ECHO] Calling gRPC worker service for request_id=%s", requestID)
+		stepStart = cfg.clock.Now()
+		workReq := &workerpb.WorkRequest{
+			TaskId: requestID,
+			Data:   message,
+		}
+		var resp *workerpb.WorkResponse
+		confirmed := false
+		if confirmCommit {
+			var deadline time.Time
+			if workerTimeout > 0 {
+				deadline = stepStart.Add(workerTimeout)
+			}
+			resp, confirmed, err = callWorkerConfirmed(workerCtx, cfg.clock, deadline, grpcClient, workReq)
+		} else {
+			resp, err = grpcClient.DoWork(workerCtx, workReq)
+		}
+		timings.WorkerMs = millisSince(stepStart)
+
+		if err != nil {
+			log.Printf("[ECHO] gRPC call failed for request_id=%s: %v", requestID, err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				// If transaction was already rolled back by the driver due to context cancellation, that's ok
+				if rbErr == sql.ErrTxDone {
+					log.Printf("[ECHO] ❌ TRANSACTION ROLLED BACK for request_id=%s (automatically by driver)", requestID)
+				} else {
+					log.Printf("[ECHO] ⚠️  Failed to rollback transaction for request_id=%s: %v", requestID, rbErr)
+				}
+			} else {
+				log.Printf("[ECHO] ❌ TRANSACTION ROLLED BACK for request_id=%s", requestID)
+			}
+			tx = nil // Prevent double rollback in defer
+
+			// The worker rolls back on every error it returns itself; anything else
+			// (transport failures, deadlines) leaves its outcome unknown to us,
+			// unless the worker was waiting for a go-ahead it never got. gRPC also
+			// reports Canceled when our own ctx was cancelled, by the client going
+			// away or an operator, and the worker may have committed by then, so
+			// Canceled only comes from the worker while ctx is still live.
+			workerOutcome := txUnknown
+			if st, ok := status.FromError(err); ok && st.Code() == codes.Canceled && ctx.Err() == nil {
+				workerOutcome = txRolledBack
+			}
+			if confirmCommit && !confirmed {
+				workerOutcome = txRolledBack
+			}
+
+			if errors.Is(context.Cause(ctx), admin.ErrCancelled) {
+				log.Printf("[ECHO] ⚠️  Request cancelled by an operator for request_id=%s", requestID)
+				writeError(w, r, http.StatusServiceUnavailable, apiErrorBody{
+					Code:         "cancelled_by_operator",
+					Message:      "Cancelled by an operator",
+					RequestID:    requestID,
+					Transactions: &transactionOutcomes{Echo: txRolledBack, Worker: workerOutcome},
+				})
+				return
+			}
+
+			// A timeout may race with the worker's commit, so without commit
+			// confirmation its outcome is unknown
+			if errors.Is(context.Cause(workerCtx), context.DeadlineExceeded) {
+				log.Printf("[ECHO] ⚠️  Worker timed out after %v for request_id=%s", workerTimeout, requestID)
+				if !confirmCommit {
+					workerOutcome = txUnknown
+				}
+				writeError(w, r, http.StatusGatewayTimeout, apiErrorBody{
+					Code:         "worker_timeout",
+					Message:      fmt.Sprintf("Worker did not answer within %v", workerTimeout),
+					RequestID:    requestID,
+					Transactions: &transactionOutcomes{Echo: txRolledBack, Worker: workerOutcome},
+				})
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, apiErrorBody{
+				Code:         "worker_failed",
+				Message:      fmt.Sprintf("Worker failed: %v", err),
+				RequestID:    requestID,
+				Transactions: &transactionOutcomes{Echo: txRolledBack, Worker: workerOutcome},
+			})
+			return
+		}
+
+		// gRPC call succeeded - commit echo transaction
+		stepStart = cfg.clock.Now()
+		if err := tx.Commit(); err != nil {
+			log.Printf("[ECHO] Failed to commit transaction: %v", err)
+			writeError(w, r, http.StatusInternalServerError, apiErrorBody{
+				Code:         "internal",
+				Message:      "Failed to commit",
+				RequestID:    requestID,
+				Transactions: &transactionOutcomes{Echo: txRolledBack, Worker: txCommitted},
+			})
+			return
+		}
+		tx = nil // Prevent rollback in defer
+		timings.CommitMs = millisSince(stepStart)
+		timings.TotalMs = millisSince(start)
+
+		log.Printf("[ECHO] ✅ TRANSACTION COMMITTED for request_id=%s", requestID)
+		log.Printf("[ECHO] Response from worker: %s", resp.Message)
+
+		if responseContentType(r) == contentTypeText {
+			w.Header().Set("Content-Type", contentTypeText+"; charset=utf-8")
+			fmt.Fprintf(w, "Success: %s\n", resp.Message)
+			return
+		}
+		writeJSON(w, http.StatusOK, echoResponse{
+			RequestID:     requestID,
+			Message:       message,
+			WorkerMessage: resp.Message,
+			Timings:       timings,
+			Transactions:  transactionOutcomes{Echo: txCommitted, Worker: txCommitted},
+		})
+	}
+}
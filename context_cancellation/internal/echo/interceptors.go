@@ -0,0 +1,110 @@
+package echo
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"time"
+
+	"context_cancellation/internal/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadataKey is the metadata key the worker reads the request id from
+const requestIDMetadataKey = "request-id"
+
+type contextKey int
+
+const requestIDContextKey contextKey = iota
+
+// Metrics published on /debug/vars
+var (
+	grpcClientCalls    = expvar.NewMap("echo_grpc_client_calls")
+	grpcClientInFlight = expvar.NewInt("echo_grpc_client_in_flight")
+)
+
+// ClientInterceptors returns the interceptor chain for the connection to the worker.
+// They mirror the worker's server chain: request id and caller propagation,
+// access logging with duration and status, and call metrics.
+func ClientInterceptors() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(
+			requestIDClientUnaryInterceptor,
+			loggingClientUnaryInterceptor,
+			metricsClientUnaryInterceptor,
+		),
+		grpc.WithChainStreamInterceptor(
+			requestIDClientStreamInterceptor,
+			loggingClientStreamInterceptor,
+			metricsClientStreamInterceptor,
+		),
+	}
+}
+
+// withRequestID stores the request id so the client interceptors can forward it
+func withRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// outgoingRequestID adds the request id and the authenticated caller to the
+// outgoing metadata, unless the caller of the RPC already set them
+func outgoingRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if id := requestIDFromContext(ctx); id != "" && len(md.Get(requestIDMetadataKey)) == 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadataKey, id)
+	}
+	if caller := callerFromContext(ctx); caller != "" && len(md.Get(auth.CallerMetadataKey)) == 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, auth.CallerMetadataKey, caller)
+	}
+	return ctx
+}
+
+func requestIDClientUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+}
+
+func requestIDClientStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+}
+
+func loggingClientUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	log.Printf("[ECHO] grpc call method=%s request_id=%s target=%s code=%s duration=%s",
+		method, requestIDFromContext(ctx), cc.Target(), status.Code(err), time.Since(start))
+	return err
+}
+
+// loggingClientStreamInterceptor logs when the stream is opened; the stream's
+// final status is only known to the code that reads it
+func loggingClientStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	log.Printf("[ECHO] grpc stream opened method=%s request_id=%s target=%s code=%s duration=%s",
+		method, requestIDFromContext(ctx), cc.Target(), status.Code(err), time.Since(start))
+	return stream, err
+}
+
+func metricsClientUnaryInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	grpcClientInFlight.Add(1)
+	defer grpcClientInFlight.Add(-1)
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	grpcClientCalls.Add(fmt.Sprintf("%s %s", method, status.Code(err)), 1)
+	return err
+}
+
+func metricsClientStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	grpcClientCalls.Add(fmt.Sprintf("%s stream %s", method, status.Code(err)), 1)
+	return stream, err
+}
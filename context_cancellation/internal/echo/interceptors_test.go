@@ -0,0 +1,34 @@
+package echo
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDClientInterceptor(t *testing.T) {
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	ctx := withRequestID(context.Background(), "echo-001")
+	if err := requestIDClientUnaryInterceptor(ctx, "/worker.WorkerService/DoWork", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Interceptor failed: %v", err)
+	}
+	if got := sent.Get(requestIDMetadataKey); len(got) != 1 || got[0] != "echo-001" {
+		t.Errorf("Expected request-id metadata echo-001, got %v", got)
+	}
+
+	// An explicit request-id in the outgoing metadata is left alone
+	ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadataKey, "explicit")
+	if err := requestIDClientUnaryInterceptor(ctx, "/worker.WorkerService/DoWork", nil, nil, nil, invoker); err != nil {
+		t.Fatalf("Interceptor failed: %v", err)
+	}
+	if got := sent.Get(requestIDMetadataKey); len(got) != 1 || got[0] != "explicit" {
+		t.Errorf("Expected explicit request-id to be kept, got %v", got)
+	}
+}
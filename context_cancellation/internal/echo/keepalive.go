@@ -0,0 +1,53 @@
+package echo
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// KeepaliveConfig controls how echo notices a worker that has gone silent.
+// When a ping goes unanswered the connection is closed and in-flight calls
+// fail with Unavailable, so echo rolls back instead of waiting forever.
+type KeepaliveConfig struct {
+	// Time is how long the connection may be idle before echo pings the worker
+	Time time.Duration
+	// Timeout is how long echo waits for the ping to be answered
+	Timeout time.Duration
+	// PermitWithoutStream keeps pinging while no call is in flight
+	PermitWithoutStream bool
+}
+
+// DefaultKeepalive pings an idle worker every 30 seconds. The worker's
+// enforcement policy must allow pings this often.
+func DefaultKeepalive() KeepaliveConfig {
+	return KeepaliveConfig{
+		Time:                30 * time.Second,
+		Timeout:             10 * time.Second,
+		PermitWithoutStream: true,
+	}
+}
+
+// Validate rejects settings gRPC would silently change
+func (c KeepaliveConfig) Validate() error {
+	if c.Time < 10*time.Second {
+		return fmt.Errorf("keepalive time %v is below gRPC's client minimum of 10s", c.Time)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("keepalive timeout must be positive, got %v", c.Timeout)
+	}
+	return nil
+}
+
+// DialOptions returns the keepalive parameters for grpc.NewClient
+func (c KeepaliveConfig) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.Time,
+			Timeout:             c.Timeout,
+			PermitWithoutStream: c.PermitWithoutStream,
+		}),
+	}
+}
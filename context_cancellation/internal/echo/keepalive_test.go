@@ -0,0 +1,29 @@
+package echo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeepaliveConfigValidate(t *testing.T) {
+	if err := DefaultKeepalive().Validate(); err != nil {
+		t.Fatalf("Default keepalive settings are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *KeepaliveConfig)
+	}{
+		{"time below gRPC client minimum", func(c *KeepaliveConfig) { c.Time = 5 * time.Second }},
+		{"zero timeout", func(c *KeepaliveConfig) { c.Timeout = 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultKeepalive()
+			tt.modify(&c)
+			if err := c.Validate(); err == nil {
+				t.Errorf("Expected %+v to be rejected", c)
+			}
+		})
+	}
+}
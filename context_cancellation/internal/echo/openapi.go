@@ -0,0 +1,17 @@
+package echo
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPIDocument describes the /echo endpoint, see openapi.json
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// OpenAPIHandler serves the OpenAPI document for the echo server
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Write(openAPIDocument)
+}
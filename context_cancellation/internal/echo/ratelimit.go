@@ -0,0 +1,296 @@
+package echo
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Metrics published on /debug/vars
+var (
+	rateLimitStats             = expvar.NewMap("echo_rate_limit")
+	rateLimitTrackedClients    = new(expvar.Int)
+	rateLimitTrackedRequestIDs = new(expvar.Int)
+)
+
+func init() {
+	rateLimitStats.Set("tracked_clients", rateLimitTrackedClients)
+	rateLimitStats.Set("tracked_request_ids", rateLimitTrackedRequestIDs)
+}
+
+// LimitConfig is one token bucket: Rate tokens per second, up to Burst at once
+type LimitConfig struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+func (c LimitConfig) enabled() bool {
+	return c.Rate > 0 && c.Burst > 0
+}
+
+// RateLimitConfig is the JSON file passed with -rate-limit-config
+//
+//	{
+//	  "per_client":     {"rate": 5, "burst": 10},
+//	  "per_request_id": {"rate": 0.2, "burst": 1},
+//	  "overrides":      {"loadgen": {"rate": 500, "burst": 500}},
+//	  "idle_timeout_seconds": 600
+//	}
+//
+// Clients are keyed by the authenticated caller when there is one, otherwise
+// by the client IP. Overrides replace per_client for the given key.
+type RateLimitConfig struct {
+	PerClient          LimitConfig            `json:"per_client"`
+	PerRequestID       LimitConfig            `json:"per_request_id"`
+	Overrides          map[string]LimitConfig `json:"overrides"`
+	IdleTimeoutSeconds int                    `json:"idle_timeout_seconds"`
+}
+
+func LoadRateLimitConfig(path string) (RateLimitConfig, error) {
+	var cfg RateLimitConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read rate limit config: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse rate limit config %s: %v", path, err)
+	}
+	return cfg, cfg.validate()
+}
+
+func (c RateLimitConfig) validate() error {
+	check := func(name string, l LimitConfig) error {
+		if l.Rate < 0 || l.Burst < 0 {
+			return fmt.Errorf("%s: rate and burst must not be negative", name)
+		}
+		if (l.Rate > 0) != (l.Burst > 0) {
+			return fmt.Errorf("%s: set both rate and burst, or neither", name)
+		}
+		return nil
+	}
+	if err := check("per_client", c.PerClient); err != nil {
+		return err
+	}
+	if err := check("per_request_id", c.PerRequestID); err != nil {
+		return err
+	}
+	for key, l := range c.Overrides {
+		if err := check("overrides."+key, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter keeps one token bucket per client and one per request_id
+type RateLimiter struct {
+	cfg         RateLimitConfig
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	mu         sync.Mutex
+	clients    map[string]*bucket
+	requestIDs map[string]*bucket
+	lastSweep  time.Time
+}
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		cfg:         cfg,
+		idleTimeout: idleTimeout(cfg),
+		now:         time.Now,
+		clients:     make(map[string]*bucket),
+		requestIDs:  make(map[string]*bucket),
+	}
+}
+
+// SetConfig replaces the limits. Buckets already tracked keep the tokens
+// they have and move to the new rate and burst; buckets whose limit is now
+// disabled are dropped.
+func (l *RateLimiter) SetConfig(cfg RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cfg = cfg
+	l.idleTimeout = idleTimeout(cfg)
+	now := l.now()
+	update := func(buckets map[string]*bucket, limit func(key string) LimitConfig) {
+		for key, b := range buckets {
+			lc := limit(key)
+			if !lc.enabled() {
+				delete(buckets, key)
+				continue
+			}
+			b.limiter.SetLimitAt(now, rate.Limit(lc.Rate))
+			b.limiter.SetBurstAt(now, lc.Burst)
+		}
+	}
+	update(l.clients, l.clientLimit)
+	update(l.requestIDs, func(string) LimitConfig { return cfg.PerRequestID })
+	rateLimitTrackedClients.Set(int64(len(l.clients)))
+	rateLimitTrackedRequestIDs.Set(int64(len(l.requestIDs)))
+}
+
+func idleTimeout(cfg RateLimitConfig) time.Duration {
+	if cfg.IdleTimeoutSeconds <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(cfg.IdleTimeoutSeconds) * time.Second
+}
+
+// allow takes one token from the client bucket and one from the request_id bucket.
+// Either both are taken or neither is, so a request rejected for its request_id
+// does not use up the client's budget. When rejected, it returns how long the
+// client should wait and which limit was hit.
+func (l *RateLimiter) allow(clientKey, requestID string) (bool, time.Duration, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	defer func() {
+		rateLimitTrackedClients.Set(int64(len(l.clients)))
+		rateLimitTrackedRequestIDs.Set(int64(len(l.requestIDs)))
+	}()
+
+	var reservations []*rate.Reservation
+	cancelAll := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	checks := []struct {
+		scope   string
+		buckets map[string]*bucket
+		key     string
+		cfg     LimitConfig
+	}{
+		{"per_client", l.clients, clientKey, l.clientLimit(clientKey)},
+		{"per_request_id", l.requestIDs, requestID, l.cfg.PerRequestID},
+	}
+	for _, c := range checks {
+		if c.key == "" || !c.cfg.enabled() {
+			continue
+		}
+		b, ok := c.buckets[c.key]
+		if !ok {
+			b = &bucket{limiter: rate.NewLimiter(rate.Limit(c.cfg.Rate), c.cfg.Burst)}
+			c.buckets[c.key] = b
+		}
+		b.lastSeen = now
+
+		r := b.limiter.ReserveN(now, 1)
+		if delay := r.DelayFrom(now); !r.OK() || delay > 0 {
+			r.CancelAt(now)
+			cancelAll()
+			rateLimitStats.Add("rejected_"+c.scope, 1)
+			return false, delay, c.scope
+		}
+		reservations = append(reservations, r)
+	}
+
+	rateLimitStats.Add("allowed", 1)
+	return true, 0, ""
+}
+
+func (l *RateLimiter) clientLimit(clientKey string) LimitConfig {
+	if override, ok := l.cfg.Overrides[clientKey]; ok {
+		return override
+	}
+	return l.cfg.PerClient
+}
+
+// sweep forgets buckets that have been idle for longer than the idle timeout
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTimeout/2 {
+		return
+	}
+	l.lastSweep = now
+	for _, buckets := range []map[string]*bucket{l.clients, l.requestIDs} {
+		for key, b := range buckets {
+			if now.Sub(b.lastSeen) > l.idleTimeout {
+				delete(buckets, key)
+			}
+		}
+	}
+}
+
+// RateLimit rejects requests over the limit with 429 and a Retry-After header.
+// It runs before the echo handler, so rejected requests never open a
+// transaction or call the worker.
+func RateLimit(limiter *RateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientKey := callerFromContext(r.Context())
+		if clientKey == "" {
+			clientKey = clientIP(r)
+		}
+		requestID := peekRequestID(r)
+
+		ok, retryAfter, scope := limiter.allow(clientKey, requestID)
+		if !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			log.Printf("[ECHO] Rate limited client=%s request_id=%s (%s), retry after %ds", clientKey, requestID, scope, seconds)
+
+			w.Header().Set("Retry-After", fmt.Sprint(seconds))
+			writeError(w, r, http.StatusTooManyRequests, apiErrorBody{
+				Code:      "rate_limited",
+				Message:   fmt.Sprintf("too many requests (%s limit), retry after %ds", scope, seconds),
+				RequestID: requestID,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// peekRequestID reads request_id without consuming the request: from the
+// query string, or from a JSON body that is put back for the handler.
+// Anything unparseable is left for the handler to reject.
+func peekRequestID(r *http.Request) string {
+	if r.Method != http.MethodPost || r.Body == nil {
+		return r.URL.Query().Get("request_id")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodyBytes+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		RequestID string `json:"request_id"`
+	}
+	json.Unmarshal(body, &req)
+	return req.RequestID
+}
@@ -0,0 +1,169 @@
+package echo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNow is a clock the test moves by hand
+type fakeNow struct {
+	t time.Time
+}
+
+func (f *fakeNow) now() time.Time { return f.t }
+
+func newTestLimiter(cfg RateLimitConfig) (*RateLimiter, *fakeNow) {
+	clock := &fakeNow{t: time.Unix(1_700_000_000, 0)}
+	limiter := NewRateLimiter(cfg)
+	limiter.now = clock.now
+	return limiter, clock
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	limiter, clock := newTestLimiter(RateLimitConfig{
+		PerClient: LimitConfig{Rate: 1, Burst: 3},
+	})
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := limiter.allow("10.0.0.1", ""); !ok {
+			t.Fatalf("Request %d within the burst was rejected", i+1)
+		}
+	}
+
+	ok, retryAfter, scope := limiter.allow("10.0.0.1", "")
+	if ok {
+		t.Fatal("Request after the burst should be rejected")
+	}
+	if scope != "per_client" || retryAfter != time.Second {
+		t.Errorf("Expected per_client limit with 1s retry, got %s after %v", scope, retryAfter)
+	}
+
+	// Other clients have their own bucket
+	if ok, _, _ := limiter.allow("10.0.0.2", ""); !ok {
+		t.Error("A different client should not be limited")
+	}
+
+	// One token comes back per second
+	clock.t = clock.t.Add(time.Second)
+	if ok, _, _ := limiter.allow("10.0.0.1", ""); !ok {
+		t.Error("A token should be available after one second")
+	}
+	if ok, _, _ := limiter.allow("10.0.0.1", ""); ok {
+		t.Error("Only one token should have been refilled")
+	}
+}
+
+func TestRateLimiterPerRequestID(t *testing.T) {
+	limiter, _ := newTestLimiter(RateLimitConfig{
+		PerClient:    LimitConfig{Rate: 1, Burst: 2},
+		PerRequestID: LimitConfig{Rate: 0.1, Burst: 1},
+	})
+
+	if ok, _, _ := limiter.allow("alice", "req-1"); !ok {
+		t.Fatal("First use of req-1 should be allowed")
+	}
+	ok, retryAfter, scope := limiter.allow("alice", "req-1")
+	if ok || scope != "per_request_id" || retryAfter != 10*time.Second {
+		t.Fatalf("Retrying req-1 should hit the per_request_id limit for 10s, got ok=%v scope=%s retry=%v", ok, scope, retryAfter)
+	}
+
+	// The rejected retry did not use up alice's second token
+	if ok, _, _ := limiter.allow("alice", "req-2"); !ok {
+		t.Error("A rejected request must not consume the client budget")
+	}
+}
+
+func TestRateLimiterOverrides(t *testing.T) {
+	limiter, _ := newTestLimiter(RateLimitConfig{
+		PerClient: LimitConfig{Rate: 1, Burst: 1},
+		Overrides: map[string]LimitConfig{"loadgen": {Rate: 100, Burst: 50}},
+	})
+
+	for i := 0; i < 50; i++ {
+		if ok, _, _ := limiter.allow("loadgen", ""); !ok {
+			t.Fatalf("loadgen request %d should use the override burst", i+1)
+		}
+	}
+	limiter.allow("alice", "")
+	if ok, _, _ := limiter.allow("alice", ""); ok {
+		t.Error("alice should be limited by per_client")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter, _ := newTestLimiter(RateLimitConfig{
+		PerRequestID: LimitConfig{Rate: 1, Burst: 1},
+	})
+
+	calls := 0
+	handler := RateLimit(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		req, err := parseEchoRequest(r)
+		if err != nil {
+			t.Errorf("Handler could not parse the request after the limiter peeked at it: %v", err)
+		}
+		if req.RequestID != "burst-001" {
+			t.Errorf("Handler saw request_id %q", req.RequestID)
+		}
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(`{"request_id":"burst-001"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusOK {
+		t.Fatalf("First request should pass, got %d", rec.Code)
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After: 1, got %q", got)
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"rate_limited"`) {
+		t.Errorf("Expected structured rate_limited error, got %s", rec.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("Rejected requests must not reach the handler, handler ran %d times", calls)
+	}
+}
+
+func TestRateLimitConfigValidate(t *testing.T) {
+	if err := (RateLimitConfig{PerClient: LimitConfig{Rate: 1}}).validate(); err == nil {
+		t.Error("Rate without burst should be rejected")
+	}
+	if err := (RateLimitConfig{PerClient: LimitConfig{Rate: 1, Burst: 1}}).validate(); err != nil {
+		t.Errorf("Valid config rejected: %v", err)
+	}
+}
+
+func TestRateLimiterSetConfig(t *testing.T) {
+	limiter, clock := newTestLimiter(RateLimitConfig{
+		PerClient:    LimitConfig{Rate: 1, Burst: 1},
+		PerRequestID: LimitConfig{Rate: 1, Burst: 1},
+	})
+	limiter.allow("alice", "req-1")
+	if ok, _, _ := limiter.allow("alice", "req-2"); ok {
+		t.Fatal("alice should be limited before the reload")
+	}
+
+	// A bigger burst applies to the bucket alice already has; per_request_id is switched off
+	limiter.SetConfig(RateLimitConfig{PerClient: LimitConfig{Rate: 1, Burst: 3}})
+	clock.t = clock.t.Add(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		if ok, _, scope := limiter.allow("alice", "req-1"); !ok {
+			t.Fatalf("Request %d should be allowed after the reload, hit %s", i+1, scope)
+		}
+	}
+	if len(limiter.requestIDs) != 0 {
+		t.Errorf("Disabled per_request_id buckets should be dropped, have %d", len(limiter.requestIDs))
+	}
+}
@@ -0,0 +1,371 @@
+// Package faultproxy is a TCP proxy that injects network faults between two
+// processes: added latency, black holes, bandwidth limits, resets at a byte
+// offset and half-closed connections. Tests put it between the HTTP client
+// and echo, or between echo and the worker, and change the faults while a
+// request is in flight.
+package faultproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Direction is the way bytes flow through the proxy
+type Direction int
+
+const (
+	// Upstream is from the connecting client to the target
+	Upstream Direction = iota
+	// Downstream is from the target back to the client
+	Downstream
+)
+
+func (d Direction) String() string {
+	if d == Upstream {
+		return "upstream"
+	}
+	return "downstream"
+}
+
+// Faults are applied to every connection in one direction. Changes take
+// effect immediately, also for connections that are already open.
+type Faults struct {
+	// Latency delays every chunk of data by this much
+	Latency time.Duration
+	// Blackhole holds all data without closing the connection, like a
+	// network partition; held data is delivered once the black hole ends
+	Blackhole bool
+	// BytesPerSecond limits throughput (0 is unlimited)
+	BytesPerSecond int
+	// ResetAfterBytes resets the connection once this many bytes have been
+	// forwarded in this direction (0 never resets)
+	ResetAfterBytes int64
+}
+
+const chunkSize = 32 * 1024
+
+// Proxy forwards TCP connections from Addr to a target address
+type Proxy struct {
+	target   string
+	listener net.Listener
+
+	mu     sync.Mutex
+	faults [2]Faults
+	wake   chan struct{}
+	links  map[*link]struct{}
+	closed bool
+
+	wg sync.WaitGroup
+}
+
+// New starts a proxy on a free localhost port that forwards to target
+func New(target string) (*Proxy, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %v", err)
+	}
+	p := &Proxy{
+		target:   target,
+		listener: lis,
+		wake:     make(chan struct{}),
+		links:    make(map[*link]struct{}),
+	}
+	p.wg.Add(1)
+	go p.acceptLoop()
+	return p, nil
+}
+
+// Addr is the address clients connect to instead of the target
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Port is the port of Addr
+func (p *Proxy) Port() int {
+	return p.listener.Addr().(*net.TCPAddr).Port
+}
+
+// SetFaults replaces the faults for one direction
+func (p *Proxy) SetFaults(dir Direction, f Faults) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults[dir] = f
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// Partition black-holes both directions
+func (p *Proxy) Partition() {
+	p.mu.Lock()
+	up, down := p.faults[Upstream], p.faults[Downstream]
+	p.mu.Unlock()
+	up.Blackhole, down.Blackhole = true, true
+	p.SetFaults(Upstream, up)
+	p.SetFaults(Downstream, down)
+}
+
+// Heal clears all faults
+func (p *Proxy) Heal() {
+	p.SetFaults(Upstream, Faults{})
+	p.SetFaults(Downstream, Faults{})
+}
+
+// HalfClose shuts down the write side towards the receiver of dir on every
+// open connection: for Upstream the target reads EOF while it can still
+// send to the client. Data sent in that direction afterwards is discarded.
+func (p *Proxy) HalfClose(dir Direction) {
+	for _, l := range p.openLinks() {
+		l.halfClose(dir)
+	}
+}
+
+// ResetAll resets every open connection on both sides with a TCP RST
+func (p *Proxy) ResetAll() {
+	for _, l := range p.openLinks() {
+		l.reset()
+	}
+}
+
+// ActiveConns is the number of connections currently being proxied
+func (p *Proxy) ActiveConns() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.links)
+}
+
+// Close stops accepting connections and closes all open ones
+func (p *Proxy) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	err := p.listener.Close()
+	for _, l := range p.openLinks() {
+		l.close()
+	}
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) openLinks() []*link {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	links := make([]*link, 0, len(p.links))
+	for l := range p.links {
+		links = append(links, l)
+	}
+	return links
+}
+
+// current returns the faults for dir and a channel closed when they change
+func (p *Proxy) current(dir Direction) (Faults, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults[dir], p.wake
+}
+
+func (p *Proxy) acceptLoop() {
+	defer p.wg.Done()
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		server, err := net.Dial("tcp", p.target)
+		if err != nil {
+			client.Close()
+			continue
+		}
+
+		l := &link{
+			proxy: p,
+			conns: [2]*net.TCPConn{client.(*net.TCPConn), server.(*net.TCPConn)},
+			done:  make(chan struct{}),
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			l.close()
+			return
+		}
+		p.links[l] = struct{}{}
+		p.mu.Unlock()
+
+		p.wg.Add(1)
+		go l.run()
+	}
+}
+
+// link is one proxied connection: conns[0] is the client, conns[1] the target
+type link struct {
+	proxy *Proxy
+	conns [2]*net.TCPConn
+
+	mu         sync.Mutex
+	halfClosed [2]bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type chunk struct {
+	data []byte
+	at   time.Time
+}
+
+func (l *link) run() {
+	defer l.proxy.wg.Done()
+
+	var wg sync.WaitGroup
+	for _, dir := range []Direction{Upstream, Downstream} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.pipe(dir)
+		}()
+	}
+	wg.Wait()
+	l.close()
+}
+
+// pipe copies one direction: src is the sender, dst the receiver
+func (l *link) pipe(dir Direction) {
+	src, dst := l.conns[0], l.conns[1]
+	if dir == Downstream {
+		src, dst = dst, src
+	}
+
+	chunks := make(chan chunk, 64)
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, chunkSize)
+			n, err := src.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- chunk{data: buf[:n], at: time.Now()}:
+				case <-l.done:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var forwarded int64
+	for c := range chunks {
+		if err := l.forward(dir, dst, c, &forwarded); err != nil {
+			return
+		}
+	}
+	// The sender closed its side; pass the EOF on
+	dst.CloseWrite()
+}
+
+var errLinkClosed = errors.New("link closed")
+
+// forward writes one chunk to dst, applying the current faults
+func (l *link) forward(dir Direction, dst *net.TCPConn, c chunk, forwarded *int64) error {
+	// Wait out black holes and latency, re-reading the faults whenever they change
+	for {
+		f, changed := l.proxy.current(dir)
+		var wait <-chan time.Time
+		if !f.Blackhole {
+			delay := time.Until(c.at.Add(f.Latency))
+			if delay <= 0 {
+				break
+			}
+			wait = time.After(delay)
+		}
+		select {
+		case <-wait:
+		case <-changed:
+		case <-l.done:
+			return errLinkClosed
+		}
+	}
+
+	data := c.data
+	for len(data) > 0 {
+		if l.isHalfClosed(dir) {
+			return nil
+		}
+		f, _ := l.proxy.current(dir)
+
+		n := len(data)
+		if f.BytesPerSecond > 0 {
+			// Send at most 1/20s worth of data at a time
+			n = min(n, max(f.BytesPerSecond/20, 1))
+		}
+		reset := false
+		if f.ResetAfterBytes > 0 && *forwarded+int64(n) >= f.ResetAfterBytes {
+			n = int(f.ResetAfterBytes - *forwarded)
+			reset = true
+		}
+
+		if n > 0 {
+			if _, err := dst.Write(data[:n]); err != nil {
+				l.close()
+				return err
+			}
+		}
+		*forwarded += int64(n)
+		data = data[n:]
+
+		if reset {
+			l.reset()
+			return errLinkClosed
+		}
+		if f.BytesPerSecond > 0 {
+			select {
+			case <-time.After(time.Duration(n) * time.Second / time.Duration(f.BytesPerSecond)):
+			case <-l.done:
+				return errLinkClosed
+			}
+		}
+	}
+	return nil
+}
+
+func (l *link) isHalfClosed(dir Direction) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.halfClosed[dir]
+}
+
+func (l *link) halfClose(dir Direction) {
+	l.mu.Lock()
+	l.halfClosed[dir] = true
+	l.mu.Unlock()
+
+	dst := l.conns[1]
+	if dir == Downstream {
+		dst = l.conns[0]
+	}
+	dst.CloseWrite()
+}
+
+// reset closes both sides with SO_LINGER 0, so the peers get a RST instead of a FIN
+func (l *link) reset() {
+	for _, c := range l.conns {
+		c.SetLinger(0)
+	}
+	l.close()
+}
+
+func (l *link) close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		for _, c := range l.conns {
+			c.Close()
+		}
+		l.proxy.mu.Lock()
+		delete(l.proxy.links, l)
+		l.proxy.mu.Unlock()
+	})
+}
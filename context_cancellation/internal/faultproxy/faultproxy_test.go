@@ -0,0 +1,195 @@
+package faultproxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// target accepts one connection at a time and hands it to the test
+type target struct {
+	listener net.Listener
+	conns    chan *net.TCPConn
+}
+
+func startTarget(t *testing.T) *target {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	tg := &target{listener: lis, conns: make(chan *net.TCPConn, 4)}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			tg.conns <- conn.(*net.TCPConn)
+		}
+	}()
+	t.Cleanup(func() { lis.Close() })
+	return tg
+}
+
+// connect opens a connection through a new proxy and returns both ends
+func connect(t *testing.T) (*Proxy, *net.TCPConn, *net.TCPConn) {
+	t.Helper()
+	tg := startTarget(t)
+	p, err := New(tg.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to start proxy: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+
+	client, err := net.Dial("tcp", p.Addr())
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	select {
+	case server := <-tg.conns:
+		t.Cleanup(func() { server.Close() })
+		return p, client.(*net.TCPConn), server
+	case <-time.After(5 * time.Second):
+		t.Fatal("Proxy did not connect to the target")
+		return nil, nil, nil
+	}
+}
+
+func readExactly(t *testing.T, conn net.Conn, n int) []byte {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return buf
+}
+
+func TestForwardsBothWays(t *testing.T) {
+	_, client, server := connect(t)
+
+	client.Write([]byte("ping"))
+	if got := readExactly(t, server, 4); string(got) != "ping" {
+		t.Errorf("Target got %q", got)
+	}
+	server.Write([]byte("pong"))
+	if got := readExactly(t, client, 4); string(got) != "pong" {
+		t.Errorf("Client got %q", got)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	p, client, server := connect(t)
+	p.SetFaults(Upstream, Faults{Latency: 100 * time.Millisecond})
+
+	start := time.Now()
+	client.Write([]byte("x"))
+	readExactly(t, server, 1)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Data arrived after %v, expected at least 100ms", elapsed)
+	}
+
+	// Downstream has no latency
+	start = time.Now()
+	server.Write([]byte("y"))
+	readExactly(t, client, 1)
+	if elapsed := time.Since(start); elapsed > 90*time.Millisecond {
+		t.Errorf("Downstream was delayed by %v", elapsed)
+	}
+}
+
+func TestBlackholeHoldsDataWithoutClosing(t *testing.T) {
+	p, client, server := connect(t)
+	p.Partition()
+
+	client.Write([]byte("lost?"))
+	server.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	buf := make([]byte, 5)
+	if n, err := server.Read(buf); !isTimeout(err) {
+		t.Fatalf("Expected the read to time out during the partition, got %d bytes, %v", n, err)
+	}
+	if p.ActiveConns() != 1 {
+		t.Errorf("Partition must not close the connection")
+	}
+
+	p.Heal()
+	if got := readExactly(t, server, 5); string(got) != "lost?" {
+		t.Errorf("Held data arrived as %q", got)
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	p, client, server := connect(t)
+	p.SetFaults(Upstream, Faults{BytesPerSecond: 20_000})
+
+	payload := bytes.Repeat([]byte("b"), 10_000)
+	start := time.Now()
+	go client.Write(payload)
+	readExactly(t, server, len(payload))
+
+	// 10kB at 20kB/s takes half a second
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("10kB arrived after %v, too fast for 20kB/s", elapsed)
+	}
+}
+
+func TestResetAfterBytes(t *testing.T) {
+	p, client, server := connect(t)
+	p.SetFaults(Upstream, Faults{ResetAfterBytes: 5})
+
+	client.Write([]byte("hello world"))
+
+	// The target gets exactly the first five bytes and then a reset
+	if got := readExactly(t, server, 5); string(got) != "hello" {
+		t.Errorf("Target got %q before the reset", got)
+	}
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := server.Read(make([]byte, 1)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Target expected a connection reset, got %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Client expected a connection reset, got %v", err)
+	}
+}
+
+func TestHalfClose(t *testing.T) {
+	p, client, server := connect(t)
+	p.HalfClose(Upstream)
+
+	// The target sees EOF but can still answer
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Target expected EOF, got %v", err)
+	}
+	server.Write([]byte("still here"))
+	if got := readExactly(t, client, 10); string(got) != "still here" {
+		t.Errorf("Client got %q", got)
+	}
+}
+
+func TestResetAll(t *testing.T) {
+	p, client, _ := connect(t)
+	p.ResetAll()
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Expected a connection reset, got %v", err)
+	}
+	if n := p.ActiveConns(); n != 0 {
+		t.Errorf("Expected no active connections, got %d", n)
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,233 @@
+// Package loadgen drives /echo with a configurable rate and concurrency,
+// optionally cancelling some requests part-way, and summarises latency,
+// transaction outcomes and errors.
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Config describes a load run
+type Config struct {
+	// URL is echo's base URL, e.g. http://localhost:8080
+	URL string
+	// Rate is the number of requests started per second (0 means as fast as Concurrency allows)
+	Rate float64
+	// Concurrency is the number of requests in flight at most
+	Concurrency int
+	// Duration stops starting new requests after this long (0 means no limit)
+	Duration time.Duration
+	// Requests stops after this many requests (0 means no limit)
+	Requests int
+	// CancelPercent is the share of requests, 0-100, that the client cancels
+	CancelPercent float64
+	// CancelAfterMax bounds the random offset after which a request is cancelled
+	CancelAfterMax time.Duration
+	// Token is sent as a bearer token when set
+	Token string
+	// Prefix starts every request_id, so the run's rows can be found afterwards
+	Prefix string
+	// Seed decides which requests are cancelled and when
+	Seed uint64
+}
+
+// Validate rejects configurations that cannot run
+func (c Config) Validate() error {
+	if c.URL == "" {
+		return errors.New("url is required")
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1, got %d", c.Concurrency)
+	}
+	if c.Rate < 0 {
+		return fmt.Errorf("rate must not be negative, got %v", c.Rate)
+	}
+	if c.Duration <= 0 && c.Requests <= 0 {
+		return errors.New("set a duration or a number of requests")
+	}
+	if c.CancelPercent < 0 || c.CancelPercent > 100 {
+		return fmt.Errorf("cancel percent must be between 0 and 100, got %v", c.CancelPercent)
+	}
+	if c.CancelPercent > 0 && c.CancelAfterMax <= 0 {
+		return errors.New("cancel-after-max must be positive when cancelling requests")
+	}
+	return nil
+}
+
+// Outcome of a single request
+type result struct {
+	latency time.Duration
+	status  int
+	// code is echo's error code, "cancelled" or "transport_error"; empty on success
+	code      string
+	echoTx    string
+	workerTx  string
+	cancelled bool
+	transport bool
+}
+
+// Run sends requests until the duration or request count is reached, then
+// waits for the requests in flight and returns the report
+func Run(ctx context.Context, cfg Config, client *http.Client) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	runCtx := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if cfg.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(cfg.Rate), 1)
+	}
+
+	var (
+		mu      sync.Mutex
+		rng     = rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+		results []result
+		next    atomic.Int64
+		wg      sync.WaitGroup
+	)
+	// cancelAfter decides whether and when the next request is cancelled; a seed
+	// gives the same sequence of decisions
+	cancelAfter := func() (time.Duration, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if rng.Float64()*100 >= cfg.CancelPercent {
+			return 0, false
+		}
+		return time.Duration(rng.Int64N(int64(cfg.CancelAfterMax))), true
+	}
+
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if err := limiter.Wait(runCtx); err != nil {
+					return
+				}
+				n := next.Add(1)
+				if cfg.Requests > 0 && n > int64(cfg.Requests) {
+					return
+				}
+				after, cancel := cancelAfter()
+				// Requests in flight finish even after the run's duration is over
+				res := send(context.WithoutCancel(ctx), client, cfg, fmt.Sprintf("%s-%d", cfg.Prefix, n), after, cancel)
+				mu.Lock()
+				results = append(results, res)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return newReport(cfg, results, time.Since(start)), nil
+}
+
+// send makes one /echo request, cancelling it after cancelAfter if cancel is set
+func send(ctx context.Context, client *http.Client, cfg Config, requestID string, cancelAfter time.Duration, cancel bool) result {
+	if cancel {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeoutCause(ctx, cancelAfter, errCancelledByLoadgen)
+		defer stop()
+	}
+
+	q := url.Values{"request_id": {requestID}, "message": {"loadgen"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL+"/echo?"+q.Encode(), nil)
+	if err != nil {
+		return result{transport: true, code: "transport_error"}
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		res := result{latency: time.Since(start), code: "transport_error", transport: true}
+		if errors.Is(context.Cause(ctx), errCancelledByLoadgen) {
+			res = result{latency: time.Since(start), code: "cancelled", cancelled: true}
+		}
+		return res
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	res := result{latency: time.Since(start), status: resp.StatusCode}
+	if err != nil {
+		res.code, res.transport = "transport_error", true
+		if errors.Is(context.Cause(ctx), errCancelledByLoadgen) {
+			res.code, res.transport, res.cancelled = "cancelled", false, true
+		}
+		return res
+	}
+
+	// Echo reports both transactions on success and on most errors
+	var parsed struct {
+		Transactions *txOutcomes `json:"transactions"`
+		Error        *struct {
+			Code         string      `json:"code"`
+			Transactions *txOutcomes `json:"transactions"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &parsed)
+
+	tx := parsed.Transactions
+	if parsed.Error != nil {
+		res.code = parsed.Error.Code
+		tx = parsed.Error.Transactions
+	} else if resp.StatusCode != http.StatusOK {
+		res.code = fmt.Sprintf("http_%d", resp.StatusCode)
+	}
+	if tx != nil {
+		res.echoTx, res.workerTx = tx.Echo, tx.Worker
+	}
+	return res
+}
+
+var errCancelledByLoadgen = errors.New("cancelled by loadgen")
+
+type txOutcomes struct {
+	Echo   string `json:"echo"`
+	Worker string `json:"worker"`
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+func sortedDurations(results []result, keep func(result) bool) []time.Duration {
+	var d []time.Duration
+	for _, r := range results {
+		if keep(r) {
+			d = append(d, r.latency)
+		}
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	return d
+}
@@ -0,0 +1,223 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/echo"
+	"context_cancellation/internal/worker"
+)
+
+// fakeEcho answers /echo like the echo server does, choosing the outcome by
+// the number at the end of the request_id
+func fakeEcho(t *testing.T, answer func(w http.ResponseWriter, r *http.Request, n int)) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("request_id")
+		var n int
+		fmt.Sscanf(id[strings.LastIndex(id, "-")+1:], "%d", &n)
+		answer(w, r, n)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func committed(w http.ResponseWriter, _ *http.Request, _ int) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"transactions":{"echo":"committed","worker":"committed"}}`)
+}
+
+func TestRunCountsOutcomes(t *testing.T) {
+	url := fakeEcho(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		w.Header().Set("Content-Type", "application/json")
+		switch n % 4 {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"code":"worker_failed","transactions":{"echo":"rolled_back","worker":"unknown"}}}`)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"code":"rate_limited"}}`)
+		default:
+			committed(w, r, n)
+		}
+	})
+
+	report, err := Run(context.Background(), Config{URL: url, Concurrency: 4, Requests: 20, Prefix: "t"}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if report.Requests != 20 {
+		t.Errorf("Expected 20 requests, got %d", report.Requests)
+	}
+	wantStatus := map[string]int{"200": 10, "500": 5, "429": 5}
+	for status, want := range wantStatus {
+		if report.Status[status] != want {
+			t.Errorf("Expected %d responses with status %s, got %v", want, status, report.Status)
+		}
+	}
+	if report.Errors["worker_failed"] != 5 || report.Errors["rate_limited"] != 5 || len(report.Errors) != 2 {
+		t.Errorf("Unexpected error histogram: %v", report.Errors)
+	}
+	wantEcho := TxCounts{Committed: 10, RolledBack: 5, Unknown: 5}
+	wantWorker := TxCounts{Committed: 10, Unknown: 10}
+	if report.Transactions.Echo != wantEcho || report.Transactions.Worker != wantWorker {
+		t.Errorf("Unexpected transactions: %+v", report.Transactions)
+	}
+	if report.Latency.Count != 20 || report.Latency.P50Ms > report.Latency.P99Ms {
+		t.Errorf("Unexpected latency summary: %+v", report.Latency)
+	}
+}
+
+func TestRunCancelsRequests(t *testing.T) {
+	url := fakeEcho(t, func(w http.ResponseWriter, r *http.Request, n int) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+			committed(w, r, n)
+		}
+	})
+
+	cfg := Config{URL: url, Concurrency: 5, Requests: 5, CancelPercent: 100, CancelAfterMax: 20 * time.Millisecond, Prefix: "t"}
+	report, err := Run(context.Background(), cfg, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Status["cancelled"] != 5 || report.Errors["cancelled"] != 5 {
+		t.Errorf("Expected 5 cancelled requests, got status %v, errors %v", report.Status, report.Errors)
+	}
+	if report.Latency.Count != 0 {
+		t.Errorf("Cancelled requests must not count towards latency: %+v", report.Latency)
+	}
+	if report.Transactions.Echo.Unknown != 5 {
+		t.Errorf("Cancelled requests have unknown outcomes: %+v", report.Transactions.Echo)
+	}
+}
+
+func TestRunRespectsRate(t *testing.T) {
+	url := fakeEcho(t, committed)
+
+	cfg := Config{URL: url, Rate: 50, Concurrency: 4, Duration: 400 * time.Millisecond, Prefix: "t"}
+	report, err := Run(context.Background(), cfg, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	// 50 req/s for 0.4s is 20 requests, give or take the first token and timing
+	if report.Requests < 15 || report.Requests > 22 {
+		t.Errorf("Expected about 20 requests at 50 req/s, got %d", report.Requests)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{URL: "http://localhost:8080", Concurrency: 1, Requests: 1}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Valid config rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{"no url", func(c *Config) { c.URL = "" }},
+		{"no concurrency", func(c *Config) { c.Concurrency = 0 }},
+		{"negative rate", func(c *Config) { c.Rate = -1 }},
+		{"no end", func(c *Config) { c.Requests = 0 }},
+		{"cancel percent over 100", func(c *Config) { c.CancelPercent = 101 }},
+		{"cancel without offset", func(c *Config) { c.CancelPercent = 10 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid
+			tt.modify(&c)
+			if err := c.Validate(); err == nil {
+				t.Errorf("Expected %+v to be rejected", c)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 95: 95 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := percentile(d, p); got != want {
+			t.Errorf("p%v = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile(d[:1], 99); got != time.Millisecond {
+		t.Errorf("p99 of one sample = %v, want 1ms", got)
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("p50 of no samples = %v, want 0", got)
+	}
+}
+
+func TestReportFormats(t *testing.T) {
+	report := newReport(Config{URL: "http://x", Concurrency: 2, Prefix: "t"}, []result{
+		{latency: 10 * time.Millisecond, status: 200, echoTx: "committed", workerTx: "committed"},
+		{latency: 20 * time.Millisecond, status: 500, code: "worker_failed", echoTx: "rolled_back", workerTx: "unknown"},
+		{latency: 5 * time.Millisecond, code: "cancelled", cancelled: true},
+	}, time.Second)
+
+	var table bytes.Buffer
+	if err := report.WriteTable(&table); err != nil {
+		t.Fatalf("WriteTable failed: %v", err)
+	}
+	for _, want := range []string{"p50", "p95", "p99", "worker_failed", "cancelled", "unlimited"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("Table is missing %q:\n%s", want, table.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteJSON(&out); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("Report JSON does not parse: %v", err)
+	}
+	if decoded.Latency.P99Ms != 20 || decoded.Errors["cancelled"] != 1 || decoded.Status["200"] != 1 {
+		t.Errorf("Unexpected decoded report: %+v", decoded)
+	}
+}
+
+func TestCountDatabases(t *testing.T) {
+	dir := t.TempDir()
+	echoDb, err := echo.InitDatabase(filepath.Join(dir, "echo.db"))
+	if err != nil {
+		t.Fatalf("Failed to init echo database: %v", err)
+	}
+	defer echoDb.Close()
+	workerDb, err := worker.InitDatabase(filepath.Join(dir, "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	defer workerDb.Close()
+
+	for _, id := range []string{"run-1", "run-2", "other-1"} {
+		echoDb.Exec("INSERT INTO echo_requests (request_id, message) VALUES (?, '')", id)
+	}
+	for _, id := range []string{"run-1", "run-2", "run-3", "other-1"} {
+		workerDb.Exec("INSERT INTO worker_tasks (task_id, data) VALUES (?, '')", id)
+	}
+
+	report := newReport(Config{Prefix: "run"}, nil, time.Second)
+	if err := report.CountDatabases(filepath.Join(dir, "echo.db"), filepath.Join(dir, "worker.db")); err != nil {
+		t.Fatalf("CountDatabases failed: %v", err)
+	}
+	want := DatabaseCounts{EchoCommitted: 2, WorkerCommitted: 3, WorkerOnly: 1}
+	if *report.Database != want {
+		t.Errorf("Expected %+v, got %+v", want, *report.Database)
+	}
+}
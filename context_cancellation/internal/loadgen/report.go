@@ -0,0 +1,249 @@
+package loadgen
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Report summarises a load run
+type Report struct {
+	Config       ReportConfig       `json:"config"`
+	Requests     int                `json:"requests"`
+	ElapsedSec   float64            `json:"elapsed_sec"`
+	Throughput   float64            `json:"throughput_rps"`
+	Latency      LatencySummary     `json:"latency"`
+	Status       map[string]int     `json:"status"`
+	Errors       map[string]int     `json:"errors"`
+	Transactions TransactionSummary `json:"transactions"`
+	Database     *DatabaseCounts    `json:"database,omitempty"`
+}
+
+// ReportConfig is the part of Config worth repeating in a report
+type ReportConfig struct {
+	URL           string  `json:"url"`
+	Rate          float64 `json:"rate"`
+	Concurrency   int     `json:"concurrency"`
+	DurationSec   float64 `json:"duration_sec"`
+	CancelPercent float64 `json:"cancel_percent"`
+	Prefix        string  `json:"prefix"`
+	Seed          uint64  `json:"seed"`
+}
+
+// LatencySummary covers the requests that got a response; requests the
+// client cancelled are left out, their latency is the cancel offset
+type LatencySummary struct {
+	Count  int     `json:"count"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+	MeanMs float64 `json:"mean_ms"`
+}
+
+// TransactionSummary counts the outcomes echo reported for each side.
+// Cancelled requests and transport errors get no report and count as unknown.
+type TransactionSummary struct {
+	Echo   TxCounts `json:"echo"`
+	Worker TxCounts `json:"worker"`
+}
+
+// TxCounts counts transaction outcomes
+type TxCounts struct {
+	Committed  int `json:"committed"`
+	RolledBack int `json:"rolled_back"`
+	NotStarted int `json:"not_started"`
+	Unknown    int `json:"unknown"`
+}
+
+func (c *TxCounts) add(outcome string) {
+	switch outcome {
+	case "committed":
+		c.Committed++
+	case "rolled_back":
+		c.RolledBack++
+	case "not_started":
+		c.NotStarted++
+	default:
+		c.Unknown++
+	}
+}
+
+// DatabaseCounts are the rows the run left behind, which settles the
+// outcomes the responses could not report
+type DatabaseCounts struct {
+	EchoCommitted   int `json:"echo_committed"`
+	WorkerCommitted int `json:"worker_committed"`
+	// WorkerOnly rows were committed by the worker after echo rolled back
+	WorkerOnly int `json:"worker_only"`
+}
+
+func newReport(cfg Config, results []result, elapsed time.Duration) *Report {
+	r := &Report{
+		Config: ReportConfig{
+			URL:           cfg.URL,
+			Rate:          cfg.Rate,
+			Concurrency:   cfg.Concurrency,
+			DurationSec:   cfg.Duration.Seconds(),
+			CancelPercent: cfg.CancelPercent,
+			Prefix:        cfg.Prefix,
+			Seed:          cfg.Seed,
+		},
+		Requests:   len(results),
+		ElapsedSec: elapsed.Seconds(),
+		Status:     map[string]int{},
+		Errors:     map[string]int{},
+	}
+	if elapsed > 0 {
+		r.Throughput = float64(len(results)) / elapsed.Seconds()
+	}
+
+	for _, res := range results {
+		switch {
+		case res.cancelled:
+			r.Status["cancelled"]++
+		case res.transport:
+			r.Status["transport_error"]++
+		default:
+			r.Status[fmt.Sprint(res.status)]++
+		}
+		if res.code != "" {
+			r.Errors[res.code]++
+		}
+		r.Transactions.Echo.add(res.echoTx)
+		r.Transactions.Worker.add(res.workerTx)
+	}
+
+	answered := sortedDurations(results, func(res result) bool { return !res.cancelled && !res.transport })
+	r.Latency.Count = len(answered)
+	if len(answered) > 0 {
+		var total time.Duration
+		for _, d := range answered {
+			total += d
+		}
+		r.Latency.P50Ms = ms(percentile(answered, 50))
+		r.Latency.P95Ms = ms(percentile(answered, 95))
+		r.Latency.P99Ms = ms(percentile(answered, 99))
+		r.Latency.MaxMs = ms(answered[len(answered)-1])
+		r.Latency.MeanMs = ms(total / time.Duration(len(answered)))
+	}
+	return r
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// CountDatabases counts the rows this run's prefix left in the echo and worker databases
+func (r *Report) CountDatabases(echoDbPath, workerDbPath string) error {
+	echoIDs, err := idsWithPrefix(echoDbPath, "SELECT request_id FROM echo_requests WHERE request_id LIKE ?", r.Config.Prefix)
+	if err != nil {
+		return err
+	}
+	workerIDs, err := idsWithPrefix(workerDbPath, "SELECT task_id FROM worker_tasks WHERE task_id LIKE ?", r.Config.Prefix)
+	if err != nil {
+		return err
+	}
+
+	counts := &DatabaseCounts{EchoCommitted: len(echoIDs), WorkerCommitted: len(workerIDs)}
+	for id := range workerIDs {
+		if !echoIDs[id] {
+			counts.WorkerOnly++
+		}
+	}
+	r.Database = counts
+	return nil
+}
+
+func idsWithPrefix(dbPath, query, prefix string) (map[string]bool, error) {
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query, prefix+"-%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %v", dbPath, err)
+	}
+	defer rows.Close()
+
+	ids := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", dbPath, err)
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteTable writes the report as aligned text tables
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	c := r.Config
+	fmt.Fprintf(tw, "Target\t%s\n", c.URL)
+	fmt.Fprintf(tw, "Rate\t%s\n", rateString(c.Rate))
+	fmt.Fprintf(tw, "Concurrency\t%d\n", c.Concurrency)
+	fmt.Fprintf(tw, "Cancelled by client\t%.1f%% (seed %d)\n", c.CancelPercent, c.Seed)
+	fmt.Fprintf(tw, "Requests\t%d in %.1fs (%.2f req/s)\n", r.Requests, r.ElapsedSec, r.Throughput)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Latency (%d answered)\tp50\tp95\tp99\tmax\tmean\n", r.Latency.Count)
+	l := r.Latency
+	fmt.Fprintf(tw, "ms\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\n", l.P50Ms, l.P95Ms, l.P99Ms, l.MaxMs, l.MeanMs)
+	fmt.Fprintln(tw)
+
+	fmt.Fprintf(tw, "Transactions\tcommitted\trolled back\tnot started\tunknown\n")
+	for _, side := range []struct {
+		name string
+		c    TxCounts
+	}{{"echo", r.Transactions.Echo}, {"worker", r.Transactions.Worker}} {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", side.name, side.c.Committed, side.c.RolledBack, side.c.NotStarted, side.c.Unknown)
+	}
+	if d := r.Database; d != nil {
+		fmt.Fprintf(tw, "rows in databases\techo %d\tworker %d\tworker only %d\t\n", d.EchoCommitted, d.WorkerCommitted, d.WorkerOnly)
+	}
+	fmt.Fprintln(tw)
+
+	writeHistogram(tw, "Status", r.Status)
+	writeHistogram(tw, "Error code", r.Errors)
+	return tw.Flush()
+}
+
+func writeHistogram(w io.Writer, title string, counts map[string]int) {
+	fmt.Fprintf(w, "%s\tcount\n", title)
+	if len(counts) == 0 {
+		fmt.Fprintf(w, "(none)\t\n")
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%d\n", k, counts[k])
+	}
+	fmt.Fprintln(w)
+}
+
+func rateString(rate float64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g req/s", rate)
+}
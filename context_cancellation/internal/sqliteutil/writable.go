@@ -0,0 +1,27 @@
+package sqliteutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// CheckWritable pings db and checks that this process may write the main
+// database file. It takes no locks, so it does not wait for transactions in
+// progress. In-memory databases are always writable.
+func CheckWritable(ctx context.Context, db *sql.DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping failed: %v", err)
+	}
+	var file string
+	if err := db.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file); err != nil {
+		return fmt.Errorf("failed to find the database file: %v", err)
+	}
+	if file == "" {
+		return nil
+	}
+	if err := canWrite(file); err != nil {
+		return fmt.Errorf("database file %s is not writable: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package sqliteutil
+
+import "syscall"
+
+// canWrite asks the kernel, without opening the file: closing any descriptor
+// of a SQLite file drops the locks this process holds on it
+func canWrite(path string) error {
+	const wOK = 2
+	return syscall.Access(path, wOK)
+}
@@ -0,0 +1,415 @@
+// Package testharness runs the echo and worker binaries as real OS processes
+// for integration tests.
+//
+// Binaries are built once per test run into a temporary directory. Each
+// process keeps its own log buffer, is considered started only once a
+// readiness check passes, and is torn down through t.Cleanup:
+//
+//	func TestMain(m *testing.M) { testharness.Main(m) }
+//
+//	func TestSomething(t *testing.T) {
+//		worker := testharness.Start(t, testharness.Config{
+//			Name:  "worker",
+//			Path:  testharness.Build(t, "context_cancellation/cmd/worker"),
+//			Args:  []string{"-port=50051"},
+//			Ready: testharness.GRPCReady("localhost:50051"),
+//		})
+//		...
+//	}
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultReadyTimeout = 10 * time.Second
+	defaultStopTimeout  = 5 * time.Second
+	pollInterval        = 20 * time.Millisecond
+)
+
+var (
+	buildMu   sync.Mutex
+	buildDir  string
+	buildErr  error
+	binaries  = make(map[string]*binary)
+	buildOnce sync.Once
+)
+
+type binary struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// Main runs the tests and removes the build directory afterwards.
+// Call it from TestMain in every package that uses Build.
+func Main(m *testing.M) {
+	code := m.Run()
+	if buildDir != "" {
+		os.RemoveAll(buildDir)
+	}
+	os.Exit(code)
+}
+
+// Build compiles the main package pkg (an import path such as
+// "context_cancellation/cmd/worker") and returns the binary's path.
+// Each package is built at most once per test run.
+func Build(t testing.TB, pkg string) string {
+	t.Helper()
+
+	buildOnce.Do(func() {
+		buildDir, buildErr = os.MkdirTemp("", "testharness-bin-")
+	})
+	if buildErr != nil {
+		t.Fatalf("Failed to create build directory: %v", buildErr)
+	}
+
+	buildMu.Lock()
+	b, ok := binaries[pkg]
+	if !ok {
+		b = &binary{}
+		binaries[pkg] = b
+	}
+	buildMu.Unlock()
+
+	b.once.Do(func() {
+		b.path = buildDir + string(os.PathSeparator) + path.Base(pkg)
+		out, err := exec.Command("go", "build", "-o", b.path, pkg).CombinedOutput()
+		if err != nil {
+			b.err = fmt.Errorf("failed to build %s: %v\n%s", pkg, err, out)
+		}
+	})
+	if b.err != nil {
+		t.Fatal(b.err)
+	}
+	return b.path
+}
+
+// FreePort returns a TCP port that was free a moment ago
+func FreePort(t testing.TB) int {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to find available port: %v", err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// ReadyFunc reports whether a started process is ready to serve
+type ReadyFunc func(ctx context.Context) error
+
+// TCPReady waits until something accepts connections on addr
+func TCPReady(addr string) ReadyFunc {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPReady waits until url answers with a 2xx status
+func HTTPReady(url string) ReadyFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// GRPCReady waits until the gRPC server on addr reports SERVING through the
+// health service. A server without the health service counts as ready as
+// soon as it answers with Unimplemented.
+func GRPCReady(addr string) ReadyFunc {
+	return func(ctx context.Context) error {
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if status.Code(err) == codes.Unimplemented {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("health status %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// Config describes a process to start
+type Config struct {
+	// Name is used in log lines and error messages
+	Name string
+	// Path is the binary, usually the result of Build
+	Path string
+	Args []string
+	// Env is added to the test's own environment
+	Env []string
+	Dir string
+
+	// Ready is polled until it succeeds; nil means the process is ready once started
+	Ready        ReadyFunc
+	ReadyTimeout time.Duration
+	// StopTimeout is how long cleanup waits after SIGTERM before sending SIGKILL
+	StopTimeout time.Duration
+}
+
+// ProcessWithLogs is a running process with its combined stdout and stderr captured
+type ProcessWithLogs struct {
+	Name string
+
+	cmd  *exec.Cmd
+	logs *logBuffer
+
+	done    chan struct{}
+	waitErr error
+}
+
+// Start starts the process, waits for it to become ready and registers its
+// teardown with t.Cleanup. The test fails if the process exits or does not
+// become ready in time.
+func Start(t testing.TB, cfg Config) *ProcessWithLogs {
+	t.Helper()
+
+	p, err := start(t, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func start(t testing.TB, cfg Config) (*ProcessWithLogs, error) {
+	if cfg.Name == "" {
+		cfg.Name = path.Base(cfg.Path)
+	}
+	if cfg.ReadyTimeout <= 0 {
+		cfg.ReadyTimeout = defaultReadyTimeout
+	}
+	if cfg.StopTimeout <= 0 {
+		cfg.StopTimeout = defaultStopTimeout
+	}
+
+	cmd := exec.Command(cfg.Path, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(os.Environ(), cfg.Env...)
+
+	p := &ProcessWithLogs{
+		Name: cfg.Name,
+		cmd:  cmd,
+		logs: &logBuffer{logf: t.Logf, prefix: cfg.Name},
+		done: make(chan struct{}),
+	}
+	cmd.Stdout = p.logs
+	cmd.Stderr = p.logs
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", cfg.Name, err)
+	}
+	go func() {
+		p.waitErr = cmd.Wait()
+		p.logs.flush()
+		close(p.done)
+	}()
+
+	t.Cleanup(func() {
+		if err := p.Stop(cfg.StopTimeout); err != nil {
+			t.Logf("%s: %v", p.Name, err)
+		}
+	})
+	t.Logf("Started %s as OS process with PID %d", cfg.Name, cmd.Process.Pid)
+
+	if cfg.Ready == nil {
+		return p, nil
+	}
+	if err := p.waitReady(cfg.Ready, cfg.ReadyTimeout); err != nil {
+		return nil, fmt.Errorf("%s did not become ready: %v\nLogs:\n%s", cfg.Name, err, p.Logs())
+	}
+	return p, nil
+}
+
+func (p *ProcessWithLogs) waitReady(ready ReadyFunc, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := ready(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-p.done:
+			return fmt.Errorf("process exited: %v", p.waitErr)
+		case <-time.After(pollInterval):
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v: %v", timeout, err)
+		}
+	}
+}
+
+// Pid returns the process id
+func (p *ProcessWithLogs) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Logs returns everything the process has written so far
+func (p *ProcessWithLogs) Logs() string {
+	return p.logs.String()
+}
+
+// WaitForLog waits until the process has logged substr
+func (p *ProcessWithLogs) WaitForLog(substr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !strings.Contains(p.Logs(), substr) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not log %q within %v", p.Name, substr, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+	return nil
+}
+
+// Signal sends sig to the process
+func (p *ProcessWithLogs) Signal(sig os.Signal) error {
+	if p.Exited() {
+		return nil
+	}
+	return p.cmd.Process.Signal(sig)
+}
+
+// Done is closed once the process has exited
+func (p *ProcessWithLogs) Done() <-chan struct{} {
+	return p.done
+}
+
+// Exited reports whether the process has exited
+func (p *ProcessWithLogs) Exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExitErr is the result of waiting for the process, valid once Done is closed
+func (p *ProcessWithLogs) ExitErr() error {
+	<-p.done
+	return p.waitErr
+}
+
+// Stop asks the process to shut down with SIGTERM and sends SIGKILL if it
+// has not exited within timeout. A stopped (SIGSTOP) process is resumed so
+// that it can handle SIGTERM. Stopping an exited process is a no-op.
+func (p *ProcessWithLogs) Stop(timeout time.Duration) error {
+	if p.Exited() {
+		return nil
+	}
+	p.cmd.Process.Signal(syscall.SIGTERM)
+	p.cmd.Process.Signal(syscall.SIGCONT)
+
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(timeout):
+	}
+	if err := p.Kill(); err != nil {
+		return err
+	}
+	return fmt.Errorf("did not exit within %v of SIGTERM, killed", timeout)
+}
+
+// Kill sends SIGKILL and waits for the process to exit
+func (p *ProcessWithLogs) Kill() error {
+	if p.Exited() {
+		return nil
+	}
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill %s: %v", p.Name, err)
+	}
+	<-p.done
+	return nil
+}
+
+// logBuffer keeps the process output and forwards complete lines to the test log
+type logBuffer struct {
+	logf   func(format string, args ...any)
+	prefix string
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	pending []byte
+}
+
+func (b *logBuffer) Write(data []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Write(data)
+	b.pending = append(b.pending, data...)
+	for {
+		i := bytes.IndexByte(b.pending, '\n')
+		if i < 0 {
+			break
+		}
+		b.logf("%s| %s", b.prefix, b.pending[:i])
+		b.pending = b.pending[i+1:]
+	}
+	return len(data), nil
+}
+
+func (b *logBuffer) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.pending) > 0 {
+		b.logf("%s| %s", b.prefix, b.pending)
+		b.pending = nil
+	}
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
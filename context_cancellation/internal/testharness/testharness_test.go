@@ -0,0 +1,165 @@
+package testharness
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// The test binary doubles as the process under test: with TESTHARNESS_HELPER
+// set it runs one of the helpers below instead of the tests.
+func TestMain(m *testing.M) {
+	switch os.Getenv("TESTHARNESS_HELPER") {
+	case "":
+		Main(m)
+	case "listen":
+		helperListen(false)
+	case "stubborn":
+		helperListen(true)
+	case "exit":
+		fmt.Println("helper failing on purpose")
+		os.Exit(3)
+	}
+}
+
+// helperListen listens on HELPER_ADDR and exits on SIGTERM unless stubborn
+func helperListen(stubborn bool) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+
+	lis, err := net.Listen("tcp", os.Getenv("HELPER_ADDR"))
+	if err != nil {
+		fmt.Println("listen failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("helper listening")
+
+	for range signals {
+		if stubborn {
+			fmt.Println("ignoring SIGTERM")
+			continue
+		}
+		fmt.Println("helper shutting down")
+		lis.Close()
+		os.Exit(0)
+	}
+}
+
+func helperConfig(t *testing.T, mode string) (Config, string) {
+	addr := fmt.Sprintf("localhost:%d", FreePort(t))
+	return Config{
+		Name:        mode,
+		Path:        os.Args[0],
+		Env:         []string{"TESTHARNESS_HELPER=" + mode, "HELPER_ADDR=" + addr},
+		Ready:       TCPReady(addr),
+		StopTimeout: 500 * time.Millisecond,
+	}, addr
+}
+
+func TestStartWaitsForReadiness(t *testing.T) {
+	cfg, addr := helperConfig(t, "listen")
+	p := Start(t, cfg)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Process was reported ready but does not accept connections: %v", err)
+	}
+	conn.Close()
+
+	if err := p.WaitForLog("helper listening", time.Second); err != nil {
+		t.Error(err)
+	}
+	if err := p.WaitForLog("never logged", 50*time.Millisecond); err == nil {
+		t.Error("WaitForLog should time out for a missing line")
+	}
+}
+
+func TestStopIsGraceful(t *testing.T) {
+	cfg, _ := helperConfig(t, "listen")
+	p := Start(t, cfg)
+
+	if err := p.Stop(5 * time.Second); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if err := p.ExitErr(); err != nil {
+		t.Errorf("Process should exit cleanly on SIGTERM, got %v", err)
+	}
+	if !strings.Contains(p.Logs(), "helper shutting down") {
+		t.Errorf("Process did not run its shutdown path:\n%s", p.Logs())
+	}
+}
+
+func TestStopEscalatesToKill(t *testing.T) {
+	cfg, _ := helperConfig(t, "stubborn")
+	p := Start(t, cfg)
+
+	err := p.Stop(200 * time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Errorf("Expected Stop to report a kill, got %v", err)
+	}
+	if !p.Exited() {
+		t.Fatal("Process should have exited")
+	}
+	if !strings.Contains(p.Logs(), "ignoring SIGTERM") {
+		t.Errorf("Process never saw SIGTERM:\n%s", p.Logs())
+	}
+}
+
+func TestStopResumesStoppedProcess(t *testing.T) {
+	cfg, _ := helperConfig(t, "listen")
+	p := Start(t, cfg)
+
+	if err := p.Signal(syscall.SIGSTOP); err != nil {
+		t.Fatalf("SIGSTOP failed: %v", err)
+	}
+	if err := p.Stop(5 * time.Second); err != nil {
+		t.Errorf("Stopped process should still shut down gracefully: %v", err)
+	}
+}
+
+func TestKill(t *testing.T) {
+	cfg, _ := helperConfig(t, "stubborn")
+	p := Start(t, cfg)
+
+	if err := p.Kill(); err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+	if p.ExitErr() == nil {
+		t.Error("A killed process should report an exit error")
+	}
+	if err := p.Kill(); err != nil {
+		t.Errorf("Killing an exited process should be a no-op, got %v", err)
+	}
+}
+
+func TestStartFailsWhenProcessExits(t *testing.T) {
+	cfg, _ := helperConfig(t, "exit")
+	_, err := start(t, cfg)
+	if err == nil {
+		t.Fatal("Start should fail when the process exits before it is ready")
+	}
+	if !strings.Contains(err.Error(), "helper failing on purpose") {
+		t.Errorf("Error should include the process logs, got: %v", err)
+	}
+}
+
+func TestBuildOncePerRun(t *testing.T) {
+	first := Build(t, "context_cancellation/cmd/token")
+	info, err := os.Stat(first)
+	if err != nil {
+		t.Fatalf("Binary missing: %v", err)
+	}
+
+	second := Build(t, "context_cancellation/cmd/token")
+	if second != first {
+		t.Errorf("Expected the cached binary %s, got %s", first, second)
+	}
+	if again, _ := os.Stat(second); !again.ModTime().Equal(info.ModTime()) {
+		t.Error("Binary was rebuilt")
+	}
+}
@@ -0,0 +1,201 @@
+// Package tlsconfig builds mutual TLS configurations for the echo and worker
+// servers. Certificates, keys and the CA bundle are re-read from disk when
+// the files change, so rotated certificates are picked up without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Files locates the PEM files for one side of a mutual TLS connection
+type Files struct {
+	CertFile string // certificate presented to the peer
+	KeyFile  string // private key for CertFile
+	CAFile   string // CA bundle used to verify the peer
+}
+
+// Enabled reports whether any TLS file was configured
+func (f Files) Enabled() bool {
+	return f.CertFile != "" || f.KeyFile != "" || f.CAFile != ""
+}
+
+// Validate checks that either all files or none are set
+func (f Files) Validate() error {
+	if !f.Enabled() {
+		return nil
+	}
+	if f.CertFile == "" || f.KeyFile == "" || f.CAFile == "" {
+		return errors.New("mutual TLS needs a certificate, a key and a CA file")
+	}
+	return nil
+}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader holds the current certificate and CA pool and reloads them when
+// the files on disk change. The files are checked on every TLS handshake,
+// which is cheap (three stat calls) and means a rotation is visible to the
+// very next connection.
+type Reloader struct {
+	files  Files
+	prefix string
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	stamps [3]fileStamp
+}
+
+// NewReloader loads the files once and fails if they are unusable.
+// logPrefix is prepended to reload log lines, e.g. "[WORKER]".
+func NewReloader(files Files, logPrefix string) (*Reloader, error) {
+	if err := files.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Reloader{files: files, prefix: logPrefix}
+	stamps, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(stamps); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) stat() ([3]fileStamp, error) {
+	var stamps [3]fileStamp
+	for i, path := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return stamps, fmt.Errorf("failed to stat %s: %v", path, err)
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+func (r *Reloader) load(stamps [3]fileStamp) error {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load key pair: %v", err)
+	}
+
+	caPEM, err := os.ReadFile(r.files.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in CA file %s", r.files.CAFile)
+	}
+
+	r.mu.Lock()
+	r.cert, r.pool, r.stamps = &cert, pool, stamps
+	r.mu.Unlock()
+	return nil
+}
+
+// current returns the certificate and CA pool, reloading them first if any file changed.
+// A failed reload (for example a half-written file during rotation) keeps the
+// previous material and is retried on the next handshake.
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	stamps, err := r.stat()
+
+	r.mu.RLock()
+	changed := err == nil && stamps != r.stamps
+	cert, pool := r.cert, r.pool
+	r.mu.RUnlock()
+
+	if !changed {
+		return cert, pool
+	}
+
+	if err := r.load(stamps); err != nil {
+		log.Printf("%s ⚠️  Failed to reload TLS certificates, keeping previous ones: %v", r.prefix, err)
+		return cert, pool
+	}
+	log.Printf("%s Reloaded TLS certificates from %s", r.prefix, r.files.CertFile)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+// ServerConfig returns a server configuration that requires and verifies client certificates
+func (r *Reloader) ServerConfig() *tls.Config {
+	// The per-connection config replaces the one gRPC prepared, so it has to
+	// advertise HTTP/2 itself
+	return r.serverConfig("h2")
+}
+
+// HTTPServerConfig is ServerConfig for an HTTP server, which also speaks
+// HTTP/1.1 to clients such as curl
+func (r *Reloader) HTTPServerConfig() *tls.Config {
+	return r.serverConfig("h2", "http/1.1")
+}
+
+func (r *Reloader) serverConfig(protos ...string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+				ClientCAs:    pool,
+				NextProtos:   protos,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a client configuration that presents the client
+// certificate and verifies the server against the CA bundle for serverName
+func (r *Reloader) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		// RootCAs cannot change after the config is built, so the standard
+		// verification is replaced by VerifyConnection, which uses the
+		// current (possibly reloaded) CA pool
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, pool := r.current()
+			return verifyServer(cs, pool)
+		},
+	}
+}
+
+func verifyServer(cs tls.ConnectionState, pool *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return err
+}
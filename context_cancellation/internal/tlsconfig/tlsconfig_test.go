@@ -0,0 +1,231 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// testCA is a throwaway certificate authority generated for one test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64 = 1
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a leaf certificate signed by the CA, plus the CA bundle, into dir
+func (ca *testCA) issue(t *testing.T, dir, name string) Files {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	files := Files{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+		CAFile:   filepath.Join(dir, name+"-ca.crt"),
+	}
+	writeFile(t, files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	writeFile(t, files.CAFile, ca.pem)
+	return files
+}
+
+// writeFile replaces path atomically, the way certificate rotation tools do
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("Failed to rename %s: %v", tmp, err)
+	}
+}
+
+// startServer serves the gRPC health service with mutual TLS
+func startServer(t *testing.T, files Files) string {
+	t.Helper()
+	reloader, err := NewReloader(files, "[TEST]")
+	if err != nil {
+		t.Fatalf("Failed to create server reloader: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return lis.Addr().String()
+}
+
+func checkHealth(t *testing.T, addr string, creds credentials.TransportCredentials) error {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func clientCreds(t *testing.T, files Files) credentials.TransportCredentials {
+	t.Helper()
+	reloader, err := NewReloader(files, "[TEST]")
+	if err != nil {
+		t.Fatalf("Failed to create client reloader: %v", err)
+	}
+	return credentials.NewTLS(reloader.ClientConfig("localhost"))
+}
+
+func expectRejected(t *testing.T, err error) {
+	t.Helper()
+	if code := status.Code(err); code != codes.Unavailable && code != codes.Unauthenticated {
+		t.Errorf("Expected Unavailable or Unauthenticated, got %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	addr := startServer(t, ca.issue(t, dir, "worker"))
+
+	t.Run("valid client certificate", func(t *testing.T) {
+		if err := checkHealth(t, addr, clientCreds(t, ca.issue(t, dir, "echo"))); err != nil {
+			t.Fatalf("Authenticated client was rejected: %v", err)
+		}
+	})
+
+	t.Run("plaintext client", func(t *testing.T) {
+		expectRejected(t, checkHealth(t, addr, insecure.NewCredentials()))
+	})
+
+	t.Run("TLS client without certificate", func(t *testing.T) {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		creds := credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "localhost"})
+		expectRejected(t, checkHealth(t, addr, creds))
+	})
+
+	t.Run("client certificate from another CA", func(t *testing.T) {
+		other := newTestCA(t, "other-ca")
+		files := other.issue(t, dir, "intruder")
+		// Trust the real CA so only the client certificate is wrong
+		writeFile(t, files.CAFile, ca.pem)
+		expectRejected(t, checkHealth(t, addr, clientCreds(t, files)))
+	})
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := newTestCA(t, "old-ca")
+	serverFiles := oldCA.issue(t, dir, "worker")
+	addr := startServer(t, serverFiles)
+
+	oldClient := oldCA.issue(t, dir, "echo-old")
+	if err := checkHealth(t, addr, clientCreds(t, oldClient)); err != nil {
+		t.Fatalf("Client was rejected before rotation: %v", err)
+	}
+
+	// Rotate the server to a certificate from a new CA, in place
+	newCA := newTestCA(t, "new-ca")
+	rotated := newCA.issue(t, t.TempDir(), "worker")
+	for src, dst := range map[string]string{
+		rotated.CertFile: serverFiles.CertFile,
+		rotated.KeyFile:  serverFiles.KeyFile,
+		rotated.CAFile:   serverFiles.CAFile,
+	} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", src, err)
+		}
+		writeFile(t, dst, data)
+	}
+
+	if err := checkHealth(t, addr, clientCreds(t, newCA.issue(t, dir, "echo-new"))); err != nil {
+		t.Fatalf("Client from the new CA was rejected after rotation: %v", err)
+	}
+	expectRejected(t, checkHealth(t, addr, clientCreds(t, oldClient)))
+}
+
+func TestFilesValidate(t *testing.T) {
+	if err := (Files{}).Validate(); err != nil {
+		t.Errorf("No files should mean TLS disabled, got %v", err)
+	}
+	if err := (Files{CertFile: "a.crt"}).Validate(); err == nil {
+		t.Error("A certificate without key and CA should be rejected")
+	}
+}
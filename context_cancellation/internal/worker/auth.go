@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"context_cancellation/internal/auth"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const callerContextKey contextKey = iota + 1
+
+// callerFromContext returns the caller identity forwarded by the echo server
+func callerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerContextKey).(string)
+	return caller
+}
+
+// unguarded reports whether fullMethod is open to every caller: health checks
+// come from orchestrators and reflection only describes the API
+func unguarded(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/grpc.health.v1.Health/") ||
+		strings.HasPrefix(fullMethod, "/grpc.reflection.")
+}
+
+// NewPolicyAuthFunc returns the auth hook for the interceptor chain.
+//
+// It always reads the caller identity echo forwards in x-caller-id metadata
+// into the context, so DoWork can record it. With a policy it also rejects
+// calls from unknown callers and task_ids outside the caller's prefixes;
+// every rejection is written to the audit log.
+//
+// The worker trusts x-caller-id as sent: run it with mutual TLS so that only
+// the echo server can reach it.
+func NewPolicyAuthFunc(policy *auth.Policy, auditor *auth.Auditor) AuthFunc {
+	var current atomic.Pointer[auth.Policy]
+	current.Store(policy)
+	return NewReloadablePolicyAuthFunc(&current, auditor)
+}
+
+// NewReloadablePolicyAuthFunc is NewPolicyAuthFunc with the policy read from
+// current on every call, so a new policy can be stored while the worker
+// runs. A nil policy allows everything.
+func NewReloadablePolicyAuthFunc(current *atomic.Pointer[auth.Policy], auditor *auth.Auditor) AuthFunc {
+	return func(ctx context.Context, fullMethod string, req any) (context.Context, error) {
+		var caller string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(auth.CallerMetadataKey); len(values) > 0 {
+				caller = values[0]
+			}
+		}
+		ctx = context.WithValue(ctx, callerContextKey, caller)
+
+		policy := current.Load()
+		if policy == nil || unguarded(fullMethod) {
+			return ctx, nil
+		}
+
+		var taskID string
+		switch r := req.(type) {
+		case *workerpb.WorkRequest:
+			taskID = r.TaskId
+		case *workerpb.ConfirmedWorkRequest:
+			taskID = r.GetWork().GetTaskId()
+		}
+
+		code := codes.PermissionDenied
+		allowed, reason := policy.AllowTask(caller, taskID)
+		if caller == "" {
+			code = codes.Unauthenticated
+		}
+		if allowed {
+			return ctx, nil
+		}
+
+		remote := ""
+		if p, ok := peer.FromContext(ctx); ok {
+			remote = p.Addr.String()
+		}
+		log.Printf("[WORKER] Rejected %s for task_id=%s: %s", fullMethod, taskID, reason)
+		auditor.Reject(auth.AuditEvent{
+			Caller:    caller,
+			RequestID: requestIDFromContext(ctx),
+			Target:    fullMethod + " task_id=" + taskID,
+			Remote:    remote,
+			Reason:    reason,
+		})
+		return nil, status.Error(code, reason)
+	}
+}
@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"context_cancellation/internal/auth"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestPolicyAuthFunc(t *testing.T) {
+	captureLogs(t)
+
+	policy := &auth.Policy{Callers: map[string]auth.CallerPolicy{
+		"alice": {TaskPrefixes: []string{"alice-"}},
+	}}
+	var audit bytes.Buffer
+	authFn := NewPolicyAuthFunc(policy, auth.NewAuditor(&audit, "worker"))
+
+	client := startInterceptedServer(t, &testWorker{doWork: func(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error) {
+		return &workerpb.WorkResponse{Success: true, Message: callerFromContext(ctx)}, nil
+	}}, authFn)
+
+	asCaller := func(caller string) context.Context {
+		if caller == "" {
+			return context.Background()
+		}
+		return metadata.AppendToOutgoingContext(context.Background(), auth.CallerMetadataKey, caller)
+	}
+
+	resp, err := client.DoWork(asCaller("alice"), &workerpb.WorkRequest{TaskId: "alice-001"})
+	if err != nil {
+		t.Fatalf("alice should be allowed alice-001: %v", err)
+	}
+	if resp.Message != "alice" {
+		t.Errorf("Expected caller alice in the handler context, got %q", resp.Message)
+	}
+
+	tests := []struct {
+		caller, taskID string
+		want           codes.Code
+	}{
+		{"alice", "bob-001", codes.PermissionDenied},
+		{"mallory", "alice-001", codes.PermissionDenied},
+		{"", "alice-001", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		_, err := client.DoWork(asCaller(tt.caller), &workerpb.WorkRequest{TaskId: tt.taskID})
+		if status.Code(err) != tt.want {
+			t.Errorf("caller=%q task_id=%q: expected %v, got %v", tt.caller, tt.taskID, tt.want, err)
+		}
+	}
+
+	// DoWorkConfirmed carries the task_id in its first stream message
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.CallerMetadataKey, "alice"))
+	work := &workerpb.ConfirmedWorkRequest{
+		Msg: &workerpb.ConfirmedWorkRequest_Work{Work: &workerpb.WorkRequest{TaskId: "alice-002"}},
+	}
+	if _, err := authFn(incoming, workerpb.WorkerService_DoWorkConfirmed_FullMethodName, work); err != nil {
+		t.Errorf("alice should be allowed alice-002 over DoWorkConfirmed: %v", err)
+	}
+
+	if lines := strings.Count(audit.String(), "\n"); lines != len(tests) {
+		t.Errorf("Expected %d audit events, got %d:\n%s", len(tests), lines, audit.String())
+	}
+}
+
+func TestPolicyAuthFuncWithoutPolicy(t *testing.T) {
+	authFn := NewPolicyAuthFunc(nil, auth.NewAuditor(&bytes.Buffer{}, "worker"))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.CallerMetadataKey, "bob"))
+	ctx, err := authFn(ctx, "/worker.WorkerService/DoWork", &workerpb.WorkRequest{TaskId: "any"})
+	if err != nil {
+		t.Fatalf("Without a policy every call is allowed: %v", err)
+	}
+	if got := callerFromContext(ctx); got != "bob" {
+		t.Errorf("Expected caller bob to be recorded, got %q", got)
+	}
+}
+
+func TestGatewayDropsCallerHeader(t *testing.T) {
+	if _, ok := gatewayHeaderMatcher("Grpc-Metadata-X-Caller-Id"); ok {
+		t.Error("The gateway must not let HTTP clients set the caller identity")
+	}
+}
+
+func TestReloadablePolicyAuthFunc(t *testing.T) {
+	captureLogs(t)
+
+	var current atomic.Pointer[auth.Policy]
+	authFn := NewReloadablePolicyAuthFunc(&current, auth.NewAuditor(&bytes.Buffer{}, "worker"))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(auth.CallerMetadataKey, "bob"))
+	req := &workerpb.WorkRequest{TaskId: "bob-001"}
+
+	if _, err := authFn(ctx, "/worker.WorkerService/DoWork", req); err != nil {
+		t.Fatalf("Without a policy every call is allowed: %v", err)
+	}
+
+	current.Store(&auth.Policy{Callers: map[string]auth.CallerPolicy{"alice": {TaskPrefixes: []string{""}}}})
+	if _, err := authFn(ctx, "/worker.WorkerService/DoWork", req); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("bob is not in the new policy, expected PermissionDenied, got %v", err)
+	}
+
+	current.Store(&auth.Policy{Callers: map[string]auth.CallerPolicy{"bob": {TaskPrefixes: []string{"bob-"}}}})
+	if _, err := authFn(ctx, "/worker.WorkerService/DoWork", req); err != nil {
+		t.Errorf("bob was added to the policy: %v", err)
+	}
+}
+
+func TestPolicyAuthFuncLetsHealthChecksThrough(t *testing.T) {
+	policy := &auth.Policy{Callers: map[string]auth.CallerPolicy{}}
+	authFn := NewPolicyAuthFunc(policy, auth.NewAuditor(&bytes.Buffer{}, "worker"))
+
+	for _, method := range []string{
+		"/grpc.health.v1.Health/Check",
+		"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	} {
+		if _, err := authFn(context.Background(), method, nil); err != nil {
+			t.Errorf("%s should not need a caller: %v", method, err)
+		}
+	}
+	if _, err := authFn(context.Background(), workerpb.WorkerService_DoWork_FullMethodName, &workerpb.WorkRequest{TaskId: "x"}); err == nil {
+		t.Error("DoWork without a caller must still be rejected")
+	}
+}
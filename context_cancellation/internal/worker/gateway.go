@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"context_cancellation/internal/auth"
+	"context_cancellation/workerpb"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+)
+
+// NewGatewayHandler returns an HTTP handler that transcodes HTTP/JSON calls
+// into gRPC calls on conn, following the google.api.http annotations in
+// worker.proto (POST /v1/work -> DoWork).
+//
+// The generated handlers derive the gRPC context from the HTTP request
+// context, so a client closing the HTTP connection cancels DoWork exactly
+// like a cancelled gRPC call does.
+func NewGatewayHandler(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(gatewayHeaderMatcher),
+	)
+	if err := workerpb.RegisterWorkerServiceHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// ServeGateway serves the gateway with srv on lis. With mutual TLS the
+// gateway calls the worker with the worker's own certificate, so it must not
+// hand that identity to callers who have none: given tlsConfig, which has to
+// require and verify client certificates, it serves HTTPS only.
+func ServeGateway(srv *http.Server, lis net.Listener, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		return srv.Serve(lis)
+	}
+	srv.TLSConfig = tlsConfig
+	return srv.ServeTLS(lis, "", "")
+}
+
+// gatewayHeaderMatcher forwards X-Request-Id as the same "request-id" metadata
+// the echo server sends, plus the default Grpc-Metadata-* headers.
+// The caller identity is never taken from HTTP headers: anyone can set them,
+// so gateway calls reach the auth hook without a caller.
+func gatewayHeaderMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "X-Request-Id") {
+		return "request-id", true
+	}
+	name, ok := runtime.DefaultHeaderMatcher(key)
+	if ok && strings.EqualFold(name, auth.CallerMetadataKey) {
+		return "", false
+	}
+	return name, ok
+}
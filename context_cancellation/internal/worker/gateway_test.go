@@ -0,0 +1,337 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/tlsconfig"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// syncBuffer is a bytes.Buffer that is safe to use as log output
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLogs redirects the standard logger into a buffer for the duration of the test
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return logs
+}
+
+// startGateway runs a worker gRPC server and the HTTP/JSON gateway in front of it
+func startGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer(ServerInterceptors(nil)...)
+	workerpb.RegisterWorkerServiceServer(grpcServer, NewServer(db))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create gateway connection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	handler, err := NewGatewayHandler(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("Failed to register gateway: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// writeTestCertificate writes a throwaway CA and a certificate for localhost
+// signed by it into dir, for both the worker and its clients
+func writeTestCertificate(t *testing.T, dir string) tlsconfig.Files {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "worker"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	files := tlsconfig.Files{
+		CertFile: filepath.Join(dir, "worker.crt"),
+		KeyFile:  filepath.Join(dir, "worker.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	for path, block := range map[string]*pem.Block{
+		files.CertFile: {Type: "CERTIFICATE", Bytes: der},
+		files.KeyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+		files.CAFile:   {Type: "CERTIFICATE", Bytes: caDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return files
+}
+
+// startTLSGateway is startGateway with mutual TLS set up the way cmd/worker
+// does it. It returns the gateway's address and the worker's TLS files.
+func startTLSGateway(t *testing.T) (string, tlsconfig.Files) {
+	t.Helper()
+	files := writeTestCertificate(t, t.TempDir())
+	reloader, err := tlsconfig.NewReloader(files, "[TEST]")
+	if err != nil {
+		t.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	opts := append(ServerInterceptors(nil), grpc.Creds(credentials.NewTLS(reloader.ServerConfig())))
+	grpcServer := grpc.NewServer(opts...)
+	workerpb.RegisterWorkerServiceServer(grpcServer, NewServer(db))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(reloader.ClientConfig("localhost"))))
+	if err != nil {
+		t.Fatalf("Failed to create gateway connection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	handler, err := NewGatewayHandler(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("Failed to register gateway: %v", err)
+	}
+	gatewayLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: handler}
+	go ServeGateway(server, gatewayLis, reloader.HTTPServerConfig())
+	t.Cleanup(func() { server.Close() })
+
+	return gatewayLis.Addr().String(), files
+}
+
+// TestGatewayRequiresClientCertificate checks that under mutual TLS only
+// callers with a certificate reach DoWork through the gateway, which itself
+// calls the worker with the worker's certificate
+func TestGatewayRequiresClientCertificate(t *testing.T) {
+	logs := captureLogs(t)
+	addr, files := startTLSGateway(t)
+	caPEM, err := os.ReadFile(files.CAFile)
+	if err != nil {
+		t.Fatalf("Failed to read CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+
+	post := func(client *http.Client, url, taskID string) (*http.Response, error) {
+		return client.Post(url+"/v1/work", "application/json",
+			strings.NewReader(`{"task_id":"`+taskID+`","data":"hello"}`))
+	}
+
+	t.Run("plain HTTP", func(t *testing.T) {
+		resp, err := post(http.DefaultClient, "http://"+addr, "gw-tls-plain")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Expected 400 for plain HTTP, got %d", resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("HTTPS without certificate", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "localhost"},
+		}}
+		resp, err := post(client, "https://"+addr, "gw-tls-nocert")
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("Expected the handshake to fail without a client certificate, got %d", resp.StatusCode)
+		}
+	})
+
+	if strings.Contains(logs.String(), "gw-tls-") {
+		t.Fatalf("DoWork was reached without a client certificate:\n%s", logs)
+	}
+
+	t.Run("HTTPS with certificate", func(t *testing.T) {
+		cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+		if err != nil {
+			t.Fatalf("Failed to load client certificate: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "localhost", Certificates: []tls.Certificate{cert}},
+		}}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+addr+"/v1/work",
+			strings.NewReader(`{"task_id":"gw-tls-cert","data":"hello"}`))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		go func() {
+			if resp, err := client.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}()
+		waitForLog(t, logs, "Inserted task record for task_id=gw-tls-cert")
+	})
+}
+
+func TestGatewayCancellationRollsBack(t *testing.T) {
+	logs := captureLogs(t)
+	server := startGateway(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v1/work",
+		strings.NewReader(`{"task_id":"gw-cancel-001","data":"hello"}`))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	requestDone := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestDone <- err
+	}()
+
+	waitForLog(t, logs, "Inserted task record for task_id=gw-cancel-001")
+	cancel()
+
+	if err := <-requestDone; err == nil {
+		t.Fatal("HTTP request should have failed after cancellation")
+	}
+
+	waitForLog(t, logs, "TRANSACTION ROLLED BACK for task_id=gw-cancel-001")
+}
+
+func TestGatewayRejectsMalformedJSON(t *testing.T) {
+	server := startGateway(t)
+
+	resp, err := http.Post(server.URL+"/v1/work", "application/json", strings.NewReader(`{"task_id":`))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for malformed JSON, got %d", resp.StatusCode)
+	}
+}
+
+func TestGatewayHeaderMatcher(t *testing.T) {
+	if key, ok := gatewayHeaderMatcher("X-Request-Id"); !ok || key != "request-id" {
+		t.Errorf("X-Request-Id should map to request-id, got %q, %v", key, ok)
+	}
+	if key, ok := gatewayHeaderMatcher("Grpc-Metadata-Tenant"); !ok || !strings.EqualFold(key, "tenant") {
+		t.Errorf("Grpc-Metadata-Tenant should map to tenant, got %q, %v", key, ok)
+	}
+}
+
+func waitForLog(t *testing.T, logs *syncBuffer, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(logs.String(), substr) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for log %q\nLogs:\n%s", substr, logs.String())
+}
@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadataKey is the metadata key the echo server uses to pass its request_id
+const requestIDMetadataKey = "request-id"
+
+type contextKey int
+
+const requestIDContextKey contextKey = iota
+
+// Metrics published on /debug/vars of the admin listener
+var (
+	grpcRequests = expvar.NewMap("worker_grpc_requests")
+	grpcPanics   = expvar.NewMap("worker_grpc_panics")
+	grpcInFlight = expvar.NewInt("worker_grpc_in_flight")
+)
+
+// AuthFunc is the hook for authenticating a call before it reaches the handler.
+// On a stream it runs when the first message arrives, with that message as req,
+// and the context it returns replaces the stream's. Returning an error rejects
+// the call; the error should be a status error (usually codes.Unauthenticated
+// or codes.PermissionDenied).
+type AuthFunc func(ctx context.Context, fullMethod string, req any) (context.Context, error)
+
+// ServerInterceptors returns the interceptor chain for the worker gRPC server.
+//
+// Order matters: the request id is extracted first so every later step can log
+// it, logging and metrics wrap recovery so they observe the codes.Internal a
+// panic is turned into, and auth runs last, right before the handler.
+func ServerInterceptors(auth AuthFunc) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			requestIDUnaryInterceptor,
+			loggingUnaryInterceptor,
+			metricsUnaryInterceptor,
+			recoveryUnaryInterceptor,
+			authUnaryInterceptor(auth),
+		),
+		grpc.ChainStreamInterceptor(
+			requestIDStreamInterceptor,
+			loggingStreamInterceptor,
+			metricsStreamInterceptor,
+			recoveryStreamInterceptor,
+			authStreamInterceptor(auth),
+		),
+	}
+}
+
+// requestIDFromContext returns the request id stored by the request id interceptor
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// extractRequestID reads the request id from incoming metadata, or generates one,
+// stores it in the context and echoes it back in the response header
+func extractRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDMetadataKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, id))
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "wrk-" + hex.EncodeToString(b)
+}
+
+func requestIDUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(extractRequestID(ctx), req)
+}
+
+func requestIDStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: extractRequestID(ss.Context())})
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logAccess(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logAccess(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+func logAccess(ctx context.Context, fullMethod string, start time.Time, err error) {
+	remote := "unknown"
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	log.Printf("[WORKER] access method=%s request_id=%s peer=%s code=%s duration=%s",
+		fullMethod, requestIDFromContext(ctx), remote, status.Code(err), time.Since(start))
+}
+
+func metricsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	grpcInFlight.Add(1)
+	defer grpcInFlight.Add(-1)
+
+	resp, err := handler(ctx, req)
+	grpcRequests.Add(fmt.Sprintf("%s %s", info.FullMethod, status.Code(err)), 1)
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	grpcInFlight.Add(1)
+	defer grpcInFlight.Add(-1)
+
+	err := handler(srv, ss)
+	grpcRequests.Add(fmt.Sprintf("%s %s", info.FullMethod, status.Code(err)), 1)
+	return err
+}
+
+// recoveryUnaryInterceptor turns a panic in the handler into codes.Internal.
+//
+// Handlers roll back with a deferred tx.Rollback(), and deferred calls still
+// run while a panic unwinds, so by the time we recover here the transaction
+// has already been rolled back.
+func recoveryUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverPanic(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func recoveryStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recoverPanic(ss.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func recoverPanic(ctx context.Context, fullMethod string, r any) error {
+	grpcPanics.Add(fullMethod, 1)
+	log.Printf("[WORKER] ⚠️  PANIC in %s for request_id=%s: %v\n%s", fullMethod, requestIDFromContext(ctx), r, debug.Stack())
+	return status.Errorf(codes.Internal, "internal error in %s", fullMethod)
+}
+
+func authUnaryInterceptor(auth AuthFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if auth == nil {
+			return handler(ctx, req)
+		}
+		ctx, err := auth(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authStreamInterceptor runs the auth hook on the first message of a stream,
+// which carries the task_id the policy decides on. Stream handlers must
+// receive that message before they use the stream's context.
+func authStreamInterceptor(auth AuthFunc) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if auth == nil {
+			return handler(srv, ss)
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ss.Context(), auth: auth, fullMethod: info.FullMethod})
+	}
+}
+
+// authServerStream authorizes the first message received on a stream
+type authServerStream struct {
+	grpc.ServerStream
+	ctx        context.Context
+	auth       AuthFunc
+	fullMethod string
+	authorized bool
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.authorized {
+		return nil
+	}
+	ctx, err := s.auth(s.ctx, s.fullMethod, m)
+	if err != nil {
+		return err
+	}
+	s.ctx = ctx
+	s.authorized = true
+	return nil
+}
+
+// contextServerStream overrides the context of a grpc.ServerStream
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
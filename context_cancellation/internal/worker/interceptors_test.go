@@ -0,0 +1,188 @@
+package worker
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testWorker lets each test plug in its own DoWork
+type testWorker struct {
+	workerpb.UnimplementedWorkerServiceServer
+	doWork func(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error)
+}
+
+func (w *testWorker) DoWork(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error) {
+	return w.doWork(ctx, req)
+}
+
+// startInterceptedServer serves impl behind the worker interceptor chain
+func startInterceptedServer(t *testing.T, impl workerpb.WorkerServiceServer, auth AuthFunc) workerpb.WorkerServiceClient {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := grpc.NewServer(ServerInterceptors(auth)...)
+	workerpb.RegisterWorkerServiceServer(server, impl)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return workerpb.NewWorkerServiceClient(conn)
+}
+
+func TestRecoveryRollsBackTransaction(t *testing.T) {
+	captureLogs(t)
+
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	defer db.Close()
+
+	client := startInterceptedServer(t, &testWorker{doWork: func(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO worker_tasks (task_id, data) VALUES (?, ?)", req.TaskId, req.Data); err != nil {
+			return nil, err
+		}
+		if req.Data == "panic" {
+			panic("boom")
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return &workerpb.WorkResponse{Success: true}, nil
+	}}, nil)
+
+	_, err = client.DoWork(context.Background(), &workerpb.WorkRequest{TaskId: "panic-001", Data: "panic"})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Expected codes.Internal after panic, got %v", err)
+	}
+
+	// The server survived and the panicking transaction released its lock
+	if _, err := client.DoWork(context.Background(), &workerpb.WorkRequest{TaskId: "ok-001", Data: "ok"}); err != nil {
+		t.Fatalf("Server should keep working after a panic: %v", err)
+	}
+
+	var taskIDs []string
+	rows, err := db.Query("SELECT task_id FROM worker_tasks")
+	if err != nil {
+		t.Fatalf("Failed to query tasks: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		taskIDs = append(taskIDs, id)
+	}
+	if len(taskIDs) != 1 || taskIDs[0] != "ok-001" {
+		t.Errorf("Expected only ok-001 to be committed, got %v", taskIDs)
+	}
+}
+
+func TestRequestIDInterceptor(t *testing.T) {
+	captureLogs(t)
+
+	client := startInterceptedServer(t, &testWorker{doWork: func(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error) {
+		return &workerpb.WorkResponse{Success: true, Message: requestIDFromContext(ctx)}, nil
+	}}, nil)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDMetadataKey, "echo-req-001")
+	var header metadata.MD
+	resp, err := client.DoWork(ctx, &workerpb.WorkRequest{TaskId: "t"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatalf("DoWork failed: %v", err)
+	}
+	if resp.Message != "echo-req-001" {
+		t.Errorf("Expected request id from metadata, got %q", resp.Message)
+	}
+	if got := header.Get(requestIDMetadataKey); len(got) != 1 || got[0] != "echo-req-001" {
+		t.Errorf("Expected request id in response header, got %v", got)
+	}
+
+	resp, err = client.DoWork(context.Background(), &workerpb.WorkRequest{TaskId: "t"})
+	if err != nil {
+		t.Fatalf("DoWork failed: %v", err)
+	}
+	if !strings.HasPrefix(resp.Message, "wrk-") {
+		t.Errorf("Expected a generated request id, got %q", resp.Message)
+	}
+}
+
+func TestAuthHookRejectsBeforeHandler(t *testing.T) {
+	logs := captureLogs(t)
+
+	called := false
+	auth := func(ctx context.Context, fullMethod string, req any) (context.Context, error) {
+		if req.(*workerpb.WorkRequest).TaskId == "forbidden" {
+			return nil, status.Error(codes.PermissionDenied, "not allowed")
+		}
+		return ctx, nil
+	}
+	client := startInterceptedServer(t, &testWorker{doWork: func(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error) {
+		called = true
+		return &workerpb.WorkResponse{Success: true}, nil
+	}}, auth)
+
+	_, err := client.DoWork(context.Background(), &workerpb.WorkRequest{TaskId: "forbidden"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+	if called {
+		t.Error("Handler must not run when auth rejects the call")
+	}
+	if !strings.Contains(logs.String(), "code=PermissionDenied") {
+		t.Errorf("Rejected call should be in the access log:\n%s", logs.String())
+	}
+}
+
+func TestAuthHookSeesFirstStreamMessage(t *testing.T) {
+	captureLogs(t)
+
+	var seen []string
+	auth := func(ctx context.Context, fullMethod string, req any) (context.Context, error) {
+		taskID := req.(*workerpb.ConfirmedWorkRequest).GetWork().GetTaskId()
+		seen = append(seen, taskID)
+		if taskID == "forbidden" {
+			return nil, status.Error(codes.PermissionDenied, "not allowed")
+		}
+		return ctx, nil
+	}
+	// Rejected before DoWorkConfirmed touches the database
+	client := startInterceptedServer(t, NewServer(nil), auth)
+
+	stream, err := client.DoWorkConfirmed(context.Background())
+	if err != nil {
+		t.Fatalf("DoWorkConfirmed failed: %v", err)
+	}
+	stream.Send(&workerpb.ConfirmedWorkRequest{
+		Msg: &workerpb.ConfirmedWorkRequest_Work{Work: &workerpb.WorkRequest{TaskId: "forbidden"}},
+	})
+	if _, err := stream.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Expected PermissionDenied, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "forbidden" {
+		t.Errorf("Auth hook should see the first message once, saw %v", seen)
+	}
+}
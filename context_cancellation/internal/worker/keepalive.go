@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// KeepaliveConfig controls how the worker notices clients that have gone
+// silent. A dead client's connection is closed, which cancels the context of
+// every DoWork call on it, so their transactions roll back instead of
+// committing for a caller that is no longer there.
+type KeepaliveConfig struct {
+	// Time is how long a connection may be idle before the worker pings the client
+	Time time.Duration
+	// Timeout is how long the worker waits for the ping to be answered
+	Timeout time.Duration
+	// MinTime is the shortest ping interval clients may use; faster clients are disconnected
+	MinTime time.Duration
+	// PermitWithoutStream lets clients ping while they have no call in flight
+	PermitWithoutStream bool
+}
+
+// DefaultKeepalive notices a dead client within about 40 seconds
+func DefaultKeepalive() KeepaliveConfig {
+	return KeepaliveConfig{
+		Time:                30 * time.Second,
+		Timeout:             10 * time.Second,
+		MinTime:             5 * time.Second,
+		PermitWithoutStream: true,
+	}
+}
+
+// Validate rejects settings gRPC would silently change
+func (c KeepaliveConfig) Validate() error {
+	if c.Time < time.Second {
+		return fmt.Errorf("keepalive time %v is below gRPC's minimum of 1s", c.Time)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("keepalive timeout must be positive, got %v", c.Timeout)
+	}
+	if c.MinTime < 0 {
+		return fmt.Errorf("keepalive min time must not be negative, got %v", c.MinTime)
+	}
+	return nil
+}
+
+// ServerOptions returns the keepalive parameters and enforcement policy for grpc.NewServer
+func (c KeepaliveConfig) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    c.Time,
+			Timeout: c.Timeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.MinTime,
+			PermitWithoutStream: c.PermitWithoutStream,
+		}),
+	}
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeepaliveConfigValidate(t *testing.T) {
+	if err := DefaultKeepalive().Validate(); err != nil {
+		t.Fatalf("Default keepalive settings are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *KeepaliveConfig)
+	}{
+		{"time below gRPC minimum", func(c *KeepaliveConfig) { c.Time = 500 * time.Millisecond }},
+		{"zero timeout", func(c *KeepaliveConfig) { c.Timeout = 0 }},
+		{"negative min time", func(c *KeepaliveConfig) { c.MinTime = -time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := DefaultKeepalive()
+			tt.modify(&c)
+			if err := c.Validate(); err == nil {
+				t.Errorf("Expected %+v to be rejected", c)
+			}
+		})
+	}
+}
+
+// The worker must accept pings at echo's default rate, or it would
+// disconnect healthy clients with "too_many_pings"
+func TestDefaultKeepaliveAllowsEchoPings(t *testing.T) {
+	const echoDefaultTime = 30 * time.Second
+	if ka := DefaultKeepalive(); ka.MinTime > echoDefaultTime {
+		t.Errorf("MinTime %v is longer than echo's ping interval %v", ka.MinTime, echoDefaultTime)
+	}
+}
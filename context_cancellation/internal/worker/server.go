@@ -0,0 +1,293 @@
+// Package worker is the gRPC worker service: DoWork records a task in its own
+// SQLite transaction and commits only if the caller is still waiting when the
+// work finishes. It also holds the worker's interceptors, auth hook and
+// HTTP/JSON gateway, so tests can run the service in-process.
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/clock"
+	"context_cancellation/internal/sqliteutil"
+	"context_cancellation/workerpb"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// workDuration is how long DoWork takes before it commits
+	workDuration = 3 * time.Second
+	// tickInterval is how often DoWork checks the clock while working
+	tickInterval = 100 * time.Millisecond
+	// defaultConfirmTimeout is how long DoWorkConfirmed waits for the caller's go-ahead
+	defaultConfirmTimeout = time.Second
+)
+
+// Server implements the WorkerService
+type Server struct {
+	workerpb.UnimplementedWorkerServiceServer
+	db             *sql.DB
+	clock          clock.Clock
+	confirmTimeout atomic.Int64
+	tracker        *admin.Tracker
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithClock runs the DoWork loop on c instead of the wall clock
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
+
+// WithConfirmTimeout sets how long DoWorkConfirmed waits for the caller's
+// go-ahead before rolling back
+func WithConfirmTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.confirmTimeout.Store(int64(d))
+	}
+}
+
+// SetConfirmTimeout changes the confirm timeout for calls that have not yet
+// asked for confirmation
+func (s *Server) SetConfirmTimeout(d time.Duration) {
+	s.confirmTimeout.Store(int64(d))
+}
+
+// WithTracker lists every task in t while it is worked on, so an operator
+// can see it and cancel it
+func WithTracker(t *admin.Tracker) Option {
+	return func(s *Server) {
+		s.tracker = t
+	}
+}
+
+// NewServer returns a WorkerService that records tasks in db
+func NewServer(db *sql.DB, opts ...Option) *Server {
+	s := &Server{db: db, clock: clock.Real()}
+	s.confirmTimeout.Store(int64(defaultConfirmTimeout))
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// DoWork implements the DoWork RPC method
+func (s *Server) DoWork(ctx context.Context, req *workerpb.WorkRequest) (*workerpb.WorkResponse, error) {
+	return s.doWork(ctx, req, nil)
+}
+
+// DoWorkConfirmed implements the DoWorkConfirmed RPC method: the same work as
+// DoWork, committed only once the caller confirms it still wants the result
+func (s *Server) DoWorkConfirmed(stream workerpb.WorkerService_DoWorkConfirmedServer) error {
+	// The auth hook runs on the first message, so read it before the context
+	msg, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "stream closed before a WorkRequest was sent")
+	}
+	if err != nil {
+		return err
+	}
+	req := msg.GetWork()
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "first message must be a WorkRequest")
+	}
+
+	resp, err := s.doWork(stream.Context(), req, func(ctx context.Context) error {
+		return s.awaitCommitDecision(ctx, stream, req.TaskId)
+	})
+	if err != nil {
+		return err
+	}
+	return stream.Send(&workerpb.ConfirmedWorkResponse{
+		Msg: &workerpb.ConfirmedWorkResponse_Result{Result: resp},
+	})
+}
+
+// awaitCommitDecision tells the caller the work is done and waits for its
+// decision. It returns nil only for an explicit go-ahead within the confirm timeout.
+func (s *Server) awaitCommitDecision(ctx context.Context, stream workerpb.WorkerService_DoWorkConfirmedServer, taskID string) error {
+	confirmTimeout := time.Duration(s.confirmTimeout.Load())
+	log.Printf("[WORKER] Work done, waiting up to %v for commit confirmation for task_id=%s", confirmTimeout, taskID)
+	err := stream.Send(&workerpb.ConfirmedWorkResponse{
+		Msg: &workerpb.ConfirmedWorkResponse_Ready{Ready: &workerpb.ReadyToCommit{
+			TaskId:           taskID,
+			ConfirmTimeoutMs: confirmTimeout.Milliseconds(),
+		}},
+	})
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to ask for commit confirmation: %v", err)
+	}
+
+	ctx, cancel := s.clock.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+
+	// Recv cannot be interrupted; it returns once the handler does
+	decisions := make(chan error, 1)
+	go func() {
+		msg, err := stream.Recv()
+		switch {
+		case err == io.EOF:
+			decisions <- status.Error(codes.Aborted, "caller closed the stream without confirming")
+		case err != nil:
+			decisions <- err
+		case msg.GetDecision() == nil:
+			decisions <- status.Error(codes.InvalidArgument, "expected a CommitDecision")
+		case !msg.GetDecision().Commit:
+			decisions <- status.Error(codes.Aborted, "caller declined the commit")
+		default:
+			decisions <- nil
+		}
+	}()
+
+	select {
+	case err := <-decisions:
+		return err
+	case <-ctx.Done():
+		if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			return status.Errorf(codes.DeadlineExceeded, "no commit confirmation within %v", confirmTimeout)
+		}
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// doWork records the task and works on it inside one transaction. With a
+// confirm func it asks the caller before committing and rolls back unless
+// confirm returns nil.
+func (s *Server) doWork(ctx context.Context, req *workerpb.WorkRequest, confirm func(ctx context.Context) error) (*workerpb.WorkResponse, error) {
+	taskID := req.TaskId
+	caller := callerFromContext(ctx)
+	log.Printf("[WORKER] Received work request: task_id=%s, data=%s, request_id=%s, caller=%s", taskID, req.Data, requestIDFromContext(ctx), caller)
+	ctx, done := s.tracker.Track(ctx, taskID, caller)
+	defer done()
+
+	// Start database transaction on worker server
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("[WORKER] Failed to start transaction: %v", err)
+		return nil, status.Error(codes.Internal, "failed to start transaction")
+	}
+
+	// Ensure transaction is rolled back if we don't commit
+	defer func() {
+		if tx != nil {
+			log.Printf("[WORKER] Rolling back transaction for task_id=%s", taskID)
+			tx.Rollback()
+		}
+	}()
+
+	// Insert a record into worker database
+	_, err = tx.ExecContext(ctx, "INSERT INTO worker_tasks (task_id, data, caller) VALUES (?, ?, ?)", taskID, req.Data, caller)
+	if err != nil {
+		log.Printf("[WORKER] Failed to insert task: %v", err)
+		return nil, status.Error(codes.Internal, "failed to insert task")
+	}
+
+	log.Printf("[WORKER] Inserted task record for task_id=%s", taskID)
+
+	// Simulate long-running work with periodic context checking
+	ticker := s.clock.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	endTime := s.clock.Now().Add(workDuration)
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Context was cancelled - rollback transaction
+			log.Printf("[WORKER] Context cancelled for task_id=%s: %v", taskID, context.Cause(ctx))
+			rollback(tx, taskID)
+			tx = nil // Prevent double rollback in defer
+			if errors.Is(context.Cause(ctx), admin.ErrCancelled) {
+				return nil, status.Error(codes.Canceled, "work cancelled by an operator")
+			}
+			return nil, status.Error(codes.Canceled, "work cancelled")
+
+		case <-ticker.C():
+			if s.clock.Now().After(endTime) {
+				// Nothing reads the ticker while waiting for the caller
+				ticker.Stop()
+				if confirm != nil {
+					if err := confirm(ctx); err != nil {
+						log.Printf("[WORKER] No commit confirmation for task_id=%s: %v", taskID, err)
+						rollback(tx, taskID)
+						tx = nil // Prevent double rollback in defer
+						return nil, err
+					}
+					log.Printf("[WORKER] Commit confirmed by caller for task_id=%s", taskID)
+				}
+
+				// Work completed successfully - commit transaction
+				if err := tx.Commit(); err != nil {
+					log.Printf("[WORKER] Failed to commit transaction: %v", err)
+					return nil, status.Error(codes.Internal, "failed to commit")
+				}
+				tx = nil // Prevent rollback in defer
+
+				log.Printf("[WORKER] ✅ TRANSACTION COMMITTED for task_id=%s", taskID)
+				return &workerpb.WorkResponse{
+					Success: true,
+					Message: fmt.Sprintf("Work completed for task %s", taskID),
+				}, nil
+			}
+		}
+	}
+}
+
+// rollback rolls tx back and logs the outcome
+func rollback(tx *sql.Tx, taskID string) {
+	if err := tx.Rollback(); err != nil {
+		// If transaction was already rolled back by the driver due to context cancellation, that's ok
+		if err == sql.ErrTxDone {
+			log.Printf("[WORKER] ❌ TRANSACTION ROLLED BACK for task_id=%s (automatically by driver)", taskID)
+		} else {
+			log.Printf("[WORKER] ⚠️  Failed to rollback transaction for task_id=%s: %v", taskID, err)
+		}
+	} else {
+		log.Printf("[WORKER] ❌ TRANSACTION ROLLED BACK for task_id=%s", taskID)
+	}
+}
+
+// InitDatabase opens the worker SQLite database and creates the worker_tasks table
+func InitDatabase(dbPath string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worker database: %v", err)
+	}
+
+	// Create worker_tasks table
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS worker_tasks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id TEXT NOT NULL,
+			data TEXT NOT NULL,
+			caller TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create worker_tasks table: %v", err)
+	}
+
+	// Databases created before authentication existed have no caller column
+	if err := sqliteutil.AddColumnIfMissing(db, "worker_tasks", "caller", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Printf("[WORKER] Database initialized successfully")
+	return db, nil
+}
@@ -0,0 +1,302 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"context_cancellation/internal/admin"
+	"context_cancellation/internal/clock"
+	"context_cancellation/workerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type doWorkResult struct {
+	resp *workerpb.WorkResponse
+	err  error
+}
+
+// startDoWork calls DoWork on a server running on a fake clock and waits
+// until its ticker exists, so the test can start advancing time
+func startDoWork(t *testing.T, ctx context.Context, taskID string, opts ...Option) (*Server, *clock.Fake, <-chan doWorkResult) {
+	t.Helper()
+	captureLogs(t)
+
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	server := NewServer(db, append([]Option{WithClock(fake)}, opts...)...)
+
+	results := make(chan doWorkResult, 1)
+	go func() {
+		resp, err := server.DoWork(ctx, &workerpb.WorkRequest{TaskId: taskID, Data: "tick"})
+		results <- doWorkResult{resp, err}
+	}()
+	fake.BlockUntil(1)
+	return server, fake, results
+}
+
+func countTasks(t *testing.T, s *Server) int {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM worker_tasks").Scan(&n); err != nil {
+		t.Fatalf("Failed to count tasks: %v", err)
+	}
+	return n
+}
+
+func TestDoWorkCommitsOnFirstTickAfterWorkDuration(t *testing.T) {
+	server, fake, results := startDoWork(t, context.Background(), "tick-001")
+
+	// Each Advance hands exactly one tick to DoWork. Once DoWork has returned,
+	// its ticker is stopped and the next tick is no longer delivered, so the
+	// last delivered tick is the one that committed.
+	lastTick := 0
+	for tick := 1; tick <= 100; tick++ {
+		if fake.Advance(tickInterval) == 0 {
+			break
+		}
+		lastTick = tick
+		if tick == 30 && countTasks(t, server) != 0 {
+			t.Fatal("Task visible before commit")
+		}
+	}
+
+	// The tick at exactly 3s is not after the end time; the next one is
+	if want := int(workDuration/tickInterval) + 1; lastTick != want {
+		t.Errorf("Committed on tick %d, want tick %d", lastTick, want)
+	}
+
+	res := <-results
+	if res.err != nil || !res.resp.Success {
+		t.Fatalf("DoWork failed: %v", res.err)
+	}
+	if n := countTasks(t, server); n != 1 {
+		t.Errorf("Expected 1 committed task, got %d", n)
+	}
+}
+
+func TestDoWorkCancelledBetweenTicks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server, fake, results := startDoWork(t, ctx, "tick-002")
+
+	for tick := 1; tick <= 15; tick++ {
+		if fake.Advance(tickInterval) != 1 {
+			t.Fatalf("Tick %d was not delivered", tick)
+		}
+	}
+	cancel()
+
+	res := <-results
+	if status.Code(res.err) != codes.Canceled {
+		t.Fatalf("Expected Canceled, got %v", res.err)
+	}
+
+	// Time running past the end of the work must not revive it
+	if n := fake.Advance(workDuration); n != 0 {
+		t.Errorf("DoWork still received %d ticks after returning", n)
+	}
+	if n := countTasks(t, server); n != 0 {
+		t.Errorf("Expected rollback, found %d tasks", n)
+	}
+}
+
+func TestDoWorkCancelledByOperator(t *testing.T) {
+	tracker := admin.NewTracker("[WORKER]")
+	server, _, results := startDoWork(t, t.Context(), "stuck-001", WithTracker(tracker))
+
+	tasks := tracker.List()
+	if len(tasks) != 1 || tasks[0].RequestID != "stuck-001" {
+		t.Fatalf("Expected stuck-001 in flight, got %+v", tasks)
+	}
+	if n := tracker.Cancel("stuck-001"); n != 1 {
+		t.Fatalf("Expected to cancel 1 task, cancelled %d", n)
+	}
+
+	res := <-results
+	if status.Code(res.err) != codes.Canceled || !strings.Contains(status.Convert(res.err).Message(), "operator") {
+		t.Fatalf("Expected Canceled by an operator, got %v", res.err)
+	}
+	if n := countTasks(t, server); n != 0 {
+		t.Errorf("Expected rollback, found %d tasks", n)
+	}
+	if tasks := tracker.List(); len(tasks) != 0 {
+		t.Errorf("Finished tasks must leave the list, have %+v", tasks)
+	}
+}
+
+// fakeConfirmStream is the server side of a DoWorkConfirmed stream whose
+// client is the test: it reads from recv (closed means the client closed its
+// side) and collects what the worker sends in sent
+type fakeConfirmStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv chan *workerpb.ConfirmedWorkRequest
+	sent chan *workerpb.ConfirmedWorkResponse
+}
+
+func (s *fakeConfirmStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeConfirmStream) Recv() (*workerpb.ConfirmedWorkRequest, error) {
+	select {
+	case msg, ok := <-s.recv:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-s.ctx.Done():
+		return nil, status.FromContextError(s.ctx.Err()).Err()
+	}
+}
+
+func (s *fakeConfirmStream) Send(msg *workerpb.ConfirmedWorkResponse) error {
+	s.sent <- msg
+	return nil
+}
+
+func decision(commit bool) *workerpb.ConfirmedWorkRequest {
+	return &workerpb.ConfirmedWorkRequest{
+		Msg: &workerpb.ConfirmedWorkRequest_Decision{Decision: &workerpb.CommitDecision{Commit: commit}},
+	}
+}
+
+// startConfirmedAtBoundary runs DoWorkConfirmed on a fake clock up to the
+// commit boundary: the work is done, ReadyToCommit has been sent and the
+// worker is waiting for the decision
+func startConfirmedAtBoundary(t *testing.T, ctx context.Context, taskID string) (*Server, *clock.Fake, *fakeConfirmStream, <-chan error) {
+	t.Helper()
+	captureLogs(t)
+
+	db, err := InitDatabase(filepath.Join(t.TempDir(), "worker.db"))
+	if err != nil {
+		t.Fatalf("Failed to init worker database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	server := NewServer(db, WithClock(fake))
+	stream := &fakeConfirmStream{
+		ctx:  ctx,
+		recv: make(chan *workerpb.ConfirmedWorkRequest, 1),
+		sent: make(chan *workerpb.ConfirmedWorkResponse, 2),
+	}
+	stream.recv <- &workerpb.ConfirmedWorkRequest{
+		Msg: &workerpb.ConfirmedWorkRequest_Work{Work: &workerpb.WorkRequest{TaskId: taskID, Data: "confirm"}},
+	}
+
+	results := make(chan error, 1)
+	go func() { results <- server.DoWorkConfirmed(stream) }()
+
+	fake.BlockUntil(1)
+	for tick := 0; tick <= int(workDuration/tickInterval); tick++ {
+		fake.Advance(tickInterval)
+	}
+	ready := (<-stream.sent).GetReady()
+	if ready == nil || ready.TaskId != taskID || ready.ConfirmTimeoutMs != defaultConfirmTimeout.Milliseconds() {
+		t.Fatalf("Expected ReadyToCommit for %s, got %v", taskID, ready)
+	}
+	if n := countTasks(t, server); n != 0 {
+		t.Fatalf("Task visible before confirmation: %d", n)
+	}
+	// The ticker is gone; wait for the confirmation timer
+	fake.BlockUntil(1)
+	return server, fake, stream, results
+}
+
+func TestDoWorkConfirmedCommits(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration
+	}{
+		{"confirmed at once", 0},
+		{"confirmed just before the deadline", defaultConfirmTimeout - time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, fake, stream, results := startConfirmedAtBoundary(t, t.Context(), "confirm-001")
+
+			fake.Advance(tt.wait)
+			stream.recv <- decision(true)
+
+			if err := <-results; err != nil {
+				t.Fatalf("DoWorkConfirmed failed: %v", err)
+			}
+			if result := (<-stream.sent).GetResult(); !result.GetSuccess() {
+				t.Errorf("Expected a successful result, got %v", result)
+			}
+			if n := countTasks(t, server); n != 1 {
+				t.Errorf("Expected 1 committed task, got %d", n)
+			}
+		})
+	}
+}
+
+func TestDoWorkConfirmedRollsBackWithoutGoAhead(t *testing.T) {
+	tests := []struct {
+		name     string
+		act      func(fake *clock.Fake, stream *fakeConfirmStream, cancel context.CancelFunc)
+		wantCode codes.Code
+	}{
+		{"declined", func(_ *clock.Fake, s *fakeConfirmStream, _ context.CancelFunc) { s.recv <- decision(false) }, codes.Aborted},
+		{"stream closed", func(_ *clock.Fake, s *fakeConfirmStream, _ context.CancelFunc) { close(s.recv) }, codes.Aborted},
+		{"cancelled at the boundary", func(_ *clock.Fake, _ *fakeConfirmStream, cancel context.CancelFunc) { cancel() }, codes.Canceled},
+		{"confirmation timed out", func(f *clock.Fake, _ *fakeConfirmStream, _ context.CancelFunc) { f.Advance(defaultConfirmTimeout) }, codes.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			server, fake, stream, results := startConfirmedAtBoundary(t, ctx, "confirm-002")
+
+			tt.act(fake, stream, cancel)
+
+			if err := <-results; status.Code(err) != tt.wantCode {
+				t.Fatalf("Expected %v, got %v", tt.wantCode, err)
+			}
+			if n := countTasks(t, server); n != 0 {
+				t.Errorf("Expected rollback, found %d tasks", n)
+			}
+		})
+	}
+}
+
+func TestSetConfirmTimeoutKeepsCallsInFlight(t *testing.T) {
+	server, fake, _, results := startConfirmedAtBoundary(t, t.Context(), "confirm-003")
+
+	// The waiting call already armed its timer with the old timeout
+	server.SetConfirmTimeout(time.Minute)
+	fake.Advance(defaultConfirmTimeout)
+	if err := <-results; status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected the old timeout to apply, got %v", err)
+	}
+	if got := time.Duration(server.confirmTimeout.Load()); got != time.Minute {
+		t.Errorf("Expected the next call to wait %v, got %v", time.Minute, got)
+	}
+}
+
+func TestDoWorkConfirmedNeedsWorkRequestFirst(t *testing.T) {
+	captureLogs(t)
+	stream := &fakeConfirmStream{
+		ctx:  t.Context(),
+		recv: make(chan *workerpb.ConfirmedWorkRequest, 1),
+		sent: make(chan *workerpb.ConfirmedWorkResponse, 1),
+	}
+	stream.recv <- decision(true)
+
+	err := NewServer(nil).DoWorkConfirmed(stream)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+}
@@ -1,19 +1,18 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"os"
-	"os/exec"
 	"strings"
 	"testing"
 	"time"
 
+	"context_cancellation/internal/testharness"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -72,105 +71,33 @@ func clearDatabases(t *testing.T, echoDbPath, workerDbPath string) {
 	}
 }
 
-// ProcessWithLogs wraps exec.Cmd with log capturing
-type ProcessWithLogs struct {
-	*exec.Cmd
-	logs *bytes.Buffer
+func TestMain(m *testing.M) {
+	testharness.Main(m)
 }
 
-// startWorkerProcess starts the gRPC worker server as a separate OS process
-func startWorkerProcess(t *testing.T, port int, dbPath string) *ProcessWithLogs {
-	// Build the worker server first
-	t.Log("Building worker server binary...")
-	buildCmd := exec.Command("go", "build", "-o", "worker_server_bin", "./cmd/worker")
-	if output, err := buildCmd.CombinedOutput(); err != nil {
-		t.Fatalf("Failed to build worker server: %v\nOutput: %s", err, output)
-	}
-
-	// Start the worker server process
-	t.Logf("Starting worker server as OS process on port %d...", port)
-	cmd := exec.Command("./worker_server_bin", fmt.Sprintf("-port=%d", port), fmt.Sprintf("-db=%s", dbPath))
-
-	// Capture logs to buffer while also showing them
-	logBuffer := &bytes.Buffer{}
-	multiWriter := io.MultiWriter(os.Stdout, logBuffer)
-	cmd.Stdout = multiWriter
-	cmd.Stderr = multiWriter
-
-	if err := cmd.Start(); err != nil {
-		t.Fatalf("Failed to start worker process: %v", err)
+// TestDistributedTransactionCancellation tests distributed transactions in every deployment mode
+func TestDistributedTransactionCancellation(t *testing.T) {
+	for _, mode := range deploymentModes {
+		t.Run(mode.name, func(t *testing.T) {
+			testDistributedTransactionCancellation(t, mode.start(t, deploymentOptions{}))
+		})
 	}
-
-	// Wait for worker to be ready
-	time.Sleep(500 * time.Millisecond)
-
-	t.Logf("Worker server process started with PID: %d", cmd.Process.Pid)
-	return &ProcessWithLogs{Cmd: cmd, logs: logBuffer}
 }
 
-// startEchoProcess starts the HTTP echo server as a separate OS process
-func startEchoProcess(t *testing.T, httpPort, grpcPort int, dbPath string) *exec.Cmd {
-	// Build the echo server first
-	t.Log("Building echo server binary...")
-	buildCmd := exec.Command("go", "build", "-o", "echo_server_bin", "./cmd/echo")
-	if output, err := buildCmd.CombinedOutput(); err != nil {
-		t.Fatalf("Failed to build echo server: %v\nOutput: %s", err, output)
-	}
-
-	// Start the echo server process
-	t.Logf("Starting echo server as OS process on port %d...", httpPort)
-	cmd := exec.Command("./echo_server_bin",
-		fmt.Sprintf("-http-port=%d", httpPort),
-		fmt.Sprintf("-grpc-port=%d", grpcPort),
-		fmt.Sprintf("-db=%s", dbPath))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
-		t.Fatalf("Failed to start echo process: %v", err)
+// TestCommitConfirmation runs the same scenarios with echo calling
+// DoWorkConfirmed, so the worker commits only after echo's go-ahead
+func TestCommitConfirmation(t *testing.T) {
+	for _, mode := range deploymentModes {
+		t.Run(mode.name, func(t *testing.T) {
+			d := mode.start(t, deploymentOptions{confirmCommit: true})
+			testDistributedTransactionCancellation(t, d)
+			d.waitForWorkerLog(t, "Commit confirmed by caller for task_id=successful-request-001")
+		})
 	}
-
-	// Wait for echo server to be ready
-	time.Sleep(500 * time.Millisecond)
-
-	t.Logf("Echo server process started with PID: %d", cmd.Process.Pid)
-	return cmd
 }
 
-// TestDistributedTransactionCancellation tests distributed transactions with separate OS processes
-func TestDistributedTransactionCancellation(t *testing.T) {
-	grpcPort := findAvailablePort(t)
-	httpPort := findAvailablePort(t)
-	echoDbPath := "./test_echo_dist.db"
-	workerDbPath := "./test_worker_dist.db"
-
-	// Clean up old databases
-	os.Remove(echoDbPath)
-	os.Remove(workerDbPath)
-	defer os.Remove(echoDbPath)
-	defer os.Remove(workerDbPath)
-
-	t.Logf("Starting SEPARATE OS PROCESSES: Echo on :%d, Worker on :%d", httpPort, grpcPort)
-
-	// Start gRPC Worker server as separate OS process
-	workerProc := startWorkerProcess(t, grpcPort, workerDbPath)
-	defer func() {
-		t.Log("Killing worker process...")
-		workerProc.Process.Kill()
-		workerProc.Wait()
-		os.Remove("./worker_server_bin")
-	}()
-
-	// Start HTTP Echo server as separate OS process
-	echoCmd := startEchoProcess(t, httpPort, grpcPort, echoDbPath)
-	defer func() {
-		t.Log("Killing echo process...")
-		echoCmd.Process.Kill()
-		echoCmd.Wait()
-		os.Remove("./echo_server_bin")
-	}()
-
-	t.Log("\n=== Test Case: Context Cancellation (Separate OS Processes) ===")
+func testDistributedTransactionCancellation(t *testing.T, d *deployment) {
+	t.Logf("\n=== Test Case: Context Cancellation (%s) ===", d.description)
 
 	// Create HTTP client with cancellable context
 	client := &http.Client{Transport: &http.Transport{}}
@@ -179,7 +106,7 @@ func TestDistributedTransactionCancellation(t *testing.T) {
 
 	// Create request
 	requestID := "cancelled-request-001"
-	url := fmt.Sprintf("http://localhost:%d/echo?request_id=%s&message=test", httpPort, requestID)
+	url := fmt.Sprintf("%s/echo?request_id=%s&message=test", d.echoURL, requestID)
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
@@ -201,8 +128,9 @@ func TestDistributedTransactionCancellation(t *testing.T) {
 		requestDone <- nil
 	}()
 
-	// Wait to ensure both transactions have started
-	time.Sleep(500 * time.Millisecond)
+	// Wait until both transactions have started: the worker only inserts
+	// after echo has inserted and called it
+	d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
 
 	t.Log("2. Cancelling HTTP request context...")
 	cancel()
@@ -219,13 +147,14 @@ func TestDistributedTransactionCancellation(t *testing.T) {
 		t.Fatal("HTTP request timeout")
 	}
 
-	// Give time for transactions to rollback
-	time.Sleep(1 * time.Second)
+	// Wait for both transactions to roll back
+	d.waitForEchoLog(t, "TRANSACTION ROLLED BACK for request_id="+requestID)
+	d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
 
 	// Check database state - both should be empty (transactions rolled back)
 	t.Log("4. Verifying database state after cancellation...")
-	echoCount := countEchoRecords(t, echoDbPath)
-	workerCount := countWorkerRecords(t, workerDbPath)
+	echoCount := countEchoRecords(t, d.echoDbPath)
+	workerCount := countWorkerRecords(t, d.workerDbPath)
 
 	t.Logf("   Echo database records: %d", echoCount)
 	t.Logf("   Worker database records: %d", workerCount)
@@ -242,14 +171,14 @@ func TestDistributedTransactionCancellation(t *testing.T) {
 		t.Log("   ✅ Worker transaction was rolled back correctly")
 	}
 
-	t.Log("\n=== Test Case: Successful Completion (Separate OS Processes) ===")
+	t.Logf("\n=== Test Case: Successful Completion (%s) ===", d.description)
 
 	// Clear databases again
-	clearDatabases(t, echoDbPath, workerDbPath)
+	clearDatabases(t, d.echoDbPath, d.workerDbPath)
 
 	// Now test successful case
 	requestID = "successful-request-001"
-	url = fmt.Sprintf("http://localhost:%d/echo?request_id=%s&message=success", httpPort, requestID)
+	url = fmt.Sprintf("%s/echo?request_id=%s&message=success", d.echoURL, requestID)
 
 	t.Log("5. Starting HTTP request that will complete successfully...")
 	resp, err := http.Get(url)
@@ -261,13 +190,11 @@ func TestDistributedTransactionCancellation(t *testing.T) {
 	body, _ := io.ReadAll(resp.Body)
 	t.Logf("6. Response: %s", string(body))
 
-	// Give time for transactions to commit
-	time.Sleep(1 * time.Second)
-
+	// Both servers commit before responding, so there is nothing to wait for
 	// Check database state - both should have records
 	t.Log("7. Verifying database state after successful completion...")
-	echoCount = countEchoRecords(t, echoDbPath)
-	workerCount = countWorkerRecords(t, workerDbPath)
+	echoCount = countEchoRecords(t, d.echoDbPath)
+	workerCount = countWorkerRecords(t, d.workerDbPath)
 
 	t.Logf("   Echo database records: %d", echoCount)
 	t.Logf("   Worker database records: %d", workerCount)
@@ -285,44 +212,22 @@ func TestDistributedTransactionCancellation(t *testing.T) {
 	}
 
 	t.Log("\n=== Test Summary ===")
-	t.Log("✓ HTTP Echo and gRPC Worker running as SEPARATE OS PROCESSES")
+	t.Logf("✓ HTTP Echo and gRPC Worker running as %s", d.description)
 	t.Log("✓ Context cancellation rolls back BOTH transactions")
 	t.Log("✓ Successful completion commits BOTH transactions")
-	t.Log("✓ Emulates real Kubernetes/Docker microservices architecture!")
 }
 
-// TestHTTPConnectionClosePropagation tests TCP connection closure with separate OS processes
+// TestHTTPConnectionClosePropagation tests TCP connection closure in every deployment mode
 func TestHTTPConnectionClosePropagation(t *testing.T) {
-	grpcPort := findAvailablePort(t)
-	httpPort := findAvailablePort(t)
-	echoDbPath := "./test_echo_conn.db"
-	workerDbPath := "./test_worker_conn.db"
-
-	// Clean up old databases
-	os.Remove(echoDbPath)
-	os.Remove(workerDbPath)
-	defer os.Remove(echoDbPath)
-	defer os.Remove(workerDbPath)
-
-	t.Logf("Starting SEPARATE OS PROCESSES: Echo on :%d, Worker on :%d", httpPort, grpcPort)
-
-	// Start gRPC Worker server as separate OS process WITH LOG CAPTURING
-	workerProc := startWorkerProcess(t, grpcPort, workerDbPath)
-	defer func() {
-		workerProc.Process.Kill()
-		workerProc.Wait()
-		os.Remove("./worker_server_bin")
-	}()
-
-	// Start HTTP Echo server as separate OS process
-	echoCmd := startEchoProcess(t, httpPort, grpcPort, echoDbPath)
-	defer func() {
-		echoCmd.Process.Kill()
-		echoCmd.Wait()
-		os.Remove("./echo_server_bin")
-	}()
+	for _, mode := range deploymentModes {
+		t.Run(mode.name, func(t *testing.T) {
+			testHTTPConnectionClosePropagation(t, mode.start(t, deploymentOptions{}))
+		})
+	}
+}
 
-	t.Log("\n=== Testing TCP Connection Close → gRPC Cancellation (Separate Processes) ===")
+func testHTTPConnectionClosePropagation(t *testing.T, d *deployment) {
+	t.Logf("\n=== Testing TCP Connection Close → gRPC Cancellation (%s) ===", d.description)
 
 	// Create a custom dialer that tracks connections
 	var activeConn net.Conn
@@ -344,7 +249,7 @@ func TestHTTPConnectionClosePropagation(t *testing.T) {
 	client := &http.Client{Transport: transport}
 
 	requestID := "conn-close-test"
-	url := fmt.Sprintf("http://localhost:%d/echo?request_id=%s&message=test", httpPort, requestID)
+	url := fmt.Sprintf("%s/echo?request_id=%s&message=test", d.echoURL, requestID)
 	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
@@ -364,7 +269,7 @@ func TestHTTPConnectionClosePropagation(t *testing.T) {
 		requestDone <- nil
 	}()
 
-	time.Sleep(500 * time.Millisecond)
+	d.waitForWorkerLog(t, "Inserted task record for task_id="+requestID)
 
 	t.Log("2. Forcefully closing TCP connection...")
 	if activeConn != nil {
@@ -382,10 +287,10 @@ func TestHTTPConnectionClosePropagation(t *testing.T) {
 		t.Fatal("HTTP request timeout")
 	}
 
-	time.Sleep(1 * time.Second)
+	d.waitForWorkerLog(t, "TRANSACTION ROLLED BACK for task_id="+requestID)
 
 	// Check database state
-	workerCount := countWorkerRecords(t, workerDbPath)
+	workerCount := countWorkerRecords(t, d.workerDbPath)
 	t.Logf("4. Worker database records after connection close: %d", workerCount)
 
 	if workerCount != 0 {
@@ -395,8 +300,8 @@ func TestHTTPConnectionClosePropagation(t *testing.T) {
 	}
 
 	// PROOF: Check worker process logs for cancellation message
-	t.Log("\n5. Verifying gRPC cancellation in worker process logs...")
-	logs := workerProc.logs.String()
+	t.Log("\n5. Verifying gRPC cancellation in worker logs...")
+	logs := d.workerLogs()
 
 	if strings.Contains(logs, "Context cancelled for task_id="+requestID) {
 		t.Log("   ✅ Found context cancellation log in worker process!")
@@ -413,17 +318,7 @@ func TestHTTPConnectionClosePropagation(t *testing.T) {
 	}
 
 	t.Log("\n=== Summary ===")
-	t.Log("✓ TCP connection closure propagated across SEPARATE OS PROCESSES")
-	t.Log("✓ gRPC worker in different process detected cancellation (VERIFIED IN LOGS)")
+	t.Logf("✓ TCP connection closure propagated to the worker (%s)", d.description)
+	t.Log("✓ gRPC worker detected cancellation (VERIFIED IN LOGS)")
 	t.Log("✓ Transaction rolled back successfully (VERIFIED IN LOGS + DATABASE)")
 }
-
-func findAvailablePort(t *testing.T) int {
-	listener, err := net.Listen("tcp", "localhost:0")
-	if err != nil {
-		t.Fatalf("Failed to find available port: %v", err)
-	}
-	port := listener.Addr().(*net.TCPAddr).Port
-	listener.Close()
-	return port
-}
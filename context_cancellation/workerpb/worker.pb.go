@@ -0,0 +1,487 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v6.33.0
+// source: worker.proto
+
+package workerpb
+
+import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type WorkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	TaskId        string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	Data          string                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkRequest) Reset() {
+	*x = WorkRequest{}
+	mi := &file_worker_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkRequest) ProtoMessage() {}
+
+func (x *WorkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkRequest.ProtoReflect.Descriptor instead.
+func (*WorkRequest) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WorkRequest) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *WorkRequest) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+type WorkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WorkResponse) Reset() {
+	*x = WorkResponse{}
+	mi := &file_worker_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WorkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WorkResponse) ProtoMessage() {}
+
+func (x *WorkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WorkResponse.ProtoReflect.Descriptor instead.
+func (*WorkResponse) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *WorkResponse) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *WorkResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type ConfirmedWorkRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Msg:
+	//
+	//	*ConfirmedWorkRequest_Work
+	//	*ConfirmedWorkRequest_Decision
+	Msg           isConfirmedWorkRequest_Msg `protobuf_oneof:"msg"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfirmedWorkRequest) Reset() {
+	*x = ConfirmedWorkRequest{}
+	mi := &file_worker_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfirmedWorkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfirmedWorkRequest) ProtoMessage() {}
+
+func (x *ConfirmedWorkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfirmedWorkRequest.ProtoReflect.Descriptor instead.
+func (*ConfirmedWorkRequest) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ConfirmedWorkRequest) GetMsg() isConfirmedWorkRequest_Msg {
+	if x != nil {
+		return x.Msg
+	}
+	return nil
+}
+
+func (x *ConfirmedWorkRequest) GetWork() *WorkRequest {
+	if x != nil {
+		if x, ok := x.Msg.(*ConfirmedWorkRequest_Work); ok {
+			return x.Work
+		}
+	}
+	return nil
+}
+
+func (x *ConfirmedWorkRequest) GetDecision() *CommitDecision {
+	if x != nil {
+		if x, ok := x.Msg.(*ConfirmedWorkRequest_Decision); ok {
+			return x.Decision
+		}
+	}
+	return nil
+}
+
+type isConfirmedWorkRequest_Msg interface {
+	isConfirmedWorkRequest_Msg()
+}
+
+type ConfirmedWorkRequest_Work struct {
+	// work must be the first message on the stream
+	Work *WorkRequest `protobuf:"bytes,1,opt,name=work,proto3,oneof"`
+}
+
+type ConfirmedWorkRequest_Decision struct {
+	// decision answers ReadyToCommit
+	Decision *CommitDecision `protobuf:"bytes,2,opt,name=decision,proto3,oneof"`
+}
+
+func (*ConfirmedWorkRequest_Work) isConfirmedWorkRequest_Msg() {}
+
+func (*ConfirmedWorkRequest_Decision) isConfirmedWorkRequest_Msg() {}
+
+type CommitDecision struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Commit        bool                   `protobuf:"varint,1,opt,name=commit,proto3" json:"commit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommitDecision) Reset() {
+	*x = CommitDecision{}
+	mi := &file_worker_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommitDecision) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommitDecision) ProtoMessage() {}
+
+func (x *CommitDecision) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommitDecision.ProtoReflect.Descriptor instead.
+func (*CommitDecision) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CommitDecision) GetCommit() bool {
+	if x != nil {
+		return x.Commit
+	}
+	return false
+}
+
+type ConfirmedWorkResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Msg:
+	//
+	//	*ConfirmedWorkResponse_Ready
+	//	*ConfirmedWorkResponse_Result
+	Msg           isConfirmedWorkResponse_Msg `protobuf_oneof:"msg"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfirmedWorkResponse) Reset() {
+	*x = ConfirmedWorkResponse{}
+	mi := &file_worker_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfirmedWorkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfirmedWorkResponse) ProtoMessage() {}
+
+func (x *ConfirmedWorkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfirmedWorkResponse.ProtoReflect.Descriptor instead.
+func (*ConfirmedWorkResponse) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ConfirmedWorkResponse) GetMsg() isConfirmedWorkResponse_Msg {
+	if x != nil {
+		return x.Msg
+	}
+	return nil
+}
+
+func (x *ConfirmedWorkResponse) GetReady() *ReadyToCommit {
+	if x != nil {
+		if x, ok := x.Msg.(*ConfirmedWorkResponse_Ready); ok {
+			return x.Ready
+		}
+	}
+	return nil
+}
+
+func (x *ConfirmedWorkResponse) GetResult() *WorkResponse {
+	if x != nil {
+		if x, ok := x.Msg.(*ConfirmedWorkResponse_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isConfirmedWorkResponse_Msg interface {
+	isConfirmedWorkResponse_Msg()
+}
+
+type ConfirmedWorkResponse_Ready struct {
+	Ready *ReadyToCommit `protobuf:"bytes,1,opt,name=ready,proto3,oneof"`
+}
+
+type ConfirmedWorkResponse_Result struct {
+	Result *WorkResponse `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*ConfirmedWorkResponse_Ready) isConfirmedWorkResponse_Msg() {}
+
+func (*ConfirmedWorkResponse_Result) isConfirmedWorkResponse_Msg() {}
+
+// ReadyToCommit tells the caller the work is done and waits for its decision
+type ReadyToCommit struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	TaskId           string                 `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	ConfirmTimeoutMs int64                  `protobuf:"varint,2,opt,name=confirm_timeout_ms,json=confirmTimeoutMs,proto3" json:"confirm_timeout_ms,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *ReadyToCommit) Reset() {
+	*x = ReadyToCommit{}
+	mi := &file_worker_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReadyToCommit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadyToCommit) ProtoMessage() {}
+
+func (x *ReadyToCommit) ProtoReflect() protoreflect.Message {
+	mi := &file_worker_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadyToCommit.ProtoReflect.Descriptor instead.
+func (*ReadyToCommit) Descriptor() ([]byte, []int) {
+	return file_worker_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ReadyToCommit) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *ReadyToCommit) GetConfirmTimeoutMs() int64 {
+	if x != nil {
+		return x.ConfirmTimeoutMs
+	}
+	return 0
+}
+
+var File_worker_proto protoreflect.FileDescriptor
+
+const file_worker_proto_rawDesc = "" +
+	"\n" +
+	"\fworker.proto\x12\x06worker\x1a\x1cgoogle/api/annotations.proto\":\n" +
+	"\vWorkRequest\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\tR\x06taskId\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\tR\x04data\"B\n" +
+	"\fWorkResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"~\n" +
+	"\x14ConfirmedWorkRequest\x12)\n" +
+	"\x04work\x18\x01 \x01(\v2\x13.worker.WorkRequestH\x00R\x04work\x124\n" +
+	"\bdecision\x18\x02 \x01(\v2\x16.worker.CommitDecisionH\x00R\bdecisionB\x05\n" +
+	"\x03msg\"(\n" +
+	"\x0eCommitDecision\x12\x16\n" +
+	"\x06commit\x18\x01 \x01(\bR\x06commit\"}\n" +
+	"\x15ConfirmedWorkResponse\x12-\n" +
+	"\x05ready\x18\x01 \x01(\v2\x15.worker.ReadyToCommitH\x00R\x05ready\x12.\n" +
+	"\x06result\x18\x02 \x01(\v2\x14.worker.WorkResponseH\x00R\x06resultB\x05\n" +
+	"\x03msg\"V\n" +
+	"\rReadyToCommit\x12\x17\n" +
+	"\atask_id\x18\x01 \x01(\tR\x06taskId\x12,\n" +
+	"\x12confirm_timeout_ms\x18\x02 \x01(\x03R\x10confirmTimeoutMs2\xad\x01\n" +
+	"\rWorkerService\x12H\n" +
+	"\x06DoWork\x12\x13.worker.WorkRequest\x1a\x14.worker.WorkResponse\"\x13\x82\xd3\xe4\x93\x02\r:\x01*\"\b/v1/work\x12R\n" +
+	"\x0fDoWorkConfirmed\x12\x1c.worker.ConfirmedWorkRequest\x1a\x1d.worker.ConfirmedWorkResponse(\x010\x01B(Z&context_cancellation/workerpb;workerpbb\x06proto3"
+
+var (
+	file_worker_proto_rawDescOnce sync.Once
+	file_worker_proto_rawDescData []byte
+)
+
+func file_worker_proto_rawDescGZIP() []byte {
+	file_worker_proto_rawDescOnce.Do(func() {
+		file_worker_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_worker_proto_rawDesc), len(file_worker_proto_rawDesc)))
+	})
+	return file_worker_proto_rawDescData
+}
+
+var file_worker_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_worker_proto_goTypes = []any{
+	(*WorkRequest)(nil),           // 0: worker.WorkRequest
+	(*WorkResponse)(nil),          // 1: worker.WorkResponse
+	(*ConfirmedWorkRequest)(nil),  // 2: worker.ConfirmedWorkRequest
+	(*CommitDecision)(nil),        // 3: worker.CommitDecision
+	(*ConfirmedWorkResponse)(nil), // 4: worker.ConfirmedWorkResponse
+	(*ReadyToCommit)(nil),         // 5: worker.ReadyToCommit
+}
+var file_worker_proto_depIdxs = []int32{
+	0, // 0: worker.ConfirmedWorkRequest.work:type_name -> worker.WorkRequest
+	3, // 1: worker.ConfirmedWorkRequest.decision:type_name -> worker.CommitDecision
+	5, // 2: worker.ConfirmedWorkResponse.ready:type_name -> worker.ReadyToCommit
+	1, // 3: worker.ConfirmedWorkResponse.result:type_name -> worker.WorkResponse
+	0, // 4: worker.WorkerService.DoWork:input_type -> worker.WorkRequest
+	2, // 5: worker.WorkerService.DoWorkConfirmed:input_type -> worker.ConfirmedWorkRequest
+	1, // 6: worker.WorkerService.DoWork:output_type -> worker.WorkResponse
+	4, // 7: worker.WorkerService.DoWorkConfirmed:output_type -> worker.ConfirmedWorkResponse
+	6, // [6:8] is the sub-list for method output_type
+	4, // [4:6] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_worker_proto_init() }
+func file_worker_proto_init() {
+	if File_worker_proto != nil {
+		return
+	}
+	file_worker_proto_msgTypes[2].OneofWrappers = []any{
+		(*ConfirmedWorkRequest_Work)(nil),
+		(*ConfirmedWorkRequest_Decision)(nil),
+	}
+	file_worker_proto_msgTypes[4].OneofWrappers = []any{
+		(*ConfirmedWorkResponse_Ready)(nil),
+		(*ConfirmedWorkResponse_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_worker_proto_rawDesc), len(file_worker_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_worker_proto_goTypes,
+		DependencyIndexes: file_worker_proto_depIdxs,
+		MessageInfos:      file_worker_proto_msgTypes,
+	}.Build()
+	File_worker_proto = out.File
+	file_worker_proto_goTypes = nil
+	file_worker_proto_depIdxs = nil
+}
@@ -0,0 +1,182 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.0
+// - protoc             v6.33.0
+// source: worker.proto
+
+package workerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	WorkerService_DoWork_FullMethodName          = "/worker.WorkerService/DoWork"
+	WorkerService_DoWorkConfirmed_FullMethodName = "/worker.WorkerService/DoWorkConfirmed"
+)
+
+// WorkerServiceClient is the client API for WorkerService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WorkerServiceClient interface {
+	// DoWork is also exposed over HTTP/JSON as POST /v1/work by the
+	// grpc-gateway mux in cmd/worker
+	DoWork(ctx context.Context, in *WorkRequest, opts ...grpc.CallOption) (*WorkResponse, error)
+	// DoWorkConfirmed does the same work as DoWork, but the worker asks the
+	// caller for a go-ahead right before committing:
+	//
+	//   caller -> worker  ConfirmedWorkRequest{work}
+	//   worker -> caller  ConfirmedWorkResponse{ready}     (work done, not committed)
+	//   caller -> worker  ConfirmedWorkRequest{decision}
+	//   worker -> caller  ConfirmedWorkResponse{result}    (committed)
+	//
+	// The worker commits only on a decision with commit=true that arrives within
+	// ReadyToCommit.confirm_timeout_ms. A declined commit ends the call with
+	// ABORTED, a late one with DEADLINE_EXCEEDED; either way it rolled back.
+	// Bidirectional streams cannot be transcoded, so this has no HTTP mapping.
+	DoWorkConfirmed(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConfirmedWorkRequest, ConfirmedWorkResponse], error)
+}
+
+type workerServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWorkerServiceClient(cc grpc.ClientConnInterface) WorkerServiceClient {
+	return &workerServiceClient{cc}
+}
+
+func (c *workerServiceClient) DoWork(ctx context.Context, in *WorkRequest, opts ...grpc.CallOption) (*WorkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WorkResponse)
+	err := c.cc.Invoke(ctx, WorkerService_DoWork_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *workerServiceClient) DoWorkConfirmed(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConfirmedWorkRequest, ConfirmedWorkResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &WorkerService_ServiceDesc.Streams[0], WorkerService_DoWorkConfirmed_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ConfirmedWorkRequest, ConfirmedWorkResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WorkerService_DoWorkConfirmedClient = grpc.BidiStreamingClient[ConfirmedWorkRequest, ConfirmedWorkResponse]
+
+// WorkerServiceServer is the server API for WorkerService service.
+// All implementations must embed UnimplementedWorkerServiceServer
+// for forward compatibility.
+type WorkerServiceServer interface {
+	// DoWork is also exposed over HTTP/JSON as POST /v1/work by the
+	// grpc-gateway mux in cmd/worker
+	DoWork(context.Context, *WorkRequest) (*WorkResponse, error)
+	// DoWorkConfirmed does the same work as DoWork, but the worker asks the
+	// caller for a go-ahead right before committing:
+	//
+	//   caller -> worker  ConfirmedWorkRequest{work}
+	//   worker -> caller  ConfirmedWorkResponse{ready}     (work done, not committed)
+	//   caller -> worker  ConfirmedWorkRequest{decision}
+	//   worker -> caller  ConfirmedWorkResponse{result}    (committed)
+	//
+	// The worker commits only on a decision with commit=true that arrives within
+	// ReadyToCommit.confirm_timeout_ms. A declined commit ends the call with
+	// ABORTED, a late one with DEADLINE_EXCEEDED; either way it rolled back.
+	// Bidirectional streams cannot be transcoded, so this has no HTTP mapping.
+	DoWorkConfirmed(grpc.BidiStreamingServer[ConfirmedWorkRequest, ConfirmedWorkResponse]) error
+	mustEmbedUnimplementedWorkerServiceServer()
+}
+
+// UnimplementedWorkerServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedWorkerServiceServer struct{}
+
+func (UnimplementedWorkerServiceServer) DoWork(context.Context, *WorkRequest) (*WorkResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DoWork not implemented")
+}
+func (UnimplementedWorkerServiceServer) DoWorkConfirmed(grpc.BidiStreamingServer[ConfirmedWorkRequest, ConfirmedWorkResponse]) error {
+	return status.Error(codes.Unimplemented, "method DoWorkConfirmed not implemented")
+}
+func (UnimplementedWorkerServiceServer) mustEmbedUnimplementedWorkerServiceServer() {}
+func (UnimplementedWorkerServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeWorkerServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WorkerServiceServer will
+// result in compilation errors.
+type UnsafeWorkerServiceServer interface {
+	mustEmbedUnimplementedWorkerServiceServer()
+}
+
+func RegisterWorkerServiceServer(s grpc.ServiceRegistrar, srv WorkerServiceServer) {
+	// If the following call panics, it indicates UnimplementedWorkerServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&WorkerService_ServiceDesc, srv)
+}
+
+func _WorkerService_DoWork_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WorkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(WorkerServiceServer).DoWork(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: WorkerService_DoWork_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(WorkerServiceServer).DoWork(ctx, req.(*WorkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _WorkerService_DoWorkConfirmed_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(WorkerServiceServer).DoWorkConfirmed(&grpc.GenericServerStream[ConfirmedWorkRequest, ConfirmedWorkResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type WorkerService_DoWorkConfirmedServer = grpc.BidiStreamingServer[ConfirmedWorkRequest, ConfirmedWorkResponse]
+
+// WorkerService_ServiceDesc is the grpc.ServiceDesc for WorkerService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var WorkerService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "worker.WorkerService",
+	HandlerType: (*WorkerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DoWork",
+			Handler:    _WorkerService_DoWork_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DoWorkConfirmed",
+			Handler:       _WorkerService_DoWorkConfirmed_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "worker.proto",
+}
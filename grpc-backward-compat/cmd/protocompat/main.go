@@ -0,0 +1,161 @@
+// Command protocompat reports what changed between two versions of the
+// UserService protos, or any other proto files, for peers still on the old
+// version, and exits with status 1 if a change breaks them:
+//
+//	protocompat [-wire-only] [-strict-json] OLD NEW
+//
+// OLD and NEW are each userv1, userv2, userv3, profilev1 or profilev2 for the
+// versions in the descriptors package, or a FileDescriptorSet file as written by
+// `buf build -o FILE` or `protoc --include_imports --descriptor_set_out=FILE`.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"grpc-backward-compat/descriptors"
+	"grpc-backward-compat/protocompat"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run compares the versions args name, writes the report to stdout and
+// returns the exit status
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("protocompat", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	wireOnly := flags.Bool("wire-only", false, "Only fail on changes that break the binary wire format, for peers that never exchange JSON")
+	strictJSON := flags.Bool("strict-json", false, "Also fail on warnings: additions old JSON peers reject if they refuse unknown names, as jsoncodec does")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: protocompat [-wire-only] [-strict-json] OLD NEW")
+		fmt.Fprintln(stderr, "OLD and NEW are userv1, userv2, userv3, profilev1, profilev2 or a FileDescriptorSet file.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	old, err := load(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load %s: %v\n", flags.Arg(0), err)
+		return 2
+	}
+	new, err := load(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to load %s: %v\n", flags.Arg(1), err)
+		return 2
+	}
+
+	changes := protocompat.Compare(old, new)
+	fmt.Fprintf(stdout, "Comparing %s -> %s\n", flags.Arg(0), flags.Arg(1))
+	if len(changes) > 0 {
+		fmt.Fprintln(stdout)
+	}
+	var breaksWire, breaksJSON, warnings int
+	for _, c := range changes {
+		if *strictJSON && c.StrictJSON {
+			c.BreaksJSON = true
+		}
+		fmt.Fprintln(stdout, c)
+		switch {
+		case c.BreaksWire || c.BreaksJSON:
+			if c.BreaksWire {
+				breaksWire++
+			}
+			if c.BreaksJSON {
+				breaksJSON++
+			}
+		case c.StrictJSON:
+			warnings++
+		}
+	}
+	fmt.Fprintf(stdout, "\n%d changes: %d break the wire format, %d break JSON, %d warnings\n", len(changes), breaksWire, breaksJSON, warnings)
+
+	if breaksWire > 0 || breaksJSON > 0 && !*wireOnly {
+		return 1
+	}
+	return 0
+}
+
+// load returns the files of the version called name, or of the descriptor
+// set in the file called name, with their imports either way. Each set is
+// resolved in a registry of its own, so two versions declaring the same
+// names do not conflict.
+func load(name string) ([]protoreflect.FileDescriptor, error) {
+	set, err := readSet(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := addImports(set); err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	var fds []protoreflect.FileDescriptor
+	for _, f := range set.File {
+		fd, err := files.FindFileByPath(f.GetName())
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+// readSet returns the descriptor set of the version called name, or the one
+// in the file called name
+func readSet(name string) (*descriptorpb.FileDescriptorSet, error) {
+	if slices.Contains(descriptors.Names, name) {
+		return descriptors.Set(name)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("not a FileDescriptorSet: %v", err)
+	}
+	return set, nil
+}
+
+// addImports adds the files set imports but does not contain, such as
+// google/protobuf/field_mask.proto when protoc ran without
+// --include_imports, from the well-known types linked into this binary
+func addImports(set *descriptorpb.FileDescriptorSet) error {
+	have := make(map[string]bool)
+	for _, f := range set.File {
+		have[f.GetName()] = true
+	}
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].Dependency {
+			if have[dep] {
+				continue
+			}
+			fd, err := protoregistry.GlobalFiles.FindFileByPath(dep)
+			if err != nil {
+				return fmt.Errorf("%s imports %s, which is neither in the set nor a well-known type", set.File[i].GetName(), dep)
+			}
+			set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+			have[dep] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestExitStatus checks that the safe evolution, adding phone, passes while
+// the profile changes fail, and that -strict-json fails on warnings
+func TestExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want int
+		// summary is the last line of the report
+		summary string
+	}{
+		{[]string{"userv1", "userv2"}, 0, "2 changes: 0 break the wire format, 0 break JSON, 2 warnings"},
+		{[]string{"-strict-json", "userv1", "userv2"}, 1, "2 changes: 0 break the wire format, 2 break JSON, 0 warnings"},
+		{[]string{"profilev1", "profilev2"}, 1, "7 changes: 4 break the wire format, 5 break JSON, 1 warnings"},
+		{[]string{"-wire-only", "profilev1", "profilev2"}, 1, "7 changes: 4 break the wire format, 5 break JSON, 1 warnings"},
+		{[]string{"userv2", "userv2"}, 0, "0 changes: 0 break the wire format, 0 break JSON, 0 warnings"},
+		{[]string{"userv1"}, 2, ""},
+		{[]string{"userv1", "no-such-file.binpb"}, 2, ""},
+	} {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(tc.args, &stdout, &stderr); got != tc.want {
+				t.Errorf("Expected exit status %d, got %d\n%s%s", tc.want, got, stdout.String(), stderr.String())
+			}
+			if tc.summary == "" {
+				return
+			}
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if got := lines[len(lines)-1]; got != tc.summary {
+				t.Errorf("Expected %q, got %q", tc.summary, got)
+			}
+		})
+	}
+}
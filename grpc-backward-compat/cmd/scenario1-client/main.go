@@ -2,13 +2,15 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
 	"time"
 
 	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/scenario"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -17,21 +19,27 @@ const (
 )
 
 func main() {
+	addr := flag.String("addr", "localhost"+port, "Address of the UserService server, which may be of any version")
+	server := flag.String("server", "V1 server", "What the server is, for the log")
+	flag.Parse()
+
 	log.Println("=== Scenario 1 Client: V2 Client (new proto WITH 'phone' field) ===")
 	log.Println()
 
 	time.Sleep(1 * time.Second)
 
-	conn, err := grpc.NewClient(fmt.Sprintf("localhost%s", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatalf("[V2 Client] Failed to connect: %v", err)
 	}
 	defer conn.Close()
 
 	client := userv2.NewUserServiceClient(conn)
+	check := scenario.NewChecker("[V2 Client]")
+	log.Printf("[V2 Client] Talking to the server on %s", *addr)
 
 	log.Println("[V2 Client] Creating user with name, email, AND phone...")
-	log.Println("[V2 Client] Sending request with phone='+1234567890' (field not in V1 server)")
+	log.Println("[V2 Client] Sending request with phone='+1234567890' (field not in V1 servers)")
 	createReq := &userv2.CreateUserRequest{
 		Name:  "John Doe",
 		Email: "john@example.com",
@@ -39,18 +47,18 @@ func main() {
 	}
 
 	createResp, err := client.CreateUser(context.Background(), createReq)
-	if err != nil {
-		log.Fatalf("[V2 Client] CreateUser failed: %v", err)
+	if !check.OK("CreateUser", err) {
+		check.Done("Scenario 1")
 	}
 
 	log.Printf("[V2 Client] ✓ Response received: id=%s, name=%s, email=%s, phone='%s'",
 		createResp.User.UserId, createResp.User.Name, createResp.User.Email, createResp.User.Phone)
 	log.Println()
 
-	if createResp.User.Phone == "" {
-		log.Println("[V2 Client] ✓ Phone field is EMPTY (as expected - V1 server doesn't know about it)")
+	if createResp.User.Phone == createReq.Phone {
+		check.Pass("Phone field came back (a V1 server keeps it as an unknown field)")
 	} else {
-		log.Printf("[V2 Client] ✗ Unexpected: Phone field has value: %s", createResp.User.Phone)
+		check.Fail("Unexpected: Phone field is '%s'", createResp.User.Phone)
 	}
 
 	log.Println()
@@ -60,16 +68,43 @@ func main() {
 	}
 
 	getResp, err := client.GetUser(context.Background(), getReq)
-	if err != nil {
-		log.Fatalf("[V2 Client] GetUser failed: %v", err)
+	if check.OK("GetUser", err) {
+		log.Printf("[V2 Client] ✓ Response received: id=%s, name=%s, email=%s, phone='%s'",
+			getResp.User.UserId, getResp.User.Name, getResp.User.Email, getResp.User.Phone)
 	}
+	log.Println()
 
-	log.Printf("[V2 Client] ✓ Response received: id=%s, name=%s, email=%s, phone='%s'",
-		getResp.User.UserId, getResp.User.Name, getResp.User.Email, getResp.User.Phone)
+	log.Println("[V2 Client] Checking the status codes of failed calls...")
+	_, err = client.GetUser(context.Background(), &userv2.GetUserRequest{UserId: "user_does_not_exist"})
+	check.Code("GetUser of a missing user", err, codes.NotFound)
+	_, err = client.CreateUser(context.Background(), &userv2.CreateUserRequest{Email: "not-an-email"})
+	check.Violations("CreateUser with no name and a malformed email", err, "name", "email")
+	_, err = client.CreateUser(context.Background(), &userv2.CreateUserRequest{Name: "Johnny", Email: "John@Example.com"})
+	check.Code("CreateUser with a taken email", err, codes.AlreadyExists)
+
+	// Only a server that knows 'phone' can validate it; a V1 server stores it as sent
+	knowsPhone := false
+	badPhone, err := client.CreateUser(context.Background(), &userv2.CreateUserRequest{
+		Name:  "Jim Doe",
+		Email: "jim@example.com",
+		Phone: "555-0123",
+	})
+	if err == nil {
+		check.Pass("Malformed phone '%s' accepted: the server stores it without validating", badPhone.User.Phone)
+	} else if check.Violations("CreateUser with a malformed phone", err, "phone") {
+		knowsPhone = true
+	}
 	log.Println()
+	check.Done("Scenario 1")
 
 	log.Println("=== Scenario 1 Summary ===")
-	log.Println("✓ V2 client successfully communicated with V1 server")
-	log.Println("✓ 'phone' field sent by V2 client was ignored by V1 server (backward compatible)")
-	log.Println("✓ V2 client received empty 'phone' field from V1 server (default value)")
+	log.Printf("✓ V2 client successfully communicated with %s", *server)
+	if knowsPhone {
+		log.Printf("✓ %s knows 'phone': it stored, returned and validated it", *server)
+	} else {
+		log.Printf("✓ 'phone' field sent by V2 client was not understood by %s (backward compatible)", *server)
+		log.Printf("✓ V2 client received 'phone' back from %s, which stored it as an unknown field", *server)
+		log.Printf("✓ %s cannot validate 'phone', so a malformed phone is stored as sent", *server)
+	}
+	log.Printf("✓ %s answered bad requests with NotFound, InvalidArgument and AlreadyExists", *server)
 }
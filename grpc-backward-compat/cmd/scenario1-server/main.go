@@ -1,11 +1,14 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net"
 
-	serverv1 "grpc-backward-compat/server/v1"
+	"grpc-backward-compat/idgen"
 	userv1 "grpc-backward-compat/proto/v1"
+	serverv1 "grpc-backward-compat/server/v1"
+	"grpc-backward-compat/storage"
 
 	"google.golang.org/grpc"
 )
@@ -15,18 +18,33 @@ const (
 )
 
 func main() {
+	addr := flag.String("addr", port, "Address to listen on")
+	storeSpec := flag.String("store", "memory", "Where users are kept: memory, sqlite:PATH or file:PATH (servers of any version can share one)")
+	idKind := flag.String("id", "counter", "How new users are named: counter (user_1, user_2, ...), uuidv7 or ulid")
+	flag.Parse()
+
 	log.Println("=== Scenario 1 Server: V1 Server (old proto without 'phone' field) ===")
 	log.Println()
 
-	lis, err := net.Listen("tcp", port)
+	lis, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	store, err := storage.Open(*storeSpec)
+	if err != nil {
+		log.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+	ids, err := idgen.New(*idKind, store)
+	if err != nil {
+		log.Fatalf("failed to create ID generator: %v", err)
+	}
+
 	s := grpc.NewServer()
-	userv1.RegisterUserServiceServer(s, serverv1.NewServer())
+	userv1.RegisterUserServiceServer(s, serverv1.NewServer(store, ids))
 
-	log.Printf("[V1 Server] Listening on %s", port)
+	log.Printf("[V1 Server] Listening on %s (store: %s, IDs: %s)", *addr, *storeSpec, *idKind)
 	log.Printf("[V1 Server] Ready to accept requests from V2 clients")
 	log.Println()
 
@@ -7,16 +7,25 @@ import (
 	"net"
 	"time"
 
-	serverv1 "grpc-backward-compat/server/v1"
+	"grpc-backward-compat/idgen"
 	userv1 "grpc-backward-compat/proto/v1"
-	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/scenario"
+	serverv1 "grpc-backward-compat/server/v1"
+	"grpc-backward-compat/storage"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	port = ":50051"
+
+	// Field numbers of phone in proto/v2: CreateUserRequest.phone and User.phone
+	requestPhoneField = 3
+	userPhoneField    = 4
 )
 
 func main() {
@@ -38,8 +47,9 @@ func startV1Server() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	store := storage.NewMemory()
 	s := grpc.NewServer()
-	userv1.RegisterUserServiceServer(s, serverv1.NewServer())
+	userv1.RegisterUserServiceServer(s, serverv1.NewServer(store, idgen.NewCounter(store)))
 
 	log.Printf("[Server] V1 Server listening on %s", port)
 	if err := s.Serve(lis); err != nil {
@@ -47,6 +57,9 @@ func startV1Server() {
 	}
 }
 
+// runV2Client sends what a V2 client puts on the wire. proto/v1 and proto/v2
+// both register the user.* names, so one binary cannot link both; the client
+// uses V1 messages and adds phone as the raw field a V2 message encodes it as.
 func runV2Client() {
 	conn, err := grpc.NewClient(fmt.Sprintf("localhost%s", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -54,40 +67,92 @@ func runV2Client() {
 	}
 	defer conn.Close()
 
-	client := userv2.NewUserServiceClient(conn)
+	client := userv1.NewUserServiceClient(conn)
+	check := scenario.NewChecker("[Client]")
 
 	log.Println("\n[Client] V2 Client creating user with name, email, AND phone...")
-	createReq := &userv2.CreateUserRequest{
+	const phone = "+1234567890"
+	createReq := &userv1.CreateUserRequest{
 		Name:  "John Doe",
 		Email: "john@example.com",
-		Phone: "+1234567890",
 	}
+	createReq.ProtoReflect().SetUnknown(appendString(nil, requestPhoneField, phone))
 
 	createResp, err := client.CreateUser(context.Background(), createReq)
-	if err != nil {
-		log.Fatalf("[Client] CreateUser failed: %v", err)
+	if !check.OK("CreateUser", err) {
+		check.Done("Scenario 1")
 	}
 
+	got := stringField(createResp.User, userPhoneField)
 	log.Printf("[Client] V2 Client received response: id=%s, name=%s, email=%s, phone=%s",
-		createResp.User.UserId, createResp.User.Name, createResp.User.Email, createResp.User.Phone)
-	log.Printf("[Client] ✓ SUCCESS: V1 server accepted V2 client request (phone field was ignored)")
+		createResp.User.UserId, createResp.User.Name, createResp.User.Email, got)
+	if got == phone {
+		check.Pass("SUCCESS: V1 server accepted V2 client request (phone field was kept unread)")
+	} else {
+		check.Fail("V1 server returned phone %q, expected %q", got, phone)
+	}
 
 	log.Println("\n[Client] V2 Client getting user...")
-	getReq := &userv2.GetUserRequest{
+	getReq := &userv1.GetUserRequest{
 		UserId: createResp.User.UserId,
 	}
 
 	getResp, err := client.GetUser(context.Background(), getReq)
-	if err != nil {
-		log.Fatalf("[Client] GetUser failed: %v", err)
+	if check.OK("GetUser", err) {
+		got = stringField(getResp.User, userPhoneField)
+		log.Printf("[Client] V2 Client received response: id=%s, name=%s, email=%s, phone=%s",
+			getResp.User.UserId, getResp.User.Name, getResp.User.Email, got)
+		if got == phone {
+			check.Pass("SUCCESS: V2 client received response from V1 server (phone came back as an unknown field)")
+		} else {
+			check.Fail("GetUser returned phone %q, expected %q", got, phone)
+		}
 	}
 
-	log.Printf("[Client] V2 Client received response: id=%s, name=%s, email=%s, phone=%s",
-		getResp.User.UserId, getResp.User.Name, getResp.User.Email, getResp.User.Phone)
-	log.Printf("[Client] ✓ SUCCESS: V2 client received response from V1 server (phone is empty, as expected)")
+	log.Println("\n[Client] Checking the status codes of failed calls...")
+	_, err = client.GetUser(context.Background(), &userv1.GetUserRequest{UserId: "user_does_not_exist"})
+	check.Code("GetUser of a missing user", err, codes.NotFound)
+	_, err = client.CreateUser(context.Background(), &userv1.CreateUserRequest{Email: "not-an-email"})
+	check.Violations("CreateUser with no name and a malformed email", err, "name", "email")
+	_, err = client.CreateUser(context.Background(), &userv1.CreateUserRequest{Name: "Someone Else", Email: "John@Example.com"})
+	check.Code("CreateUser with a taken email", err, codes.AlreadyExists)
+	check.Done("Scenario 1")
 
 	log.Println("\n=== Scenario 1 Result ===")
 	log.Println("✓ Backward compatibility WORKS: V2 client can communicate with V1 server")
-	log.Println("✓ New field 'phone' sent by V2 client is ignored by V1 server")
-	log.Println("✓ V2 client receives empty 'phone' field from V1 server (default value)")
+	log.Println("✓ New field 'phone' sent by V2 client is not understood by V1 server")
+	log.Println("✓ V2 client receives 'phone' back from V1 server, which stored it as an unknown field")
+	log.Println("✓ V1 server answered bad requests with NotFound, InvalidArgument and AlreadyExists")
+}
+
+// appendString appends a string field the way a generated message encodes it
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// stringField returns the string field num from m's unknown fields, which
+// is where a V1 message keeps a field only V2 knows, or "" if it is not there
+func stringField(m proto.Message, num protowire.Number) string {
+	b := m.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		n, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return ""
+		}
+		b = b[tagLen:]
+		if n == num && typ == protowire.BytesType {
+			v, vLen := protowire.ConsumeString(b)
+			if vLen < 0 {
+				return ""
+			}
+			return v
+		}
+		fieldLen := protowire.ConsumeFieldValue(n, typ, b)
+		if fieldLen < 0 {
+			return ""
+		}
+		b = b[fieldLen:]
+	}
+	return ""
 }
@@ -2,13 +2,15 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
 	"time"
 
 	userv1 "grpc-backward-compat/proto/v1"
+	"grpc-backward-compat/scenario"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -17,18 +19,24 @@ const (
 )
 
 func main() {
+	addr := flag.String("addr", "localhost"+port, "Address of the UserService server, which may be of any version")
+	server := flag.String("server", "V2 server", "What the server is, for the log")
+	flag.Parse()
+
 	log.Println("=== Scenario 2 Client: V1 Client (old proto WITHOUT 'phone' field) ===")
 	log.Println()
 
 	time.Sleep(1 * time.Second)
 
-	conn, err := grpc.NewClient(fmt.Sprintf("localhost%s", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatalf("[V1 Client] Failed to connect: %v", err)
 	}
 	defer conn.Close()
 
 	client := userv1.NewUserServiceClient(conn)
+	check := scenario.NewChecker("[V1 Client]")
+	log.Printf("[V1 Client] Talking to the server on %s", *addr)
 
 	log.Println("[V1 Client] Creating user with name and email (NO phone field)")
 	log.Println("[V1 Client] V1 client doesn't even know about 'phone' field")
@@ -38,14 +46,14 @@ func main() {
 	}
 
 	createResp, err := client.CreateUser(context.Background(), createReq)
-	if err != nil {
-		log.Fatalf("[V1 Client] CreateUser failed: %v", err)
+	if !check.OK("CreateUser", err) {
+		check.Done("Scenario 2")
 	}
 
 	log.Printf("[V1 Client] ✓ Response received: id=%s, name=%s, email=%s",
 		createResp.User.UserId, createResp.User.Name, createResp.User.Email)
 	log.Println()
-	log.Println("[V1 Client] ✓ Request accepted by V2 server (forward compatible)")
+	log.Printf("[V1 Client] ✓ Request accepted by %s (forward compatible)", *server)
 
 	log.Println()
 	log.Println("[V1 Client] Getting user back from server...")
@@ -54,16 +62,25 @@ func main() {
 	}
 
 	getResp, err := client.GetUser(context.Background(), getReq)
-	if err != nil {
-		log.Fatalf("[V1 Client] GetUser failed: %v", err)
+	if check.OK("GetUser", err) {
+		log.Printf("[V1 Client] ✓ Response received: id=%s, name=%s, email=%s",
+			getResp.User.UserId, getResp.User.Name, getResp.User.Email)
 	}
+	log.Println()
 
-	log.Printf("[V1 Client] ✓ Response received: id=%s, name=%s, email=%s",
-		getResp.User.UserId, getResp.User.Name, getResp.User.Email)
+	log.Println("[V1 Client] Checking the status codes of failed calls...")
+	_, err = client.GetUser(context.Background(), &userv1.GetUserRequest{UserId: "user_does_not_exist"})
+	check.Code("GetUser of a missing user", err, codes.NotFound)
+	_, err = client.CreateUser(context.Background(), &userv1.CreateUserRequest{Name: " ", Email: "jane@"})
+	check.Violations("CreateUser with a blank name and a malformed email", err, "name", "email")
+	_, err = client.CreateUser(context.Background(), &userv1.CreateUserRequest{Name: "Janet", Email: "JANE@example.com"})
+	check.Code("CreateUser with a taken email", err, codes.AlreadyExists)
 	log.Println()
+	check.Done("Scenario 2")
 
 	log.Println("=== Scenario 2 Summary ===")
-	log.Println("✓ V1 client successfully communicated with V2 server")
-	log.Println("✓ Missing 'phone' field from V1 client was accepted by V2 server (forward compatible)")
-	log.Println("✓ V1 client ignores 'phone' field sent by V2 server (doesn't know about it)")
+	log.Printf("✓ V1 client successfully communicated with %s", *server)
+	log.Printf("✓ Missing 'phone' field from V1 client was accepted by %s (forward compatible)", *server)
+	log.Printf("✓ V1 client ignores 'phone' field sent by %s (doesn't know about it)", *server)
+	log.Printf("✓ V1 client read NotFound, InvalidArgument with field violations and AlreadyExists from %s", *server)
 }
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net"
 
-	serverv2 "grpc-backward-compat/server/v2"
+	"grpc-backward-compat/idgen"
 	userv2 "grpc-backward-compat/proto/v2"
+	serverv2 "grpc-backward-compat/server/v2"
+	"grpc-backward-compat/storage"
 
 	"google.golang.org/grpc"
 )
@@ -15,18 +18,33 @@ const (
 )
 
 func main() {
+	addr := flag.String("addr", port, "Address to listen on")
+	storeSpec := flag.String("store", "memory", "Where users are kept: memory, sqlite:PATH or file:PATH (servers of any version can share one)")
+	idKind := flag.String("id", "counter", "How new users are named: counter (user_1, user_2, ...), uuidv7 or ulid")
+	flag.Parse()
+
 	log.Println("=== Scenario 2 Server: V2 Server (new proto WITH 'phone' field) ===")
 	log.Println()
 
-	lis, err := net.Listen("tcp", port)
+	lis, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	store, err := storage.Open(*storeSpec)
+	if err != nil {
+		log.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+	ids, err := idgen.New(*idKind, store)
+	if err != nil {
+		log.Fatalf("failed to create ID generator: %v", err)
+	}
+
 	s := grpc.NewServer()
-	userv2.RegisterUserServiceServer(s, serverv2.NewServer())
+	userv2.RegisterUserServiceServer(s, serverv2.NewServer(store, ids))
 
-	log.Printf("[V2 Server] Listening on %s", port)
+	log.Printf("[V2 Server] Listening on %s (store: %s, IDs: %s)", *addr, *storeSpec, *idKind)
 	log.Printf("[V2 Server] Ready to accept requests from V1 clients")
 	log.Println()
 
@@ -7,11 +7,14 @@ import (
 	"net"
 	"time"
 
-	serverv2 "grpc-backward-compat/server/v2"
-	userv1 "grpc-backward-compat/proto/v1"
+	"grpc-backward-compat/idgen"
 	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/scenario"
+	serverv2 "grpc-backward-compat/server/v2"
+	"grpc-backward-compat/storage"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -38,8 +41,9 @@ func startV2Server() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
+	store := storage.NewMemory()
 	s := grpc.NewServer()
-	userv2.RegisterUserServiceServer(s, serverv2.NewServer())
+	userv2.RegisterUserServiceServer(s, serverv2.NewServer(store, idgen.NewCounter(store)))
 
 	log.Printf("[Server] V2 Server listening on %s", port)
 	if err := s.Serve(lis); err != nil {
@@ -47,6 +51,9 @@ func startV2Server() {
 	}
 }
 
+// runV1Client sends what a V1 client puts on the wire. proto/v1 and proto/v2
+// both register the user.* names, so one binary cannot link both; the client
+// uses V2 messages and never sets phone, which encodes exactly like V1.
 func runV1Client() {
 	conn, err := grpc.NewClient(fmt.Sprintf("localhost%s", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -54,39 +61,56 @@ func runV1Client() {
 	}
 	defer conn.Close()
 
-	client := userv1.NewUserServiceClient(conn)
+	client := userv2.NewUserServiceClient(conn)
+	check := scenario.NewChecker("[Client]")
 
 	log.Println("\n[Client] V1 Client creating user with name and email (NO phone)...")
-	createReq := &userv1.CreateUserRequest{
+	createReq := &userv2.CreateUserRequest{
 		Name:  "Jane Smith",
 		Email: "jane@example.com",
 	}
 
 	createResp, err := client.CreateUser(context.Background(), createReq)
-	if err != nil {
-		log.Fatalf("[Client] CreateUser failed: %v", err)
+	if !check.OK("CreateUser", err) {
+		check.Done("Scenario 2")
 	}
 
 	log.Printf("[Client] V1 Client received response: id=%s, name=%s, email=%s",
 		createResp.User.UserId, createResp.User.Name, createResp.User.Email)
-	log.Printf("[Client] ✓ SUCCESS: V2 server accepted V1 client request (phone field was empty)")
+	if createResp.User.Phone == "" {
+		check.Pass("SUCCESS: V2 server accepted V1 client request (phone field was empty)")
+	} else {
+		check.Fail("V2 server made up phone %q for a V1 client that sent none", createResp.User.Phone)
+	}
 
 	log.Println("\n[Client] V1 Client getting user...")
-	getReq := &userv1.GetUserRequest{
+	getReq := &userv2.GetUserRequest{
 		UserId: createResp.User.UserId,
 	}
 
 	getResp, err := client.GetUser(context.Background(), getReq)
-	if err != nil {
-		log.Fatalf("[Client] GetUser failed: %v", err)
+	if check.OK("GetUser", err) {
+		log.Printf("[Client] V1 Client received response: id=%s, name=%s, email=%s",
+			getResp.User.UserId, getResp.User.Name, getResp.User.Email)
+		if getResp.User.Phone == "" {
+			check.Pass("SUCCESS: V1 client received response from V2 server (phone field is ignored)")
+		} else {
+			check.Fail("GetUser returned phone %q for a user created without one", getResp.User.Phone)
+		}
 	}
 
-	log.Printf("[Client] V1 Client received response: id=%s, name=%s, email=%s",
-		getResp.User.UserId, getResp.User.Name, getResp.User.Email)
-	log.Printf("[Client] ✓ SUCCESS: V1 client received response from V2 server (phone field is ignored)")
+	log.Println("\n[Client] Checking the status codes of failed calls...")
+	_, err = client.GetUser(context.Background(), &userv2.GetUserRequest{UserId: "user_does_not_exist"})
+	check.Code("GetUser of a missing user", err, codes.NotFound)
+	_, err = client.CreateUser(context.Background(), &userv2.CreateUserRequest{Email: "not-an-email"})
+	check.Violations("CreateUser with no name and a malformed email", err, "name", "email")
+	_, err = client.CreateUser(context.Background(), &userv2.CreateUserRequest{Name: "Someone Else", Email: "JANE@example.com"})
+	check.Code("CreateUser with a taken email", err, codes.AlreadyExists)
+	check.Done("Scenario 2")
 
 	log.Println("\n=== Scenario 2 Result ===")
 	log.Println("✓ Forward compatibility WORKS: V1 client can communicate with V2 server")
 	log.Println("✓ Missing 'phone' field from V1 client is accepted by V2 server (defaults to empty)")
 	log.Println("✓ V1 client ignores additional 'phone' field sent by V2 server")
+	log.Println("✓ V2 server answered bad requests with NotFound, InvalidArgument and AlreadyExists")
 }
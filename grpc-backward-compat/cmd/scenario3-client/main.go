@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/scenario"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	v1Port = ":50051"
+	v2Port = ":50052"
+)
+
+func dial(port string) (userv2.UserServiceClient, func()) {
+	conn, err := grpc.NewClient(fmt.Sprintf("localhost%s", port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("[V2 Client] Failed to connect to %s: %v", port, err)
+	}
+	return userv2.NewUserServiceClient(conn), func() { conn.Close() }
+}
+
+func main() {
+	log.Println("=== Scenario 3 Client: V2 Client writing through a V1 Server that shares its store with a V2 Server ===")
+	log.Println()
+
+	time.Sleep(1 * time.Second)
+
+	v1Server, closeV1 := dial(v1Port)
+	defer closeV1()
+	v2Server, closeV2 := dial(v2Port)
+	defer closeV2()
+	check := scenario.NewChecker("[V2 Client]")
+
+	log.Printf("[V2 Client] Creating user with phone='+1234567890' through the V1 server on %s...", v1Port)
+	createReq := &userv2.CreateUserRequest{
+		Name:  "Ada Lovelace",
+		Email: "ada@example.com",
+		Phone: "+1234567890",
+	}
+	createResp, err := v1Server.CreateUser(context.Background(), createReq)
+	if !check.OK("CreateUser", err) {
+		check.Done("Scenario 3")
+	}
+	log.Printf("[V2 Client] ✓ Created: id=%s", createResp.User.UserId)
+	log.Println()
+
+	for _, server := range []struct {
+		name   string
+		client userv2.UserServiceClient
+	}{
+		{"V1 server on " + v1Port, v1Server},
+		{"V2 server on " + v2Port, v2Server},
+	} {
+		log.Printf("[V2 Client] Reading the user back through the %s...", server.name)
+		getResp, err := server.client.GetUser(context.Background(), &userv2.GetUserRequest{UserId: createResp.User.UserId})
+		if !check.OK("GetUser", err) {
+			continue
+		}
+		log.Printf("[V2 Client]   id=%s, name=%s, email=%s, phone='%s'",
+			getResp.User.UserId, getResp.User.Name, getResp.User.Email, getResp.User.Phone)
+		if getResp.User.Phone != createReq.Phone {
+			check.Fail("Phone was lost: want '%s'", createReq.Phone)
+			continue
+		}
+		check.Pass("Phone survived")
+	}
+	log.Println()
+
+	log.Printf("[V2 Client] Creating another user with the same email through the V2 server on %s...", v2Port)
+	_, err = v2Server.CreateUser(context.Background(), &userv2.CreateUserRequest{Name: "Ada King", Email: "Ada@Example.com"})
+	check.Code("CreateUser with an email taken through the V1 server", err, codes.AlreadyExists)
+	_, err = v2Server.CreateUser(context.Background(), &userv2.CreateUserRequest{Name: "Ada King", Email: "ada.king@example.com", Phone: "555-0123"})
+	check.Violations("CreateUser with a malformed phone on the V2 server", err, "phone")
+	log.Println()
+	check.Done("Scenario 3")
+
+	log.Println("=== Scenario 3 Summary ===")
+	log.Println("✓ V1 server stored 'phone' as an unknown field instead of dropping it")
+	log.Println("✓ V2 client read 'phone' back through the V1 server (re-emitted unknown field)")
+	log.Println("✓ V2 client read 'phone' back through the V2 server sharing the store")
+	log.Println("✓ Email uniqueness holds across both servers sharing the store")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	userv3 "grpc-backward-compat/proto/v3"
+	"grpc-backward-compat/scenario"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	port = ":50053"
+)
+
+func main() {
+	log.Println("=== Scenario 4 Client: V3 Client (update, delete and list) ===")
+	log.Println()
+
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.NewClient("localhost"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("[V3 Client] Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	client := userv3.NewUserServiceClient(conn)
+	check := scenario.NewChecker("[V3 Client]")
+	ctx := context.Background()
+
+	log.Println("[V3 Client] Creating four users...")
+	var grace *userv3.User
+	for _, req := range []*userv3.CreateUserRequest{
+		{Name: "Grace Hopper", Email: "grace@example.com", Phone: "+1234567890"},
+		{Name: "Alan Turing", Email: "alan@example.com"},
+		{Name: "Ada Lovelace", Email: "ada@example.com"},
+		{Name: "Alonzo Church", Email: "alonzo@example.com"},
+	} {
+		resp, err := client.CreateUser(ctx, req)
+		if !check.OK("CreateUser", err) {
+			check.Done("Scenario 4")
+		}
+		log.Printf("[V3 Client] ✓ Created: id=%s, name=%s", resp.User.UserId, resp.User.Name)
+		if grace == nil {
+			grace = resp.User
+		}
+	}
+	log.Println()
+
+	log.Printf("[V3 Client] Renaming %s with update_mask=[name], leaving email and phone empty in the request...", grace.UserId)
+	updateResp, err := client.UpdateUser(ctx, &userv3.UpdateUserRequest{
+		User:       &userv3.User{UserId: grace.UserId, Name: "Rear Admiral Grace Hopper"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if check.OK("UpdateUser", err) {
+		log.Printf("[V3 Client]   id=%s, name=%s, email=%s, phone='%s'",
+			updateResp.User.UserId, updateResp.User.Name, updateResp.User.Email, updateResp.User.Phone)
+		if updateResp.User.Email == grace.Email && updateResp.User.Phone == grace.Phone {
+			check.Pass("Only the name changed")
+		} else {
+			check.Fail("Fields outside the mask changed")
+		}
+	}
+	_, err = client.UpdateUser(ctx, &userv3.UpdateUserRequest{User: &userv3.User{UserId: grace.UserId, Name: "Grace"}})
+	check.Violations("UpdateUser without an update_mask", err, "update_mask")
+	_, err = client.UpdateUser(ctx, &userv3.UpdateUserRequest{
+		User:       &userv3.User{UserId: grace.UserId, Email: "ADA@example.com"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+	})
+	check.Code("UpdateUser to a taken email", err, codes.AlreadyExists)
+	log.Println()
+
+	log.Println("[V3 Client] Listing users whose name starts with 'A', by name, two per page...")
+	var names []string
+	req := &userv3.ListUsersRequest{PageSize: 2, NamePrefix: "A", OrderBy: userv3.ListUsersRequest_ORDER_NAME}
+	for page := 1; ; page++ {
+		resp, err := client.ListUsers(ctx, req)
+		if !check.OK("ListUsers", err) {
+			break
+		}
+		for _, user := range resp.Users {
+			log.Printf("[V3 Client]   page %d: id=%s, name=%s", page, user.UserId, user.Name)
+			names = append(names, user.Name)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken = resp.NextPageToken
+	}
+	if want := []string{"Ada Lovelace", "Alan Turing", "Alonzo Church"}; slices.Equal(names, want) {
+		check.Pass("Listed %v", names)
+	} else {
+		check.Fail("Expected %v, listed %v", want, names)
+	}
+	_, err = client.ListUsers(ctx, &userv3.ListUsersRequest{PageToken: req.PageToken})
+	check.Violations("ListUsers with a page token from another order", err, "page_token")
+	log.Println()
+
+	log.Printf("[V3 Client] Deleting %s...", grace.UserId)
+	_, err = client.DeleteUser(ctx, &userv3.DeleteUserRequest{UserId: grace.UserId})
+	if check.OK("DeleteUser", err) {
+		check.Pass("Deleted %s", grace.UserId)
+	}
+	_, err = client.GetUser(ctx, &userv3.GetUserRequest{UserId: grace.UserId})
+	check.Code("GetUser of a deleted user", err, codes.NotFound)
+	_, err = client.DeleteUser(ctx, &userv3.DeleteUserRequest{UserId: grace.UserId})
+	check.Code("DeleteUser of a deleted user", err, codes.NotFound)
+	log.Println()
+	check.Done("Scenario 4")
+
+	log.Println("=== Scenario 4 Summary ===")
+	log.Println("✓ UpdateUser changed only the fields in update_mask")
+	log.Println("✓ ListUsers filtered by name prefix, ordered by name and paged with page tokens")
+	log.Println("✓ DeleteUser removed the user, and later calls for it got NotFound")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"grpc-backward-compat/idgen"
+	userv3 "grpc-backward-compat/proto/v3"
+	serverv3 "grpc-backward-compat/server/v3"
+	"grpc-backward-compat/storage"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	port = ":50053"
+)
+
+func main() {
+	addr := flag.String("addr", port, "Address to listen on")
+	storeSpec := flag.String("store", "memory", "Where users are kept: memory, sqlite:PATH or file:PATH (servers of any version can share one)")
+	idKind := flag.String("id", "counter", "How new users are named: counter (user_1, user_2, ...), uuidv7 or ulid")
+	flag.Parse()
+
+	log.Println("=== Scenario 4 Server: V3 Server (adds DeleteUser and ListUsers) ===")
+	log.Println()
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	store, err := storage.Open(*storeSpec)
+	if err != nil {
+		log.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+	ids, err := idgen.New(*idKind, store)
+	if err != nil {
+		log.Fatalf("failed to create ID generator: %v", err)
+	}
+
+	s := grpc.NewServer()
+	userv3.RegisterUserServiceServer(s, serverv3.NewServer(store, ids))
+
+	log.Printf("[V3 Server] Listening on %s (store: %s, IDs: %s)", *addr, *storeSpec, *idKind)
+	log.Printf("[V3 Server] Ready to accept requests from V1, V2 and V3 clients")
+	log.Println()
+
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
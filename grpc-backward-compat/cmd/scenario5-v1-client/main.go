@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	userv1 "grpc-backward-compat/proto/v1"
+	"grpc-backward-compat/scenario"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+var servers = []struct{ name, addr string }{
+	{"V1 server", "localhost:50051"},
+	{"V2 server", "localhost:50052"},
+	{"V3 server", "localhost:50053"},
+}
+
+func main() {
+	userID := flag.String("user", "", "ID of the user the V2 client created")
+	flag.Parse()
+
+	log.Println("=== Scenario 5 V1 Client: renaming a user without knowing 'phone' ===")
+	log.Println()
+
+	time.Sleep(1 * time.Second)
+
+	check := scenario.NewChecker("[V1 Client]")
+	ctx := context.Background()
+	for _, server := range servers {
+		conn, err := grpc.NewClient(server.addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("[V1 Client] Failed to connect to %s: %v", server.addr, err)
+		}
+		client := userv1.NewUserServiceClient(conn)
+
+		name := "Grace Hopper (renamed through the " + server.name + ")"
+		log.Printf("[V1 Client] Renaming %s through the %s with update_mask=[name]...", *userID, server.name)
+		resp, err := client.UpdateUser(ctx, &userv1.UpdateUserRequest{
+			User:       &userv1.User{UserId: *userID, Name: name},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+		})
+		if check.OK("UpdateUser", err) {
+			log.Printf("[V1 Client]   id=%s, name=%s, email=%s, plus %d bytes of fields V1 does not know",
+				resp.User.UserId, resp.User.Name, resp.User.Email, len(resp.User.ProtoReflect().GetUnknown()))
+			if resp.User.Name == name {
+				check.Pass("Renamed")
+			} else {
+				check.Fail("Expected name '%s'", name)
+			}
+		}
+
+		// An update that does not say what to change is refused, so a client
+		// cannot wipe fields it leaves empty by accident
+		_, err = client.UpdateUser(ctx, &userv1.UpdateUserRequest{User: &userv1.User{UserId: *userID, Name: name}})
+		check.Violations("UpdateUser without an update_mask", err, "update_mask")
+		conn.Close()
+		log.Println()
+	}
+	check.Done("Scenario 5")
+
+	log.Println("[V1 Client] ✓ Renamed the user through every server version without sending 'phone'")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/scenario"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	v1Addr = "localhost:50051"
+	v2Addr = "localhost:50052"
+	v3Addr = "localhost:50053"
+)
+
+func dial(addr string) (userv2.UserServiceClient, func()) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("[V2 Client] Failed to connect to %s: %v", addr, err)
+	}
+	return userv2.NewUserServiceClient(conn), func() { conn.Close() }
+}
+
+func main() {
+	create := flag.Bool("create", false, "Create the user and print its ID")
+	checkID := flag.String("check", "", "Check the user with this ID after the V1 client renamed it")
+	flag.Parse()
+
+	switch {
+	case *create:
+		createUser()
+	case *checkID != "":
+		checkUser(*checkID)
+	default:
+		log.Fatal("want -create or -check=ID")
+	}
+}
+
+// createUser creates a user with a phone through the V2 server and prints
+// its ID on stdout for the V1 client
+func createUser() {
+	log.Println("=== Scenario 5 V2 Client: creating a user with a phone ===")
+	log.Println()
+
+	time.Sleep(1 * time.Second)
+
+	v2Server, closeV2 := dial(v2Addr)
+	defer closeV2()
+
+	check := scenario.NewChecker("[V2 Client]")
+	resp, err := v2Server.CreateUser(context.Background(), &userv2.CreateUserRequest{
+		Name:  "Grace Hopper",
+		Email: "grace@example.com",
+		Phone: "+1234567890",
+	})
+	if !check.OK("CreateUser", err) {
+		check.Done("Scenario 5")
+	}
+	log.Printf("[V2 Client] ✓ Created through the V2 server: id=%s, phone='%s'", resp.User.UserId, resp.User.Phone)
+	log.Println()
+	fmt.Println(resp.User.UserId)
+}
+
+// checkUser reads the user back after the V1 client renamed it through
+// every server, then changes the phone on purpose
+func checkUser(id string) {
+	log.Println("=== Scenario 5 V2 Client: checking the phone after V1 renames ===")
+	log.Println()
+
+	v1Server, closeV1 := dial(v1Addr)
+	defer closeV1()
+	v2Server, closeV2 := dial(v2Addr)
+	defer closeV2()
+	v3Server, closeV3 := dial(v3Addr)
+	defer closeV3()
+
+	check := scenario.NewChecker("[V2 Client]")
+	ctx := context.Background()
+
+	resp, err := v2Server.GetUser(ctx, &userv2.GetUserRequest{UserId: id})
+	if !check.OK("GetUser", err) {
+		check.Done("Scenario 5")
+	}
+	log.Printf("[V2 Client]   id=%s, name=%s, email=%s, phone='%s'", resp.User.UserId, resp.User.Name, resp.User.Email, resp.User.Phone)
+	if strings.Contains(resp.User.Name, "V3 server") {
+		check.Pass("The V1 client's last rename stuck")
+	} else {
+		check.Fail("Expected the name set through the V3 server")
+	}
+	if resp.User.Phone == "+1234567890" {
+		check.Pass("Phone survived three renames by a client that does not know it")
+	} else {
+		check.Fail("Phone was lost: want '+1234567890'")
+	}
+	log.Println()
+
+	log.Println("[V2 Client] Asking the V1 server to clear the phone...")
+	_, err = v1Server.UpdateUser(ctx, &userv2.UpdateUserRequest{
+		User:       &userv2.User{UserId: id},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}},
+	})
+	check.Violations("UpdateUser of 'phone' on a server that does not know it", err, "update_mask")
+
+	log.Println("[V2 Client] Clearing the phone on purpose through the V3 server with update_mask=[phone]...")
+	updated, err := v3Server.UpdateUser(ctx, &userv2.UpdateUserRequest{
+		User:       &userv2.User{UserId: id},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}},
+	})
+	if check.OK("UpdateUser", err) {
+		if updated.User.Phone == "" && strings.Contains(updated.User.Name, "V3 server") {
+			check.Pass("Phone cleared, name kept: an empty phone in the mask means empty")
+		} else {
+			check.Fail("Expected only the phone to be cleared, got %v", updated.User)
+		}
+	}
+	log.Println()
+	check.Done("Scenario 5")
+
+	log.Println("=== Scenario 5 Summary ===")
+	log.Println("✓ A V1 client renamed a user through V1, V2 and V3 servers without wiping its phone")
+	log.Println("✓ Every server refused an update without update_mask")
+	log.Println("✓ The V1 server refused to change 'phone', a field it does not know, instead of ignoring it")
+	log.Println("✓ Listing 'phone' in update_mask cleared it on purpose")
+}
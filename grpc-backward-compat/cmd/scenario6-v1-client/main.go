@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"grpc-backward-compat/evolution"
+	"grpc-backward-compat/jsoncodec"
+	profilev1 "grpc-backward-compat/proto/profile/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	port = ":50055"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost"+port, "Address of the V2 profile server")
+	json := flag.Bool("json", false, "Send protojson (application/grpc+json) instead of binary protobuf")
+	flag.Parse()
+
+	encoding := "binary protobuf"
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if *json {
+		encoding = "JSON"
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsoncodec.Name)))
+	}
+
+	log.Printf("=== Scenario 6 Client: V1 Profile Client sending %s to a V2 server ===", encoding)
+	log.Println()
+
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.NewClient(*addr, opts...)
+	if err != nil {
+		log.Fatalf("[V1 Client] Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	client := profilev1.NewProfileServiceClient(conn)
+	ctx := context.Background()
+
+	// One profile per change in V2, so a refused one does not hide the others
+	for i, change := range []struct {
+		name    string
+		profile *profilev1.Profile
+	}{
+		{"string to bytes", &profilev1.Profile{Avatar: "ann.png"}},
+		{"int32 to int64", &profilev1.Profile{LoginCount: -1}},
+		{"field to oneof", &profilev1.Profile{Email: "ann@example.com"}},
+		{"singular to repeated", &profilev1.Profile{Tags: "go"}},
+		{"rename", &profilev1.Profile{DisplayName: "Ann"}},
+		{"reused tag", &profilev1.Profile{Karma: 42}},
+	} {
+		change.profile.UserId = fmt.Sprintf("v1-client-%d", i+1)
+		log.Printf("[V1 Client] %s: sending %s", change.name, evolution.Describe(change.profile))
+
+		if _, err := client.PutProfile(ctx, &profilev1.PutProfileRequest{Profile: change.profile}); err != nil {
+			st := status.Convert(err)
+			log.Printf("[V1 Client]   V2 server refused it: %s: %s", st.Code(), st.Message())
+			log.Println()
+			continue
+		}
+		resp, err := client.GetProfile(ctx, &profilev1.GetProfileRequest{UserId: change.profile.UserId})
+		if err != nil {
+			log.Fatalf("[V1 Client] GetProfile failed: %v", err)
+		}
+		log.Printf("[V1 Client]   read back: %s", evolution.Describe(resp.Profile))
+		log.Println()
+	}
+
+	log.Println("=== What the V2 server made of each profile is in its log ===")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	_ "grpc-backward-compat/jsoncodec"
+	profilev1 "grpc-backward-compat/proto/profile/v1"
+	serverv1 "grpc-backward-compat/server/profile/v1"
+	"grpc-backward-compat/storage"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	port = ":50054"
+)
+
+func main() {
+	addr := flag.String("addr", port, "Address to listen on")
+	storeSpec := flag.String("store", "memory", "Where profiles are kept: memory, sqlite:PATH or file:PATH")
+	flag.Parse()
+
+	log.Println("=== Scenario 6 Server: V1 Profile Server ===")
+	log.Println()
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	store, err := storage.Open(*storeSpec)
+	if err != nil {
+		log.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	s := grpc.NewServer()
+	profilev1.RegisterProfileServiceServer(s, serverv1.NewServer(store))
+
+	log.Printf("[V1 Profile Server] Listening on %s (store: %s)", *addr, *storeSpec)
+	log.Printf("[V1 Profile Server] Accepting binary protobuf and JSON (application/grpc+json)")
+	log.Println()
+
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"grpc-backward-compat/evolution"
+	"grpc-backward-compat/jsoncodec"
+	profilev2 "grpc-backward-compat/proto/profile/v2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	port = ":50054"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost"+port, "Address of the V1 profile server")
+	json := flag.Bool("json", false, "Send protojson (application/grpc+json) instead of binary protobuf")
+	flag.Parse()
+
+	encoding := "binary protobuf"
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if *json {
+		encoding = "JSON"
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsoncodec.Name)))
+	}
+
+	log.Printf("=== Scenario 6 Client: V2 Profile Client sending %s to a V1 server ===", encoding)
+	log.Println()
+
+	time.Sleep(1 * time.Second)
+
+	conn, err := grpc.NewClient(*addr, opts...)
+	if err != nil {
+		log.Fatalf("[V2 Client] Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	client := profilev2.NewProfileServiceClient(conn)
+	ctx := context.Background()
+
+	// One profile per change since V1, so a refused one does not hide the others
+	for i, change := range []struct {
+		name    string
+		profile *profilev2.Profile
+	}{
+		{"string to bytes, valid UTF-8", &profilev2.Profile{Avatar: []byte("ann.png")}},
+		{"string to bytes, not UTF-8", &profilev2.Profile{Avatar: []byte("\x89PNG")}},
+		{"int32 to int64", &profilev2.Profile{LoginCount: 1<<32 + 5}},
+		{"field to oneof", &profilev2.Profile{Contact: &profilev2.Profile_Phone{Phone: "+1234567890"}}},
+		{"singular to repeated", &profilev2.Profile{Tags: []string{"go", "grpc"}}},
+		{"rename", &profilev2.Profile{Nickname: "Ann"}},
+		{"reused tag", &profilev2.Profile{Referrer: "bob"}},
+	} {
+		change.profile.UserId = fmt.Sprintf("v2-client-%d", i+1)
+		log.Printf("[V2 Client] %s: sending %s", change.name, evolution.Describe(change.profile))
+
+		if _, err := client.PutProfile(ctx, &profilev2.PutProfileRequest{Profile: change.profile}); err != nil {
+			st := status.Convert(err)
+			log.Printf("[V2 Client]   V1 server refused it: %s: %s", st.Code(), st.Message())
+			log.Println()
+			continue
+		}
+		resp, err := client.GetProfile(ctx, &profilev2.GetProfileRequest{UserId: change.profile.UserId})
+		if err != nil {
+			log.Fatalf("[V2 Client] GetProfile failed: %v", err)
+		}
+		log.Printf("[V2 Client]   read back: %s", evolution.Describe(resp.Profile))
+		log.Println()
+	}
+
+	log.Println("=== What the V1 server made of each profile is in its log ===")
+}
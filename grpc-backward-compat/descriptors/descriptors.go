@@ -0,0 +1,62 @@
+// Package descriptors holds the compiled descriptors of every proto version
+// in this module, so one binary can read them all. The generated packages
+// cannot be linked together: userv1, userv2 and userv3 register the same
+// user.* names, and profilev1 and profilev2 the same profile.* names, in the
+// global registry, which panics on the second. Load resolves each version in
+// a registry of its own instead, which nothing else sees.
+//
+// The sets are built from the protos with their imports and without source
+// info; rebuild them whenever a proto changes:
+//
+//	buf build --path proto/v1/user.proto --exclude-source-info -o descriptors/userv1.binpb
+//
+// Each proto package has a test that fails while its set is out of date.
+package descriptors
+
+import (
+	"embed"
+	"fmt"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+//go:embed *.binpb
+var sets embed.FS
+
+// Names are the versions this package holds
+var Names = []string{"userv1", "userv2", "userv3", "profilev1", "profilev2"}
+
+// Set returns the FileDescriptorSet of the version called name, its proto
+// file last and the files it imports before it
+func Set(name string) (*descriptorpb.FileDescriptorSet, error) {
+	if !slices.Contains(Names, name) {
+		return nil, fmt.Errorf("unknown version %q", name)
+	}
+	data, err := sets.ReadFile(name + ".binpb")
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %v", name, err)
+	}
+	return set, nil
+}
+
+// Load returns the files of the version called name in a registry of their
+// own, where its messages and services can be looked up by full name
+func Load(name string) (*protoregistry.Files, error) {
+	set, err := Set(name)
+	if err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", name, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,106 @@
+// Package evolution shows what a peer on one version of a message observes
+// when the other side is on another. Describe prints a message as its reader
+// decoded it, unknown fields included, which the scenario 6 clients log and
+// the tests compare against.
+package evolution
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Describe returns the fields set in m in declaration order, then the fields
+// m does not know by number, e.g.
+//
+//	user_id:"ann" tags:["go" "grpc"] 8:"+1234567890"
+//
+// Bytes are quoted like strings. An unknown field is shown as its wire
+// format carries it: varints as numbers, length-delimited fields quoted.
+func Describe(m proto.Message) string {
+	var parts []string
+	describe(m.ProtoReflect(), &parts)
+	return strings.Join(parts, " ")
+}
+
+func describe(m protoreflect.Message, parts *[]string) {
+	fields := m.Descriptor().Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		*parts = append(*parts, fmt.Sprintf("%s:%s", fd.Name(), value(fd, m.Get(fd))))
+	}
+
+	unknown := m.GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			*parts = append(*parts, fmt.Sprintf("malformed:%q", unknown))
+			return
+		}
+		unknown = unknown[n:]
+		var v string
+		switch typ {
+		case protowire.VarintType:
+			x, k := protowire.ConsumeVarint(unknown)
+			v, n = fmt.Sprint(x), k
+		case protowire.BytesType:
+			b, k := protowire.ConsumeBytes(unknown)
+			v, n = fmt.Sprintf("%q", b), k
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, unknown)
+			if n >= 0 {
+				v = fmt.Sprintf("%x", unknown[:n])
+			}
+		}
+		if n < 0 {
+			*parts = append(*parts, fmt.Sprintf("malformed:%q", unknown))
+			return
+		}
+		unknown = unknown[n:]
+		*parts = append(*parts, fmt.Sprintf("%d:%s", num, v))
+	}
+}
+
+func value(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		items := make([]string, list.Len())
+		for i := range items {
+			items[i] = scalar(fd, list.Get(i))
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case fd.IsMap():
+		var items []string
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			items = append(items, fmt.Sprintf("%v:%s", k.Interface(), scalar(fd.MapValue(), v)))
+			return true
+		})
+		slices.Sort(items)
+		return "{" + strings.Join(items, " ") + "}"
+	}
+	return scalar(fd, v)
+}
+
+func scalar(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return fmt.Sprintf("%q", v.String())
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("%q", v.Bytes())
+	case protoreflect.EnumKind:
+		return fmt.Sprint(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		var parts []string
+		describe(v.Message(), &parts)
+		return "{" + strings.Join(parts, " ") + "}"
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,312 @@
+package evolution_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"grpc-backward-compat/descriptors"
+	"grpc-backward-compat/evolution"
+	"grpc-backward-compat/jsoncodec"
+	"grpc-backward-compat/serverproc"
+	"grpc-backward-compat/storage"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// peer is a profile server of one version, run as a process of its own
+// since profilev1 and profilev2 cannot be linked into one binary. Its
+// clients build their messages from the version's descriptors.
+type peer struct {
+	addr string
+	// store is the server's SQLite store, opened by the test as well
+	store storage.Store
+	files *protoregistry.Files
+}
+
+// startPeers starts a V1 and a V2 profile server, each with its own store
+func startPeers(t *testing.T) map[string]*peer {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	bins, err := serverproc.Build(ctx, dir, "grpc-backward-compat/cmd/scenario6-v1-server", "grpc-backward-compat/cmd/scenario6-v2-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := make(map[string]*peer)
+	for i, version := range []string{"V1", "V2"} {
+		path := filepath.Join(dir, strings.ToLower(version)+".db")
+		server, err := serverproc.Start(ctx, bins[i], "-store", "sqlite:"+path)
+		if err != nil {
+			t.Fatalf("Failed to start the %s server: %v", version, err)
+		}
+		t.Cleanup(server.Stop)
+		store, err := storage.OpenSQLite(path)
+		if err != nil {
+			t.Fatalf("Failed to open the %s store: %v", version, err)
+		}
+		t.Cleanup(func() { store.Close() })
+		files, err := descriptors.Load("profile" + strings.ToLower(version))
+		if err != nil {
+			t.Fatalf("Failed to load the %s descriptors: %v", version, err)
+		}
+		peers[version] = &peer{addr: server.Addr, store: store, files: files}
+	}
+	return peers
+}
+
+// message returns an empty message of p's version called name
+func (p *peer) message(t *testing.T, name protoreflect.FullName) *dynamicpb.Message {
+	t.Helper()
+	d, err := p.files.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatalf("Failed to find %s: %v", name, err)
+	}
+	return dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+}
+
+// call calls method of ProfileService through conn with a request of p's
+// version, which set fills, and returns the profile of the response
+func (p *peer) call(t *testing.T, ctx context.Context, conn grpc.ClientConnInterface, method string, set func(req protoreflect.Message)) (proto.Message, error) {
+	t.Helper()
+	req := p.message(t, protoreflect.FullName("profile."+method+"Request"))
+	set(req)
+	resp := p.message(t, protoreflect.FullName("profile."+method+"Response"))
+	if err := conn.Invoke(ctx, "/profile.ProfileService/"+method, req, resp); err != nil {
+		return nil, err
+	}
+	return resp.Get(field(resp, "profile")).Message().Interface(), nil
+}
+
+func field(m protoreflect.Message, name protoreflect.Name) protoreflect.FieldDescriptor {
+	return m.Descriptor().Fields().ByName(name)
+}
+
+func dial(t *testing.T, addr, encoding string) *grpc.ClientConn {
+	t.Helper()
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if encoding == "json" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsoncodec.Name)))
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestPeerObserves sends a profile from a client of one version to a server
+// of the other and records what the server stored and what the client reads
+// back, for each change between proto/profile/v1 and proto/profile/v2.
+func TestPeerObserves(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx := context.Background()
+	peers := startPeers(t)
+
+	for _, tc := range []struct {
+		name     string
+		encoding string
+		// from is the version of the client, which talks to a server of the
+		// other version
+		from string
+		// sent is the client's Profile in text format
+		sent string
+		// stored is the server's Profile as Describe prints it
+		stored string
+		// back is the profile GetProfile then returns to the sender
+		back string
+		// code and err are how PutProfile failed instead, if it did
+		code codes.Code
+		err  string
+	}{
+		// string avatar = 2 -> bytes avatar = 2
+		{
+			name: "string to bytes/V2 sends UTF-8", encoding: "binary",
+			from: "V2", sent: `user_id:"a1" avatar:"ann.png"`,
+			stored: `user_id:"a1" avatar:"ann.png"`,
+			back:   `user_id:"a1" avatar:"ann.png"`,
+		},
+		{
+			name: "string to bytes/V2 sends binary", encoding: "binary",
+			from: "V2", sent: `user_id:"a2" avatar:"\x89PNG"`,
+			code: codes.Internal, err: "invalid UTF-8",
+		},
+		{
+			name: "string to bytes/V2 sends binary", encoding: "json",
+			from: "V2", sent: `user_id:"a3" avatar:"\x89PNG"`,
+			stored: `user_id:"a3" avatar:"iVBORw=="`,
+			back:   `user_id:"a3" avatar:"\x89PNG"`,
+		},
+		{
+			name: "string to bytes/V1 sends text", encoding: "json",
+			from: "V1", sent: `user_id:"a4" avatar:"ann.png"`,
+			code: codes.Internal, err: "invalid value for bytes field avatar",
+		},
+
+		// int32 login_count = 3 -> int64 login_count = 3
+		{
+			name: "int32 to int64/V2 sends over 32 bits", encoding: "binary",
+			from: "V2", sent: `user_id:"c1" login_count:4294967301`,
+			stored: `user_id:"c1" login_count:5`,
+			back:   `user_id:"c1" login_count:5`,
+		},
+		{
+			name: "int32 to int64/V1 sends negative", encoding: "binary",
+			from: "V1", sent: `user_id:"c2" login_count:-1`,
+			stored: `user_id:"c2" login_count:-1`,
+			back:   `user_id:"c2" login_count:-1`,
+		},
+		{
+			name: "int32 to int64/V2 sends 32 bits", encoding: "json",
+			from: "V2", sent: `user_id:"c3" login_count:5`,
+			stored: `user_id:"c3" login_count:5`,
+			back:   `user_id:"c3" login_count:5`,
+		},
+		{
+			name: "int32 to int64/V2 sends over 32 bits", encoding: "json",
+			from: "V2", sent: `user_id:"c4" login_count:4294967301`,
+			code: codes.Internal, err: "invalid value for int32 field loginCount",
+		},
+
+		// string email = 4 -> oneof contact { string email = 4; string phone = 8; }
+		{
+			name: "field to oneof/V1 sends email", encoding: "binary",
+			from: "V1", sent: `user_id:"o1" email:"ann@example.com"`,
+			stored: `user_id:"o1" email:"ann@example.com"`,
+			back:   `user_id:"o1" email:"ann@example.com"`,
+		},
+		{
+			name: "field to oneof/V2 sends phone", encoding: "binary",
+			from: "V2", sent: `user_id:"o2" phone:"+1234567890"`,
+			stored: `user_id:"o2" 8:"+1234567890"`,
+			back:   `user_id:"o2" phone:"+1234567890"`,
+		},
+		{
+			name: "field to oneof/V2 sends phone", encoding: "json",
+			from: "V2", sent: `user_id:"o3" phone:"+1234567890"`,
+			code: codes.Internal, err: `unknown field "phone"`,
+		},
+
+		// string tags = 5 -> repeated string tags = 5
+		{
+			name: "singular to repeated/V1 sends one", encoding: "binary",
+			from: "V1", sent: `user_id:"r1" tags:"go"`,
+			stored: `user_id:"r1" tags:["go"]`,
+			back:   `user_id:"r1" tags:"go"`,
+		},
+		{
+			name: "singular to repeated/V2 sends two", encoding: "binary",
+			from: "V2", sent: `user_id:"r2" tags:["go", "grpc"]`,
+			stored: `user_id:"r2" tags:"grpc"`,
+			back:   `user_id:"r2" tags:["grpc"]`,
+		},
+		{
+			name: "singular to repeated/V1 sends one", encoding: "json",
+			from: "V1", sent: `user_id:"r3" tags:"go"`,
+			code: codes.Internal, err: `unexpected token "go"`,
+		},
+		{
+			name: "singular to repeated/V2 sends two", encoding: "json",
+			from: "V2", sent: `user_id:"r4" tags:["go", "grpc"]`,
+			code: codes.Internal, err: "invalid value for string field tags",
+		},
+
+		// string display_name = 6 -> string nickname = 6
+		{
+			name: "rename/V1 sends display_name", encoding: "binary",
+			from: "V1", sent: `user_id:"n1" display_name:"Ann"`,
+			stored: `user_id:"n1" nickname:"Ann"`,
+			back:   `user_id:"n1" display_name:"Ann"`,
+		},
+		{
+			name: "rename/V1 sends display_name", encoding: "json",
+			from: "V1", sent: `user_id:"n2" display_name:"Ann"`,
+			code: codes.Internal, err: `unknown field "displayName"`,
+		},
+		{
+			name: "rename/V2 sends nickname", encoding: "json",
+			from: "V2", sent: `user_id:"n3" nickname:"Ann"`,
+			code: codes.Internal, err: `unknown field "nickname"`,
+		},
+
+		// int64 karma = 7 -> reserved "karma"; string referrer = 7
+		{
+			name: "reused tag/V1 sends karma", encoding: "binary",
+			from: "V1", sent: `user_id:"t1" karma:42`,
+			stored: `user_id:"t1" 7:42`,
+			back:   `user_id:"t1" karma:42`,
+		},
+		{
+			name: "reused tag/V2 sends referrer", encoding: "binary",
+			from: "V2", sent: `user_id:"t2" referrer:"bob"`,
+			stored: `user_id:"t2" 7:"bob"`,
+			back:   `user_id:"t2" referrer:"bob"`,
+		},
+		{
+			name: "reused tag/V1 sends karma", encoding: "json",
+			from: "V1", sent: `user_id:"t3" karma:42`,
+			code: codes.Internal, err: `unknown field "karma"`,
+		},
+	} {
+		t.Run(tc.name+"/"+tc.encoding, func(t *testing.T) {
+			client, server, serverVer := peers["V1"], peers["V2"], "V2"
+			if tc.from == "V2" {
+				client, server, serverVer = peers["V2"], peers["V1"], "V1"
+			}
+			sent := client.message(t, "profile.Profile")
+			if err := prototext.Unmarshal([]byte(tc.sent), sent); err != nil {
+				t.Fatalf("Failed to parse %s profile %s: %v", tc.from, tc.sent, err)
+			}
+			userID := sent.Get(field(sent, "user_id")).String()
+			conn := dial(t, server.addr, tc.encoding)
+
+			_, err := client.call(t, ctx, conn, "PutProfile", func(req protoreflect.Message) {
+				req.Set(field(req, "profile"), protoreflect.ValueOfMessage(sent))
+			})
+			if tc.err != "" {
+				if status.Code(err) != tc.code || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("Expected PutProfile to fail with %s containing %q, got %v", tc.code, tc.err, err)
+				}
+				if _, err := server.store.Get(ctx, userID); !errors.Is(err, storage.ErrNotFound) {
+					t.Errorf("Expected nothing stored after a failed PutProfile, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PutProfile failed: %v", err)
+			}
+
+			stored := server.message(t, "profile.Profile")
+			if err := storage.GetMessage(ctx, server.store, userID, stored); err != nil {
+				t.Fatalf("Failed to read what the %s server stored: %v", serverVer, err)
+			}
+			if got := evolution.Describe(stored); got != tc.stored {
+				t.Errorf("%s server stored %s, expected %s", serverVer, got, tc.stored)
+			}
+			back, err := client.call(t, ctx, conn, "GetProfile", func(req protoreflect.Message) {
+				req.Set(field(req, "user_id"), protoreflect.ValueOfString(userID))
+			})
+			if err != nil {
+				t.Fatalf("GetProfile failed: %v", err)
+			}
+			if got := evolution.Describe(back); got != tc.back {
+				t.Errorf("Read back %s, expected %s", got, tc.back)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Package idgen allocates user IDs for the UserService servers. Every
+// generator is safe for concurrent use and never hands out the same ID
+// twice, including to servers of other versions sharing a store.
+package idgen
+
+import (
+	"context"
+	"fmt"
+
+	"grpc-backward-compat/storage"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+// prefix starts every user ID
+const prefix = "user_"
+
+// Generator hands out user IDs
+type Generator interface {
+	NewID(ctx context.Context) (string, error)
+}
+
+// Counter numbers users user_1, user_2, ... from the store's sequence, so
+// the numbering continues after a restart when the store is durable
+type Counter struct {
+	store storage.Store
+}
+
+func NewCounter(store storage.Store) *Counter {
+	return &Counter{store: store}
+}
+
+func (c *Counter) NewID(ctx context.Context) (string, error) {
+	n, err := c.store.NextSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%d", prefix, n), nil
+}
+
+// UUIDv7 makes time-ordered random IDs (RFC 9562) that need no coordination
+type UUIDv7 struct{}
+
+func (UUIDv7) NewID(ctx context.Context) (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a UUIDv7: %v", err)
+	}
+	return prefix + id.String(), nil
+}
+
+// ULID makes lexicographically sortable random IDs that need no coordination
+type ULID struct{}
+
+func (ULID) NewID(ctx context.Context) (string, error) {
+	return prefix + ulid.Make().String(), nil
+}
+
+// New returns the generator called kind: counter, uuidv7 or ulid
+func New(kind string, store storage.Store) (Generator, error) {
+	switch kind {
+	case "counter":
+		return NewCounter(store), nil
+	case "uuidv7":
+		return UUIDv7{}, nil
+	case "ulid":
+		return ULID{}, nil
+	}
+	return nil, fmt.Errorf("unknown ID generator %q: want counter, uuidv7 or ulid", kind)
+}
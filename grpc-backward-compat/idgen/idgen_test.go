@@ -0,0 +1,57 @@
+package idgen
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"grpc-backward-compat/storage"
+)
+
+func TestGenerators(t *testing.T) {
+	ctx := context.Background()
+	for _, kind := range []string{"counter", "uuidv7", "ulid"} {
+		t.Run(kind, func(t *testing.T) {
+			gen, err := New(kind, storage.NewMemory())
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			seen := map[string]bool{}
+			prev := ""
+			for range 100 {
+				id, err := gen.NewID(ctx)
+				if err != nil {
+					t.Fatalf("NewID failed: %v", err)
+				}
+				if !strings.HasPrefix(id, "user_") || seen[id] {
+					t.Fatalf("Bad or repeated ID %q", id)
+				}
+				// UUIDv7s and ULIDs made in one process sort in creation order
+				if kind != "counter" && id <= prev {
+					t.Errorf("%q does not sort after %q", id, prev)
+				}
+				seen[id], prev = true, id
+			}
+		})
+	}
+	if _, err := New("random", storage.NewMemory()); err == nil {
+		t.Error("Expected an unknown generator to fail")
+	}
+}
+
+func TestCounterContinuesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.db")
+	for _, want := range []string{"user_1", "user_2"} {
+		store, err := storage.OpenSQLite(path)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		id, err := NewCounter(store).NewID(ctx)
+		store.Close()
+		if err != nil || id != want {
+			t.Fatalf("Expected %s, got %q, %v", want, id, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package jsoncodec lets gRPC carry messages as protojson instead of binary
+// protobuf, the way a REST gateway or a JSON client would see them.
+// Importing it registers the codec on both sides; a client asks for it with
+// grpc.CallContentSubtype(jsoncodec.Name), and a server answers each call in
+// the encoding it was made with.
+package jsoncodec
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Name is the content subtype of calls in JSON: application/grpc+json
+const Name = "json"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// codec rejects fields the reader does not know, as protojson does by
+// default, so they fail the call instead of silently vanishing. Binary
+// protobuf keeps them as unknown fields instead.
+type codec struct{}
+
+func (codec) Name() string {
+	return Name
+}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal %T: not a proto message", v)
+	}
+	return protojson.Marshal(m)
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal %T: not a proto message", v)
+	}
+	return protojson.Unmarshal(data, m)
+}
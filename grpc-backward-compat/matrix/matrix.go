@@ -0,0 +1,251 @@
+// Package matrix runs every client version against every server version and
+// reports which expectations hold for each pairing. Each server runs as its
+// own process, built from its scenario command, with an in-memory store and
+// a free port; the clients talk to it over gRPC like any remote client would.
+//
+// The generated packages of two versions cannot be linked into one binary,
+// since they register the same names. The clients build their messages from
+// each version's descriptors instead, which is what its generated types
+// would put on the wire, and the servers are kept out of this process.
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"grpc-backward-compat/descriptors"
+	"grpc-backward-compat/serverproc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// User is a user as any client version sees it. Fields the client does not
+// know are left empty.
+type User struct {
+	ID    string
+	Name  string
+	Email string
+	Phone string
+}
+
+// Client is UserService as one client version calls it
+type Client interface {
+	CreateUser(ctx context.Context, u User) (User, error)
+	GetUser(ctx context.Context, id string) (User, error)
+	// UpdateUser changes the fields of the user u.ID named by paths
+	UpdateUser(ctx context.Context, u User, paths ...string) (User, error)
+	// DeleteUser and ListUsers can only be called by a client version whose
+	// Methods have them
+	DeleteUser(ctx context.Context, id string) error
+	// ListUsers returns one page of users and the token of the next, empty
+	// on the last page
+	ListUsers(ctx context.Context, req ListRequest) ([]User, string, error)
+}
+
+// ListRequest is a ListUsers request, listing by user ID
+type ListRequest struct {
+	PageSize    int32
+	PageToken   string
+	NamePrefix  string
+	EmailPrefix string
+}
+
+// ServerVersion is a UserService implementation the matrix can start
+type ServerVersion struct {
+	Name string
+	// Fields are the User fields besides user_id the server knows
+	Fields []string
+	// Methods are the UserService methods besides GetUser, CreateUser and
+	// UpdateUser, which every version has, that the server implements
+	Methods []string
+	// Command is the import path of the server's main package, which must
+	// take the address to listen on as -addr
+	Command string
+}
+
+// Knows reports whether the server knows field
+func (v ServerVersion) Knows(field string) bool {
+	return slices.Contains(v.Fields, field)
+}
+
+// Implements reports whether the server implements method
+func (v ServerVersion) Implements(method string) bool {
+	return slices.Contains(v.Methods, method)
+}
+
+// ClientVersion is a UserService client the matrix can run the suite with
+type ClientVersion struct {
+	Name string
+	// Fields are the User fields besides user_id the client knows
+	Fields []string
+	// Methods are the UserService methods besides GetUser, CreateUser and
+	// UpdateUser the client can call
+	Methods []string
+	// Descriptors is the version in the descriptors package the client
+	// builds its messages from
+	Descriptors string
+}
+
+// Knows reports whether the client knows field
+func (v ClientVersion) Knows(field string) bool {
+	return slices.Contains(v.Fields, field)
+}
+
+// Calls reports whether the client can call method
+func (v ClientVersion) Calls(method string) bool {
+	return slices.Contains(v.Methods, method)
+}
+
+// Pairing is one client version talking to one server version
+type Pairing struct {
+	Server ServerVersion
+	Client ClientVersion
+	// Call is the client, connected to the server
+	Call Client
+}
+
+// Check is one expectation the suite has of every pairing
+type Check struct {
+	Name string
+	// Run returns nil if the expectation holds, Skip if it does not apply to
+	// p, or an error describing what p got instead
+	Run func(ctx context.Context, p *Pairing) error
+}
+
+// Skip is returned by a check that does not apply to a pairing, with why
+type Skip string
+
+func (s Skip) Error() string {
+	return string(s)
+}
+
+// Status is the outcome of one check
+type Status string
+
+const (
+	Passed  Status = "pass"
+	Failed  Status = "fail"
+	Skipped Status = "skip"
+)
+
+// CheckResult is how one check went for one pairing
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	// Detail is why the check failed or was skipped
+	Detail string `json:"detail,omitempty"`
+}
+
+// Result is how the suite went for one pairing
+type Result struct {
+	Server string        `json:"server"`
+	Client string        `json:"client"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Count returns how many checks of the result have status
+func (r Result) Count(status Status) int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Run starts each server version in turn and runs checks with every client
+// version against it, in order. The servers are built with the go command
+// first. It only returns an error if a server cannot be built, started or
+// reached; failed checks are in the report.
+func Run(ctx context.Context, servers []ServerVersion, clients []ClientVersion, checks []Check) (*Report, error) {
+	report := &Report{}
+	for _, s := range servers {
+		report.Servers = append(report.Servers, s.Name)
+	}
+	for _, c := range clients {
+		report.Clients = append(report.Clients, c.Name)
+	}
+	for _, c := range checks {
+		report.Checks = append(report.Checks, c.Name)
+	}
+
+	files := make([]*protoregistry.Files, len(clients))
+	for i, c := range clients {
+		var err error
+		if files[i], err = descriptors.Load(c.Descriptors); err != nil {
+			return nil, fmt.Errorf("failed to load %s client: %v", c.Name, err)
+		}
+	}
+	bin, err := os.MkdirTemp("", "matrix")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build directory: %v", err)
+	}
+	defer os.RemoveAll(bin)
+	cmds := make([]string, len(servers))
+	for i, s := range servers {
+		cmds[i] = s.Command
+	}
+	bins, err := serverproc.Build(ctx, bin, cmds...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, server := range servers {
+		results, err := runServer(ctx, bins[i], server, clients, files, checks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run %s server: %v", server.Name, err)
+		}
+		report.Results = append(report.Results, results...)
+	}
+	return report, nil
+}
+
+// runServer runs the server binary bin on a free port for as long as every
+// client takes to run checks against it
+func runServer(ctx context.Context, bin string, server ServerVersion, clients []ClientVersion, files []*protoregistry.Files, checks []Check) ([]Result, error) {
+	proc, err := serverproc.Start(ctx, bin)
+	if err != nil {
+		return nil, err
+	}
+	defer proc.Stop()
+
+	conn, err := grpc.NewClient(proc.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	var results []Result
+	for i, client := range clients {
+		call, err := newClient(conn, files[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s client: %v", client.Name, err)
+		}
+		p := &Pairing{Server: server, Client: client, Call: call}
+		result := Result{Server: server.Name, Client: client.Name}
+		for _, check := range checks {
+			result.Checks = append(result.Checks, run(ctx, check, p))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func run(ctx context.Context, check Check, p *Pairing) CheckResult {
+	err := check.Run(ctx, p)
+	var skip Skip
+	switch {
+	case err == nil:
+		return CheckResult{Name: check.Name, Status: Passed}
+	case errors.As(err, &skip):
+		return CheckResult{Name: check.Name, Status: Skipped, Detail: skip.Error()}
+	default:
+		return CheckResult{Name: check.Name, Status: Failed, Detail: err.Error()}
+	}
+}
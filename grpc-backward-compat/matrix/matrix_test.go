@@ -0,0 +1,99 @@
+package matrix
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var reportDir = flag.String("report", "", "Directory to write matrix.md and matrix.json to")
+
+// TestMatrix runs Suite with every client version against every server
+// version. Run it with -v to see each check, or -report=DIR for the reports.
+func TestMatrix(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	report, err := Run(context.Background(), Servers, Clients, Suite)
+	if err != nil {
+		t.Fatalf("Matrix failed to run: %v", err)
+	}
+	for _, res := range report.Results {
+		t.Run(res.Client+" client/"+res.Server+" server", func(t *testing.T) {
+			for _, c := range res.Checks {
+				t.Run(strings.ReplaceAll(c.Name, " ", "_"), func(t *testing.T) {
+					switch c.Status {
+					case Failed:
+						t.Error(c.Detail)
+					case Skipped:
+						t.Skip(c.Detail)
+					}
+				})
+			}
+		})
+	}
+
+	if len(report.Results) != len(Servers)*len(Clients) {
+		t.Errorf("Expected %d pairings, got %d", len(Servers)*len(Clients), len(report.Results))
+	}
+	if *reportDir == "" {
+		return
+	}
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(*reportDir, 0o755); err != nil {
+		t.Fatalf("Failed to create report directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(*reportDir, "matrix.json"), data, 0o644); err != nil {
+		t.Fatalf("Failed to write JSON report: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(*reportDir, "matrix.md"), []byte(report.Markdown()), 0o644); err != nil {
+		t.Fatalf("Failed to write Markdown report: %v", err)
+	}
+}
+
+// TestReportFailure checks that a failing check fails the report and shows
+// in both formats
+func TestReportFailure(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	broken := Check{"broken", func(ctx context.Context, p *Pairing) error {
+		if p.Server.Name == "V1" {
+			return io.ErrUnexpectedEOF
+		}
+		return Skip("only V1 is broken")
+	}}
+	report, err := Run(context.Background(), Servers[:2], Clients[:1], []Check{Suite[0], broken})
+	if err != nil {
+		t.Fatalf("Matrix failed to run: %v", err)
+	}
+	if report.Passed() {
+		t.Error("Expected the report to fail")
+	}
+
+	md := report.Markdown()
+	for _, want := range []string{
+		"| V1 | ✗ 1/2 | ✓ 1/1, 1 skipped |",
+		"| broken | ✗ fail | unexpected EOF |",
+		"| broken | – skip | only V1 is broken |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("Expected %q in the Markdown report:\n%s", want, md)
+		}
+	}
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"status": "fail"`) {
+		t.Errorf("Expected a failed check in the JSON report:\n%s", data)
+	}
+}
@@ -0,0 +1,109 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Report is the outcome of Run. It marshals to the JSON report.
+type Report struct {
+	Servers []string `json:"servers"`
+	Clients []string `json:"clients"`
+	Checks  []string `json:"checks"`
+	Results []Result `json:"results"`
+}
+
+// Passed reports whether no check failed for any pairing
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Count(Failed) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Result returns the result of client against server
+func (r *Report) Result(server, client string) (Result, bool) {
+	for _, res := range r.Results {
+		if res.Server == server && res.Client == client {
+			return res, true
+		}
+	}
+	return Result{}, false
+}
+
+// JSON returns the report as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode report: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Markdown returns the report as a client-by-server table of passed checks,
+// followed by one table per pairing saying how each check went
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Compatibility Matrix\n\n")
+	b.WriteString("| Client \\ Server |")
+	for _, s := range r.Servers {
+		fmt.Fprintf(&b, " %s |", s)
+	}
+	b.WriteString("\n|-----------------|")
+	for range r.Servers {
+		b.WriteString("----|")
+	}
+	b.WriteString("\n")
+	for _, c := range r.Clients {
+		fmt.Fprintf(&b, "| %s |", c)
+		for _, s := range r.Servers {
+			res, ok := r.Result(s, c)
+			if !ok {
+				b.WriteString(" |")
+				continue
+			}
+			fmt.Fprintf(&b, " %s |", summary(res))
+		}
+		b.WriteString("\n")
+	}
+
+	for _, res := range r.Results {
+		fmt.Fprintf(&b, "\n## %s Client → %s Server\n\n", res.Client, res.Server)
+		b.WriteString("| Check | Result | Detail |\n|-------|--------|--------|\n")
+		for _, c := range res.Checks {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", c.Name, mark(c.Status), escape(c.Detail))
+		}
+	}
+	return b.String()
+}
+
+// summary is a pairing's cell in the matrix, e.g. "✓ 6/6" or "✗ 5/7, 1 skipped"
+func summary(res Result) string {
+	passed, failed, skipped := res.Count(Passed), res.Count(Failed), res.Count(Skipped)
+	s := fmt.Sprintf("✓ %d/%d", passed, passed+failed)
+	if failed > 0 {
+		s = "✗" + s[len("✓"):]
+	}
+	if skipped > 0 {
+		s += fmt.Sprintf(", %d skipped", skipped)
+	}
+	return s
+}
+
+func mark(status Status) string {
+	switch status {
+	case Passed:
+		return "✓ pass"
+	case Failed:
+		return "✗ fail"
+	}
+	return "– skip"
+}
+
+// escape keeps detail inside its table cell
+func escape(detail string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(detail)
+}
@@ -0,0 +1,355 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Suite is what every pairing of versions is expected to do. A check that
+// only makes sense for some pairings, such as sending a phone, skips the
+// others; where the answer depends on the server knowing a field or method,
+// the check expects the answer for the server it talks to.
+var Suite = []Check{
+	{"create", checkCreate},
+	{"round-trip", checkRoundTrip},
+	{"partial update", checkPartialUpdate},
+	{"update phone", checkUpdatePhone},
+	{"not found", checkNotFound},
+	{"missing fields", checkMissingFields},
+	{"no email", checkNoEmail},
+	{"email taken", checkEmailTaken},
+	{"invalid phone", checkInvalidPhone},
+	{"delete", checkDelete},
+	{"list pages", checkListPages},
+	{"list filters", checkListFilters},
+}
+
+// newUser returns a user with every field the client knows set, and an
+// email no other check or client uses
+func (p *Pairing) newUser(check string) User {
+	u := User{
+		Name:  "Ann " + check,
+		Email: fmt.Sprintf("%s.%s@example.com", strings.ReplaceAll(check, " ", "-"), strings.ToLower(p.Client.Name)),
+	}
+	if p.Client.Knows("phone") {
+		u.Phone = "+1234567890"
+	}
+	return u
+}
+
+// create stores u through the client and returns it with its ID
+func (p *Pairing) create(ctx context.Context, u User) (User, error) {
+	created, err := p.Call.CreateUser(ctx, u)
+	if err != nil {
+		return User{}, fmt.Errorf("CreateUser failed: %v", err)
+	}
+	u.ID = created.ID
+	return u, nil
+}
+
+// createListed creates n users of check whose names, and no others, start
+// with the prefix it returns, in the order ListUsers lists them by ID
+func (p *Pairing) createListed(ctx context.Context, check string, n int) (string, []User, error) {
+	prefix := fmt.Sprintf("Ann %s %s ", check, p.Client.Name)
+	users := make([]User, n)
+	for i := range users {
+		u := p.newUser(fmt.Sprintf("%s %d", check, i))
+		u.Name = fmt.Sprintf("%s%d", prefix, i)
+		var err error
+		if users[i], err = p.create(ctx, u); err != nil {
+			return "", nil, err
+		}
+	}
+	slices.SortFunc(users, func(a, b User) int { return storage.CompareIDs(a.ID, b.ID) })
+	return prefix, users, nil
+}
+
+// checkCreate expects CreateUser to assign an ID and return every field sent,
+// including ones the server does not know
+func checkCreate(ctx context.Context, p *Pairing) error {
+	sent := p.newUser("create")
+	got, err := p.Call.CreateUser(ctx, sent)
+	if err != nil {
+		return fmt.Errorf("CreateUser failed: %v", err)
+	}
+	if got.ID == "" {
+		return errors.New("CreateUser assigned no user_id")
+	}
+	sent.ID = got.ID
+	return diff("CreateUser", sent, got)
+}
+
+// checkRoundTrip expects GetUser to return every field CreateUser was sent
+func checkRoundTrip(ctx context.Context, p *Pairing) error {
+	want, err := p.create(ctx, p.newUser("round-trip"))
+	if err != nil {
+		return err
+	}
+	got, err := p.Call.GetUser(ctx, want.ID)
+	if err != nil {
+		return fmt.Errorf("GetUser failed: %v", err)
+	}
+	return diff("GetUser", want, got)
+}
+
+// checkPartialUpdate renames a user the way every client version can, with
+// the other fields left empty, and expects only the name to change
+func checkPartialUpdate(ctx context.Context, p *Pairing) error {
+	want, err := p.create(ctx, p.newUser("partial update"))
+	if err != nil {
+		return err
+	}
+	want.Name = "Ann Smith"
+	got, err := p.Call.UpdateUser(ctx, User{ID: want.ID, Name: want.Name}, "name")
+	if err != nil {
+		return fmt.Errorf("UpdateUser failed: %v", err)
+	}
+	if err := diff("UpdateUser", want, got); err != nil {
+		return err
+	}
+	got, err = p.Call.GetUser(ctx, want.ID)
+	if err != nil {
+		return fmt.Errorf("GetUser failed: %v", err)
+	}
+	return diff("GetUser after UpdateUser", want, got)
+}
+
+// checkUpdatePhone expects a server that knows phone to change it, and one
+// that does not to refuse rather than ignore the mask
+func checkUpdatePhone(ctx context.Context, p *Pairing) error {
+	if !p.Client.Knows("phone") {
+		return Skip("the client cannot send phone")
+	}
+	want, err := p.create(ctx, p.newUser("update phone"))
+	if err != nil {
+		return err
+	}
+	_, err = p.Call.UpdateUser(ctx, User{ID: want.ID, Phone: "+1987654321"}, "phone")
+	if p.Server.Knows("phone") {
+		if err != nil {
+			return fmt.Errorf("UpdateUser failed: %v", err)
+		}
+		want.Phone = "+1987654321"
+	} else if err := violations("UpdateUser of phone", err, "update_mask"); err != nil {
+		return err
+	}
+	got, err := p.Call.GetUser(ctx, want.ID)
+	if err != nil {
+		return fmt.Errorf("GetUser failed: %v", err)
+	}
+	return diff("GetUser after UpdateUser", want, got)
+}
+
+func checkNotFound(ctx context.Context, p *Pairing) error {
+	_, err := p.Call.GetUser(ctx, "user_does_not_exist")
+	return code("GetUser of a missing user", err, codes.NotFound)
+}
+
+func checkMissingFields(ctx context.Context, p *Pairing) error {
+	_, err := p.Call.CreateUser(ctx, User{})
+	return violations("CreateUser without name", err, "name")
+}
+
+// checkNoEmail expects a user without an email, which every version has
+// always been able to create, to still be accepted
+func checkNoEmail(ctx context.Context, p *Pairing) error {
+	u := p.newUser("no email")
+	u.Email = ""
+	want, err := p.create(ctx, u)
+	if err != nil {
+		return err
+	}
+	got, err := p.Call.GetUser(ctx, want.ID)
+	if err != nil {
+		return fmt.Errorf("GetUser failed: %v", err)
+	}
+	return diff("GetUser", want, got)
+}
+
+// checkEmailTaken expects emails to be unique whatever their case
+func checkEmailTaken(ctx context.Context, p *Pairing) error {
+	u, err := p.create(ctx, p.newUser("email taken"))
+	if err != nil {
+		return err
+	}
+	_, err = p.Call.CreateUser(ctx, User{Name: "Ann Two", Email: strings.ToUpper(u.Email)})
+	return code("CreateUser with a taken email", err, codes.AlreadyExists)
+}
+
+// checkInvalidPhone expects a server that knows phone to reject a malformed
+// one, and one that does not to store it as sent, since it cannot validate it
+func checkInvalidPhone(ctx context.Context, p *Pairing) error {
+	if !p.Client.Knows("phone") {
+		return Skip("the client cannot send phone")
+	}
+	u := p.newUser("invalid phone")
+	u.Phone = "555-0123"
+	if p.Server.Knows("phone") {
+		_, err := p.Call.CreateUser(ctx, u)
+		return violations("CreateUser with a malformed phone", err, "phone")
+	}
+	want, err := p.create(ctx, u)
+	if err != nil {
+		return err
+	}
+	got, err := p.Call.GetUser(ctx, want.ID)
+	if err != nil {
+		return fmt.Errorf("GetUser failed: %v", err)
+	}
+	return diff("GetUser", want, got)
+}
+
+// checkDelete expects a server with DeleteUser to delete a user for good, and
+// one without it to answer Unimplemented and keep the user
+func checkDelete(ctx context.Context, p *Pairing) error {
+	if !p.Client.Calls("DeleteUser") {
+		return Skip("the client cannot call DeleteUser")
+	}
+	want, err := p.create(ctx, p.newUser("delete"))
+	if err != nil {
+		return err
+	}
+	err = p.Call.DeleteUser(ctx, want.ID)
+	if !p.Server.Implements("DeleteUser") {
+		if err := code("DeleteUser on a server without it", err, codes.Unimplemented); err != nil {
+			return err
+		}
+		got, err := p.Call.GetUser(ctx, want.ID)
+		if err != nil {
+			return fmt.Errorf("GetUser failed: %v", err)
+		}
+		return diff("GetUser after DeleteUser", want, got)
+	}
+	if err != nil {
+		return fmt.Errorf("DeleteUser failed: %v", err)
+	}
+	_, err = p.Call.GetUser(ctx, want.ID)
+	if err := code("GetUser of a deleted user", err, codes.NotFound); err != nil {
+		return err
+	}
+	return code("DeleteUser of a deleted user", p.Call.DeleteUser(ctx, want.ID), codes.NotFound)
+}
+
+// checkListPages expects ListUsers to page through the users with a name
+// prefix by ID, each once, with a token after every page but the last
+func checkListPages(ctx context.Context, p *Pairing) error {
+	if !p.Client.Calls("ListUsers") {
+		return Skip("the client cannot call ListUsers")
+	}
+	if !p.Server.Implements("ListUsers") {
+		_, _, err := p.Call.ListUsers(ctx, ListRequest{PageSize: 2})
+		return code("ListUsers on a server without it", err, codes.Unimplemented)
+	}
+	prefix, want, err := p.createListed(ctx, "list pages", 3)
+	if err != nil {
+		return err
+	}
+	req := ListRequest{PageSize: 2, NamePrefix: prefix}
+	first, next, err := p.Call.ListUsers(ctx, req)
+	if err != nil {
+		return fmt.Errorf("ListUsers failed: %v", err)
+	}
+	if len(first) != 2 || next == "" {
+		return fmt.Errorf("ListUsers: expected 2 users and a page token, got %d users and token %q", len(first), next)
+	}
+	req.PageToken = next
+	second, next, err := p.Call.ListUsers(ctx, req)
+	if err != nil {
+		return fmt.Errorf("ListUsers of the second page failed: %v", err)
+	}
+	if len(second) != 1 || next != "" {
+		return fmt.Errorf("ListUsers of the second page: expected 1 user and no page token, got %d users and token %q", len(second), next)
+	}
+	for i, got := range append(first, second...) {
+		if err := diff(fmt.Sprintf("ListUsers user %d", i+1), want[i], got); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkListFilters expects ListUsers to combine a name and an email prefix,
+// the email ignoring case, and to refuse a page token sent with filters other
+// than those it was returned for
+func checkListFilters(ctx context.Context, p *Pairing) error {
+	if !p.Client.Calls("ListUsers") {
+		return Skip("the client cannot call ListUsers")
+	}
+	if !p.Server.Implements("ListUsers") {
+		_, _, err := p.Call.ListUsers(ctx, ListRequest{NamePrefix: "Ann"})
+		return code("ListUsers on a server without it", err, codes.Unimplemented)
+	}
+	prefix, want, err := p.createListed(ctx, "list filters", 3)
+	if err != nil {
+		return err
+	}
+	got, next, err := p.Call.ListUsers(ctx, ListRequest{NamePrefix: prefix, EmailPrefix: strings.ToUpper(want[1].Email)})
+	if err != nil {
+		return fmt.Errorf("ListUsers failed: %v", err)
+	}
+	if len(got) != 1 || next != "" {
+		return fmt.Errorf("ListUsers by name and email: expected 1 user and no page token, got %d users and token %q", len(got), next)
+	}
+	if err := diff("ListUsers by name and email", want[1], got[0]); err != nil {
+		return err
+	}
+
+	_, next, err = p.Call.ListUsers(ctx, ListRequest{PageSize: 1, NamePrefix: prefix})
+	if err != nil {
+		return fmt.Errorf("ListUsers failed: %v", err)
+	}
+	_, _, err = p.Call.ListUsers(ctx, ListRequest{PageSize: 1, PageToken: next, NamePrefix: prefix + "0"})
+	return violations("ListUsers with a page token from other filters", err, "page_token")
+}
+
+// diff returns an error naming every field of got that is not as in want
+func diff(what string, want, got User) error {
+	var diffs []string
+	for _, f := range []struct{ name, want, got string }{
+		{"user_id", want.ID, got.ID},
+		{"name", want.Name, got.Name},
+		{"email", want.Email, got.Email},
+		{"phone", want.Phone, got.Phone},
+	} {
+		if f.want != f.got {
+			diffs = append(diffs, fmt.Sprintf("%s %q, got %q", f.name, f.want, f.got))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%s: expected %s", what, strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// code returns an error unless err carries the status code want
+func code(what string, err error, want codes.Code) error {
+	if got := status.Code(err); got != want {
+		return fmt.Errorf("%s: expected %s, got %s (%v)", what, want, got, err)
+	}
+	return nil
+}
+
+// violations returns an error unless err is InvalidArgument with BadRequest
+// violations of exactly fields, in order
+func violations(what string, err error, fields ...string) error {
+	if err := code(what, err, codes.InvalidArgument); err != nil {
+		return err
+	}
+	var got []string
+	for _, fv := range validation.FieldViolations(err) {
+		got = append(got, fv.Field)
+	}
+	if !slices.Equal(got, fields) {
+		return fmt.Errorf("%s: expected violations of %v, got %v", what, fields, got)
+	}
+	return nil
+}
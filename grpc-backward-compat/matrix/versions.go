@@ -0,0 +1,156 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Servers are every server version, oldest first. A new version is one more
+// entry here and in Clients.
+var Servers = []ServerVersion{
+	{Name: "V1", Fields: []string{"name", "email"}, Command: "grpc-backward-compat/cmd/scenario1-server"},
+	{Name: "V2", Fields: []string{"name", "email", "phone"}, Command: "grpc-backward-compat/cmd/scenario2-server"},
+	{Name: "V3", Fields: []string{"name", "email", "phone"}, Methods: []string{"DeleteUser", "ListUsers"}, Command: "grpc-backward-compat/cmd/scenario4-server"},
+}
+
+// Clients are every client version, oldest first
+var Clients = []ClientVersion{
+	{Name: "V1", Fields: []string{"name", "email"}, Descriptors: "userv1"},
+	{Name: "V2", Fields: []string{"name", "email", "phone"}, Descriptors: "userv2"},
+	{Name: "V3", Fields: []string{"name", "email", "phone"}, Methods: []string{"DeleteUser", "ListUsers"}, Descriptors: "userv3"},
+}
+
+// client calls UserService with messages of one version, built from its
+// descriptors. A User field the version does not have is never sent, and
+// comes back empty, as with its generated types.
+type client struct {
+	conn    grpc.ClientConnInterface
+	service protoreflect.ServiceDescriptor
+}
+
+func newClient(conn grpc.ClientConnInterface, files *protoregistry.Files) (client, error) {
+	d, err := files.FindDescriptorByName("user.UserService")
+	if err != nil {
+		return client{}, err
+	}
+	service, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return client{}, fmt.Errorf("%s is not a service", d.FullName())
+	}
+	return client{conn: conn, service: service}, nil
+}
+
+func (c client) CreateUser(ctx context.Context, u User) (User, error) {
+	return c.call(ctx, "CreateUser", func(req protoreflect.Message) {
+		setUser(req, u)
+	})
+}
+
+func (c client) GetUser(ctx context.Context, id string) (User, error) {
+	return c.call(ctx, "GetUser", func(req protoreflect.Message) {
+		setUser(req, User{ID: id})
+	})
+}
+
+func (c client) UpdateUser(ctx context.Context, u User, paths ...string) (User, error) {
+	return c.call(ctx, "UpdateUser", func(req protoreflect.Message) {
+		setUser(req.Mutable(field(req, "user")).Message(), u)
+		mask := req.Mutable(field(req, "update_mask")).Message()
+		list := mask.Mutable(field(mask, "paths")).List()
+		for _, p := range paths {
+			list.Append(protoreflect.ValueOfString(p))
+		}
+	})
+}
+
+func (c client) DeleteUser(ctx context.Context, id string) error {
+	_, err := c.invoke(ctx, "DeleteUser", func(req protoreflect.Message) {
+		setUser(req, User{ID: id})
+	})
+	return err
+}
+
+func (c client) ListUsers(ctx context.Context, r ListRequest) ([]User, string, error) {
+	resp, err := c.invoke(ctx, "ListUsers", func(req protoreflect.Message) {
+		req.Set(field(req, "page_size"), protoreflect.ValueOfInt32(r.PageSize))
+		req.Set(field(req, "page_token"), protoreflect.ValueOfString(r.PageToken))
+		req.Set(field(req, "name_prefix"), protoreflect.ValueOfString(r.NamePrefix))
+		req.Set(field(req, "email_prefix"), protoreflect.ValueOfString(r.EmailPrefix))
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	list := resp.Get(field(resp, "users")).List()
+	users := make([]User, list.Len())
+	for i := range users {
+		users[i] = getUser(list.Get(i).Message())
+	}
+	return users, resp.Get(field(resp, "next_page_token")).String(), nil
+}
+
+// call calls method with the request fill sets and returns the user of the
+// response
+func (c client) call(ctx context.Context, method string, fill func(req protoreflect.Message)) (User, error) {
+	resp, err := c.invoke(ctx, method, fill)
+	if err != nil {
+		return User{}, err
+	}
+	return getUser(resp.Get(field(resp, "user")).Message()), nil
+}
+
+// invoke calls method with the request fill sets and returns the response
+func (c client) invoke(ctx context.Context, method string, fill func(req protoreflect.Message)) (protoreflect.Message, error) {
+	md := c.service.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, fmt.Errorf("%s has no method %s", c.service.FullName(), method)
+	}
+	req := dynamicpb.NewMessage(md.Input())
+	fill(req)
+	resp := dynamicpb.NewMessage(md.Output())
+	if err := c.conn.Invoke(ctx, fmt.Sprintf("/%s/%s", c.service.FullName(), method), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// userFields are the fields of User and the proto fields they are sent as
+var userFields = []struct {
+	name protoreflect.Name
+	get  func(u *User) *string
+}{
+	{"user_id", func(u *User) *string { return &u.ID }},
+	{"name", func(u *User) *string { return &u.Name }},
+	{"email", func(u *User) *string { return &u.Email }},
+	{"phone", func(u *User) *string { return &u.Phone }},
+}
+
+// setUser sets every field of u that m has and u does not leave empty
+func setUser(m protoreflect.Message, u User) {
+	for _, f := range userFields {
+		fd := m.Descriptor().Fields().ByName(f.name)
+		if v := *f.get(&u); fd != nil && v != "" {
+			m.Set(fd, protoreflect.ValueOfString(v))
+		}
+	}
+}
+
+// getUser returns the fields of m that User has
+func getUser(m protoreflect.Message) User {
+	var u User
+	for _, f := range userFields {
+		if fd := m.Descriptor().Fields().ByName(f.name); fd != nil {
+			*f.get(&u) = m.Get(fd).String()
+		}
+	}
+	return u
+}
+
+// field returns the field of m called name, which every version with m has
+func field(m protoreflect.Message, name protoreflect.Name) protoreflect.FieldDescriptor {
+	return m.Descriptor().Fields().ByName(name)
+}
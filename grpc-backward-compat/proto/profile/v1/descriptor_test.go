@@ -0,0 +1,27 @@
+package profilev1_test
+
+import (
+	"testing"
+
+	"grpc-backward-compat/descriptors"
+	profilev1 "grpc-backward-compat/proto/profile/v1"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// TestDescriptorSet checks that descriptors holds this version as generated
+func TestDescriptorSet(t *testing.T) {
+	files, err := descriptors.Load("profilev1")
+	if err != nil {
+		t.Fatalf("Failed to load the descriptor set: %v", err)
+	}
+	want := profilev1.File_proto_profile_v1_profile_proto
+	got, err := files.FindFileByPath(want.Path())
+	if err != nil {
+		t.Fatalf("Failed to find %s: %v", want.Path(), err)
+	}
+	if !proto.Equal(protodesc.ToFileDescriptorProto(got), protodesc.ToFileDescriptorProto(want)) {
+		t.Errorf("Expected descriptors/profilev1.binpb to match %s; rebuild it", want.Path())
+	}
+}
@@ -0,0 +1,421 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v6.33.0
+// source: proto/profile/v2/profile.proto
+
+package profilev2
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Profile struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	UserId     string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Avatar     []byte                 `protobuf:"bytes,2,opt,name=avatar,proto3" json:"avatar,omitempty"`                            // V1: string avatar = 2
+	LoginCount int64                  `protobuf:"varint,3,opt,name=login_count,json=loginCount,proto3" json:"login_count,omitempty"` // V1: int32 login_count = 3
+	// Types that are valid to be assigned to Contact:
+	//
+	//	*Profile_Email
+	//	*Profile_Phone
+	Contact       isProfile_Contact `protobuf_oneof:"contact"`
+	Tags          []string          `protobuf:"bytes,5,rep,name=tags,proto3" json:"tags,omitempty"`         // V1: string tags = 5
+	Nickname      string            `protobuf:"bytes,6,opt,name=nickname,proto3" json:"nickname,omitempty"` // V1: string display_name = 6
+	Referrer      string            `protobuf:"bytes,7,opt,name=referrer,proto3" json:"referrer,omitempty"` // V1: int64 karma = 7, removed and reserved by name only
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Profile) Reset() {
+	*x = Profile{}
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Profile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Profile) ProtoMessage() {}
+
+func (x *Profile) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Profile.ProtoReflect.Descriptor instead.
+func (*Profile) Descriptor() ([]byte, []int) {
+	return file_proto_profile_v2_profile_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Profile) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Profile) GetAvatar() []byte {
+	if x != nil {
+		return x.Avatar
+	}
+	return nil
+}
+
+func (x *Profile) GetLoginCount() int64 {
+	if x != nil {
+		return x.LoginCount
+	}
+	return 0
+}
+
+func (x *Profile) GetContact() isProfile_Contact {
+	if x != nil {
+		return x.Contact
+	}
+	return nil
+}
+
+func (x *Profile) GetEmail() string {
+	if x != nil {
+		if x, ok := x.Contact.(*Profile_Email); ok {
+			return x.Email
+		}
+	}
+	return ""
+}
+
+func (x *Profile) GetPhone() string {
+	if x != nil {
+		if x, ok := x.Contact.(*Profile_Phone); ok {
+			return x.Phone
+		}
+	}
+	return ""
+}
+
+func (x *Profile) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Profile) GetNickname() string {
+	if x != nil {
+		return x.Nickname
+	}
+	return ""
+}
+
+func (x *Profile) GetReferrer() string {
+	if x != nil {
+		return x.Referrer
+	}
+	return ""
+}
+
+type isProfile_Contact interface {
+	isProfile_Contact()
+}
+
+type Profile_Email struct {
+	Email string `protobuf:"bytes,4,opt,name=email,proto3,oneof"`
+}
+
+type Profile_Phone struct {
+	Phone string `protobuf:"bytes,8,opt,name=phone,proto3,oneof"`
+}
+
+func (*Profile_Email) isProfile_Contact() {}
+
+func (*Profile_Phone) isProfile_Contact() {}
+
+type GetProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetProfileRequest) Reset() {
+	*x = GetProfileRequest{}
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetProfileRequest) ProtoMessage() {}
+
+func (x *GetProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetProfileRequest.ProtoReflect.Descriptor instead.
+func (*GetProfileRequest) Descriptor() ([]byte, []int) {
+	return file_proto_profile_v2_profile_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetProfileRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type GetProfileResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       *Profile               `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetProfileResponse) Reset() {
+	*x = GetProfileResponse{}
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetProfileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetProfileResponse) ProtoMessage() {}
+
+func (x *GetProfileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetProfileResponse.ProtoReflect.Descriptor instead.
+func (*GetProfileResponse) Descriptor() ([]byte, []int) {
+	return file_proto_profile_v2_profile_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetProfileResponse) GetProfile() *Profile {
+	if x != nil {
+		return x.Profile
+	}
+	return nil
+}
+
+type PutProfileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       *Profile               `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutProfileRequest) Reset() {
+	*x = PutProfileRequest{}
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutProfileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutProfileRequest) ProtoMessage() {}
+
+func (x *PutProfileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutProfileRequest.ProtoReflect.Descriptor instead.
+func (*PutProfileRequest) Descriptor() ([]byte, []int) {
+	return file_proto_profile_v2_profile_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *PutProfileRequest) GetProfile() *Profile {
+	if x != nil {
+		return x.Profile
+	}
+	return nil
+}
+
+type PutProfileResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Profile       *Profile               `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutProfileResponse) Reset() {
+	*x = PutProfileResponse{}
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutProfileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutProfileResponse) ProtoMessage() {}
+
+func (x *PutProfileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_profile_v2_profile_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutProfileResponse.ProtoReflect.Descriptor instead.
+func (*PutProfileResponse) Descriptor() ([]byte, []int) {
+	return file_proto_profile_v2_profile_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PutProfileResponse) GetProfile() *Profile {
+	if x != nil {
+		return x.Profile
+	}
+	return nil
+}
+
+var File_proto_profile_v2_profile_proto protoreflect.FileDescriptor
+
+const file_proto_profile_v2_profile_proto_rawDesc = "" +
+	"\n" +
+	"\x1eproto/profile/v2/profile.proto\x12\aprofile\"\xe9\x01\n" +
+	"\aProfile\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x16\n" +
+	"\x06avatar\x18\x02 \x01(\fR\x06avatar\x12\x1f\n" +
+	"\vlogin_count\x18\x03 \x01(\x03R\n" +
+	"loginCount\x12\x16\n" +
+	"\x05email\x18\x04 \x01(\tH\x00R\x05email\x12\x16\n" +
+	"\x05phone\x18\b \x01(\tH\x00R\x05phone\x12\x12\n" +
+	"\x04tags\x18\x05 \x03(\tR\x04tags\x12\x1a\n" +
+	"\bnickname\x18\x06 \x01(\tR\bnickname\x12\x1a\n" +
+	"\breferrer\x18\a \x01(\tR\breferrerB\t\n" +
+	"\acontactR\x05karma\",\n" +
+	"\x11GetProfileRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\"@\n" +
+	"\x12GetProfileResponse\x12*\n" +
+	"\aprofile\x18\x01 \x01(\v2\x10.profile.ProfileR\aprofile\"?\n" +
+	"\x11PutProfileRequest\x12*\n" +
+	"\aprofile\x18\x01 \x01(\v2\x10.profile.ProfileR\aprofile\"@\n" +
+	"\x12PutProfileResponse\x12*\n" +
+	"\aprofile\x18\x01 \x01(\v2\x10.profile.ProfileR\aprofile2\x9e\x01\n" +
+	"\x0eProfileService\x12E\n" +
+	"\n" +
+	"GetProfile\x12\x1a.profile.GetProfileRequest\x1a\x1b.profile.GetProfileResponse\x12E\n" +
+	"\n" +
+	"PutProfile\x12\x1a.profile.PutProfileRequest\x1a\x1b.profile.PutProfileResponseB1Z/grpc-backward-compat/proto/profile/v2;profilev2b\x06proto3"
+
+var (
+	file_proto_profile_v2_profile_proto_rawDescOnce sync.Once
+	file_proto_profile_v2_profile_proto_rawDescData []byte
+)
+
+func file_proto_profile_v2_profile_proto_rawDescGZIP() []byte {
+	file_proto_profile_v2_profile_proto_rawDescOnce.Do(func() {
+		file_proto_profile_v2_profile_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_profile_v2_profile_proto_rawDesc), len(file_proto_profile_v2_profile_proto_rawDesc)))
+	})
+	return file_proto_profile_v2_profile_proto_rawDescData
+}
+
+var file_proto_profile_v2_profile_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proto_profile_v2_profile_proto_goTypes = []any{
+	(*Profile)(nil),            // 0: profile.Profile
+	(*GetProfileRequest)(nil),  // 1: profile.GetProfileRequest
+	(*GetProfileResponse)(nil), // 2: profile.GetProfileResponse
+	(*PutProfileRequest)(nil),  // 3: profile.PutProfileRequest
+	(*PutProfileResponse)(nil), // 4: profile.PutProfileResponse
+}
+var file_proto_profile_v2_profile_proto_depIdxs = []int32{
+	0, // 0: profile.GetProfileResponse.profile:type_name -> profile.Profile
+	0, // 1: profile.PutProfileRequest.profile:type_name -> profile.Profile
+	0, // 2: profile.PutProfileResponse.profile:type_name -> profile.Profile
+	1, // 3: profile.ProfileService.GetProfile:input_type -> profile.GetProfileRequest
+	3, // 4: profile.ProfileService.PutProfile:input_type -> profile.PutProfileRequest
+	2, // 5: profile.ProfileService.GetProfile:output_type -> profile.GetProfileResponse
+	4, // 6: profile.ProfileService.PutProfile:output_type -> profile.PutProfileResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_proto_profile_v2_profile_proto_init() }
+func file_proto_profile_v2_profile_proto_init() {
+	if File_proto_profile_v2_profile_proto != nil {
+		return
+	}
+	file_proto_profile_v2_profile_proto_msgTypes[0].OneofWrappers = []any{
+		(*Profile_Email)(nil),
+		(*Profile_Phone)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_profile_v2_profile_proto_rawDesc), len(file_proto_profile_v2_profile_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_profile_v2_profile_proto_goTypes,
+		DependencyIndexes: file_proto_profile_v2_profile_proto_depIdxs,
+		MessageInfos:      file_proto_profile_v2_profile_proto_msgTypes,
+	}.Build()
+	File_proto_profile_v2_profile_proto = out.File
+	file_proto_profile_v2_profile_proto_goTypes = nil
+	file_proto_profile_v2_profile_proto_depIdxs = nil
+}
@@ -0,0 +1,27 @@
+package userv1_test
+
+import (
+	"testing"
+
+	"grpc-backward-compat/descriptors"
+	userv1 "grpc-backward-compat/proto/v1"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// TestDescriptorSet checks that descriptors holds this version as generated
+func TestDescriptorSet(t *testing.T) {
+	files, err := descriptors.Load("userv1")
+	if err != nil {
+		t.Fatalf("Failed to load the descriptor set: %v", err)
+	}
+	want := userv1.File_proto_v1_user_proto
+	got, err := files.FindFileByPath(want.Path())
+	if err != nil {
+		t.Fatalf("Failed to find %s: %v", want.Path(), err)
+	}
+	if !proto.Equal(protodesc.ToFileDescriptorProto(got), protodesc.ToFileDescriptorProto(want)) {
+		t.Errorf("Expected descriptors/userv1.binpb to match %s; rebuild it", want.Path())
+	}
+}
@@ -0,0 +1,27 @@
+package userv2_test
+
+import (
+	"testing"
+
+	"grpc-backward-compat/descriptors"
+	userv2 "grpc-backward-compat/proto/v2"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+)
+
+// TestDescriptorSet checks that descriptors holds this version as generated
+func TestDescriptorSet(t *testing.T) {
+	files, err := descriptors.Load("userv2")
+	if err != nil {
+		t.Fatalf("Failed to load the descriptor set: %v", err)
+	}
+	want := userv2.File_proto_v2_user_proto
+	got, err := files.FindFileByPath(want.Path())
+	if err != nil {
+		t.Fatalf("Failed to find %s: %v", want.Path(), err)
+	}
+	if !proto.Equal(protodesc.ToFileDescriptorProto(got), protodesc.ToFileDescriptorProto(want)) {
+		t.Errorf("Expected descriptors/userv2.binpb to match %s; rebuild it", want.Path())
+	}
+}
@@ -0,0 +1,442 @@
+// Package protocompat compares two versions of a set of proto files and
+// reports what changed for a peer still using the old version: over the
+// binary wire format, over protojson, or neither. Elements are matched by
+// full name, and fields and enum values by number, since that is what the
+// encodings match them by.
+package protocompat
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Change is one difference between the old and the new version
+type Change struct {
+	// Element is the full name of what changed, e.g. user.User.phone
+	Element     string
+	Description string
+	// BreaksWire is set if peers exchanging binary protobuf can fail to
+	// parse, misread or lose data, or calls can fail, because of the change
+	BreaksWire bool
+	// BreaksJSON is the same for peers exchanging protojson
+	BreaksJSON bool
+	// StrictJSON is set if the change only breaks old JSON peers that refuse
+	// field and enum value names they do not know, as protojson and jsoncodec
+	// do by default. Peers that discard them, like grpc-gateway and buf's
+	// checks assume, are unaffected, so it is a warning rather than a break.
+	StrictJSON bool
+}
+
+// Breaking reports whether the change breaks either encoding
+func (c Change) Breaking() bool {
+	return c.BreaksWire || c.BreaksJSON
+}
+
+func (c Change) String() string {
+	verdict := "compatible"
+	switch {
+	case c.BreaksWire && c.BreaksJSON:
+		verdict = "breaks wire+JSON"
+	case c.BreaksWire:
+		verdict = "breaks wire"
+	case c.BreaksJSON:
+		verdict = "breaks JSON"
+	case c.StrictJSON:
+		verdict = "warning"
+	}
+	return fmt.Sprintf("%-16s %s: %s", verdict, c.Element, c.Description)
+}
+
+// Compare returns the changes from the old files to the new ones, in the
+// order the elements are declared
+func Compare(old, new []protoreflect.FileDescriptor) []Change {
+	c := &comparison{}
+	oldIndex, newIndex := index(old), index(new)
+
+	for _, m := range oldIndex.messages {
+		if nm, ok := newIndex.byName[m.FullName()].(protoreflect.MessageDescriptor); ok {
+			c.message(m, nm)
+		}
+	}
+	for _, m := range newIndex.messages {
+		if _, ok := oldIndex.byName[m.FullName()].(protoreflect.MessageDescriptor); !ok {
+			c.add(m, "message added", false, false)
+		}
+	}
+	// Fields and methods that use a removed type are reported with them
+	for _, m := range oldIndex.messages {
+		if _, ok := newIndex.byName[m.FullName()].(protoreflect.MessageDescriptor); !ok {
+			c.add(m, "message removed", false, false)
+		}
+	}
+	for _, e := range oldIndex.enums {
+		if ne, ok := newIndex.byName[e.FullName()].(protoreflect.EnumDescriptor); ok {
+			c.enum(e, ne)
+		}
+	}
+	for _, e := range newIndex.enums {
+		if _, ok := oldIndex.byName[e.FullName()].(protoreflect.EnumDescriptor); !ok {
+			c.add(e, "enum added", false, false)
+		}
+	}
+	for _, e := range oldIndex.enums {
+		if _, ok := newIndex.byName[e.FullName()].(protoreflect.EnumDescriptor); !ok {
+			c.add(e, "enum removed", false, false)
+		}
+	}
+	c.services(oldIndex.services, newIndex.services)
+	return c.changes
+}
+
+type comparison struct {
+	changes []Change
+}
+
+func (c *comparison) add(d protoreflect.Descriptor, description string, wire, json bool) {
+	c.changes = append(c.changes, Change{
+		Element:     string(d.FullName()),
+		Description: description,
+		BreaksWire:  wire,
+		BreaksJSON:  json,
+	})
+}
+
+// warn adds a change that only breaks strict JSON peers
+func (c *comparison) warn(d protoreflect.Descriptor, description string) {
+	c.changes = append(c.changes, Change{
+		Element:     string(d.FullName()),
+		Description: description,
+		StrictJSON:  true,
+	})
+}
+
+// descriptors holds every message, enum and service of some files, nested
+// ones included
+type descriptors struct {
+	messages []protoreflect.MessageDescriptor
+	enums    []protoreflect.EnumDescriptor
+	services []protoreflect.ServiceDescriptor
+	byName   map[protoreflect.FullName]protoreflect.Descriptor
+}
+
+func index(files []protoreflect.FileDescriptor) *descriptors {
+	d := &descriptors{byName: make(map[protoreflect.FullName]protoreflect.Descriptor)}
+	var addMessages func(protoreflect.MessageDescriptors)
+	addEnums := func(enums protoreflect.EnumDescriptors) {
+		for i := range enums.Len() {
+			d.enums = append(d.enums, enums.Get(i))
+			d.byName[enums.Get(i).FullName()] = enums.Get(i)
+		}
+	}
+	addMessages = func(messages protoreflect.MessageDescriptors) {
+		for i := range messages.Len() {
+			m := messages.Get(i)
+			if m.IsMapEntry() {
+				continue
+			}
+			d.messages = append(d.messages, m)
+			d.byName[m.FullName()] = m
+			addEnums(m.Enums())
+			addMessages(m.Messages())
+		}
+	}
+	for _, f := range files {
+		addMessages(f.Messages())
+		addEnums(f.Enums())
+		for i := range f.Services().Len() {
+			d.services = append(d.services, f.Services().Get(i))
+			d.byName[f.Services().Get(i).FullName()] = f.Services().Get(i)
+		}
+	}
+	return d
+}
+
+func (c *comparison) message(old, new protoreflect.MessageDescriptor) {
+	for i := range old.Fields().Len() {
+		f := old.Fields().Get(i)
+		nf := new.Fields().ByNumber(f.Number())
+		if nf == nil {
+			c.missingField(f, new)
+			continue
+		}
+		c.field(f, nf)
+	}
+	for i := range new.Fields().Len() {
+		nf := new.Fields().Get(i)
+		if old.Fields().ByNumber(nf.Number()) != nil || old.Fields().ByName(nf.Name()) != nil {
+			continue // compared above
+		}
+		// protojson refuses a field it does not know unless it discards
+		// unknown fields, which jsoncodec does not, but skips reserved names.
+		// Adding one is safe for the peers that discard them.
+		switch {
+		case old.ReservedRanges().Has(nf.Number()):
+			c.add(nf, fmt.Sprintf("added as field %d, a number reserved in the old version: old peers may still send the removed field's values under it, and old JSON peers refuse it", nf.Number()), true, true)
+		case old.ReservedNames().Has(nf.Name()):
+			c.add(nf, "added with a name reserved in the old version: old JSON peers may still send the removed field under it", false, true)
+		default:
+			c.warn(nf, fmt.Sprintf("added as field %d (%s): old JSON peers that refuse unknown fields, like jsoncodec, reject it", nf.Number(), typeName(nf)))
+		}
+	}
+	c.oneofs(old, new)
+}
+
+// missingField reports old field f, whose number new does not use
+func (c *comparison) missingField(f protoreflect.FieldDescriptor, new protoreflect.MessageDescriptor) {
+	if moved := new.Fields().ByName(f.Name()); moved != nil {
+		c.add(f, fmt.Sprintf("renumbered from %d to %d: peers on either version drop the other's values", f.Number(), moved.Number()),
+			true, moved.JSONName() != f.JSONName())
+		if t := typeChange(f, moved); t != nil {
+			c.add(f, t.description, false, t.breaksJSON)
+		}
+		return
+	}
+	numberReserved := new.ReservedRanges().Has(f.Number())
+	nameReserved := new.ReservedNames().Has(f.Name())
+	var missing []string
+	if !numberReserved {
+		missing = append(missing, fmt.Sprintf("reserved %d", f.Number()))
+	}
+	if !nameReserved {
+		missing = append(missing, fmt.Sprintf("reserved %q", f.Name()))
+	}
+	if len(missing) == 0 {
+		c.add(f, fmt.Sprintf("removed; field %d and its name are reserved", f.Number()), false, false)
+		return
+	}
+	// A number that is not reserved can be reused for something else, and
+	// protojson only skips the names of removed fields if they are reserved
+	c.add(f, fmt.Sprintf("field %d removed without %s", f.Number(), strings.Join(missing, " and ")), !numberReserved, !nameReserved)
+}
+
+// field reports how f changed into nf, which has the same number
+func (c *comparison) field(f, nf protoreflect.FieldDescriptor) {
+	t := typeChange(f, nf)
+	if f.Name() != nf.Name() {
+		if t != nil && t.breaksWire {
+			c.add(f, fmt.Sprintf("field %d reused for %s %s, was %s %s", f.Number(), typeName(nf), nf.Name(), typeName(f), f.Name()), true, true)
+			return
+		}
+		c.add(f, fmt.Sprintf("renamed to %s: the binary encoding only uses field %d", nf.Name(), f.Number()), false, f.JSONName() != nf.JSONName())
+	} else if f.JSONName() != nf.JSONName() {
+		c.add(f, fmt.Sprintf("JSON name changed from %s to %s", f.JSONName(), nf.JSONName()), false, true)
+	}
+	if t != nil {
+		c.add(f, t.description, t.breaksWire, t.breaksJSON)
+	}
+
+	switch {
+	case f.IsMap() != nf.IsMap():
+		c.add(f, fmt.Sprintf("changed from %s to %s", typeName(f), typeName(nf)), true, true)
+	case f.IsList() != nf.IsList():
+		// A length-delimited value is read the same alone or repeated, but
+		// the singular peer keeps only the last of several, and repeated
+		// scalars are packed, which a singular field cannot read at all
+		from, to := "singular", "repeated"
+		if f.IsList() {
+			from, to = to, from
+		}
+		problem := "the singular peer keeps only the last of several values"
+		if !lengthDelimited(f.Kind()) || !lengthDelimited(nf.Kind()) {
+			problem = "the singular peer cannot read packed values"
+		}
+		c.add(f, fmt.Sprintf("changed from %s to %s: %s, and JSON has an array for one and a value for the other", from, to, problem), true, true)
+	case !f.IsList() && f.HasPresence() != nf.HasPresence() && f.Message() == nil && nf.Message() == nil &&
+		!inOneof(f) && !inOneof(nf):
+		if nf.HasPresence() {
+			c.add(f, "now tracks presence (optional): unset and zero can be told apart", false, false)
+		} else {
+			c.add(f, "no longer tracks presence: unset and zero read the same", false, false)
+		}
+	}
+}
+
+// oneofs reports fields that moved into or out of a oneof
+func (c *comparison) oneofs(old, new protoreflect.MessageDescriptor) {
+	for i := range new.Oneofs().Len() {
+		o := new.Oneofs().Get(i)
+		if o.IsSynthetic() {
+			continue
+		}
+		// Fields old peers already had that are now members of o, and those
+		// of them that were not members of o before
+		var existing, moved []string
+		for j := range o.Fields().Len() {
+			nf := o.Fields().Get(j)
+			f := old.Fields().ByNumber(nf.Number())
+			if f == nil {
+				continue
+			}
+			existing = append(existing, string(nf.Name()))
+			if !inOneof(f) || f.ContainingOneof().Name() != o.Name() {
+				moved = append(moved, string(nf.Name()))
+			}
+		}
+		switch {
+		case len(moved) == 0:
+		case len(existing) == 1:
+			c.add(o, fmt.Sprintf("%s moved into the oneof; no other existing field is in it", moved[0]), false, false)
+		default:
+			// Old peers may set several, of which new ones keep one; JSON
+			// with more than one member of a oneof does not parse
+			c.add(o, fmt.Sprintf("existing fields %s are now in one oneof: setting one clears the others", strings.Join(existing, ", ")), true, true)
+		}
+	}
+	for i := range old.Fields().Len() {
+		f := old.Fields().Get(i)
+		nf := new.Fields().ByNumber(f.Number())
+		if nf != nil && inOneof(f) && !inOneof(nf) {
+			c.add(f, fmt.Sprintf("moved out of oneof %s: new peers can set it with fields old peers treat as alternatives", f.ContainingOneof().Name()), true, true)
+		}
+	}
+}
+
+func (c *comparison) enum(old, new protoreflect.EnumDescriptor) {
+	for i := range old.Values().Len() {
+		v := old.Values().Get(i)
+		nv := new.Values().ByNumber(v.Number())
+		if nv == nil {
+			if moved := new.Values().ByName(v.Name()); moved != nil {
+				c.add(v, fmt.Sprintf("renumbered from %d to %d", v.Number(), moved.Number()), true, false)
+				continue
+			}
+			numberReserved := new.ReservedRanges().Has(v.Number())
+			nameReserved := new.ReservedNames().Has(v.Name())
+			if numberReserved && nameReserved {
+				c.add(v, fmt.Sprintf("removed; value %d and its name are reserved", v.Number()), false, false)
+			} else {
+				c.add(v, fmt.Sprintf("value %d removed without reserving it", v.Number()), !numberReserved, !nameReserved)
+			}
+			continue
+		}
+		if nv.Name() != v.Name() {
+			c.add(v, fmt.Sprintf("renamed to %s: JSON sends enum values by name", nv.Name()), false, true)
+		}
+	}
+	for i := range new.Values().Len() {
+		nv := new.Values().Get(i)
+		if old.Values().ByNumber(nv.Number()) != nil || old.Values().ByName(nv.Name()) != nil {
+			continue
+		}
+		// Old binary peers keep a number they do not know, but protojson
+		// refuses a name it does not know like an unknown field
+		if old.ReservedRanges().Has(nv.Number()) {
+			c.add(nv, fmt.Sprintf("added as %d, a number reserved in the old version, and old JSON peers refuse its name", nv.Number()), true, true)
+		} else {
+			c.warn(nv, fmt.Sprintf("added as %d: old JSON peers that refuse unknown names, like jsoncodec, reject it", nv.Number()))
+		}
+	}
+}
+
+func (c *comparison) services(old, new []protoreflect.ServiceDescriptor) {
+	newByName := make(map[protoreflect.FullName]protoreflect.ServiceDescriptor)
+	for _, s := range new {
+		newByName[s.FullName()] = s
+	}
+	oldByName := make(map[protoreflect.FullName]bool)
+	for _, s := range old {
+		oldByName[s.FullName()] = true
+	}
+	renamedTo := make(map[protoreflect.FullName]bool)
+	for _, s := range old {
+		if ns, ok := newByName[s.FullName()]; ok {
+			c.methods(s, ns)
+			continue
+		}
+		// gRPC calls a method by /package.Service/Method, so renaming the
+		// service or its package moves every method
+		renamed := slices.IndexFunc(new, func(ns protoreflect.ServiceDescriptor) bool {
+			return !oldByName[ns.FullName()] && !renamedTo[ns.FullName()] && sameMethods(s, ns)
+		})
+		if renamed >= 0 {
+			renamedTo[new[renamed].FullName()] = true
+			c.add(s, fmt.Sprintf("renamed to %s: old clients call methods under the old name", new[renamed].FullName()), true, true)
+		} else {
+			c.add(s, "service removed", true, true)
+		}
+	}
+	for _, ns := range new {
+		if !oldByName[ns.FullName()] && !renamedTo[ns.FullName()] {
+			c.add(ns, "service added", false, false)
+		}
+	}
+}
+
+func (c *comparison) methods(old, new protoreflect.ServiceDescriptor) {
+	renamedTo := make(map[protoreflect.Name]bool)
+	for i := range old.Methods().Len() {
+		m := old.Methods().Get(i)
+		nm := new.Methods().ByName(m.Name())
+		if nm == nil {
+			c.missingMethod(m, old, new, renamedTo)
+			continue
+		}
+		if m.Input().FullName() != nm.Input().FullName() {
+			c.add(m, fmt.Sprintf("request type changed from %s to %s", m.Input().FullName(), nm.Input().FullName()), true, true)
+		}
+		if m.Output().FullName() != nm.Output().FullName() {
+			c.add(m, fmt.Sprintf("response type changed from %s to %s", m.Output().FullName(), nm.Output().FullName()), true, true)
+		}
+		if m.IsStreamingClient() != nm.IsStreamingClient() || m.IsStreamingServer() != nm.IsStreamingServer() {
+			c.add(m, fmt.Sprintf("streaming changed from %s to %s", streaming(m), streaming(nm)), true, true)
+		}
+	}
+	for i := range new.Methods().Len() {
+		nm := new.Methods().Get(i)
+		if old.Methods().ByName(nm.Name()) == nil && !renamedTo[nm.Name()] {
+			c.add(nm, "RPC added", false, false)
+		}
+	}
+}
+
+// missingMethod reports old method m, which new does not have; a method new
+// adds with the same signature is taken to be m renamed
+func (c *comparison) missingMethod(m protoreflect.MethodDescriptor, old, new protoreflect.ServiceDescriptor, renamedTo map[protoreflect.Name]bool) {
+	for i := range new.Methods().Len() {
+		candidate := new.Methods().Get(i)
+		if old.Methods().ByName(candidate.Name()) == nil && !renamedTo[candidate.Name()] && sameSignature(m, candidate) {
+			renamedTo[candidate.Name()] = true
+			c.add(m, fmt.Sprintf("RPC renamed to %s: old clients get Unimplemented", candidate.Name()), true, true)
+			return
+		}
+	}
+	c.add(m, "RPC removed: old clients get Unimplemented", true, true)
+}
+
+// inOneof reports whether f is in a oneof other than the one proto3
+// optional puts it in
+func inOneof(f protoreflect.FieldDescriptor) bool {
+	return f.ContainingOneof() != nil && !f.ContainingOneof().IsSynthetic()
+}
+
+func sameSignature(a, b protoreflect.MethodDescriptor) bool {
+	return a.Input().FullName() == b.Input().FullName() && a.Output().FullName() == b.Output().FullName() &&
+		a.IsStreamingClient() == b.IsStreamingClient() && a.IsStreamingServer() == b.IsStreamingServer()
+}
+
+func sameMethods(a, b protoreflect.ServiceDescriptor) bool {
+	if a.Methods().Len() != b.Methods().Len() {
+		return false
+	}
+	for i := range a.Methods().Len() {
+		if b.Methods().ByName(a.Methods().Get(i).Name()) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func streaming(m protoreflect.MethodDescriptor) string {
+	switch {
+	case m.IsStreamingClient() && m.IsStreamingServer():
+		return "bidirectional streaming"
+	case m.IsStreamingClient():
+		return "client streaming"
+	case m.IsStreamingServer():
+		return "server streaming"
+	}
+	return "unary"
+}
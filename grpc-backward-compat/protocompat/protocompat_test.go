@@ -0,0 +1,274 @@
+package protocompat
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+// userFile is the version every test case changes
+func userFile() *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("user.proto"),
+		Package: proto.String("user"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("user_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("email", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("age", 4, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			},
+			ReservedRange: []*descriptorpb.DescriptorProto_ReservedRange{{Start: proto.Int32(9), End: proto.Int32(10)}},
+			ReservedName:  []string{"fax"},
+			NestedType:    []*descriptorpb.DescriptorProto{{Name: proto.String("Address")}},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name:  proto.String("Role"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("ROLE_MEMBER"), Number: proto.Int32(0)}},
+			}},
+		}},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATUS_UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("STATUS_ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("UserService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetUser"), InputType: proto.String(".user.User"), OutputType: proto.String(".user.User")},
+				{Name: proto.String("WatchUser"), InputType: proto.String(".user.User"), OutputType: proto.String(".user.User"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+}
+
+func newFile(t *testing.T, f *descriptorpb.FileDescriptorProto) []protoreflect.FileDescriptor {
+	t.Helper()
+	fd, err := protodesc.NewFile(f, nil)
+	if err != nil {
+		t.Fatalf("Invalid file: %v", err)
+	}
+	return []protoreflect.FileDescriptor{fd}
+}
+
+// verdict is a Change without its description
+type verdict struct {
+	element    string
+	wire, json bool
+}
+
+func TestIntegerHolds(t *testing.T) {
+	for _, tc := range []struct {
+		from, to protoreflect.Kind
+		want     bool
+	}{
+		{protoreflect.Int32Kind, protoreflect.Int64Kind, true},
+		{protoreflect.Int64Kind, protoreflect.Int32Kind, false},
+		{protoreflect.Uint32Kind, protoreflect.Int64Kind, true},
+		{protoreflect.Uint32Kind, protoreflect.Int32Kind, false},
+		{protoreflect.Uint32Kind, protoreflect.Uint64Kind, true},
+		{protoreflect.Int32Kind, protoreflect.Uint64Kind, false},
+		{protoreflect.Uint64Kind, protoreflect.Int64Kind, false},
+	} {
+		if got := varint[tc.from].holds(varint[tc.to]); got != tc.want {
+			t.Errorf("Expected %s to hold every %s value: %t, got %t", tc.to, tc.from, tc.want, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto)
+		want   []verdict
+	}{
+		{"unchanged", func(*descriptorpb.FileDescriptorProto, *descriptorpb.DescriptorProto) {}, nil},
+		{"field added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field = append(user.Field, field("phone", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+		}, []verdict{{"user.User.phone", false, false}}},
+		{"field renamed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[1].Name = proto.String("full_name")
+		}, []verdict{{"user.User.name", false, true}}},
+		{"field renamed keeping its JSON name", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[1].Name = proto.String("full_name")
+			user.Field[1].JsonName = proto.String("name")
+		}, []verdict{{"user.User.name", false, false}}},
+		{"field renumbered", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[2].Number = proto.Int32(7)
+		}, []verdict{{"user.User.email", true, false}}},
+		{"field removed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field = user.Field[:3]
+		}, []verdict{{"user.User.age", true, true}}},
+		{"field removed and reserved", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field = user.Field[:3]
+			user.ReservedRange = append(user.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(4), End: proto.Int32(5)})
+			user.ReservedName = append(user.ReservedName, "age")
+		}, []verdict{{"user.User.age", false, false}}},
+		{"reserved number reused", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.ReservedRange = nil
+			user.Field = append(user.Field, field("phone", 9, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+		}, []verdict{{"user.User.phone", true, true}}},
+		{"reserved name reused", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.ReservedName = nil
+			user.Field = append(user.Field, field("fax", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+		}, []verdict{{"user.User.fax", false, true}}},
+		{"number reused for another type", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[2] = field("verified", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL)
+		}, []verdict{{"user.User.email", true, true}}},
+		{"string to bytes", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[1].Type = descriptorpb.FieldDescriptorProto_TYPE_BYTES.Enum()
+		}, []verdict{{"user.User.name", true, true}}},
+		{"int32 to int64", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[3].Type = descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum()
+		}, []verdict{{"user.User.age", true, true}}},
+		{"sint32 to sint64", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[3].Type = descriptorpb.FieldDescriptorProto_TYPE_SINT64.Enum()
+		}, []verdict{{"user.User.age", true, true}}},
+		{"int32 to uint32", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[3].Type = descriptorpb.FieldDescriptorProto_TYPE_UINT32.Enum()
+		}, []verdict{{"user.User.age", true, true}}},
+		{"int32 to sint32", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[3].Type = descriptorpb.FieldDescriptorProto_TYPE_SINT32.Enum()
+		}, []verdict{{"user.User.age", true, true}}},
+		{"int32 to enum", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[3].Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+			user.Field[3].TypeName = proto.String(".user.Status")
+		}, []verdict{{"user.User.age", false, true}}},
+		{"string made repeated", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[1].Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}, []verdict{{"user.User.name", true, true}}},
+		{"int32 made repeated", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field[3].Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}, []verdict{{"user.User.age", true, true}}},
+		{"proto3 optional", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.OneofDecl = []*descriptorpb.OneofDescriptorProto{{Name: proto.String("_age")}}
+			user.Field[3].OneofIndex = proto.Int32(0)
+			user.Field[3].Proto3Optional = proto.Bool(true)
+		}, []verdict{{"user.User.age", false, false}}},
+		{"one field into a oneof", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.OneofDecl = []*descriptorpb.OneofDescriptorProto{{Name: proto.String("contact")}}
+			phone := field("phone", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING)
+			phone.OneofIndex = proto.Int32(0)
+			user.Field[2].OneofIndex = proto.Int32(0)
+			user.Field = slices.Insert(user.Field, 3, phone)
+		}, []verdict{{"user.User.phone", false, false}, {"user.User.contact", false, false}}},
+		{"two fields into a oneof", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.OneofDecl = []*descriptorpb.OneofDescriptorProto{{Name: proto.String("contact")}}
+			user.Field[1].OneofIndex = proto.Int32(0)
+			user.Field[2].OneofIndex = proto.Int32(0)
+		}, []verdict{{"user.User.contact", true, true}}},
+		{"enum value renamed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.EnumType[0].Value[1].Name = proto.String("STATUS_ENABLED")
+		}, []verdict{{"user.STATUS_ACTIVE", false, true}}},
+		{"enum value removed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.EnumType[0].Value = f.EnumType[0].Value[:1]
+		}, []verdict{{"user.STATUS_ACTIVE", true, true}}},
+		{"enum value added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.EnumType[0].Value = append(f.EnumType[0].Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String("STATUS_BANNED"), Number: proto.Int32(2)})
+		}, []verdict{{"user.STATUS_BANNED", false, false}}},
+		{"message added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.MessageType = append(f.MessageType, &descriptorpb.DescriptorProto{Name: proto.String("Team")})
+		}, []verdict{{"user.Team", false, false}}},
+		{"message removed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.NestedType = nil
+		}, []verdict{{"user.User.Address", false, false}}},
+		{"enum removed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.EnumType = nil
+		}, []verdict{{"user.Status", false, false}}},
+		{"nested enum added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.EnumType = append(user.EnumType, &descriptorpb.EnumDescriptorProto{
+				Name:  proto.String("Order"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("ORDER_ID"), Number: proto.Int32(0)}},
+			})
+		}, []verdict{{"user.User.Order", false, false}}},
+		{"nested enum removed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.EnumType = nil
+		}, []verdict{{"user.User.Role", false, false}}},
+		{"RPC renamed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.Service[0].Method[0].Name = proto.String("FetchUser")
+		}, []verdict{{"user.UserService.GetUser", true, true}}},
+		{"RPC removed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.Service[0].Method = f.Service[0].Method[1:]
+		}, []verdict{{"user.UserService.GetUser", true, true}}},
+		{"RPC added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.Service[0].Method = append(f.Service[0].Method, &descriptorpb.MethodDescriptorProto{
+				Name: proto.String("DeleteUser"), InputType: proto.String(".user.User"), OutputType: proto.String(".user.User"),
+			})
+		}, []verdict{{"user.UserService.DeleteUser", false, false}}},
+		{"streaming changed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.Service[0].Method[1].ServerStreaming = nil
+			f.Service[0].Method[1].ClientStreaming = proto.Bool(true)
+		}, []verdict{{"user.UserService.WatchUser", true, true}}},
+		{"service renamed", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.Service[0].Name = proto.String("Users")
+		}, []verdict{{"user.UserService", true, true}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			changed := userFile()
+			tc.change(changed, changed.MessageType[0])
+
+			var got []verdict
+			changes := Compare(newFile(t, userFile()), newFile(t, changed))
+			for _, c := range changes {
+				got = append(got, verdict{c.Element, c.BreaksWire, c.BreaksJSON})
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, changes)
+			}
+		})
+	}
+}
+
+// TestStrictJSON checks that additions only warn, while a reused reserved
+// number still breaks both encodings
+func TestStrictJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto)
+		want   string
+	}{
+		{"field added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.Field = append(user.Field, field("phone", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+		}, "warning"},
+		{"enum value added", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			f.EnumType[0].Value = append(f.EnumType[0].Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String("STATUS_BANNED"), Number: proto.Int32(2)})
+		}, "warning"},
+		{"reserved number reused", func(f *descriptorpb.FileDescriptorProto, user *descriptorpb.DescriptorProto) {
+			user.ReservedRange = nil
+			user.Field = append(user.Field, field("phone", 9, descriptorpb.FieldDescriptorProto_TYPE_STRING))
+		}, "breaks wire+JSON"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			changed := userFile()
+			tc.change(changed, changed.MessageType[0])
+
+			changes := Compare(newFile(t, userFile()), newFile(t, changed))
+			if len(changes) != 1 {
+				t.Fatalf("Expected 1 change, got %v", changes)
+			}
+			if got := changes[0].String(); !strings.HasPrefix(got, tc.want+" ") {
+				t.Errorf("Expected %q, got %q", tc.want, got)
+			}
+			if changes[0].StrictJSON != (tc.want == "warning") {
+				t.Errorf("Expected StrictJSON %t, got %v", tc.want == "warning", changes[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package protocompat
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// typeChangeResult describes a change of a field's type
+type typeChangeResult struct {
+	description string
+	breaksWire  bool
+	breaksJSON  bool
+}
+
+// integer is the range of values an integer kind can hold
+type integer struct {
+	bits   int
+	signed bool
+}
+
+// holds reports whether every value of a fits in b
+func (a integer) holds(b integer) bool {
+	if a.signed != b.signed {
+		return !a.signed && b.bits > a.bits
+	}
+	return b.bits >= a.bits
+}
+
+// varint describes the integer kinds encoded as plain varints
+var varint = map[protoreflect.Kind]integer{
+	protoreflect.Int32Kind:  {32, true},
+	protoreflect.Int64Kind:  {64, true},
+	protoreflect.Uint32Kind: {32, false},
+	protoreflect.Uint64Kind: {64, false},
+}
+
+// zigzag describes the integer kinds encoded as zigzag varints
+var zigzag = map[protoreflect.Kind]integer{
+	protoreflect.Sint32Kind: {32, true},
+	protoreflect.Sint64Kind: {64, true},
+}
+
+// typeChange returns how f's type changed into nf's, or nil if it did not.
+// The rules follow the proto language guide: kinds that share an encoding
+// parse, but values can be truncated, reinterpreted or rejected. Peers of
+// both versions write, so a value either type can hold and the other cannot
+// is a problem in one direction or the other.
+func typeChange(f, nf protoreflect.FieldDescriptor) *typeChangeResult {
+	from, to := f.Kind(), nf.Kind()
+	if from == to {
+		switch {
+		case f.Message() != nil && f.Message().FullName() != nf.Message().FullName():
+			return &typeChangeResult{fmt.Sprintf("message type changed from %s to %s", f.Message().FullName(), nf.Message().FullName()), true, true}
+		case f.Enum() != nil && f.Enum().FullName() != nf.Enum().FullName():
+			// Both are varints, but JSON sends values by name
+			return &typeChangeResult{fmt.Sprintf("enum type changed from %s to %s", f.Enum().FullName(), nf.Enum().FullName()), false, true}
+		}
+		return nil
+	}
+	change := &typeChangeResult{description: fmt.Sprintf("type changed from %s to %s", typeName(f), typeName(nf))}
+	switch {
+	case isVarint(from) && isVarint(to):
+		// protojson refuses a number its field cannot hold
+		change.description += ": " + rangeChange(from, to, varint[from], varint[to])
+		change.breaksWire, change.breaksJSON = true, true
+	case isVarint(from) && to == protoreflect.EnumKind, from == protoreflect.EnumKind && isVarint(to):
+		change.description += ": same varint, but JSON sends enum values by name"
+		change.breaksJSON = true
+	case from == protoreflect.BoolKind && isVarint(to), isVarint(from) && to == protoreflect.BoolKind:
+		// The integer side can send values the bool side reads back as true
+		change.description += ": same varint, but the bool peer reads any value but 0 and 1 as true, and JSON has true/false for one and numbers for the other"
+		change.breaksWire, change.breaksJSON = true, true
+	case isZigzag(from) && isZigzag(to):
+		change.description += ": " + rangeChange(from, to, zigzag[from], zigzag[to])
+		change.breaksWire, change.breaksJSON = true, true
+	case pair(from, to, protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind), pair(from, to, protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind):
+		change.description += ": same size, but values with the top bit set change sign"
+		change.breaksWire, change.breaksJSON = true, true
+	case pair(from, to, protoreflect.StringKind, protoreflect.BytesKind):
+		// Go and most runtimes reject a string that is not valid UTF-8
+		change.description += ": same bytes on the wire, but the string peer rejects bytes that are not valid UTF-8, and JSON has base64 for bytes"
+		change.breaksWire, change.breaksJSON = true, true
+	case pair(from, to, protoreflect.MessageKind, protoreflect.BytesKind):
+		change.description += ": same bytes on the wire, but the message peer fails to parse bytes that are not the encoded message, and JSON has an object for one and base64 for the other"
+		change.breaksWire, change.breaksJSON = true, true
+	default:
+		change.description += ": incompatible encodings"
+		change.breaksWire, change.breaksJSON = true, true
+	}
+	return change
+}
+
+// rangeChange describes an integer type change between kinds that share an
+// encoding, by the values one side sends that the other cannot hold. A type
+// change between different kinds always has some.
+func rangeChange(from, to protoreflect.Kind, a, b integer) string {
+	var problems []string
+	if !a.holds(b) {
+		problems = append(problems, fmt.Sprintf("new peers misread old %s values outside the %s range", from, to))
+	}
+	if !b.holds(a) {
+		problems = append(problems, fmt.Sprintf("old peers truncate or misread new %s values outside the %s range", to, from))
+	}
+	return strings.Join(problems, "; ")
+}
+
+func isVarint(k protoreflect.Kind) bool {
+	_, ok := varint[k]
+	return ok
+}
+
+func isZigzag(k protoreflect.Kind) bool {
+	_, ok := zigzag[k]
+	return ok
+}
+
+// pair reports whether from and to are a and b in either order
+func pair(from, to, a, b protoreflect.Kind) bool {
+	return from == a && to == b || from == b && to == a
+}
+
+// lengthDelimited reports whether values of kind k are encoded with their
+// length, the same whether the field is singular or repeated
+func lengthDelimited(k protoreflect.Kind) bool {
+	return k == protoreflect.StringKind || k == protoreflect.BytesKind || k == protoreflect.MessageKind
+}
+
+// typeName is f's type as written in a .proto file
+func typeName(f protoreflect.FieldDescriptor) string {
+	if f.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", typeName(f.MapKey()), typeName(f.MapValue()))
+	}
+	name := f.Kind().String()
+	switch {
+	case f.Message() != nil:
+		name = string(f.Message().FullName())
+	case f.Enum() != nil:
+		name = string(f.Enum().FullName())
+	}
+	if f.IsList() {
+		return "repeated " + name
+	}
+	return name
+}
@@ -1,71 +1,29 @@
 #!/bin/bash
+# Runs the shared suite with every client version against every server
+# version and prints the pass/fail matrix. The Markdown and JSON reports are
+# written to the directory given as the first argument, or a temporary one.
+# Exits non-zero if any check fails.
 
-set -e
+cd "$(dirname "$0")"
+REPORT_DIR=$(realpath -m "${1:-$(mktemp -d)}")
 
 echo "=========================================="
-echo "gRPC Backward Compatibility Test Suite"
+echo "gRPC Backward Compatibility Matrix"
 echo "=========================================="
 echo ""
 
-# Build all binaries
-echo "Building binaries..."
-go build -o cmd/scenario1-server/server cmd/scenario1-server/main.go
-go build -o cmd/scenario1-client/client cmd/scenario1-client/main.go
-go build -o cmd/scenario2-server/server cmd/scenario2-server/main.go
-go build -o cmd/scenario2-client/client cmd/scenario2-client/main.go
-echo "✓ All binaries built"
+go test -count=1 ./matrix -run 'TestMatrix$' -report="$REPORT_DIR"
+STATUS=$?
 echo ""
 
-# Run Scenario 1
-echo "=========================================="
-echo "Running Scenario 1: V1 Server + V2 Client"
-echo "=========================================="
-echo ""
-
-./cmd/scenario1-server/server > /tmp/scenario1-server.log 2>&1 &
-SERVER1_PID=$!
-sleep 2
+if [ -f "$REPORT_DIR/matrix.md" ]; then
+    cat "$REPORT_DIR/matrix.md"
+    echo ""
+    echo "Reports: $REPORT_DIR/matrix.md, $REPORT_DIR/matrix.json"
+fi
 
-./cmd/scenario1-client/client 2>&1
-
-sleep 1
-kill $SERVER1_PID 2>/dev/null || true
-wait $SERVER1_PID 2>/dev/null || true
-
-echo ""
-echo "--- Server Logs ---"
-cat /tmp/scenario1-server.log
-echo ""
-echo ""
-
-# Run Scenario 2
-echo "=========================================="
-echo "Running Scenario 2: V2 Server + V1 Client"
-echo "=========================================="
-echo ""
-
-./cmd/scenario2-server/server > /tmp/scenario2-server.log 2>&1 &
-SERVER2_PID=$!
-sleep 2
-
-./cmd/scenario2-client/client 2>&1
-
-sleep 1
-kill $SERVER2_PID 2>/dev/null || true
-wait $SERVER2_PID 2>/dev/null || true
-
-echo ""
-echo "--- Server Logs ---"
-cat /tmp/scenario2-server.log
-echo ""
-echo ""
-
-echo "=========================================="
-echo "All Tests Complete!"
-echo "=========================================="
-echo ""
-echo "Summary:"
-echo "✓ Scenario 1: Backward compatibility (V1 server + V2 client) - PASSED"
-echo "✓ Scenario 2: Forward compatibility (V2 server + V1 client) - PASSED"
-echo ""
-echo "Conclusion: gRPC backward compatibility works perfectly!"
+if [ "$STATUS" -ne 0 ]; then
+    echo "=== Compatibility matrix FAILED ==="
+    exit "$STATUS"
+fi
+echo "=== Every pairing passed ==="
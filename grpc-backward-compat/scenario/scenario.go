@@ -0,0 +1,80 @@
+// Package scenario checks what the scenario clients get back from a server.
+// A failed check is logged with ✗ and the client keeps going, so one run
+// reports every problem; Done then exits non-zero.
+package scenario
+
+import (
+	"log"
+	"slices"
+
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Checker logs checks for one client, e.g. "[V2 Client]"
+type Checker struct {
+	prefix string
+	failed bool
+}
+
+func NewChecker(prefix string) *Checker {
+	return &Checker{prefix: prefix}
+}
+
+// Pass logs a check that held
+func (c *Checker) Pass(format string, args ...any) {
+	log.Printf(c.prefix+" ✓ "+format, args...)
+}
+
+// Fail logs a check that did not hold
+func (c *Checker) Fail(format string, args ...any) {
+	log.Printf(c.prefix+" ✗ "+format, args...)
+	c.failed = true
+}
+
+// OK reports whether a call that should succeed did
+func (c *Checker) OK(what string, err error) bool {
+	if err != nil {
+		c.Fail("%s failed: %v", what, err)
+		return false
+	}
+	return true
+}
+
+// Code reports whether err carries the status code want
+func (c *Checker) Code(what string, err error, want codes.Code) bool {
+	got := status.Code(err)
+	if got != want {
+		c.Fail("%s: expected %s, got %s (%v)", what, want, got, err)
+		return false
+	}
+	c.Pass("%s: %s (%s)", what, got, status.Convert(err).Message())
+	return true
+}
+
+// Violations reports whether err is InvalidArgument with BadRequest
+// violations of exactly fields, in order
+func (c *Checker) Violations(what string, err error, fields ...string) bool {
+	if !c.Code(what, err, codes.InvalidArgument) {
+		return false
+	}
+	var got []string
+	for _, fv := range validation.FieldViolations(err) {
+		got = append(got, fv.Field)
+		log.Printf("%s     %s: %s", c.prefix, fv.Field, fv.Description)
+	}
+	if !slices.Equal(got, fields) {
+		c.Fail("%s: expected violations of %v, got %v", what, fields, got)
+		return false
+	}
+	return true
+}
+
+// Done exits with a failure summary if any check failed
+func (c *Checker) Done(name string) {
+	if c.failed {
+		log.Fatalf("=== %s FAILED ===", name)
+	}
+}
@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"grpc-backward-compat/evolution"
+	profilev1 "grpc-backward-compat/proto/profile/v1"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Server struct {
+	profilev1.UnimplementedProfileServiceServer
+	store storage.Store
+}
+
+// NewServer serves the profiles in store, stored as this version's Profile
+// with any fields it does not know kept
+func NewServer(store storage.Store) *Server {
+	return &Server{store: store}
+}
+
+func (s *Server) GetProfile(ctx context.Context, req *profilev1.GetProfileRequest) (*profilev1.GetProfileResponse, error) {
+	log.Printf("[V1 Profile Server] GetProfile called for user_id: %s", req.UserId)
+
+	var violations validation.Violations
+	violations.Required("user_id", req.UserId)
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
+
+	profile := &profilev1.Profile{}
+	err := storage.GetMessage(ctx, s.store, req.UserId, profile)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "profile not found: %s", req.UserId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read profile %s: %v", req.UserId, err)
+	}
+
+	log.Printf("[V1 Profile Server] Returning profile: %s", evolution.Describe(profile))
+	return &profilev1.GetProfileResponse{Profile: profile}, nil
+}
+
+func (s *Server) PutProfile(ctx context.Context, req *profilev1.PutProfileRequest) (*profilev1.PutProfileResponse, error) {
+	profile := req.GetProfile()
+	log.Printf("[V1 Profile Server] PutProfile called with: %s", evolution.Describe(profile))
+
+	var violations validation.Violations
+	violations.Required("profile.user_id", profile.GetUserId())
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := storage.PutMessage(ctx, s.store, profile.UserId, "", profile); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to store profile %s: %v", profile.UserId, err)
+	}
+	return &profilev1.PutProfileResponse{Profile: profile}, nil
+}
@@ -2,56 +2,165 @@ package v1
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"sync"
 
+	"grpc-backward-compat/idgen"
 	userv1 "grpc-backward-compat/proto/v1"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/unknownfields"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// createToUser is how much higher a field is numbered in User than in
+// CreateUserRequest (see user.proto)
+const createToUser = 1
+
 type Server struct {
 	userv1.UnimplementedUserServiceServer
-	users map[string]*userv1.User
-	mu    sync.RWMutex
+	store storage.Store
+	ids   idgen.Generator
 }
 
-func NewServer() *Server {
+// NewServer serves the users in store, which servers of other versions may
+// share, and names new users with ids
+func NewServer(store storage.Store, ids idgen.Generator) *Server {
 	return &Server{
-		users: make(map[string]*userv1.User),
+		store: store,
+		ids:   ids,
 	}
 }
 
 func (s *Server) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
 	log.Printf("[V1 Server] GetUser called for user_id: %s", req.UserId)
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	var violations validation.Violations
+	violations.Required("user_id", req.UserId)
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
 
-	user, exists := s.users[req.UserId]
-	if !exists {
-		return nil, fmt.Errorf("user not found: %s", req.UserId)
+	user := &userv1.User{}
+	err := storage.GetMessage(ctx, s.store, req.UserId, user)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", req.UserId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read user %s: %v", req.UserId, err)
 	}
 
 	log.Printf("[V1 Server] Returning user: id=%s, name=%s, email=%s", user.UserId, user.Name, user.Email)
+	if unknown := user.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+		log.Printf("[V1 Server] Passing on %d bytes of stored fields V1 does not know (e.g. 'phone' written by a V2 server)", len(unknown))
+	}
 	return &userv1.GetUserResponse{User: user}, nil
 }
 
 func (s *Server) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
 	log.Printf("[V1 Server] CreateUser called with name=%s, email=%s", req.Name, req.Email)
 
-	userId := fmt.Sprintf("user_%d", len(s.users)+1)
+	var violations validation.Violations
+	violations.Required("name", req.Name)
+	violations.Email("email", req.Email)
+	if err := violations.Err(); err != nil {
+		log.Printf("[V1 Server] Rejected CreateUser: %v", err)
+		return nil, err
+	}
+
+	userId, err := s.ids.NewID(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to allocate a user ID: %v", err)
+	}
 	user := &userv1.User{
 		UserId: userId,
 		Name:   req.Name,
 		Email:  req.Email,
 	}
 
-	s.mu.Lock()
-	s.users[userId] = user
-	s.mu.Unlock()
+	// Fields a newer client sent that this version does not know are stored
+	// with the user, so servers that know them can read them back
+	if unknown := req.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+		carried, err := unknownfields.Renumber(unknown, createToUser)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to keep unknown fields: %v", err)
+		}
+		user.ProtoReflect().SetUnknown(carried)
+		log.Printf("[V1 Server] Keeping %d bytes of fields V1 does not know", len(carried))
+	}
+
+	err = storage.CreateMessage(ctx, s.store, userId, validation.NormalizeEmail(req.Email), user)
+	switch {
+	case errors.Is(err, storage.ErrEmailTaken):
+		log.Printf("[V1 Server] Rejected CreateUser: email %s is taken", req.Email)
+		return nil, status.Errorf(codes.AlreadyExists, "a user with email %s already exists", req.Email)
+	case errors.Is(err, storage.ErrExists):
+		return nil, status.Errorf(codes.Aborted, "user ID %s is already taken, retry", userId)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to store user %s: %v", userId, err)
+	}
 
 	log.Printf("[V1 Server] Created user: id=%s, name=%s, email=%s", user.UserId, user.Name, user.Email)
-	log.Printf("[V1 Server] Note: V1 server does not handle 'phone' field - it will be ignored if sent by V2 client")
+	log.Printf("[V1 Server] Note: V1 server does not handle 'phone' field - it is stored and returned unread if sent by V2 client")
 
 	return &userv1.CreateUserResponse{User: user}, nil
 }
+
+func (s *Server) UpdateUser(ctx context.Context, req *userv1.UpdateUserRequest) (*userv1.UpdateUserResponse, error) {
+	change := req.GetUser()
+	paths := req.GetUpdateMask().GetPaths()
+	log.Printf("[V1 Server] UpdateUser called for user_id: %s, fields: %v", change.GetUserId(), paths)
+
+	var violations validation.Violations
+	violations.Required("user.user_id", change.GetUserId())
+	if len(paths) == 0 {
+		violations.Add("update_mask", "must list the fields to change")
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			violations.Required("user.name", change.Name)
+		case "email":
+			violations.Email("user.email", change.Email)
+		default:
+			violations.Add("update_mask", fmt.Sprintf("%q is not a field V1 servers can change: want name or email", path))
+		}
+	}
+	if err := violations.Err(); err != nil {
+		log.Printf("[V1 Server] Rejected UpdateUser: %v", err)
+		return nil, err
+	}
+
+	// Only the listed fields change; the stored user's other fields,
+	// including 'phone' written by a V2 server, are written back as they were
+	user := &userv1.User{}
+	err := storage.UpdateMessage(ctx, s.store, change.UserId, user, func() (string, error) {
+		for _, path := range paths {
+			switch path {
+			case "name":
+				user.Name = change.Name
+			case "email":
+				user.Email = change.Email
+			}
+		}
+		return validation.NormalizeEmail(user.Email), nil
+	})
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", change.UserId)
+	case errors.Is(err, storage.ErrEmailTaken):
+		log.Printf("[V1 Server] Rejected UpdateUser: email %s is taken", change.Email)
+		return nil, status.Errorf(codes.AlreadyExists, "a user with email %s already exists", change.Email)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to update user %s: %v", change.UserId, err)
+	}
+
+	log.Printf("[V1 Server] Updated user: id=%s, name=%s, email=%s", user.UserId, user.Name, user.Email)
+	if unknown := user.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+		log.Printf("[V1 Server] Kept %d bytes of stored fields V1 does not know", len(unknown))
+	}
+	return &userv1.UpdateUserResponse{User: user}, nil
+}
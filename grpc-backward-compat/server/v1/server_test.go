@@ -0,0 +1,217 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"grpc-backward-compat/idgen"
+	userv1 "grpc-backward-compat/proto/v1"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// TestConcurrentCreateUser makes 1000 CreateUser calls at once; run it with
+// -race. Every call must get its own ID and none may overwrite another.
+func TestConcurrentCreateUser(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, tc := range []struct {
+		name string
+		open func(t *testing.T) (storage.Store, error)
+		ids  func(storage.Store) idgen.Generator
+	}{
+		{"memory/counter", openMemory, counter},
+		{"memory/uuidv7", openMemory, func(storage.Store) idgen.Generator { return idgen.UUIDv7{} }},
+		{"memory/ulid", openMemory, func(storage.Store) idgen.Generator { return idgen.ULID{} }},
+		{"sqlite/counter", func(t *testing.T) (storage.Store, error) {
+			return storage.OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+		}, counter},
+		{"file/counter", func(t *testing.T) (storage.Store, error) {
+			return storage.OpenFile(filepath.Join(t.TempDir(), "users.log"))
+		}, counter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, err := tc.open(t)
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+			server := NewServer(store, tc.ids(store))
+
+			const n = 1000
+			ids := make([]string, n)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := server.CreateUser(ctx, &userv1.CreateUserRequest{
+						Name:  "user",
+						Email: fmt.Sprintf("user%d@example.com", i),
+					})
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					ids[i] = resp.User.UserId
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, n)
+			for i, id := range ids {
+				if errs[i] != nil {
+					t.Fatalf("CreateUser failed: %v", errs[i])
+				}
+				if seen[id] {
+					t.Fatalf("ID %s was handed out twice", id)
+				}
+				seen[id] = true
+			}
+			if count, _ := store.Count(ctx); count != n {
+				t.Errorf("Expected %d stored users, found %d", n, count)
+			}
+		})
+	}
+}
+
+func openMemory(t *testing.T) (storage.Store, error) {
+	return storage.NewMemory(), nil
+}
+
+func counter(store storage.Store) idgen.Generator {
+	return idgen.NewCounter(store)
+}
+
+func TestStatusCodes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx := context.Background()
+	store := storage.NewMemory()
+	server := NewServer(store, idgen.NewCounter(store))
+
+	if _, err := server.CreateUser(ctx, &userv1.CreateUserRequest{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	_, err := server.GetUser(ctx, &userv1.GetUserRequest{UserId: "user_404"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser of a missing user: expected NotFound, got %v", err)
+	}
+	_, err = server.GetUser(ctx, &userv1.GetUserRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetUser without user_id: expected InvalidArgument, got %v", err)
+	}
+
+	_, err = server.CreateUser(ctx, &userv1.CreateUserRequest{Name: "Ann Two", Email: "ANN@example.com"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateUser with a taken email: expected AlreadyExists, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *userv1.CreateUserRequest
+		fields []string
+	}{
+		{"empty", &userv1.CreateUserRequest{}, []string{"name"}},
+		{"blank name", &userv1.CreateUserRequest{Name: "  ", Email: "bob@example.com"}, []string{"name"}},
+		{"bad email", &userv1.CreateUserRequest{Name: "Bob", Email: "bob@"}, []string{"email"}},
+	} {
+		_, err := server.CreateUser(ctx, tc.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tc.name, err)
+			continue
+		}
+		var fields []string
+		for _, fv := range validation.FieldViolations(err) {
+			fields = append(fields, fv.Field)
+		}
+		if !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected violations of %v, got %v", tc.name, tc.fields, fields)
+		}
+	}
+	if n, _ := store.Count(ctx); n != 1 {
+		t.Errorf("Rejected requests must not store users, have %d", n)
+	}
+}
+
+// phoneField is User.phone in proto/v2, which V1 does not know
+const phoneField protowire.Number = 4
+
+// TestUpdateUserKeepsUnknownFields updates a user a V2 server stored with a
+// phone. The phone is written back untouched, and a V2 client asking a V1
+// server to change it is refused rather than ignored.
+func TestUpdateUserKeepsUnknownFields(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx := context.Background()
+	store := storage.NewMemory()
+	server := NewServer(store, idgen.NewCounter(store))
+
+	phone := protowire.AppendTag(nil, phoneField, protowire.BytesType)
+	phone = protowire.AppendString(phone, "+1234567890")
+	stored := &userv1.User{UserId: "user_1", Name: "Ann", Email: "ann@example.com"}
+	stored.ProtoReflect().SetUnknown(phone)
+	storage.CreateMessage(ctx, store, stored.UserId, stored.Email, stored)
+
+	resp, err := server.UpdateUser(ctx, &userv1.UpdateUserRequest{
+		User:       &userv1.User{UserId: "user_1", Name: "Ann Smith"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	want := &userv1.User{UserId: "user_1", Name: "Ann Smith", Email: "ann@example.com"}
+	want.ProtoReflect().SetUnknown(phone)
+	got := &userv1.User{}
+	storage.GetMessage(ctx, store, "user_1", got)
+	for _, user := range []*userv1.User{resp.User, got} {
+		if !proto.Equal(user, want) {
+			t.Errorf("Expected %v with the phone kept, got %v", want, user)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		paths []string
+	}{
+		{"no mask", nil},
+		{"phone", []string{"name", "phone"}},
+	} {
+		_, err := server.UpdateUser(ctx, &userv1.UpdateUserRequest{
+			User:       &userv1.User{UserId: "user_1", Name: "Ann"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: tc.paths},
+		})
+		if fields := violationFields(err); !slices.Equal(fields, []string{"update_mask"}) {
+			t.Errorf("%s: expected an update_mask violation, got %v", tc.name, err)
+		}
+	}
+	storage.GetMessage(ctx, store, "user_1", got)
+	if got.Name != "Ann Smith" {
+		t.Errorf("A rejected update changed the user: %v", got)
+	}
+}
+
+func violationFields(err error) []string {
+	var fields []string
+	for _, fv := range validation.FieldViolations(err) {
+		fields = append(fields, fv.Field)
+	}
+	return fields
+}
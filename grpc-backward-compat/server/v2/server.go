@@ -2,34 +2,55 @@ package v2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"sync"
 
+	"grpc-backward-compat/idgen"
 	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/unknownfields"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// createToUser is how much higher a field is numbered in User than in
+// CreateUserRequest (see user.proto)
+const createToUser = 1
+
 type Server struct {
 	userv2.UnimplementedUserServiceServer
-	users map[string]*userv2.User
-	mu    sync.RWMutex
+	store storage.Store
+	ids   idgen.Generator
 }
 
-func NewServer() *Server {
+// NewServer serves the users in store, which servers of other versions may
+// share, and names new users with ids
+func NewServer(store storage.Store, ids idgen.Generator) *Server {
 	return &Server{
-		users: make(map[string]*userv2.User),
+		store: store,
+		ids:   ids,
 	}
 }
 
 func (s *Server) GetUser(ctx context.Context, req *userv2.GetUserRequest) (*userv2.GetUserResponse, error) {
 	log.Printf("[V2 Server] GetUser called for user_id: %s", req.UserId)
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	var violations validation.Violations
+	violations.Required("user_id", req.UserId)
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
 
-	user, exists := s.users[req.UserId]
-	if !exists {
-		return nil, fmt.Errorf("user not found: %s", req.UserId)
+	user := &userv2.User{}
+	err := storage.GetMessage(ctx, s.store, req.UserId, user)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", req.UserId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read user %s: %v", req.UserId, err)
 	}
 
 	log.Printf("[V2 Server] Returning user: id=%s, name=%s, email=%s, phone=%s", user.UserId, user.Name, user.Email, user.Phone)
@@ -39,7 +60,19 @@ func (s *Server) GetUser(ctx context.Context, req *userv2.GetUserRequest) (*user
 func (s *Server) CreateUser(ctx context.Context, req *userv2.CreateUserRequest) (*userv2.CreateUserResponse, error) {
 	log.Printf("[V2 Server] CreateUser called with name=%s, email=%s, phone=%s", req.Name, req.Email, req.Phone)
 
-	userId := fmt.Sprintf("user_%d", len(s.users)+1)
+	var violations validation.Violations
+	violations.Required("name", req.Name)
+	violations.Email("email", req.Email)
+	violations.Phone("phone", req.Phone)
+	if err := violations.Err(); err != nil {
+		log.Printf("[V2 Server] Rejected CreateUser: %v", err)
+		return nil, err
+	}
+
+	userId, err := s.ids.NewID(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to allocate a user ID: %v", err)
+	}
 	user := &userv2.User{
 		UserId: userId,
 		Name:   req.Name,
@@ -47,12 +80,87 @@ func (s *Server) CreateUser(ctx context.Context, req *userv2.CreateUserRequest)
 		Phone:  req.Phone,
 	}
 
-	s.mu.Lock()
-	s.users[userId] = user
-	s.mu.Unlock()
+	// Fields a newer client sent that this version does not know are stored
+	// with the user, so servers that know them can read them back
+	if unknown := req.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+		carried, err := unknownfields.Renumber(unknown, createToUser)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to keep unknown fields: %v", err)
+		}
+		user.ProtoReflect().SetUnknown(carried)
+		log.Printf("[V2 Server] Keeping %d bytes of fields V2 does not know", len(carried))
+	}
+
+	err = storage.CreateMessage(ctx, s.store, userId, validation.NormalizeEmail(req.Email), user)
+	switch {
+	case errors.Is(err, storage.ErrEmailTaken):
+		log.Printf("[V2 Server] Rejected CreateUser: email %s is taken", req.Email)
+		return nil, status.Errorf(codes.AlreadyExists, "a user with email %s already exists", req.Email)
+	case errors.Is(err, storage.ErrExists):
+		return nil, status.Errorf(codes.Aborted, "user ID %s is already taken, retry", userId)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to store user %s: %v", userId, err)
+	}
 
 	log.Printf("[V2 Server] Created user: id=%s, name=%s, email=%s, phone=%s", user.UserId, user.Name, user.Email, user.Phone)
 	log.Printf("[V2 Server] Note: V2 server handles 'phone' field - if V1 client sends request, phone will be empty")
 
 	return &userv2.CreateUserResponse{User: user}, nil
 }
+
+func (s *Server) UpdateUser(ctx context.Context, req *userv2.UpdateUserRequest) (*userv2.UpdateUserResponse, error) {
+	change := req.GetUser()
+	paths := req.GetUpdateMask().GetPaths()
+	log.Printf("[V2 Server] UpdateUser called for user_id: %s, fields: %v", change.GetUserId(), paths)
+
+	var violations validation.Violations
+	violations.Required("user.user_id", change.GetUserId())
+	if len(paths) == 0 {
+		violations.Add("update_mask", "must list the fields to change")
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			violations.Required("user.name", change.Name)
+		case "email":
+			violations.Email("user.email", change.Email)
+		case "phone":
+			violations.Phone("user.phone", change.Phone)
+		default:
+			violations.Add("update_mask", fmt.Sprintf("%q is not a field V2 servers can change: want name, email or phone", path))
+		}
+	}
+	if err := violations.Err(); err != nil {
+		log.Printf("[V2 Server] Rejected UpdateUser: %v", err)
+		return nil, err
+	}
+
+	// Only the listed fields change; the stored user's other fields,
+	// including any V2 does not know, are written back as they were
+	user := &userv2.User{}
+	err := storage.UpdateMessage(ctx, s.store, change.UserId, user, func() (string, error) {
+		for _, path := range paths {
+			switch path {
+			case "name":
+				user.Name = change.Name
+			case "email":
+				user.Email = change.Email
+			case "phone":
+				user.Phone = change.Phone
+			}
+		}
+		return validation.NormalizeEmail(user.Email), nil
+	})
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", change.UserId)
+	case errors.Is(err, storage.ErrEmailTaken):
+		log.Printf("[V2 Server] Rejected UpdateUser: email %s is taken", change.Email)
+		return nil, status.Errorf(codes.AlreadyExists, "a user with email %s already exists", change.Email)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to update user %s: %v", change.UserId, err)
+	}
+
+	log.Printf("[V2 Server] Updated user: id=%s, name=%s, email=%s, phone=%s", user.UserId, user.Name, user.Email, user.Phone)
+	return &userv2.UpdateUserResponse{User: user}, nil
+}
@@ -0,0 +1,224 @@
+package v2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"grpc-backward-compat/idgen"
+	userv2 "grpc-backward-compat/proto/v2"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// TestConcurrentCreateUser makes 1000 CreateUser calls at once; run it with
+// -race. Every call must get its own ID and none may overwrite another.
+func TestConcurrentCreateUser(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, tc := range []struct {
+		name string
+		open func(t *testing.T) (storage.Store, error)
+		ids  func(storage.Store) idgen.Generator
+	}{
+		{"memory/counter", openMemory, counter},
+		{"memory/uuidv7", openMemory, func(storage.Store) idgen.Generator { return idgen.UUIDv7{} }},
+		{"memory/ulid", openMemory, func(storage.Store) idgen.Generator { return idgen.ULID{} }},
+		{"sqlite/counter", func(t *testing.T) (storage.Store, error) {
+			return storage.OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+		}, counter},
+		{"file/counter", func(t *testing.T) (storage.Store, error) {
+			return storage.OpenFile(filepath.Join(t.TempDir(), "users.log"))
+		}, counter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, err := tc.open(t)
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+			server := NewServer(store, tc.ids(store))
+
+			const n = 1000
+			ids := make([]string, n)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := server.CreateUser(ctx, &userv2.CreateUserRequest{
+						Name:  "user",
+						Email: fmt.Sprintf("user%d@example.com", i),
+					})
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					ids[i] = resp.User.UserId
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, n)
+			for i, id := range ids {
+				if errs[i] != nil {
+					t.Fatalf("CreateUser failed: %v", errs[i])
+				}
+				if seen[id] {
+					t.Fatalf("ID %s was handed out twice", id)
+				}
+				seen[id] = true
+			}
+			if count, _ := store.Count(ctx); count != n {
+				t.Errorf("Expected %d stored users, found %d", n, count)
+			}
+		})
+	}
+}
+
+func openMemory(t *testing.T) (storage.Store, error) {
+	return storage.NewMemory(), nil
+}
+
+func counter(store storage.Store) idgen.Generator {
+	return idgen.NewCounter(store)
+}
+
+func TestStatusCodes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx := context.Background()
+	store := storage.NewMemory()
+	server := NewServer(store, idgen.NewCounter(store))
+
+	if _, err := server.CreateUser(ctx, &userv2.CreateUserRequest{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	_, err := server.GetUser(ctx, &userv2.GetUserRequest{UserId: "user_404"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser of a missing user: expected NotFound, got %v", err)
+	}
+	_, err = server.GetUser(ctx, &userv2.GetUserRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetUser without user_id: expected InvalidArgument, got %v", err)
+	}
+
+	_, err = server.CreateUser(ctx, &userv2.CreateUserRequest{Name: "Ann Two", Email: "ANN@example.com"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateUser with a taken email: expected AlreadyExists, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *userv2.CreateUserRequest
+		fields []string
+	}{
+		{"empty", &userv2.CreateUserRequest{}, []string{"name"}},
+		{"blank name", &userv2.CreateUserRequest{Name: "  ", Email: "bob@example.com"}, []string{"name"}},
+		{"bad email", &userv2.CreateUserRequest{Name: "Bob", Email: "bob@"}, []string{"email"}},
+		{"bad phone", &userv2.CreateUserRequest{Name: "Ann", Email: "ann@example.com", Phone: "555-0123"}, []string{"phone"}},
+	} {
+		_, err := server.CreateUser(ctx, tc.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tc.name, err)
+			continue
+		}
+		var fields []string
+		for _, fv := range validation.FieldViolations(err) {
+			fields = append(fields, fv.Field)
+		}
+		if !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected violations of %v, got %v", tc.name, tc.fields, fields)
+		}
+	}
+	if n, _ := store.Count(ctx); n != 1 {
+		t.Errorf("Rejected requests must not store users, have %d", n)
+	}
+}
+
+// TestUpdateUser checks that fields outside update_mask survive even when
+// the request leaves them empty, as every V1 client's request does for phone
+func TestUpdateUser(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx := context.Background()
+	store := storage.NewMemory()
+	server := NewServer(store, idgen.NewCounter(store))
+	created, err := server.CreateUser(ctx, &userv2.CreateUserRequest{Name: "Ann", Email: "ann@example.com", Phone: "+1234567890"})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	id := created.User.UserId
+
+	// What a V1 client sends to rename Ann
+	resp, err := server.UpdateUser(ctx, &userv2.UpdateUserRequest{
+		User:       &userv2.User{UserId: id, Name: "Ann Smith"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if resp.User.Name != "Ann Smith" || resp.User.Email != "ann@example.com" || resp.User.Phone != "+1234567890" {
+		t.Errorf("Expected only the name to change, got %v", resp.User)
+	}
+
+	// Listing phone clears it
+	resp, err = server.UpdateUser(ctx, &userv2.UpdateUserRequest{
+		User:       &userv2.User{UserId: id},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}},
+	})
+	if err != nil || resp.User.Phone != "" || resp.User.Name != "Ann Smith" {
+		t.Errorf("Expected only the phone to be cleared, got %v, %v", resp.GetUser(), err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *userv2.UpdateUserRequest
+		fields []string
+	}{
+		{"no mask", &userv2.UpdateUserRequest{User: &userv2.User{UserId: id, Name: "Ann"}}, []string{"update_mask"}},
+		{"bad phone", &userv2.UpdateUserRequest{
+			User:       &userv2.User{UserId: id, Phone: "555"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone"}},
+		}, []string{"user.phone"}},
+		{"unknown field", &userv2.UpdateUserRequest{
+			User:       &userv2.User{UserId: id},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"address"}},
+		}, []string{"update_mask"}},
+	} {
+		_, err := server.UpdateUser(ctx, tc.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tc.name, err)
+			continue
+		}
+		var fields []string
+		for _, fv := range validation.FieldViolations(err) {
+			fields = append(fields, fv.Field)
+		}
+		if !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected violations of %v, got %v", tc.name, tc.fields, fields)
+		}
+	}
+
+	_, err = server.UpdateUser(ctx, &userv2.UpdateUserRequest{
+		User:       &userv2.User{UserId: "user_404", Name: "Nobody"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateUser of a missing user: expected NotFound, got %v", err)
+	}
+}
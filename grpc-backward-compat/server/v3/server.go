@@ -0,0 +1,355 @@
+package v3
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"grpc-backward-compat/idgen"
+	userv3 "grpc-backward-compat/proto/v3"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/unknownfields"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// createToUser is how much higher a field is numbered in User than in
+// CreateUserRequest (see user.proto)
+const createToUser = 1
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+type Server struct {
+	userv3.UnimplementedUserServiceServer
+	store storage.Store
+	ids   idgen.Generator
+}
+
+// NewServer serves the users in store, which servers of other versions may
+// share, and names new users with ids
+func NewServer(store storage.Store, ids idgen.Generator) *Server {
+	return &Server{
+		store: store,
+		ids:   ids,
+	}
+}
+
+func (s *Server) GetUser(ctx context.Context, req *userv3.GetUserRequest) (*userv3.GetUserResponse, error) {
+	log.Printf("[V3 Server] GetUser called for user_id: %s", req.UserId)
+
+	var violations validation.Violations
+	violations.Required("user_id", req.UserId)
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
+
+	user := &userv3.User{}
+	err := storage.GetMessage(ctx, s.store, req.UserId, user)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", req.UserId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read user %s: %v", req.UserId, err)
+	}
+
+	log.Printf("[V3 Server] Returning user: id=%s, name=%s, email=%s, phone=%s", user.UserId, user.Name, user.Email, user.Phone)
+	return &userv3.GetUserResponse{User: user}, nil
+}
+
+func (s *Server) CreateUser(ctx context.Context, req *userv3.CreateUserRequest) (*userv3.CreateUserResponse, error) {
+	log.Printf("[V3 Server] CreateUser called with name=%s, email=%s, phone=%s", req.Name, req.Email, req.Phone)
+
+	var violations validation.Violations
+	violations.Required("name", req.Name)
+	violations.Email("email", req.Email)
+	violations.Phone("phone", req.Phone)
+	if err := violations.Err(); err != nil {
+		log.Printf("[V3 Server] Rejected CreateUser: %v", err)
+		return nil, err
+	}
+
+	userId, err := s.ids.NewID(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to allocate a user ID: %v", err)
+	}
+	user := &userv3.User{
+		UserId: userId,
+		Name:   req.Name,
+		Email:  req.Email,
+		Phone:  req.Phone,
+	}
+
+	// Fields a newer client sent that this version does not know are stored
+	// with the user, so servers that know them can read them back
+	if unknown := req.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+		carried, err := unknownfields.Renumber(unknown, createToUser)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to keep unknown fields: %v", err)
+		}
+		user.ProtoReflect().SetUnknown(carried)
+		log.Printf("[V3 Server] Keeping %d bytes of fields V3 does not know", len(carried))
+	}
+
+	err = storage.CreateMessage(ctx, s.store, userId, validation.NormalizeEmail(req.Email), user)
+	switch {
+	case errors.Is(err, storage.ErrEmailTaken):
+		log.Printf("[V3 Server] Rejected CreateUser: email %s is taken", req.Email)
+		return nil, status.Errorf(codes.AlreadyExists, "a user with email %s already exists", req.Email)
+	case errors.Is(err, storage.ErrExists):
+		return nil, status.Errorf(codes.Aborted, "user ID %s is already taken, retry", userId)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to store user %s: %v", userId, err)
+	}
+
+	log.Printf("[V3 Server] Created user: id=%s, name=%s, email=%s, phone=%s", user.UserId, user.Name, user.Email, user.Phone)
+	return &userv3.CreateUserResponse{User: user}, nil
+}
+
+func (s *Server) UpdateUser(ctx context.Context, req *userv3.UpdateUserRequest) (*userv3.UpdateUserResponse, error) {
+	change := req.GetUser()
+	paths := req.GetUpdateMask().GetPaths()
+	log.Printf("[V3 Server] UpdateUser called for user_id: %s, fields: %v", change.GetUserId(), paths)
+
+	var violations validation.Violations
+	violations.Required("user.user_id", change.GetUserId())
+	if len(paths) == 0 {
+		violations.Add("update_mask", "must list the fields to change")
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			violations.Required("user.name", change.Name)
+		case "email":
+			violations.Email("user.email", change.Email)
+		case "phone":
+			violations.Phone("user.phone", change.Phone)
+		default:
+			violations.Add("update_mask", fmt.Sprintf("%q is not a field V3 servers can change: want name, email or phone", path))
+		}
+	}
+	if err := violations.Err(); err != nil {
+		log.Printf("[V3 Server] Rejected UpdateUser: %v", err)
+		return nil, err
+	}
+
+	// Only the listed fields change; the stored user's other fields,
+	// including any V3 does not know, are written back as they were
+	user := &userv3.User{}
+	err := storage.UpdateMessage(ctx, s.store, change.UserId, user, func() (string, error) {
+		for _, path := range paths {
+			switch path {
+			case "name":
+				user.Name = change.Name
+			case "email":
+				user.Email = change.Email
+			case "phone":
+				user.Phone = change.Phone
+			}
+		}
+		return validation.NormalizeEmail(user.Email), nil
+	})
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", change.UserId)
+	case errors.Is(err, storage.ErrEmailTaken):
+		log.Printf("[V3 Server] Rejected UpdateUser: email %s is taken", change.Email)
+		return nil, status.Errorf(codes.AlreadyExists, "a user with email %s already exists", change.Email)
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to update user %s: %v", change.UserId, err)
+	}
+
+	log.Printf("[V3 Server] Updated user: id=%s, name=%s, email=%s, phone=%s", user.UserId, user.Name, user.Email, user.Phone)
+	return &userv3.UpdateUserResponse{User: user}, nil
+}
+
+func (s *Server) DeleteUser(ctx context.Context, req *userv3.DeleteUserRequest) (*userv3.DeleteUserResponse, error) {
+	log.Printf("[V3 Server] DeleteUser called for user_id: %s", req.UserId)
+
+	var violations validation.Violations
+	violations.Required("user_id", req.UserId)
+	if err := violations.Err(); err != nil {
+		return nil, err
+	}
+
+	err := s.store.Delete(ctx, req.UserId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "user not found: %s", req.UserId)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete user %s: %v", req.UserId, err)
+	}
+
+	log.Printf("[V3 Server] Deleted user: id=%s", req.UserId)
+	return &userv3.DeleteUserResponse{}, nil
+}
+
+// pageToken is where the previous page ended, and the filters and order it
+// was listed with, which every later page must repeat
+type pageToken struct {
+	Order       userv3.ListUsersRequest_Order `json:"o,omitempty"`
+	Descending  bool                          `json:"d,omitempty"`
+	NamePrefix  string                        `json:"n,omitempty"`
+	EmailPrefix string                        `json:"e,omitempty"`
+	// Sort key and ID of the last user on the previous page
+	Key    string `json:"k"`
+	UserID string `json:"i"`
+}
+
+func (t pageToken) encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	var t pageToken
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &t)
+	}
+	return t, err
+}
+
+// sortKey is what order compares users by, before their IDs in
+// storage.CompareIDs order; ORDER_USER_ID compares the IDs alone
+func sortKey(user *userv3.User, order userv3.ListUsersRequest_Order) string {
+	switch order {
+	case userv3.ListUsersRequest_ORDER_NAME:
+		return user.Name
+	case userv3.ListUsersRequest_ORDER_EMAIL:
+		return validation.NormalizeEmail(user.Email)
+	}
+	return ""
+}
+
+func (s *Server) ListUsers(ctx context.Context, req *userv3.ListUsersRequest) (*userv3.ListUsersResponse, error) {
+	log.Printf("[V3 Server] ListUsers called with page_size=%d, name_prefix=%q, email_prefix=%q, order_by=%s, descending=%t",
+		req.PageSize, req.NamePrefix, req.EmailPrefix, req.OrderBy, req.Descending)
+
+	var violations validation.Violations
+	if req.PageSize < 0 {
+		violations.Add("page_size", "must not be negative")
+	}
+	if _, ok := userv3.ListUsersRequest_Order_name[int32(req.OrderBy)]; !ok {
+		violations.Add("order_by", fmt.Sprintf("unknown order %d", req.OrderBy))
+	}
+	emailPrefix := validation.NormalizeEmail(req.EmailPrefix)
+	var after *pageToken
+	if req.PageToken != "" {
+		token, err := decodePageToken(req.PageToken)
+		switch {
+		case err != nil:
+			violations.Add("page_token", "is not a token returned by ListUsers")
+		case token.Order != req.OrderBy || token.Descending != req.Descending ||
+			token.NamePrefix != req.NamePrefix || token.EmailPrefix != emailPrefix:
+			violations.Add("page_token", "was returned for other filters or another order")
+		default:
+			after = &token
+		}
+	}
+	if err := violations.Err(); err != nil {
+		log.Printf("[V3 Server] Rejected ListUsers: %v", err)
+		return nil, err
+	}
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	// add decodes recs and keeps the users that pass the filters
+	var users []*userv3.User
+	add := func(recs []storage.Record) error {
+		for _, rec := range recs {
+			user := &userv3.User{}
+			if err := proto.Unmarshal(rec.Data, user); err != nil {
+				return status.Errorf(codes.Internal, "failed to decode user %s: %v", rec.ID, err)
+			}
+			if strings.HasPrefix(user.Name, req.NamePrefix) && strings.HasPrefix(validation.NormalizeEmail(user.Email), emailPrefix) {
+				users = append(users, user)
+			}
+		}
+		return nil
+	}
+	if req.OrderBy == userv3.ListUsersRequest_ORDER_USER_ID {
+		// The store lists in this order, so it reads no further than the
+		// first user after this page, a page's worth at a time
+		page := storage.Page{Descending: req.Descending, Limit: pageSize + 1}
+		if after != nil {
+			page.After = after.UserID
+		}
+		for len(users) <= pageSize {
+			recs, err := s.store.ListPage(ctx, page)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to list users: %v", err)
+			}
+			if err := add(recs); err != nil {
+				return nil, err
+			}
+			if len(recs) < page.Limit {
+				break
+			}
+			page.After = recs[len(recs)-1].ID
+		}
+	} else {
+		// Other orders need every user that passes the filters
+		recs, err := s.store.List(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to list users: %v", err)
+		}
+		if err := add(recs); err != nil {
+			return nil, err
+		}
+
+		// Users are ordered by their sort key, then ID, so every user has one
+		// place in the order and a page can start right after the last one
+		// shown even if users were added or removed in between
+		compare := func(key, id string, user *userv3.User) int {
+			c := cmp.Or(cmp.Compare(key, sortKey(user, req.OrderBy)), storage.CompareIDs(id, user.UserId))
+			if req.Descending {
+				return -c
+			}
+			return c
+		}
+		slices.SortFunc(users, func(a, b *userv3.User) int {
+			return compare(sortKey(a, req.OrderBy), a.UserId, b)
+		})
+		if after != nil {
+			start := 0
+			for start < len(users) && compare(after.Key, after.UserID, users[start]) >= 0 {
+				start++
+			}
+			users = users[start:]
+		}
+	}
+
+	resp := &userv3.ListUsersResponse{Users: users}
+	if len(users) > pageSize {
+		resp.Users = users[:pageSize]
+		last := resp.Users[pageSize-1]
+		resp.NextPageToken = pageToken{
+			Order:       req.OrderBy,
+			Descending:  req.Descending,
+			NamePrefix:  req.NamePrefix,
+			EmailPrefix: emailPrefix,
+			Key:         sortKey(last, req.OrderBy),
+			UserID:      last.UserId,
+		}.encode()
+	}
+
+	log.Printf("[V3 Server] Returning %d users, more: %t", len(resp.Users), resp.NextPageToken != "")
+	return resp, nil
+}
@@ -0,0 +1,453 @@
+package v3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"grpc-backward-compat/idgen"
+	userv3 "grpc-backward-compat/proto/v3"
+	"grpc-backward-compat/storage"
+	"grpc-backward-compat/validation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// TestConcurrentCreateUser makes 1000 CreateUser calls at once; run it with
+// -race. Every call must get its own ID and none may overwrite another.
+func TestConcurrentCreateUser(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, tc := range []struct {
+		name string
+		open func(t *testing.T) (storage.Store, error)
+		ids  func(storage.Store) idgen.Generator
+	}{
+		{"memory/counter", openMemory, counter},
+		{"memory/uuidv7", openMemory, func(storage.Store) idgen.Generator { return idgen.UUIDv7{} }},
+		{"memory/ulid", openMemory, func(storage.Store) idgen.Generator { return idgen.ULID{} }},
+		{"sqlite/counter", func(t *testing.T) (storage.Store, error) {
+			return storage.OpenSQLite(filepath.Join(t.TempDir(), "users.db"))
+		}, counter},
+		{"file/counter", func(t *testing.T) (storage.Store, error) {
+			return storage.OpenFile(filepath.Join(t.TempDir(), "users.log"))
+		}, counter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			store, err := tc.open(t)
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+			server := NewServer(store, tc.ids(store))
+
+			const n = 1000
+			ids := make([]string, n)
+			errs := make([]error, n)
+			var wg sync.WaitGroup
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					resp, err := server.CreateUser(ctx, &userv3.CreateUserRequest{
+						Name:  "user",
+						Email: fmt.Sprintf("user%d@example.com", i),
+					})
+					if err != nil {
+						errs[i] = err
+						return
+					}
+					ids[i] = resp.User.UserId
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, n)
+			for i, id := range ids {
+				if errs[i] != nil {
+					t.Fatalf("CreateUser failed: %v", errs[i])
+				}
+				if seen[id] {
+					t.Fatalf("ID %s was handed out twice", id)
+				}
+				seen[id] = true
+			}
+			if count, _ := store.Count(ctx); count != n {
+				t.Errorf("Expected %d stored users, found %d", n, count)
+			}
+		})
+	}
+}
+
+func openMemory(t *testing.T) (storage.Store, error) {
+	return storage.NewMemory(), nil
+}
+
+func counter(store storage.Store) idgen.Generator {
+	return idgen.NewCounter(store)
+}
+
+func TestStatusCodes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	ctx := context.Background()
+	store := storage.NewMemory()
+	server := NewServer(store, idgen.NewCounter(store))
+
+	if _, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	_, err := server.GetUser(ctx, &userv3.GetUserRequest{UserId: "user_404"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser of a missing user: expected NotFound, got %v", err)
+	}
+	_, err = server.GetUser(ctx, &userv3.GetUserRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetUser without user_id: expected InvalidArgument, got %v", err)
+	}
+
+	_, err = server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Ann Two", Email: "ANN@example.com"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("CreateUser with a taken email: expected AlreadyExists, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *userv3.CreateUserRequest
+		fields []string
+	}{
+		{"empty", &userv3.CreateUserRequest{}, []string{"name"}},
+		{"blank name", &userv3.CreateUserRequest{Name: "  ", Email: "bob@example.com"}, []string{"name"}},
+		{"bad email", &userv3.CreateUserRequest{Name: "Bob", Email: "bob@"}, []string{"email"}},
+		{"bad phone", &userv3.CreateUserRequest{Name: "Ann", Email: "ann@example.com", Phone: "555-0123"}, []string{"phone"}},
+	} {
+		_, err := server.CreateUser(ctx, tc.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tc.name, err)
+			continue
+		}
+		var fields []string
+		for _, fv := range validation.FieldViolations(err) {
+			fields = append(fields, fv.Field)
+		}
+		if !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected violations of %v, got %v", tc.name, tc.fields, fields)
+		}
+	}
+	if n, _ := store.Count(ctx); n != 1 {
+		t.Errorf("Rejected requests must not store users, have %d", n)
+	}
+}
+
+// newTestServer returns a server on an empty memory store, with log output
+// discarded for the test
+func newTestServer(t *testing.T) (*Server, storage.Store) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	store := storage.NewMemory()
+	return NewServer(store, idgen.NewCounter(store)), store
+}
+
+func violationFields(err error) []string {
+	var fields []string
+	for _, fv := range validation.FieldViolations(err) {
+		fields = append(fields, fv.Field)
+	}
+	return fields
+}
+
+func TestUpdateUser(t *testing.T) {
+	ctx := context.Background()
+	server, store := newTestServer(t)
+
+	// Ann was stored by a newer server, with a field V3 does not know
+	ann := &userv3.User{UserId: "user_ann", Name: "Ann", Email: "ann@example.com", Phone: "+1234567890"}
+	unknown := protowire.AppendTag(nil, 9, protowire.BytesType)
+	unknown = protowire.AppendString(unknown, "from the future")
+	ann.ProtoReflect().SetUnknown(unknown)
+	if err := storage.CreateMessage(ctx, store, ann.UserId, ann.Email, ann); err != nil {
+		t.Fatalf("CreateMessage failed: %v", err)
+	}
+	bob, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Bob", Email: "bob@example.com"})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	bobID := bob.User.UserId
+
+	// Fields left out of the mask keep their values even though the request
+	// leaves them empty
+	resp, err := server.UpdateUser(ctx, &userv3.UpdateUserRequest{
+		User:       &userv3.User{UserId: "user_ann", Name: "Ann Smith"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	want := &userv3.User{UserId: "user_ann", Name: "Ann Smith", Email: "ann@example.com", Phone: "+1234567890"}
+	want.ProtoReflect().SetUnknown(unknown)
+	stored := &userv3.User{}
+	storage.GetMessage(ctx, store, "user_ann", stored)
+	for _, got := range []*userv3.User{resp.User, stored} {
+		if !proto.Equal(got, want) {
+			t.Errorf("Expected %v, got %v", want, got)
+		}
+	}
+
+	// A listed field is set even to empty
+	_, err = server.UpdateUser(ctx, &userv3.UpdateUserRequest{
+		User:       &userv3.User{UserId: "user_ann", Email: "Ann.Smith@example.com"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"phone", "email"}},
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	storage.GetMessage(ctx, store, "user_ann", stored)
+	if stored.Phone != "" || stored.Email != "Ann.Smith@example.com" {
+		t.Errorf("Expected an empty phone and the new email, got %v", stored)
+	}
+	// The old email is free, the new one taken
+	if _, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Another Ann", Email: "ann@example.com"}); err != nil {
+		t.Errorf("CreateUser with Ann's old email failed: %v", err)
+	}
+
+	_, err = server.UpdateUser(ctx, &userv3.UpdateUserRequest{
+		User:       &userv3.User{UserId: bobID, Email: "ann.smith@EXAMPLE.com"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"email"}},
+	})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("UpdateUser to a taken email: expected AlreadyExists, got %v", err)
+	}
+	_, err = server.UpdateUser(ctx, &userv3.UpdateUserRequest{
+		User:       &userv3.User{UserId: "user_404", Name: "Nobody"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateUser of a missing user: expected NotFound, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *userv3.UpdateUserRequest
+		fields []string
+	}{
+		{"empty", &userv3.UpdateUserRequest{}, []string{"user.user_id", "update_mask"}},
+		{"no mask", &userv3.UpdateUserRequest{User: &userv3.User{UserId: bobID, Name: "Bobby"}}, []string{"update_mask"}},
+		{"user_id in mask", &userv3.UpdateUserRequest{
+			User:       &userv3.User{UserId: bobID},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"user_id"}},
+		}, []string{"update_mask"}},
+		{"bad values", &userv3.UpdateUserRequest{
+			User:       &userv3.User{UserId: bobID, Email: "bob", Phone: "12"},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "email", "phone"}},
+		}, []string{"user.name", "user.email", "user.phone"}},
+	} {
+		_, err := server.UpdateUser(ctx, tc.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tc.name, err)
+			continue
+		}
+		if fields := violationFields(err); !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected violations of %v, got %v", tc.name, tc.fields, fields)
+		}
+	}
+	if resp, _ := server.GetUser(ctx, &userv3.GetUserRequest{UserId: bobID}); resp.User.Name != "Bob" {
+		t.Errorf("A rejected update changed the user: %v", resp.User)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestServer(t)
+	created, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Ann", Email: "ann@example.com"})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	id := created.User.UserId
+
+	if _, err := server.DeleteUser(ctx, &userv3.DeleteUserRequest{UserId: id}); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := server.GetUser(ctx, &userv3.GetUserRequest{UserId: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUser of a deleted user: expected NotFound, got %v", err)
+	}
+	if _, err := server.DeleteUser(ctx, &userv3.DeleteUserRequest{UserId: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("DeleteUser of a deleted user: expected NotFound, got %v", err)
+	}
+	if _, err := server.DeleteUser(ctx, &userv3.DeleteUserRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("DeleteUser without user_id: expected InvalidArgument, got %v", err)
+	}
+	if _, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Ann", Email: "ann@example.com"}); err != nil {
+		t.Errorf("CreateUser with a deleted user's email failed: %v", err)
+	}
+}
+
+// listAll pages through ListUsers with req's filters and order, and returns
+// the names of the users listed and how many pages it took
+func listAll(t *testing.T, server *Server, req *userv3.ListUsersRequest) ([]string, int) {
+	t.Helper()
+	var names []string
+	for pages := 1; ; pages++ {
+		resp, err := server.ListUsers(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ListUsers failed: %v", err)
+		}
+		for _, user := range resp.Users {
+			names = append(names, user.Name)
+		}
+		if resp.NextPageToken == "" {
+			return names, pages
+		}
+		req = proto.CloneOf(req)
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestServer(t)
+	for _, u := range []struct{ name, email string }{
+		{"Carol", "carol@example.com"},
+		{"Ann", "ann@example.org"},
+		{"Dave", "DAVE@example.com"},
+		{"Anna", "anna@example.com"},
+		{"Bob", "bob@example.org"},
+		{"Ann", "ann.b@example.com"},
+		{"Eve", "eve@example.com"},
+	} {
+		if _, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: u.name, Email: u.email}); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		req   *userv3.ListUsersRequest
+		want  []string
+		pages int
+	}{
+		{"by ID", &userv3.ListUsersRequest{}, []string{"Carol", "Ann", "Dave", "Anna", "Bob", "Ann", "Eve"}, 1},
+		{"by name", &userv3.ListUsersRequest{PageSize: 3, OrderBy: userv3.ListUsersRequest_ORDER_NAME},
+			[]string{"Ann", "Ann", "Anna", "Bob", "Carol", "Dave", "Eve"}, 3},
+		{"by name descending", &userv3.ListUsersRequest{PageSize: 2, OrderBy: userv3.ListUsersRequest_ORDER_NAME, Descending: true},
+			[]string{"Eve", "Dave", "Carol", "Bob", "Anna", "Ann", "Ann"}, 4},
+		{"by email", &userv3.ListUsersRequest{PageSize: 1, OrderBy: userv3.ListUsersRequest_ORDER_EMAIL},
+			[]string{"Ann", "Ann", "Anna", "Bob", "Carol", "Dave", "Eve"}, 7},
+		{"name prefix", &userv3.ListUsersRequest{PageSize: 1, NamePrefix: "Ann"}, []string{"Ann", "Anna", "Ann"}, 3},
+		{"email prefix", &userv3.ListUsersRequest{EmailPrefix: "D"}, []string{"Dave"}, 1},
+		{"both prefixes", &userv3.ListUsersRequest{NamePrefix: "A", EmailPrefix: "ann@"}, []string{"Ann"}, 1},
+		{"no match", &userv3.ListUsersRequest{NamePrefix: "Zed"}, nil, 1},
+	} {
+		names, pages := listAll(t, server, tc.req)
+		if !slices.Equal(names, tc.want) || pages != tc.pages {
+			t.Errorf("%s: expected %v in %d pages, got %v in %d", tc.name, tc.want, tc.pages, names, pages)
+		}
+	}
+}
+
+// IDs from the counter list in the order they were handed out, user_10
+// after user_9, a page at a time
+func TestListUsersByID(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestServer(t)
+	var want []string
+	for i := 1; i <= 12; i++ {
+		name := fmt.Sprintf("User %d", i)
+		if i%2 == 0 {
+			name = fmt.Sprintf("Even %d", i)
+		}
+		resp, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: name, Email: fmt.Sprintf("user%d@example.com", i)})
+		if err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+		if resp.User.UserId != fmt.Sprintf("user_%d", i) {
+			t.Fatalf("Expected user_%d, got %s", i, resp.User.UserId)
+		}
+		want = append(want, name)
+	}
+
+	names, pages := listAll(t, server, &userv3.ListUsersRequest{PageSize: 5})
+	if !slices.Equal(names, want) || pages != 3 {
+		t.Errorf("Expected %v in 3 pages, got %v in %d", want, names, pages)
+	}
+	slices.Reverse(want)
+	names, pages = listAll(t, server, &userv3.ListUsersRequest{PageSize: 5, Descending: true})
+	if !slices.Equal(names, want) || pages != 3 {
+		t.Errorf("Expected %v in 3 pages, got %v in %d", want, names, pages)
+	}
+	// Pages fill up with users that pass the filter even when most do not
+	names, pages = listAll(t, server, &userv3.ListUsersRequest{PageSize: 2, NamePrefix: "Even"})
+	if expected := []string{"Even 2", "Even 4", "Even 6", "Even 8", "Even 10", "Even 12"}; !slices.Equal(names, expected) || pages != 3 {
+		t.Errorf("Expected %v in 3 pages, got %v in %d", expected, names, pages)
+	}
+}
+
+func TestListUsersPageToken(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestServer(t)
+	var ids []string
+	for _, name := range []string{"Ann", "Bob", "Carol", "Dave"} {
+		resp, err := server.CreateUser(ctx, &userv3.CreateUserRequest{Name: name, Email: name + "@example.com"})
+		if err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+		ids = append(ids, resp.User.UserId)
+	}
+
+	req := &userv3.ListUsersRequest{PageSize: 2, OrderBy: userv3.ListUsersRequest_ORDER_NAME}
+	first, err := server.ListUsers(ctx, req)
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+
+	// The next page starts after the last user shown, even once that user
+	// is gone and another has been added before it
+	server.DeleteUser(ctx, &userv3.DeleteUserRequest{UserId: ids[1]})
+	server.CreateUser(ctx, &userv3.CreateUserRequest{Name: "Abe", Email: "abe@example.com"})
+	req.PageToken = first.NextPageToken
+	second, err := server.ListUsers(ctx, req)
+	if err != nil {
+		t.Fatalf("ListUsers failed: %v", err)
+	}
+	var names []string
+	for _, user := range second.Users {
+		names = append(names, user.Name)
+	}
+	if !slices.Equal(names, []string{"Carol", "Dave"}) || second.NextPageToken != "" {
+		t.Errorf("Expected the last page of Carol and Dave, got %v, %q", names, second.NextPageToken)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		req    *userv3.ListUsersRequest
+		fields []string
+	}{
+		{"other order", &userv3.ListUsersRequest{PageToken: first.NextPageToken}, []string{"page_token"}},
+		{"other filter", &userv3.ListUsersRequest{
+			PageToken: first.NextPageToken, OrderBy: userv3.ListUsersRequest_ORDER_NAME, NamePrefix: "C",
+		}, []string{"page_token"}},
+		{"garbage", &userv3.ListUsersRequest{PageToken: "not a token"}, []string{"page_token"}},
+		{"bad size and order", &userv3.ListUsersRequest{PageSize: -1, OrderBy: 7}, []string{"page_size", "order_by"}},
+	} {
+		_, err := server.ListUsers(ctx, tc.req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", tc.name, err)
+			continue
+		}
+		if fields := violationFields(err); !slices.Equal(fields, tc.fields) {
+			t.Errorf("%s: expected violations of %v, got %v", tc.name, tc.fields, fields)
+		}
+	}
+}
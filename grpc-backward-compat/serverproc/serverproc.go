@@ -0,0 +1,94 @@
+// Package serverproc builds the scenario servers and runs each as a process
+// of its own. The generated packages of two proto versions register the same
+// names and cannot be linked into one binary, so whatever talks to servers of
+// several versions at once, like the matrix and the evolution tests, keeps
+// them out of its own process.
+package serverproc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// StartTimeout is how long a server may take to listen once started
+const StartTimeout = 10 * time.Second
+
+// Build builds the main packages cmds, given by import path, into dir and
+// returns the path of each binary
+func Build(ctx context.Context, dir string, cmds ...string) ([]string, error) {
+	args := []string{"build", "-o", dir + string(filepath.Separator)}
+	bins := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		args = append(args, cmd)
+		bins[i] = filepath.Join(dir, path.Base(cmd))
+	}
+	if out, err := exec.CommandContext(ctx, "go", args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to build servers: %v\n%s", err, out)
+	}
+	return bins, nil
+}
+
+// Server is a server running in a process of its own
+type Server struct {
+	// Addr is the loopback address the server listens on
+	Addr string
+
+	cmd    *exec.Cmd
+	logs   bytes.Buffer
+	exited chan error
+}
+
+// Start runs bin with args and -addr set to a free loopback port, and waits
+// until it accepts connections there
+func Start(ctx context.Context, bin string, args ...string) (*Server, error) {
+	addr, err := freeAddr()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{Addr: addr, exited: make(chan error, 1)}
+	s.cmd = exec.CommandContext(ctx, bin, append([]string{"-addr", addr}, args...)...)
+	s.cmd.Stdout, s.cmd.Stderr = &s.logs, &s.logs
+	if err := s.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", bin, err)
+	}
+	go func() { s.exited <- s.cmd.Wait() }()
+
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			c.Close()
+			return s, nil
+		}
+		select {
+		case err := <-s.exited:
+			return nil, fmt.Errorf("%s exited before listening: %v\n%s", bin, err, s.logs.String())
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			s.Stop()
+			return nil, fmt.Errorf("%s not listening on %s after %v\n%s", bin, addr, StartTimeout, s.logs.String())
+		}
+	}
+}
+
+// Stop kills the server and waits for it to exit
+func (s *Server) Stop() {
+	s.cmd.Process.Kill()
+	<-s.exited
+}
+
+// freeAddr returns a loopback address with a port nothing listens on
+func freeAddr() (string, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %v", err)
+	}
+	defer lis.Close()
+	return lis.Addr().String(), nil
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// File keeps records in an append-only log with one JSON line per write;
+// the last line for an ID wins. Every call first reads what other processes
+// appended, so servers sharing the file see each other's writes.
+type File struct {
+	mu       sync.Mutex
+	f        *os.File
+	offset   int64 // bytes of the log applied to records
+	records  map[string]Record
+	emails   map[string]string // email -> ID
+	sequence uint64
+}
+
+// fileEntry is one line of the log: a record, the removal of one if Deleted
+// is set, or with Sequence set, the user counter's new value. Data is base64
+// in JSON.
+type fileEntry struct {
+	ID       string `json:"id,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+	Deleted  bool   `json:"deleted,omitempty"`
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	s := &File{f: f, records: make(map[string]Record), emails: make(map[string]string)}
+	if _, err := s.catchUp(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *File) apply(e fileEntry) {
+	if e.Sequence > 0 {
+		s.sequence = e.Sequence
+		return
+	}
+	if old, ok := s.records[e.ID]; ok {
+		delete(s.emails, old.Email)
+	}
+	if e.Deleted {
+		delete(s.records, e.ID)
+		return
+	}
+	if e.Email != "" {
+		s.emails[e.Email] = e.ID
+	}
+	s.records[e.ID] = Record{ID: e.ID, Email: e.Email, Data: e.Data}
+}
+
+// checkEmail returns ErrEmailTaken if a record other than rec has its email
+func (s *File) checkEmail(rec Record) error {
+	if owner, ok := s.emails[rec.Email]; ok && rec.Email != "" && owner != rec.ID {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// catchUp applies the complete lines past offset and reports whether an
+// incomplete line follows them
+func (s *File) catchUp() (partial bool, err error) {
+	info, err := s.f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %v", s.f.Name(), err)
+	}
+	if info.Size() <= s.offset {
+		return false, nil
+	}
+	buf := make([]byte, info.Size()-s.offset)
+	if _, err := s.f.ReadAt(buf, s.offset); err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read %s: %v", s.f.Name(), err)
+	}
+	for {
+		line, rest, ok := bytes.Cut(buf, []byte("\n"))
+		if !ok {
+			return len(buf) > 0, nil
+		}
+		var e fileEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return false, fmt.Errorf("corrupt entry at offset %d of %s: %v", s.offset, s.f.Name(), err)
+		}
+		s.apply(e)
+		s.offset += int64(len(line) + 1)
+		buf = rest
+	}
+}
+
+// write appends the entry next returns once every other process's writes
+// are applied. next runs under the file lock, so it can check and allocate
+// against the latest state.
+func (s *File) write(next func() (fileEntry, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Writers hold the file lock, so an incomplete line seen under it was
+	// left by a process that died mid-write and is cut off
+	if err := lockFile(s.f); err != nil {
+		return fmt.Errorf("failed to lock %s: %v", s.f.Name(), err)
+	}
+	defer unlockFile(s.f)
+
+	partial, err := s.catchUp()
+	if err != nil {
+		return err
+	}
+	if partial {
+		if err := s.f.Truncate(s.offset); err != nil {
+			return fmt.Errorf("failed to drop a torn entry from %s: %v", s.f.Name(), err)
+		}
+	}
+
+	e, err := next()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %v", err)
+	}
+	line = append(line, '\n')
+	if _, err := s.f.Write(line); err != nil {
+		return fmt.Errorf("failed to write %s: %v", s.f.Name(), err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %v", s.f.Name(), err)
+	}
+	s.apply(e)
+	s.offset += int64(len(line))
+	return nil
+}
+
+func (s *File) Get(ctx context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.catchUp(); err != nil {
+		return Record{}, err
+	}
+	rec, ok := s.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	rec.Data = slices.Clone(rec.Data)
+	return rec, nil
+}
+
+func (s *File) Create(ctx context.Context, rec Record) error {
+	return s.write(func() (fileEntry, error) {
+		if _, ok := s.records[rec.ID]; ok {
+			return fileEntry{}, ErrExists
+		}
+		if err := s.checkEmail(rec); err != nil {
+			return fileEntry{}, err
+		}
+		return fileEntry{ID: rec.ID, Email: rec.Email, Data: slices.Clone(rec.Data)}, nil
+	})
+}
+
+func (s *File) Put(ctx context.Context, rec Record) error {
+	return s.write(func() (fileEntry, error) {
+		if err := s.checkEmail(rec); err != nil {
+			return fileEntry{}, err
+		}
+		return fileEntry{ID: rec.ID, Email: rec.Email, Data: slices.Clone(rec.Data)}, nil
+	})
+}
+
+func (s *File) Update(ctx context.Context, id string, update func(Record) (Record, error)) error {
+	return s.write(func() (fileEntry, error) {
+		rec, ok := s.records[id]
+		if !ok {
+			return fileEntry{}, ErrNotFound
+		}
+		rec.Data = slices.Clone(rec.Data)
+		rec, err := update(rec)
+		if err != nil {
+			return fileEntry{}, err
+		}
+		rec.ID = id
+		if err := s.checkEmail(rec); err != nil {
+			return fileEntry{}, err
+		}
+		return fileEntry{ID: id, Email: rec.Email, Data: rec.Data}, nil
+	})
+}
+
+func (s *File) Delete(ctx context.Context, id string) error {
+	return s.write(func() (fileEntry, error) {
+		if _, ok := s.records[id]; !ok {
+			return fileEntry{}, ErrNotFound
+		}
+		return fileEntry{ID: id, Deleted: true}, nil
+	})
+}
+
+func (s *File) List(ctx context.Context) ([]Record, error) {
+	return s.ListPage(ctx, Page{})
+}
+
+func (s *File) ListPage(ctx context.Context, page Page) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.catchUp(); err != nil {
+		return nil, err
+	}
+	return listPage(s.records, page), nil
+}
+
+func (s *File) NextSequence(ctx context.Context) (uint64, error) {
+	var next uint64
+	err := s.write(func() (fileEntry, error) {
+		next = s.sequence
+		if next == 0 {
+			for id := range s.records {
+				if n, ok := idSequence(id); ok {
+					next = max(next, n)
+				}
+			}
+		}
+		next++
+		return fileEntry{Sequence: next}, nil
+	})
+	return next, err
+}
+
+func (s *File) Count(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.catchUp(); err != nil {
+		return 0, err
+	}
+	return len(s.records), nil
+}
+
+func (s *File) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// Without flock, only one process may write a log file at a time
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
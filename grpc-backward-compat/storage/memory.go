@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Memory keeps records in a map; they are lost when the process exits
+type Memory struct {
+	mu       sync.RWMutex
+	records  map[string]Record
+	emails   map[string]string // email -> ID
+	sequence uint64
+}
+
+func NewMemory() *Memory {
+	return &Memory{records: make(map[string]Record), emails: make(map[string]string)}
+}
+
+func (m *Memory) Get(ctx context.Context, id string) (Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rec, ok := m.records[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	rec.Data = slices.Clone(rec.Data)
+	return rec, nil
+}
+
+func (m *Memory) Create(ctx context.Context, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[rec.ID]; ok {
+		return ErrExists
+	}
+	return m.put(rec)
+}
+
+func (m *Memory) Put(ctx context.Context, rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.put(rec)
+}
+
+// put stores rec with m.mu held
+func (m *Memory) put(rec Record) error {
+	if owner, ok := m.emails[rec.Email]; ok && rec.Email != "" && owner != rec.ID {
+		return ErrEmailTaken
+	}
+	if old, ok := m.records[rec.ID]; ok {
+		delete(m.emails, old.Email)
+	}
+	if rec.Email != "" {
+		m.emails[rec.Email] = rec.ID
+	}
+	rec.Data = slices.Clone(rec.Data)
+	m.records[rec.ID] = rec
+	return nil
+}
+
+func (m *Memory) Update(ctx context.Context, id string, update func(Record) (Record, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	rec.Data = slices.Clone(rec.Data)
+	rec, err := update(rec)
+	if err != nil {
+		return err
+	}
+	rec.ID = id
+	return m.put(rec)
+}
+
+func (m *Memory) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rec, ok := m.records[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.emails, rec.Email)
+	delete(m.records, id)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context) ([]Record, error) {
+	return m.ListPage(ctx, Page{})
+}
+
+func (m *Memory) ListPage(ctx context.Context, page Page) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return listPage(m.records, page), nil
+}
+
+func (m *Memory) NextSequence(ctx context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sequence == 0 {
+		for id := range m.records {
+			if n, ok := idSequence(id); ok {
+				m.sequence = max(m.sequence, n)
+			}
+		}
+	}
+	m.sequence++
+	return m.sequence, nil
+}
+
+func (m *Memory) Count(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.records), nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
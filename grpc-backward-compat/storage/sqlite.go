@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLite keeps records in a SQLite database file, which several server
+// processes can open at once
+type SQLite struct {
+	db *sql.DB
+}
+
+func OpenSQLite(path string) (*SQLite, error) {
+	// WAL and a busy timeout let a V1 and a V2 server share the file.
+	// Transactions take the write lock when they begin, so an Update waits
+	// for other writers instead of failing when it comes to write.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	// SQLite has one writer at a time. Queueing this process's writers for a
+	// single connection keeps them from spending the busy timeout polling
+	// each other for the lock under load.
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS users (
+		id   TEXT PRIMARY KEY,
+		data BLOB NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS sequences (
+		name  TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	)`)
+	if err == nil {
+		err = addEmailColumn(db)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables in %s: %v", path, err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// addEmailColumn adds the unique email column to tables created before it
+// existed; their rows keep an empty email, which is not indexed
+func addEmailColumn(db *sql.DB) error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info('users') WHERE name = 'email'").Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := db.Exec("ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (email) WHERE email != ''")
+	return err
+}
+
+// writeError turns a violated email index into ErrEmailTaken
+func writeError(id string, err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return ErrEmailTaken
+	}
+	return fmt.Errorf("failed to write user %s: %v", id, err)
+}
+
+// blob keeps an empty message, which marshals to nil, from becoming NULL
+func blob(data []byte) []byte {
+	if data == nil {
+		return []byte{}
+	}
+	return data
+}
+
+func (s *SQLite) Get(ctx context.Context, id string) (Record, error) {
+	rec := Record{ID: id}
+	err := s.db.QueryRowContext(ctx, "SELECT email, data FROM users WHERE id = ?", id).Scan(&rec.Email, &rec.Data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to read user %s: %v", id, err)
+	}
+	return rec, nil
+}
+
+func (s *SQLite) Create(ctx context.Context, rec Record) error {
+	res, err := s.db.ExecContext(ctx, "INSERT INTO users (id, email, data) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING",
+		rec.ID, rec.Email, blob(rec.Data))
+	if err != nil {
+		return writeError(rec.ID, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrExists
+	}
+	return nil
+}
+
+func (s *SQLite) Put(ctx context.Context, rec Record) error {
+	// Not INSERT OR REPLACE, which would delete another user with the same email
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (id, email, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET email = excluded.email, data = excluded.data`,
+		rec.ID, rec.Email, blob(rec.Data))
+	if err != nil {
+		return writeError(rec.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLite) Update(ctx context.Context, id string, update func(Record) (Record, error)) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update user %s: %v", id, err)
+	}
+	defer tx.Rollback()
+
+	rec := Record{ID: id}
+	err = tx.QueryRowContext(ctx, "SELECT email, data FROM users WHERE id = ?", id).Scan(&rec.Email, &rec.Data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read user %s: %v", id, err)
+	}
+	if rec, err = update(rec); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET email = ?, data = ? WHERE id = ?", rec.Email, blob(rec.Data), id); err != nil {
+		return writeError(id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update user %s: %v", id, err)
+	}
+	return nil
+}
+
+func (s *SQLite) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user %s: %v", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// sqlIDSequence is idSequence in SQL: the sequence of the row's id, or NULL
+const sqlIDSequence = `CASE WHEN instr(id, '_') > 0
+	AND length(substr(id, instr(id, '_') + 1)) BETWEEN 1 AND 18
+	AND substr(id, instr(id, '_') + 1) NOT GLOB '*[^0-9]*'
+	THEN CAST(substr(id, instr(id, '_') + 1) AS INTEGER) END`
+
+func (s *SQLite) List(ctx context.Context) ([]Record, error) {
+	return s.ListPage(ctx, Page{})
+}
+
+func (s *SQLite) ListPage(ctx context.Context, page Page) ([]Record, error) {
+	// CompareIDs compares (no sequence, sequence, id)
+	query := "SELECT id, email, data FROM (SELECT id, email, data, " + sqlIDSequence + " AS seq FROM users)"
+	var args []any
+	after, order := ">", "seq IS NULL, seq, id"
+	if page.Descending {
+		after, order = "<", "seq IS NULL DESC, seq DESC, id DESC"
+	}
+	if page.After != "" {
+		n, ok := idSequence(page.After)
+		query += " WHERE (seq IS NULL, COALESCE(seq, 0), id) " + after + " (?, ?, ?)"
+		args = append(args, !ok, int64(n), page.After)
+	}
+	query += " ORDER BY " + order
+	if page.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, page.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+	defer rows.Close()
+
+	var recs []Record
+	for rows.Next() {
+		var rec Record
+		if err := rows.Scan(&rec.ID, &rec.Email, &rec.Data); err != nil {
+			return nil, fmt.Errorf("failed to list users: %v", err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %v", err)
+	}
+	return recs, nil
+}
+
+func (s *SQLite) NextSequence(ctx context.Context) (uint64, error) {
+	// One statement, so concurrent callers in any process are serialized by SQLite
+	var next uint64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO sequences (name, value)
+		VALUES ('users', (SELECT COALESCE(MAX(`+sqlIDSequence+`), 0) + 1 FROM users))
+		ON CONFLICT (name) DO UPDATE SET value = value + 1
+		RETURNING value`).Scan(&next)
+	if err != nil {
+		return 0, fmt.Errorf("failed to advance the user sequence: %v", err)
+	}
+	return next, nil
+}
+
+func (s *SQLite) Count(ctx context.Context) (int, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count users: %v", err)
+	}
+	return n, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,206 @@
+// Package storage keeps users for the UserService servers. Every proto
+// version stores the same records, so V1 and V2 servers can run against one
+// store during a rolling upgrade.
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// ErrNotFound is returned for an ID that is not stored
+	ErrNotFound = errors.New("not found")
+	// ErrExists is returned by Create for an ID that is already stored
+	ErrExists = errors.New("already exists")
+	// ErrEmailTaken is returned when another record has the same Email
+	ErrEmailTaken = errors.New("email already in use")
+)
+
+// Record is one stored user. Data is the User message in protobuf wire
+// format exactly as the server that wrote it marshaled it, so fields that a
+// server reading it does not know, such as phone on a V1 server, survive
+// the round trip.
+type Record struct {
+	ID string
+	// Email is unique among records unless empty. Servers normalize it, since
+	// the store compares it byte for byte.
+	Email string
+	Data  []byte
+}
+
+// Store is where users live. Implementations are safe for concurrent use.
+type Store interface {
+	// Get returns the record with id, or ErrNotFound
+	Get(ctx context.Context, id string) (Record, error)
+	// Create stores rec, or returns ErrExists if its ID is taken or
+	// ErrEmailTaken if its Email is
+	Create(ctx context.Context, rec Record) error
+	// Put stores rec, replacing any record with the same ID, or returns
+	// ErrEmailTaken if another record has its Email
+	Put(ctx context.Context, rec Record) error
+	// Update replaces the record with id by what update returns for it, with
+	// no other write to the store in between. It returns ErrNotFound if there
+	// is no such record, ErrEmailTaken if another record has the new Email,
+	// or any error update returns, in which case nothing is written.
+	Update(ctx context.Context, id string, update func(Record) (Record, error)) error
+	// Delete removes the record with id, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+	// List returns every record, ordered by CompareIDs
+	List(ctx context.Context) ([]Record, error)
+	// ListPage returns the records page selects, ordered by CompareIDs
+	ListPage(ctx context.Context, page Page) ([]Record, error)
+	// NextSequence increments the store's user counter and returns it. A new
+	// counter starts after the highest sequence of the stored IDs (see
+	// idSequence), so it skips IDs that are taken even after deletes. Durable
+	// stores keep it across restarts, and processes sharing a store never see
+	// the same value.
+	NextSequence(ctx context.Context) (uint64, error)
+	// Count returns how many records are stored
+	Count(ctx context.Context) (int, error)
+	Close() error
+}
+
+// Page selects records for ListPage
+type Page struct {
+	// After is the ID the page starts after, or "" to start at the first
+	After string
+	// Descending reverses the order
+	Descending bool
+	// Limit is the most records returned, or 0 for no limit
+	Limit int
+}
+
+// idSequence returns the number an ID such as user_12 was allocated from:
+// the 1 to 18 digits after its first '_'. ok is false for any other ID, such
+// as a UUID or ULID. sqlIDSequence does the same in SQL.
+func idSequence(id string) (n uint64, ok bool) {
+	_, digits, found := strings.Cut(id, "_")
+	if !found || len(digits) == 0 || len(digits) > 18 {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	return n, err == nil
+}
+
+// CompareIDs orders IDs with a sequence by that number, so user_2 comes
+// before user_10, and after them every other ID as a string
+func CompareIDs(a, b string) int {
+	na, okA := idSequence(a)
+	nb, okB := idSequence(b)
+	switch {
+	case okA && !okB:
+		return -1
+	case !okA && okB:
+		return 1
+	}
+	return cmp.Or(cmp.Compare(na, nb), cmp.Compare(a, b))
+}
+
+// listPage selects page from records, for the stores that keep them in a map
+func listPage(records map[string]Record, page Page) []Record {
+	ids := slices.SortedFunc(maps.Keys(records), CompareIDs)
+	if page.Descending {
+		slices.Reverse(ids)
+	}
+	if page.After != "" {
+		start, _ := slices.BinarySearchFunc(ids, page.After, func(id, after string) int {
+			if page.Descending {
+				return CompareIDs(after, id)
+			}
+			return CompareIDs(id, after)
+		})
+		if start < len(ids) && ids[start] == page.After {
+			start++
+		}
+		ids = ids[start:]
+	}
+	if page.Limit > 0 && len(ids) > page.Limit {
+		ids = ids[:page.Limit]
+	}
+	recs := make([]Record, 0, len(ids))
+	for _, id := range ids {
+		rec := records[id]
+		rec.Data = slices.Clone(rec.Data)
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// Open opens the store described by spec:
+//
+//	memory          in-memory, lost on exit
+//	sqlite:PATH     SQLite database file
+//	file:PATH       append-only log file
+func Open(spec string) (Store, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "memory" && path == "":
+		return NewMemory(), nil
+	case kind == "sqlite" && path != "":
+		return OpenSQLite(path)
+	case kind == "file" && path != "":
+		return OpenFile(path)
+	}
+	return nil, fmt.Errorf("invalid store %q: want memory, sqlite:PATH or file:PATH", spec)
+}
+
+// GetMessage reads the record with id into m. Fields m does not know are
+// kept as its unknown fields, so marshaling m again writes them back.
+func GetMessage(ctx context.Context, s Store, id string, m proto.Message) error {
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(rec.Data, m); err != nil {
+		return fmt.Errorf("failed to decode user %s: %v", id, err)
+	}
+	return nil
+}
+
+// CreateMessage stores m, unknown fields included, under id and email like Create
+func CreateMessage(ctx context.Context, s Store, id, email string, m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode user %s: %v", id, err)
+	}
+	return s.Create(ctx, Record{ID: id, Email: email, Data: data})
+}
+
+// PutMessage stores m, unknown fields included, under id and email like Put
+func PutMessage(ctx context.Context, s Store, id, email string, m proto.Message) error {
+	data, err := proto.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to encode user %s: %v", id, err)
+	}
+	return s.Put(ctx, Record{ID: id, Email: email, Data: data})
+}
+
+// UpdateMessage reads the record with id into m, lets update change m and
+// return its email, and stores m again like Update. Fields m does not know
+// are written back unchanged.
+func UpdateMessage(ctx context.Context, s Store, id string, m proto.Message, update func() (email string, err error)) error {
+	return s.Update(ctx, id, func(rec Record) (Record, error) {
+		proto.Reset(m)
+		if err := proto.Unmarshal(rec.Data, m); err != nil {
+			return Record{}, fmt.Errorf("failed to decode user %s: %v", id, err)
+		}
+		email, err := update()
+		if err != nil {
+			return Record{}, err
+		}
+		data, err := proto.Marshal(m)
+		if err != nil {
+			return Record{}, fmt.Errorf("failed to encode user %s: %v", id, err)
+		}
+		return Record{ID: id, Email: email, Data: data}, nil
+	})
+}
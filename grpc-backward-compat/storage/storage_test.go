@@ -0,0 +1,419 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	userv1 "grpc-backward-compat/proto/v1"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// stores opens each implementation; reopen opens a second handle on the same data
+var stores = []struct {
+	name string
+	open func(t *testing.T) (s Store, reopen func() Store)
+}{
+	{"memory", func(t *testing.T) (Store, func() Store) {
+		m := NewMemory()
+		return m, func() Store { return m }
+	}},
+	{"sqlite", func(t *testing.T) (Store, func() Store) {
+		return openPath(t, "users.db", func(p string) (Store, error) { return OpenSQLite(p) })
+	}},
+	{"file", func(t *testing.T) (Store, func() Store) {
+		return openPath(t, "users.log", func(p string) (Store, error) { return OpenFile(p) })
+	}},
+}
+
+func openPath(t *testing.T, name string, open func(string) (Store, error)) (Store, func() Store) {
+	path := filepath.Join(t.TempDir(), name)
+	reopen := func() Store {
+		s, err := open(path)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", path, err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	}
+	return reopen(), reopen
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+
+			if _, err := s.Get(ctx, "user_1"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Expected ErrNotFound, got %v", err)
+			}
+			s.Put(ctx, Record{ID: "user_1", Data: []byte("first")})
+			s.Put(ctx, Record{ID: "user_2", Data: []byte("second")})
+			if err := s.Put(ctx, Record{ID: "user_1", Data: []byte("replaced")}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			// A second handle sees the same records, as a restarted or
+			// concurrently running server would
+			other := reopen()
+			for _, store := range []Store{s, other} {
+				rec, err := store.Get(ctx, "user_1")
+				if err != nil || string(rec.Data) != "replaced" {
+					t.Errorf("Expected the replaced record, got %q, %v", rec.Data, err)
+				}
+				if n, _ := store.Count(ctx); n != 2 {
+					t.Errorf("Expected 2 records, counted %d", n)
+				}
+			}
+
+			// Writes through either handle are visible through the other
+			other.Put(ctx, Record{ID: "user_3", Data: []byte("third")})
+			if rec, err := s.Get(ctx, "user_3"); err != nil || string(rec.Data) != "third" {
+				t.Errorf("Expected the other handle's write, got %q, %v", rec.Data, err)
+			}
+		})
+	}
+}
+
+func TestCreateRefusesTakenID(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+			if err := s.Create(ctx, Record{ID: "user_1", Data: []byte("first")}); err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			if err := reopen().Create(ctx, Record{ID: "user_1", Data: []byte("second")}); !errors.Is(err, ErrExists) {
+				t.Fatalf("Expected ErrExists, got %v", err)
+			}
+			if rec, _ := s.Get(ctx, "user_1"); string(rec.Data) != "first" {
+				t.Errorf("A refused Create overwrote the record: %q", rec.Data)
+			}
+		})
+	}
+}
+
+func TestNextSequence(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+			// Stores written before the sequence existed continue after the
+			// highest ID, whatever was deleted in between
+			s.Put(ctx, Record{ID: "user_1"})
+			s.Put(ctx, Record{ID: "user_2"})
+			s.Put(ctx, Record{ID: "user_9"})
+			s.Put(ctx, Record{ID: "user_01J9ZQ"})
+			s.Delete(ctx, "user_2")
+
+			want := uint64(10)
+			for _, store := range []Store{s, reopen(), s} {
+				if n, err := store.NextSequence(ctx); err != nil || n != want {
+					t.Fatalf("Expected %d, got %d, %v", want, n, err)
+				}
+				want++
+			}
+		})
+	}
+}
+
+func TestEmailIsUnique(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+			s.Create(ctx, Record{ID: "user_1", Email: "ann@example.com"})
+			s.Create(ctx, Record{ID: "user_2", Email: "bob@example.com"})
+			other := reopen()
+
+			if err := other.Create(ctx, Record{ID: "user_3", Email: "ann@example.com"}); !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("Create with a taken email: expected ErrEmailTaken, got %v", err)
+			}
+			if err := other.Put(ctx, Record{ID: "user_2", Email: "ann@example.com"}); !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("Put with a taken email: expected ErrEmailTaken, got %v", err)
+			}
+			if rec, _ := s.Get(ctx, "user_1"); rec.Email != "ann@example.com" {
+				t.Errorf("A refused Put changed another user: %+v", rec)
+			}
+
+			// Changing an email frees the old one; empty emails never clash
+			if err := s.Put(ctx, Record{ID: "user_1", Email: "ann@example.org"}); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+			for _, rec := range []Record{{ID: "user_3", Email: "ann@example.com"}, {ID: "user_4"}, {ID: "user_5"}} {
+				if err := other.Create(ctx, rec); err != nil {
+					t.Errorf("Create %+v failed: %v", rec, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+			s.Create(ctx, Record{ID: "user_1", Email: "ann@example.com", Data: []byte("ann")})
+			s.Create(ctx, Record{ID: "user_2", Email: "bob@example.com", Data: []byte("bob")})
+			other := reopen()
+
+			err := other.Update(ctx, "user_1", func(rec Record) (Record, error) {
+				if string(rec.Data) != "ann" {
+					t.Errorf("Update was handed %+v", rec)
+				}
+				return Record{Email: "ann@example.org", Data: []byte("ann smith")}, nil
+			})
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if rec, _ := s.Get(ctx, "user_1"); rec.Email != "ann@example.org" || string(rec.Data) != "ann smith" {
+				t.Errorf("Expected the updated record, got %+v", rec)
+			}
+
+			refused := errors.New("refused")
+			for _, tc := range []struct {
+				id     string
+				update Record
+				err    error
+				want   error
+			}{
+				{"user_3", Record{}, nil, ErrNotFound},
+				{"user_2", Record{Email: "ann@example.org"}, nil, ErrEmailTaken},
+				{"user_2", Record{}, refused, refused},
+			} {
+				err := s.Update(ctx, tc.id, func(Record) (Record, error) { return tc.update, tc.err })
+				if !errors.Is(err, tc.want) {
+					t.Errorf("Update of %s: expected %v, got %v", tc.id, tc.want, err)
+				}
+			}
+			if rec, _ := other.Get(ctx, "user_2"); rec.Email != "bob@example.com" || string(rec.Data) != "bob" {
+				t.Errorf("A refused Update changed the record: %+v", rec)
+			}
+		})
+	}
+}
+
+func TestDeleteAndList(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+			for _, id := range []string{"user_b", "user_c", "user_a"} {
+				s.Create(ctx, Record{ID: id, Email: id + "@example.com", Data: []byte(id)})
+			}
+			if err := s.Delete(ctx, "user_c"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			other := reopen()
+			if err := other.Delete(ctx, "user_c"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Delete of a deleted record: expected ErrNotFound, got %v", err)
+			}
+			if _, err := other.Get(ctx, "user_c"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get of a deleted record: expected ErrNotFound, got %v", err)
+			}
+
+			for _, store := range []Store{s, other} {
+				recs, err := store.List(ctx)
+				if err != nil {
+					t.Fatalf("List failed: %v", err)
+				}
+				var ids []string
+				for _, rec := range recs {
+					ids = append(ids, rec.ID)
+					if string(rec.Data) != rec.ID {
+						t.Errorf("Listed %+v", rec)
+					}
+				}
+				if !slices.Equal(ids, []string{"user_a", "user_b"}) {
+					t.Errorf("Expected user_a and user_b, listed %v", ids)
+				}
+			}
+
+			// A deleted user's email is free again
+			if err := other.Create(ctx, Record{ID: "user_d", Email: "user_c@example.com"}); err != nil {
+				t.Errorf("Create with a deleted user's email failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestListPage(t *testing.T) {
+	ctx := context.Background()
+	want := []string{"user_1", "user_2", "user_10", "user_01J9ZQX", "user_abc"}
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, reopen := tc.open(t)
+			for _, id := range []string{"user_10", "user_abc", "user_2", "user_01J9ZQX", "user_1"} {
+				s.Create(ctx, Record{ID: id})
+			}
+
+			for _, descending := range []bool{false, true} {
+				var ids []string
+				page := Page{Descending: descending, Limit: 2}
+				for {
+					recs, err := reopen().ListPage(ctx, page)
+					if err != nil {
+						t.Fatalf("ListPage failed: %v", err)
+					}
+					for _, rec := range recs {
+						ids = append(ids, rec.ID)
+					}
+					if len(recs) < page.Limit {
+						break
+					}
+					page.After = recs[len(recs)-1].ID
+				}
+				expected := slices.Clone(want)
+				if descending {
+					slices.Reverse(expected)
+				}
+				if !slices.Equal(ids, expected) {
+					t.Errorf("Descending %t: expected %v, listed %v", descending, expected, ids)
+				}
+			}
+
+			// A page can start after an ID that has since been deleted
+			s.Delete(ctx, "user_2")
+			recs, err := s.ListPage(ctx, Page{After: "user_2", Limit: 1})
+			if err != nil || len(recs) != 1 || recs[0].ID != "user_10" {
+				t.Errorf("Expected user_10 after the deleted user_2, got %v, %v", recs, err)
+			}
+		})
+	}
+}
+
+func TestSQLiteAddsEmailColumn(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	db.Exec("CREATE TABLE users (id TEXT PRIMARY KEY, data BLOB NOT NULL)")
+	db.Exec("INSERT INTO users VALUES ('user_1', x'0a06757365725f31'), ('user_2', x'')")
+	db.Close()
+
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to open a store from before emails were stored: %v", err)
+	}
+	defer s.Close()
+	if rec, err := s.Get(ctx, "user_1"); err != nil || rec.Email != "" || len(rec.Data) == 0 {
+		t.Errorf("Expected the old record with no email, got %+v, %v", rec, err)
+	}
+	if err := s.Create(ctx, Record{ID: "user_3", Email: "ann@example.com"}); err != nil {
+		t.Errorf("Create failed: %v", err)
+	}
+}
+
+func TestFileDropsTornEntry(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "users.log")
+	s, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer s.Close()
+	s.Put(ctx, Record{ID: "user_1", Data: []byte("first")})
+
+	// A process that died halfway through writing an entry
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString(`{"id":"user_2","da`)
+	f.Close()
+
+	if err := s.Put(ctx, Record{ID: "user_3", Data: []byte("third")}); err != nil {
+		t.Fatalf("Put after a torn entry failed: %v", err)
+	}
+	reopened, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("Log is corrupt after recovering from a torn entry: %v", err)
+	}
+	defer reopened.Close()
+	if n, _ := reopened.Count(ctx); n != 2 {
+		t.Errorf("Expected user_1 and user_3, counted %d", n)
+	}
+}
+
+// phoneField is User.phone in proto/v2, which proto/v1 does not have
+const phoneField protowire.Number = 4
+
+// TestUnknownFieldsSurvive stores a user with a phone, as a V2 server would,
+// then reads and rewrites it as a V1 server does. Both proto versions cannot
+// be linked into one binary, so the phone is written with protowire.
+func TestUnknownFieldsSurvive(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range stores {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := tc.open(t)
+			data, _ := proto.Marshal(&userv1.User{UserId: "user_1", Name: "Ann", Email: "ann@example.com"})
+			data = protowire.AppendTag(data, phoneField, protowire.BytesType)
+			data = protowire.AppendString(data, "+1234567890")
+			s.Put(ctx, Record{ID: "user_1", Data: data})
+
+			user := &userv1.User{}
+			if err := GetMessage(ctx, s, "user_1", user); err != nil {
+				t.Fatalf("GetMessage failed: %v", err)
+			}
+			user.Name = "Ann Smith"
+			if err := PutMessage(ctx, s, "user_1", "ann@example.com", user); err != nil {
+				t.Fatalf("PutMessage failed: %v", err)
+			}
+
+			rec, _ := s.Get(ctx, "user_1")
+			if phone := stringField(t, rec.Data, phoneField); phone != "+1234567890" {
+				t.Errorf("Expected the phone to survive a V1 rewrite, got %q", phone)
+			}
+			if name := stringField(t, rec.Data, 2); name != "Ann Smith" {
+				t.Errorf("Expected the V1 rename, got %q", name)
+			}
+		})
+	}
+}
+
+// stringField returns the last value of string field num in a wire-format message
+func stringField(t *testing.T, data []byte, num protowire.Number) string {
+	t.Helper()
+	var value string
+	for len(data) > 0 {
+		n, typ, tagLen := protowire.ConsumeTag(data)
+		if tagLen < 0 {
+			t.Fatalf("Malformed record: %v", protowire.ParseError(tagLen))
+		}
+		data = data[tagLen:]
+		valueLen := protowire.ConsumeFieldValue(n, typ, data)
+		if valueLen < 0 {
+			t.Fatalf("Malformed record: %v", protowire.ParseError(valueLen))
+		}
+		if n == num && typ == protowire.BytesType {
+			v, _ := protowire.ConsumeString(data)
+			value = v
+		}
+		data = data[valueLen:]
+	}
+	return value
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	for _, spec := range []string{"memory", "sqlite:" + filepath.Join(dir, "users.db"), "file:" + filepath.Join(dir, "users.log")} {
+		s, err := Open(spec)
+		if err != nil {
+			t.Errorf("Open(%q) failed: %v", spec, err)
+			continue
+		}
+		s.Close()
+	}
+	for _, spec := range []string{"", "sqlite", "sqlite:", "memory:x", "postgres:db"} {
+		if _, err := Open(spec); err == nil {
+			t.Errorf("Open(%q) should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Package unknownfields carries protobuf fields a server does not know from
+// one message to another, so older servers keep what newer clients send.
+package unknownfields
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Renumber returns the wire-format fields in b with offset added to each
+// field number. Values are copied unchanged, so a field keeps its meaning
+// as long as both messages declare it with the same type.
+func Renumber(b []byte, offset protowire.Number) ([]byte, error) {
+	var out []byte
+	for len(b) > 0 {
+		num, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return nil, fmt.Errorf("malformed field: %v", protowire.ParseError(tagLen))
+		}
+		if typ == protowire.StartGroupType {
+			return nil, fmt.Errorf("field %d is a group, which cannot be renumbered", num)
+		}
+		valueLen := protowire.ConsumeFieldValue(num, typ, b[tagLen:])
+		if valueLen < 0 {
+			return nil, fmt.Errorf("malformed field %d: %v", num, protowire.ParseError(valueLen))
+		}
+		renumbered := num + offset
+		if !renumbered.IsValid() {
+			return nil, fmt.Errorf("field %d cannot be renumbered to %d", num, renumbered)
+		}
+		out = protowire.AppendTag(out, renumbered, typ)
+		out = append(out, b[tagLen:tagLen+valueLen]...)
+		b = b[tagLen+valueLen:]
+	}
+	return out, nil
+}
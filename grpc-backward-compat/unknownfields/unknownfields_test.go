@@ -0,0 +1,56 @@
+package unknownfields
+
+import (
+	"testing"
+
+	userv1 "grpc-backward-compat/proto/v1"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRenumber(t *testing.T) {
+	// name, email and phone of a V2 CreateUserRequest, phone unknown to V1
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendString(req, "Ann")
+	req = protowire.AppendTag(req, 3, protowire.BytesType)
+	req = protowire.AppendString(req, "+1234567890")
+	req = protowire.AppendTag(req, 7, protowire.VarintType)
+	req = protowire.AppendVarint(req, 42)
+
+	out, err := Renumber(req, 1)
+	if err != nil {
+		t.Fatalf("Renumber failed: %v", err)
+	}
+	user := &userv1.User{}
+	if err := proto.Unmarshal(out, user); err != nil {
+		t.Fatalf("Renumbered fields do not parse: %v", err)
+	}
+	if user.Name != "Ann" {
+		t.Errorf("Expected field 1 to become User.name, got %v", user)
+	}
+
+	var want []byte
+	want = protowire.AppendTag(want, 4, protowire.BytesType)
+	want = protowire.AppendString(want, "+1234567890")
+	want = protowire.AppendTag(want, 8, protowire.VarintType)
+	want = protowire.AppendVarint(want, 42)
+	if got := user.ProtoReflect().GetUnknown(); string(got) != string(want) {
+		t.Errorf("Expected phone as field 4 and the varint as field 8, got %x", got)
+	}
+}
+
+func TestRenumberRejects(t *testing.T) {
+	group := protowire.AppendTag(nil, 5, protowire.StartGroupType)
+	group = protowire.AppendTag(group, 5, protowire.EndGroupType)
+	for name, b := range map[string][]byte{
+		"truncated": protowire.AppendTag(nil, 3, protowire.BytesType),
+		"group":     group,
+		"too large": protowire.AppendVarint(protowire.AppendTag(nil, protowire.MaxValidNumber, protowire.VarintType), 1),
+	} {
+		if _, err := Renumber(b, 1); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
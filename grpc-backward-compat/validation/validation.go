@@ -0,0 +1,87 @@
+// Package validation checks UserService requests. Every problem becomes a
+// google.rpc.BadRequest field violation on one InvalidArgument status, so a
+// client learns about all of them at once.
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// e164 is an international phone number: +, a country code, up to 15 digits
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Violations collects what is wrong with one request
+type Violations struct {
+	list []*errdetails.BadRequest_FieldViolation
+}
+
+// Add records that field is invalid
+func (v *Violations) Add(field, description string) {
+	v.list = append(v.list, &errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+}
+
+// Required flags an empty or blank value
+func (v *Violations) Required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "must not be empty")
+	}
+}
+
+// Email flags a value that is set but not a bare address such as
+// ann@example.com; empty is allowed, as users never needed an email
+func (v *Violations) Email(field, value string) {
+	if value == "" {
+		return
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+		v.Add(field, "must be an email address such as ann@example.com")
+	}
+}
+
+// Phone flags a value that is set but not in E.164 form; empty is allowed
+func (v *Violations) Phone(field, value string) {
+	if value != "" && !e164.MatchString(value) {
+		v.Add(field, "must be in E.164 form, e.g. +14155550123")
+	}
+}
+
+// Err returns nil if nothing was added, otherwise an InvalidArgument status
+// carrying every violation as BadRequest details
+func (v *Violations) Err() error {
+	if len(v.list) == 0 {
+		return nil
+	}
+	fields := make([]string, len(v.list))
+	for i, fv := range v.list {
+		fields[i] = fv.Field
+	}
+	st := status.Newf(codes.InvalidArgument, "invalid %s", strings.Join(fields, ", "))
+	withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: v.list})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// FieldViolations returns the BadRequest field violations carried by err
+func FieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			violations = append(violations, br.FieldViolations...)
+		}
+	}
+	return violations
+}
+
+// NormalizeEmail is the form emails are compared in for uniqueness
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
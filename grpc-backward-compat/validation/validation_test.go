@@ -0,0 +1,50 @@
+package validation
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestViolations(t *testing.T) {
+	for _, tc := range []struct {
+		check func(v *Violations)
+		valid bool
+	}{
+		{func(v *Violations) { v.Email("email", "ann@example.com") }, true},
+		{func(v *Violations) { v.Email("email", "ann.smith+tag@mail.example.co.uk") }, true},
+		{func(v *Violations) { v.Email("email", "") }, true},
+		{func(v *Violations) { v.Email("email", "ann") }, false},
+		{func(v *Violations) { v.Email("email", "ann@localhost") }, false},
+		{func(v *Violations) { v.Email("email", "Ann <ann@example.com>") }, false},
+		{func(v *Violations) { v.Phone("phone", "") }, true},
+		{func(v *Violations) { v.Phone("phone", "+1234567890") }, true},
+		{func(v *Violations) { v.Phone("phone", "1234567890") }, false},
+		{func(v *Violations) { v.Phone("phone", "+1 234 567 890") }, false},
+		{func(v *Violations) { v.Phone("phone", "+0123456789") }, false},
+		{func(v *Violations) { v.Required("name", "Ann") }, true},
+		{func(v *Violations) { v.Required("name", " \t") }, false},
+	} {
+		var v Violations
+		tc.check(&v)
+		if err := v.Err(); (err == nil) != tc.valid {
+			t.Errorf("Expected valid=%v, got %v (%+v)", tc.valid, err, v.list)
+		}
+	}
+}
+
+func TestErrCarriesEveryViolation(t *testing.T) {
+	var v Violations
+	v.Required("name", "")
+	v.Email("email", "nope")
+	err := v.Err()
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+	violations := FieldViolations(err)
+	if len(violations) != 2 || violations[0].Field != "name" || violations[1].Field != "email" {
+		t.Errorf("Expected name and email violations, got %v", violations)
+	}
+}